@@ -7,17 +7,24 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"shadowgate/internal/admin"
 	"shadowgate/internal/config"
+	"shadowgate/internal/decision"
+	"shadowgate/internal/events"
 	"shadowgate/internal/gateway"
 	"shadowgate/internal/geoip"
+	"shadowgate/internal/learning"
 	"shadowgate/internal/logging"
 	"shadowgate/internal/metrics"
 	"shadowgate/internal/profile"
 	"shadowgate/internal/proxy"
+	"shadowgate/internal/redis"
+	"shadowgate/internal/rules"
 )
 
 var (
@@ -27,8 +34,12 @@ var (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "eval" {
+		os.Exit(runEval(os.Args[2:]))
+	}
+
 	// Command-line flags
-	configPath := flag.String("config", "config.yaml", "path to configuration file")
+	configPath := flag.String("config", "config.yaml", "path to configuration file or directory of .yaml files")
 	validateOnly := flag.Bool("validate", false, "validate configuration and exit")
 	showVersion := flag.Bool("version", false, "show version and exit")
 	flag.Parse()
@@ -41,7 +52,7 @@ func main() {
 
 	// Load and validate configuration
 	fmt.Printf("Loading configuration from: %s\n", *configPath)
-	cfg, err := config.Load(*configPath)
+	cfg, err := config.LoadPath(*configPath)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
@@ -57,6 +68,12 @@ func main() {
 		Level:  cfg.Global.Log.Level,
 		Format: cfg.Global.Log.Format,
 		Output: cfg.Global.Log.Output,
+		Rotate: logging.RotateConfig{
+			MaxSizeMB:  cfg.Global.Log.MaxSizeMB,
+			MaxBackups: cfg.Global.Log.MaxBackups,
+			MaxAgeDays: cfg.Global.Log.MaxAgeDays,
+			Compress:   cfg.Global.Log.Compress,
+		},
 	})
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error initializing logger: %v\n", err)
@@ -72,10 +89,15 @@ func main() {
 	// Initialize GeoIP if configured
 	if cfg.Global.GeoIPDBPath != "" {
 		if err := geoip.LoadGlobal(cfg.Global.GeoIPDBPath); err != nil {
-			logger.Warn("Failed to load GeoIP database", map[string]interface{}{
+			fields := map[string]interface{}{
 				"path":  cfg.Global.GeoIPDBPath,
 				"error": err.Error(),
-			})
+			}
+			if cfg.Global.GeoIPRequired {
+				logger.Error("Failed to load required GeoIP database", fields)
+				os.Exit(1)
+			}
+			logger.Warn("Failed to load GeoIP database", fields)
 		} else {
 			logger.Info("GeoIP database loaded", map[string]interface{}{
 				"path": cfg.Global.GeoIPDBPath,
@@ -85,118 +107,341 @@ func main() {
 	}
 
 	// Initialize metrics
-	metricsCollector := metrics.New()
+	metricsCollector := metrics.NewWithLimits(metrics.Limits{
+		MaxKeys:      cfg.Global.MetricsLimits.MaxKeys,
+		MaxUniqueIPs: cfg.Global.MetricsLimits.MaxUniqueIPs,
+	})
+
+	// Learning mode recorders, kept across reloads
+	learningRegistry := learning.NewRegistry()
 
-	// Track backend pools for admin API
+	// Request decisions streamed by the admin API
+	var eventBus *events.Bus
+	var recentRequests *events.Recent
+	if cfg.Global.MetricsAddr != "" {
+		eventBus = events.NewBus()
+		recentRequests = events.NewRecent(cfg.Global.AdminAPI.RecentRequests)
+	}
+
+	// Shared rate limit counters for multi-instance deployments
+	var rateLimitStore rules.RateLimitStore
+	if store := cfg.Global.RateLimitStore; store.Type == "redis" {
+		timeout, _ := time.ParseDuration(store.Redis.Timeout)
+		client := redis.New(redis.Options{
+			Addr:     store.Redis.Addr,
+			Password: store.Redis.Password,
+			DB:       store.Redis.DB,
+			Timeout:  timeout,
+			PoolSize: store.Redis.PoolSize,
+		})
+		defer client.Close()
+		if _, err := client.Do("PING"); err != nil {
+			logger.Warn("Redis rate limit store unreachable, counting in memory until it is", map[string]interface{}{
+				"addr":  store.Redis.Addr,
+				"error": err.Error(),
+			})
+		}
+		rateLimitStore = rules.NewRedisRateLimitStore(client, store.Redis.KeyPrefix)
+	}
+
+	// Track backend pools and decision engines for admin API
 	backendPools := make(map[string]*proxy.Pool)
+	engines := make(map[string]*decision.Engine)
 
 	// Create profile manager
 	profileMgr := profile.NewManager()
+	profileMgr.SetConnObserver(metricsCollector)
 
 	// Handler factory creates gateway handlers for each profile
-	handlerFactory := func(p *profile.Profile) http.Handler {
-		// Create backend pool first (shared with admin API for health checking)
-		pool := proxy.NewPool()
-		for _, bc := range p.Config.Backends {
-			weight := bc.Weight
-			if weight == 0 {
-				weight = 1
-			}
+	xffMode, err := proxy.ParseXFFMode(cfg.Global.XFFMode)
+	if err != nil {
+		logger.Error("Invalid xff_mode", map[string]interface{}{
+			"error": err.Error(),
+		})
+		os.Exit(1)
+	}
 
-			// Configure backend options
-			opts := proxy.DefaultBackendOptions()
-			if bc.HealthCheckPath != "" {
-				opts.HealthCheckPath = bc.HealthCheckPath
+	// newHandlerFactory returns a factory that creates gateway handlers for
+	// each profile and records their backend pools and decision engines.
+	// Backends unchanged from prev keep their health and circuit breaker state.
+	newHandlerFactory := func(pools map[string]*proxy.Pool, engines map[string]*decision.Engine, prev map[string]*proxy.Pool) func(p *profile.Profile) http.Handler {
+		return func(p *profile.Profile) http.Handler {
+			// Create backend pool first (shared with admin API for health checking)
+			pool := proxy.NewPool()
+			if mode, err := proxy.ParseBalanceMode(p.Config.LoadBalancing); err == nil {
+				pool.SetMode(mode)
+			}
+			if aw := p.Config.AdaptiveWeight; aw.Enabled {
+				pool.SetAdaptiveWeight(proxy.AdaptiveWeightOptions{
+					Enabled:        true,
+					ErrorThreshold: aw.ErrorThreshold,
+					MinFactor:      aw.MinFactor,
+				})
 			}
-			if bc.Timeout != "" {
-				timeout, err := time.ParseDuration(bc.Timeout)
+			for _, bc := range p.Config.Backends {
+				weight := bc.Weight
+				if weight == 0 {
+					weight = 1
+				}
+
+				// Configure backend options
+				opts := proxy.DefaultBackendOptions()
+				opts.XFFMode = xffMode
+				rewrite, err := proxy.NewPathRewrite(bc.PathRewrite())
 				if err != nil {
-					logger.Warn("Invalid backend timeout, using default", map[string]interface{}{
+					logger.Error("Invalid backend path rewrite", map[string]interface{}{
 						"profile": p.ID,
 						"backend": bc.Name,
-						"timeout": bc.Timeout,
 						"error":   err.Error(),
 					})
-				} else {
-					opts.Timeout = timeout
+					continue
+				}
+				opts.PathRewrite = rewrite
+				opts.Priority = bc.Priority
+				opts.MaxIdleConns, opts.MaxIdleConnsPerHost, opts.IdleConnTimeout = bc.ConnPool()
+				opts.ShareTransport = bc.ShareTransport
+				if bc.TLS != nil {
+					opts.TLS = proxy.BackendTLS{
+						CAFile:             bc.TLS.CAFile,
+						CertFile:           bc.TLS.CertFile,
+						KeyFile:            bc.TLS.KeyFile,
+						ServerName:         bc.TLS.ServerName,
+						InsecureSkipVerify: bc.TLS.InsecureSkipVerify,
+					}
+				}
+				if bc.HealthCheckPath != "" {
+					opts.HealthCheckPath = bc.HealthCheckPath
+				}
+				if bc.Timeout != "" {
+					timeout, err := time.ParseDuration(bc.Timeout)
+					if err != nil {
+						logger.Warn("Invalid backend timeout, using default", map[string]interface{}{
+							"profile": p.ID,
+							"backend": bc.Name,
+							"timeout": bc.Timeout,
+							"error":   err.Error(),
+						})
+					} else {
+						opts.Timeout = timeout
+					}
 				}
-			}
 
-			backend, err := proxy.NewBackendWithOptions(bc.Name, bc.URL, weight, opts)
+				backend, err := proxy.NewBackendWithOptions(bc.Name, bc.URL, weight, opts)
+				if err != nil {
+					logger.Error("Failed to create backend", map[string]interface{}{
+						"profile": p.ID,
+						"backend": bc.Name,
+						"error":   err.Error(),
+					})
+					continue
+				}
+				pool.Add(backend)
+			}
+			if n := pool.InheritState(prev[p.ID]); n > 0 {
+				logger.Debug("Backend state carried over", map[string]interface{}{
+					"profile":  p.ID,
+					"backends": n,
+				})
+			}
+			pools[p.ID] = pool
+
+			// Create handler with the shared pool
+			h, err := gateway.NewHandler(gateway.Config{
+				ProfileID:       p.ID,
+				Profile:         p.Config,
+				Logger:          logger,
+				Metrics:         metricsCollector,
+				BackendPool:     pool,
+				TrustedProxies:  cfg.Global.TrustedProxies,
+				TrustedHops:     cfg.Global.XFFTrustedHops,
+				TrustedCount:    cfg.Global.TrustedProxyCount,
+				ClientIPHeaders: cfg.Global.ClientIPHeaders,
+				MaxRequestBody:  cfg.Global.MaxRequestBody,
+				ErrorPages:      cfg.Global.ErrorPages,
+				Learning:        learningRegistry,
+				RateLimitStore:  rateLimitStore,
+				Events:          eventBus,
+				Recent:          recentRequests,
+
+				RuleTimingSampleRate: cfg.Global.RuleTimingSampleRate,
+			})
 			if err != nil {
-				logger.Error("Failed to create backend", map[string]interface{}{
+				logger.Error("Failed to create handler", map[string]interface{}{
 					"profile": p.ID,
-					"backend": bc.Name,
 					"error":   err.Error(),
 				})
-				continue
+				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(http.StatusInternalServerError)
+				})
 			}
-			pool.Add(backend)
-		}
-		backendPools[p.ID] = pool
-
-		// Create handler with the shared pool
-		h, err := gateway.NewHandler(gateway.Config{
-			ProfileID:      p.ID,
-			Profile:        p.Config,
-			Logger:         logger,
-			Metrics:        metricsCollector,
-			BackendPool:    pool,
-			TrustedProxies: cfg.Global.TrustedProxies,
-			MaxRequestBody: cfg.Global.MaxRequestBody,
-		})
-		if err != nil {
-			logger.Error("Failed to create handler", map[string]interface{}{
-				"profile": p.ID,
-				"error":   err.Error(),
-			})
-			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-				w.WriteHeader(http.StatusInternalServerError)
-			})
-		}
+			engines[p.ID] = h.DecisionEngine()
 
-		return h
+			return h
+		}
 	}
 
 	// Load profiles from config
-	if err := profileMgr.LoadFromConfig(cfg, handlerFactory); err != nil {
+	if err := profileMgr.LoadFromConfig(cfg, newHandlerFactory(backendPools, engines, nil)); err != nil {
 		logger.Error("Failed to load profiles", map[string]interface{}{
 			"error": err.Error(),
 		})
 		os.Exit(1)
 	}
 
-	// Reload function for admin API (validates config, requires restart for changes)
+	// Determine shutdown timeout
+	shutdownTimeout := 30 * time.Second
+	if cfg.Global.ShutdownTimeout > 0 {
+		shutdownTimeout = time.Duration(cfg.Global.ShutdownTimeout) * time.Second
+	}
+
+	// startHealthCheckers starts a health checker for each backend pool
+	startHealthCheckers := func(pools map[string]*proxy.Pool) []*proxy.HealthChecker {
+		checkers := make([]*proxy.HealthChecker, 0, len(pools))
+		for profileID, pool := range pools {
+			checker := proxy.NewHealthChecker(pool, proxy.HealthConfig{
+				Enabled:  true,
+				Interval: 30 * time.Second,
+				Timeout:  5 * time.Second,
+				Path:     "/",
+			})
+			checker.Start()
+			checkers = append(checkers, checker)
+			logger.Info("Health checker started", map[string]interface{}{
+				"profile": profileID,
+			})
+		}
+		return checkers
+	}
+
+	var (
+		adminAPI       *admin.API
+		healthCheckers []*proxy.HealthChecker
+		reloadMu       sync.Mutex // serializes reloads and shutdown
+	)
+
+	// rebuild swaps in profiles built by apply, replacing the backend pools,
+	// decision engines and health checkers. The caller holds reloadMu.
+	rebuild := func(apply func(ctx context.Context, factory func(p *profile.Profile) http.Handler) (profile.ReloadResult, error)) (profile.ReloadResult, error) {
+		pools := make(map[string]*proxy.Pool)
+		newEngines := make(map[string]*decision.Engine)
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+
+		result, err := apply(ctx, newHandlerFactory(pools, newEngines, backendPools))
+		if err != nil {
+			return result, err
+		}
+
+		for _, checker := range healthCheckers {
+			checker.Stop()
+		}
+		backendPools = pools
+		engines = newEngines
+		healthCheckers = startHealthCheckers(backendPools)
+		if adminAPI != nil {
+			adminAPI.ReplacePools(backendPools)
+			adminAPI.ReplaceEngines(engines)
+		}
+
+		for addr, lerr := range result.Errors {
+			logger.Error("Listener reload failed", map[string]interface{}{
+				"addr":  addr,
+				"error": lerr.Error(),
+			})
+		}
+		return result, nil
+	}
+
+	// Reload function for admin API and SIGHUP. Profiles are rebuilt from the
+	// new configuration; listeners whose address, protocol and TLS settings
+	// are unchanged keep their connections. Global settings require a restart.
 	reloadFunc := func() error {
-		newCfg, err := config.Load(*configPath)
+		newCfg, err := config.LoadPath(*configPath)
 		if err != nil {
 			return err
 		}
-		// Note: Currently only validates config. Actual changes require restart.
-		// TODO: Implement hot handler swapping for true hot reload.
-		logger.Info("Configuration validated", map[string]interface{}{
+
+		reloadMu.Lock()
+		defer reloadMu.Unlock()
+
+		result, err := rebuild(func(ctx context.Context, factory func(p *profile.Profile) http.Handler) (profile.ReloadResult, error) {
+			return profileMgr.Reload(ctx, newCfg, factory)
+		})
+		if err != nil {
+			return err
+		}
+		logger.Info("Configuration reloaded", map[string]interface{}{
 			"profiles": len(newCfg.Profiles),
-			"note":     "restart required for changes to take effect",
+			"kept":     result.Kept,
+			"started":  result.Started,
+			"stopped":  result.Stopped,
 		})
+		if len(result.Errors) > 0 {
+			return fmt.Errorf("configuration applied but %d listener(s) failed", len(result.Errors))
+		}
+		return nil
+	}
+
+	// Enable or disable a profile at runtime, leaving the configuration file
+	// untouched. The change lasts until the next reload.
+	profileEnableFunc := func(profileID string, enabled bool) error {
+		reloadMu.Lock()
+		defer reloadMu.Unlock()
+
+		result, err := rebuild(func(ctx context.Context, factory func(p *profile.Profile) http.Handler) (profile.ReloadResult, error) {
+			return profileMgr.SetEnabled(ctx, profileID, enabled, factory)
+		})
+		if err != nil {
+			return err
+		}
+		logger.Info("Profile toggled", map[string]interface{}{
+			"profile": profileID,
+			"enabled": enabled,
+			"started": result.Started,
+			"stopped": result.Stopped,
+		})
+		if len(result.Errors) > 0 {
+			return fmt.Errorf("profile toggled but %d listener(s) failed", len(result.Errors))
+		}
 		return nil
 	}
 
 	// Start Admin API if configured
-	var adminAPI *admin.API
 	if cfg.Global.MetricsAddr != "" {
 		adminAPI = admin.New(admin.Config{
 			Addr:       cfg.Global.MetricsAddr,
 			Metrics:    metricsCollector,
 			ReloadFunc: reloadFunc,
+			ReopenLogsFunc: func() error {
+				err := logger.Reopen()
+				if err == nil {
+					logger.Info("Log file reopened", nil)
+				}
+				return err
+			},
 			Version:    version,
 			AuthToken:  cfg.Global.AdminAPI.Token,
 			AllowedIPs: cfg.Global.AdminAPI.AllowedIPs,
+			DrainFunc: func() (map[string]int64, error) {
+				logger.Info("Drain requested, no longer accepting new connections", nil)
+				err := profileMgr.Drain()
+				return profileMgr.ActiveConnections(), err
+			},
+			ListenersFunc:     profileMgr.ListenerStatus,
+			ProfileEnableFunc: profileEnableFunc,
+			GeoIPConfigured:   cfg.Global.GeoIPDBPath != "",
+			Learning:          learningRegistry,
+			Events:            eventBus,
+			Recent:            recentRequests,
 		})
 
 		// Register backend pools
 		for profileID, pool := range backendPools {
 			adminAPI.RegisterPool(profileID, pool)
 		}
+		for profileID, engine := range engines {
+			adminAPI.RegisterEngine(profileID, engine)
+		}
 
 		if err := adminAPI.Start(); err != nil {
 			logger.Error("Failed to start admin API", map[string]interface{}{
@@ -211,20 +456,7 @@ func main() {
 	}
 
 	// Start health checks for all backend pools
-	healthCheckers := make([]*proxy.HealthChecker, 0)
-	for profileID, pool := range backendPools {
-		checker := proxy.NewHealthChecker(pool, proxy.HealthConfig{
-			Enabled:  true,
-			Interval: 30 * time.Second,
-			Timeout:  5 * time.Second,
-			Path:     "/",
-		})
-		checker.Start()
-		healthCheckers = append(healthCheckers, checker)
-		logger.Info("Health checker started", map[string]interface{}{
-			"profile": profileID,
-		})
-	}
+	healthCheckers = startHealthCheckers(backendPools)
 
 	// Start all profiles (listeners)
 	ctx := context.Background()
@@ -243,33 +475,40 @@ func main() {
 	// Wait for shutdown signal
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	if reopenLogsSignal != nil {
+		signal.Notify(sigChan, reopenLogsSignal)
+	}
 
 	for {
 		sig := <-sigChan
 		switch sig {
 		case syscall.SIGHUP:
-			logger.Info("Received SIGHUP, validating configuration", nil)
-			fmt.Println("Received SIGHUP, validating configuration...")
+			logger.Info("Received SIGHUP, reloading configuration", nil)
+			fmt.Println("Received SIGHUP, reloading configuration...")
 
 			if err := reloadFunc(); err != nil {
-				logger.Error("Configuration validation failed", map[string]interface{}{
+				logger.Error("Configuration reload failed", map[string]interface{}{
 					"error": err.Error(),
 				})
-				fmt.Fprintf(os.Stderr, "Validation failed: %v\n", err)
+				fmt.Fprintf(os.Stderr, "Reload failed: %v\n", err)
 				continue
 			}
 
-			fmt.Println("Configuration valid. Restart required for changes to take effect.")
+			fmt.Println("Configuration reloaded.")
+
+		case reopenLogsSignal:
+			if err := logger.Reopen(); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to reopen log file: %v\n", err)
+				continue
+			}
+			logger.Info("Received SIGUSR1, log file reopened", nil)
 
 		case syscall.SIGINT, syscall.SIGTERM:
 			logger.Info("Shutting down - draining connections", nil)
 			fmt.Println("Shutting down - draining connections...")
 
-			// Determine shutdown timeout
-			shutdownTimeout := 30 * time.Second
-			if cfg.Global.ShutdownTimeout > 0 {
-				shutdownTimeout = time.Duration(cfg.Global.ShutdownTimeout) * time.Second
-			}
+			// Wait for any reload in progress, then block further reloads
+			reloadMu.Lock()
 
 			// Stop health checkers first (stop marking backends unhealthy)
 			for _, checker := range healthCheckers {
@@ -309,3 +548,97 @@ func main() {
 		}
 	}
 }
+
+// headerFlags collects repeated -header "Name: value" flags
+type headerFlags []string
+
+func (h *headerFlags) String() string {
+	return strings.Join(*h, ", ")
+}
+
+func (h *headerFlags) Set(v string) error {
+	if name, _, ok := strings.Cut(v, ":"); !ok || strings.TrimSpace(name) == "" {
+		return fmt.Errorf("expected \"Name: value\", got %q", v)
+	}
+	*h = append(*h, v)
+	return nil
+}
+
+// runEval evaluates a single request against a profile's rules offline and
+// prints the decision. With -expect, it exits non-zero when the decision
+// differs, so rule changes can be tested in CI.
+func runEval(args []string) int {
+	fs := flag.NewFlagSet("eval", flag.ContinueOnError)
+	configPath := fs.String("config", "config.yaml", "path to configuration file or directory of .yaml files")
+	profileID := fs.String("profile", "", "profile to evaluate (may be omitted with a single profile)")
+	clientIP := fs.String("ip", "127.0.0.1", "client IP address")
+	method := fs.String("method", "GET", "HTTP method")
+	path := fs.String("path", "/", "request path, optionally with a query string")
+	host := fs.String("host", "localhost", "Host header")
+	ua := fs.String("ua", "", "User-Agent header")
+	expect := fs.String("expect", "", "expected action (e.g. allow_forward, deny_decoy); exit 1 on mismatch")
+	var headers headerFlags
+	fs.Var(&headers, "header", "request header as \"Name: value\" (repeatable)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, err := config.LoadPath(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+
+	var profileCfg *config.ProfileConfig
+	for i := range cfg.Profiles {
+		if cfg.Profiles[i].ID == *profileID || (*profileID == "" && len(cfg.Profiles) == 1) {
+			profileCfg = &cfg.Profiles[i]
+			break
+		}
+	}
+	if profileCfg == nil {
+		if *profileID == "" {
+			fmt.Fprintf(os.Stderr, "Error: -profile is required with %d profiles\n", len(cfg.Profiles))
+		} else {
+			fmt.Fprintf(os.Stderr, "Error: profile %q not found\n", *profileID)
+		}
+		return 2
+	}
+
+	if cfg.Global.GeoIPDBPath != "" {
+		if err := geoip.LoadGlobal(cfg.Global.GeoIPDBPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to load GeoIP database: %v\n", err)
+		} else {
+			defer geoip.CloseGlobal()
+		}
+	}
+
+	req, err := http.NewRequest(strings.ToUpper(*method), "http://"+*host+*path, nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid request: %v\n", err)
+		return 2
+	}
+	req.RemoteAddr = *clientIP + ":0"
+	if *ua != "" {
+		req.Header.Set("User-Agent", *ua)
+	}
+	for _, h := range headers {
+		name, value, _ := strings.Cut(h, ":")
+		req.Header.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+
+	engine := gateway.NewDecisionEngine(*profileCfg)
+	d := engine.Evaluate(req, *clientIP)
+
+	fmt.Printf("profile: %s\n", profileCfg.ID)
+	fmt.Printf("action:  %s\n", d.Action)
+	fmt.Printf("rule:    %s\n", d.RuleType)
+	fmt.Printf("reason:  %s\n", d.Reason)
+	fmt.Printf("labels:  %s\n", strings.Join(d.Labels, ", "))
+
+	if *expect != "" && d.Action.String() != *expect {
+		fmt.Fprintf(os.Stderr, "FAIL: expected %s, got %s\n", *expect, d.Action)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,11 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// reopenLogsSignal asks the gateway to reopen its log file after rotation
+var reopenLogsSignal os.Signal = syscall.SIGUSR1
@@ -0,0 +1,8 @@
+//go:build windows
+
+package main
+
+import "os"
+
+// reopenLogsSignal is unavailable on Windows; use the admin API instead
+var reopenLogsSignal os.Signal
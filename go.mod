@@ -3,8 +3,13 @@ module shadowgate
 go 1.21
 
 require (
-	github.com/oschwald/geoip2-golang v1.13.0 // indirect
+	github.com/oschwald/geoip2-golang v1.13.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
 	github.com/oschwald/maxminddb-golang v1.13.0 // indirect
 	golang.org/x/sys v0.20.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
+
+replace github.com/oschwald/geoip2-golang => github.com/oschwald/geoip2-golang v1.9.0
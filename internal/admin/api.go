@@ -2,16 +2,29 @@ package admin
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net"
 	"net/http"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"shadowgate/internal/decision"
+	"shadowgate/internal/events"
+	"shadowgate/internal/geoip"
+	"shadowgate/internal/learning"
+	"shadowgate/internal/logging"
 	"shadowgate/internal/metrics"
+	"shadowgate/internal/profile"
 	"shadowgate/internal/proxy"
+	"shadowgate/internal/rules"
 )
 
 // API provides administrative endpoints
@@ -21,11 +34,27 @@ type API struct {
 	metrics     *metrics.Metrics
 	pools       map[string]*proxy.Pool
 	poolsMu     sync.RWMutex
+	engines     map[string]*decision.Engine
+	enginesMu   sync.RWMutex
 	reloadFunc  func() error
+	reopenLogs  func() error
 	startTime   time.Time
 	version     string
 	authToken   string
 	allowedNets []*net.IPNet
+	drainFunc   func() (map[string]int64, error)
+	draining    int32 // atomic flag, 1 once drain has been requested
+	enableFunc  func(profileID string, enabled bool) error
+
+	listenersFunc   func() map[string]bool
+	geoIPConfigured bool
+	learning        *learning.Registry
+
+	events    *events.Bus
+	recent    *events.Recent
+	keepAlive time.Duration // interval of comments keeping event streams open
+	done      chan struct{} // closed by Stop to end event streams
+	stopOnce  sync.Once
 }
 
 // Config configures the Admin API
@@ -33,21 +62,57 @@ type Config struct {
 	Addr       string
 	Metrics    *metrics.Metrics
 	ReloadFunc func() error
-	Version    string
-	AuthToken  string   // Bearer token for authentication
-	AllowedIPs []string // CIDRs allowed to access admin API
+	// ReopenLogsFunc reopens file log outputs after external rotation
+	ReopenLogsFunc func() error
+	Version        string
+	AuthToken      string   // Bearer token for authentication
+	AllowedIPs     []string // CIDRs allowed to access admin API
+	// DrainFunc stops listeners from accepting new connections and returns
+	// active connection counts keyed by listener address
+	DrainFunc func() (map[string]int64, error)
+	// ListenersFunc reports whether each listener is accepting connections,
+	// keyed by listener address
+	ListenersFunc func() map[string]bool
+	// ProfileEnableFunc enables or disables a profile at runtime, starting
+	// or stopping its listeners
+	ProfileEnableFunc func(profileID string, enabled bool) error
+	// GeoIPConfigured marks the GeoIP database as expected to be loaded
+	GeoIPConfigured bool
+	// Learning holds the recorders of profiles running in learning mode
+	Learning *learning.Registry
+	// Events streams request decisions to GET /events subscribers
+	Events *events.Bus
+	// Recent holds the requests served by GET /requests/recent
+	Recent *events.Recent
 }
 
+// EventsKeepAlive is the interval at which idle event streams receive a
+// comment, so proxies and clients do not time them out
+const EventsKeepAlive = 15 * time.Second
+
 // New creates a new Admin API
 func New(cfg Config) *API {
 	api := &API{
 		addr:       cfg.Addr,
 		metrics:    cfg.Metrics,
 		pools:      make(map[string]*proxy.Pool),
+		engines:    make(map[string]*decision.Engine),
 		reloadFunc: cfg.ReloadFunc,
+		reopenLogs: cfg.ReopenLogsFunc,
 		startTime:  time.Now(),
 		version:    cfg.Version,
 		authToken:  cfg.AuthToken,
+		drainFunc:  cfg.DrainFunc,
+		enableFunc: cfg.ProfileEnableFunc,
+
+		listenersFunc:   cfg.ListenersFunc,
+		geoIPConfigured: cfg.GeoIPConfigured,
+		learning:        cfg.Learning,
+
+		events:    cfg.Events,
+		recent:    cfg.Recent,
+		keepAlive: EventsKeepAlive,
+		done:      make(chan struct{}),
 	}
 
 	// Parse allowed IP networks
@@ -72,12 +137,23 @@ func New(cfg Config) *API {
 	mux := http.NewServeMux()
 	// Health endpoint - no auth required (for load balancer checks)
 	mux.HandleFunc("/health", api.handleHealth)
+	// Readiness endpoint - no auth required; verbose details require auth
+	mux.HandleFunc("/healthz", api.handleReadiness)
 	// All other endpoints require authentication
 	mux.HandleFunc("/status", api.requireAuth(api.handleStatus))
 	mux.HandleFunc("/metrics", api.requireAuth(api.handleMetrics))
 	mux.HandleFunc("/metrics/prometheus", api.requireAuth(api.handlePrometheusMetrics))
+	mux.HandleFunc("/metrics/reset", api.requireAuth(api.handleMetricsReset))
+	mux.HandleFunc("/denials/top", api.requireAuth(api.handleTopDenials))
 	mux.HandleFunc("/backends", api.requireAuth(api.handleBackends))
 	mux.HandleFunc("/reload", api.requireAuth(api.handleReload))
+	mux.HandleFunc("/reopen-logs", api.requireAuth(api.handleReopenLogs))
+	mux.HandleFunc("/drain", api.requireAuth(api.handleDrain))
+	mux.HandleFunc("/learn/", api.requireAuth(api.handleLearn))
+	mux.HandleFunc("/profiles/", api.requireAuth(api.handleProfileToggle))
+	mux.HandleFunc("/evaluate", api.requireAuth(api.handleEvaluate))
+	mux.HandleFunc("/events", api.requireAuth(api.handleEvents))
+	mux.HandleFunc("/requests/recent", api.requireAuth(api.handleRecentRequests))
 
 	api.server = &http.Server{
 		Addr:         cfg.Addr,
@@ -92,41 +168,51 @@ func New(cfg Config) *API {
 // requireAuth wraps a handler with authentication and IP-based access control
 func (a *API) requireAuth(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Check IP allowlist if configured
-		if len(a.allowedNets) > 0 {
-			clientIP := extractIP(r.RemoteAddr)
-			allowed := false
-			if clientIP != nil {
-				for _, network := range a.allowedNets {
-					if network.Contains(clientIP) {
-						allowed = true
-						break
-					}
-				}
-			}
-			if !allowed {
-				http.Error(w, "Forbidden", http.StatusForbidden)
-				return
+		switch a.authStatus(r) {
+		case http.StatusForbidden:
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		case http.StatusUnauthorized:
+			if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+				w.Header().Set("WWW-Authenticate", "Bearer")
 			}
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
 		}
 
-		// Check bearer token if configured
-		if a.authToken != "" {
-			auth := r.Header.Get("Authorization")
-			if !strings.HasPrefix(auth, "Bearer ") {
-				w.Header().Set("WWW-Authenticate", "Bearer")
-				http.Error(w, "Unauthorized", http.StatusUnauthorized)
-				return
-			}
-			token := strings.TrimPrefix(auth, "Bearer ")
-			if token != a.authToken {
-				http.Error(w, "Unauthorized", http.StatusUnauthorized)
-				return
+		next(w, r)
+	}
+}
+
+// authStatus checks the IP allowlist and bearer token, returning 0 if the
+// request may access protected endpoints or the status to reject it with
+func (a *API) authStatus(r *http.Request) int {
+	// Check IP allowlist if configured
+	if len(a.allowedNets) > 0 {
+		clientIP := extractIP(r.RemoteAddr)
+		allowed := false
+		if clientIP != nil {
+			for _, network := range a.allowedNets {
+				if network.Contains(clientIP) {
+					allowed = true
+					break
+				}
 			}
 		}
+		if !allowed {
+			return http.StatusForbidden
+		}
+	}
 
-		next(w, r)
+	// Check bearer token if configured
+	if a.authToken != "" {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token != a.authToken {
+			return http.StatusUnauthorized
+		}
 	}
+
+	return 0
 }
 
 // extractIP extracts the IP address from a remote address string
@@ -145,6 +231,33 @@ func (a *API) RegisterPool(profileID string, pool *proxy.Pool) {
 	a.pools[profileID] = pool
 }
 
+// ReplacePools replaces all registered backend pools, e.g. after a reload
+func (a *API) ReplacePools(pools map[string]*proxy.Pool) {
+	a.poolsMu.Lock()
+	defer a.poolsMu.Unlock()
+	a.pools = make(map[string]*proxy.Pool, len(pools))
+	for profileID, pool := range pools {
+		a.pools[profileID] = pool
+	}
+}
+
+// RegisterEngine registers a profile's decision engine for rule testing
+func (a *API) RegisterEngine(profileID string, engine *decision.Engine) {
+	a.enginesMu.Lock()
+	defer a.enginesMu.Unlock()
+	a.engines[profileID] = engine
+}
+
+// ReplaceEngines replaces all registered decision engines, e.g. after a reload
+func (a *API) ReplaceEngines(engines map[string]*decision.Engine) {
+	a.enginesMu.Lock()
+	defer a.enginesMu.Unlock()
+	a.engines = make(map[string]*decision.Engine, len(engines))
+	for profileID, engine := range engines {
+		a.engines[profileID] = engine
+	}
+}
+
 // Start starts the Admin API server
 func (a *API) Start() error {
 	go func() {
@@ -157,18 +270,20 @@ func (a *API) Start() error {
 
 // Stop stops the Admin API server
 func (a *API) Stop(ctx context.Context) error {
+	// Shutdown waits for active requests, so end event streams first
+	a.stopOnce.Do(func() { close(a.done) })
 	return a.server.Shutdown(ctx)
 }
 
 // StatusResponse represents the status endpoint response
 type StatusResponse struct {
-	Status    string        `json:"status"`
-	Version   string        `json:"version"`
-	Uptime    string        `json:"uptime"`
-	GoVersion string        `json:"go_version"`
-	NumCPU    int           `json:"num_cpu"`
-	Goroutines int          `json:"goroutines"`
-	Memory    MemoryStats   `json:"memory"`
+	Status     string      `json:"status"`
+	Version    string      `json:"version"`
+	Uptime     string      `json:"uptime"`
+	GoVersion  string      `json:"go_version"`
+	NumCPU     int         `json:"num_cpu"`
+	Goroutines int         `json:"goroutines"`
+	Memory     MemoryStats `json:"memory"`
 }
 
 // MemoryStats contains memory statistics
@@ -186,9 +301,122 @@ func (a *API) handleHealth(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", "application/json")
+
+	// Fail health checks while draining so load balancers pull the instance
+	if a.IsDraining() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]string{"status": "draining"})
+		return
+	}
+
 	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 }
 
+// ReadinessResponse represents the readiness endpoint response
+type ReadinessResponse struct {
+	Status    string                      `json:"status"` // ready, not_ready or draining
+	Reasons   []string                    `json:"reasons,omitempty"`
+	Listeners map[string]bool             `json:"listeners,omitempty"`
+	Profiles  map[string]ProfileReadiness `json:"profiles,omitempty"`
+	GeoIP     string                      `json:"geoip,omitempty"` // loaded, not_loaded or not_configured
+}
+
+// ProfileReadiness summarizes backend availability for one profile
+type ProfileReadiness struct {
+	Backends     int      `json:"backends"`
+	Healthy      int      `json:"healthy"` // passing health checks with a closed or half-open circuit
+	OpenCircuits []string `json:"open_circuits,omitempty"`
+}
+
+// handleReadiness reports whether the gateway can serve traffic: every
+// listener is accepting connections and every profile with backends has at
+// least one usable backend. Unlike /health it returns 503 when it cannot.
+// With ?verbose=1 and valid credentials the full state is included.
+func (a *API) handleReadiness(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	resp := a.readiness()
+
+	status := http.StatusOK
+	if resp.Status != "ready" {
+		status = http.StatusServiceUnavailable
+	}
+
+	v := r.URL.Query().Get("verbose")
+	verbose := (v == "1" || v == "true") && a.authStatus(r) == 0
+	if !verbose {
+		resp = ReadinessResponse{Status: resp.Status}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// readiness collects listener, backend and GeoIP state
+func (a *API) readiness() ReadinessResponse {
+	resp := ReadinessResponse{
+		Status:   "ready",
+		Profiles: make(map[string]ProfileReadiness),
+		GeoIP:    "not_configured",
+	}
+
+	if a.listenersFunc != nil {
+		resp.Listeners = a.listenersFunc()
+		for addr, up := range resp.Listeners {
+			if !up {
+				resp.Reasons = append(resp.Reasons, fmt.Sprintf("listener %s is not accepting connections", addr))
+			}
+		}
+	}
+
+	a.poolsMu.RLock()
+	for profileID, pool := range a.pools {
+		pr := ProfileReadiness{Backends: pool.Len()}
+		for name, status := range pool.GetHealthStatuses() {
+			b := pool.Get(name)
+			if b == nil {
+				continue
+			}
+			circuitOpen := b.CircuitBreakerState() == proxy.CircuitOpen
+			if circuitOpen {
+				pr.OpenCircuits = append(pr.OpenCircuits, name)
+			}
+			if status.Healthy && !circuitOpen {
+				pr.Healthy++
+			}
+		}
+		sort.Strings(pr.OpenCircuits)
+		// Profiles without backends only serve decoys and are always ready
+		if pr.Backends > 0 && pr.Healthy == 0 {
+			resp.Reasons = append(resp.Reasons, fmt.Sprintf("profile %s has no healthy backends", profileID))
+		}
+		resp.Profiles[profileID] = pr
+	}
+	a.poolsMu.RUnlock()
+
+	if a.geoIPConfigured {
+		// GeoIP failures are reported but do not fail readiness: the gateway
+		// runs without it and geo rules simply do not match
+		resp.GeoIP = "not_loaded"
+		if geoip.GetGlobal() != nil {
+			resp.GeoIP = "loaded"
+		}
+	}
+
+	sort.Strings(resp.Reasons)
+	if len(resp.Reasons) > 0 {
+		resp.Status = "not_ready"
+	}
+	if a.IsDraining() {
+		resp.Status = "draining"
+	}
+	return resp
+}
+
 func (a *API) handleStatus(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -223,12 +451,12 @@ func (a *API) handleMetrics(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if a.metrics == nil {
-		http.Error(w, "Metrics not available", http.StatusServiceUnavailable)
+	m, ok := a.metricsFor(w, r)
+	if !ok {
 		return
 	}
 
-	a.metrics.Handler()(w, r)
+	m.Handler()(w, r)
 }
 
 func (a *API) handlePrometheusMetrics(w http.ResponseWriter, r *http.Request) {
@@ -237,18 +465,307 @@ func (a *API) handlePrometheusMetrics(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if a.metrics == nil {
-		http.Error(w, "Metrics not available", http.StatusServiceUnavailable)
+	m, ok := a.metricsFor(w, r)
+	if !ok {
 		return
 	}
 
 	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
 
 	// Write the main metrics
-	a.metrics.PrometheusHandler()(w, r)
+	m.PrometheusHandler()(w, r)
+
+	// Circuit breaker and health metrics belong to the shared collector
+	if m == a.metrics {
+		a.writeCircuitBreakerMetrics(w)
+	}
+}
+
+// metricsFor returns the collector selected by the optional profile query
+// parameter, writing an error response if it is unavailable
+func (a *API) metricsFor(w http.ResponseWriter, r *http.Request) (*metrics.Metrics, bool) {
+	if a.metrics == nil {
+		http.Error(w, "Metrics not available", http.StatusServiceUnavailable)
+		return nil, false
+	}
+
+	profileID := r.URL.Query().Get("profile")
+	if profileID == "" {
+		return a.metrics, true
+	}
+	m, ok := a.metrics.LookupProfile(profileID)
+	if !ok {
+		http.Error(w, "No isolated metrics for profile", http.StatusNotFound)
+		return nil, false
+	}
+	return m, true
+}
+
+// TopDenialsResponse ranks the rule types responsible for denied requests
+type TopDenialsResponse struct {
+	Profile string                 `json:"profile,omitempty"`
+	Total   int64                  `json:"total"`
+	Reasons []metrics.DenialReason `json:"reasons"`
+}
+
+func (a *API) handleTopDenials(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	m, ok := a.metricsFor(w, r)
+	if !ok {
+		return
+	}
+
+	limit := metrics.DefaultTopDenialReasons
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	resp := TopDenialsResponse{
+		Profile: r.URL.Query().Get("profile"),
+		Reasons: m.TopDenialReasons(0),
+	}
+	for _, reason := range resp.Reasons {
+		resp.Total += reason.Count
+	}
+	if len(resp.Reasons) > limit {
+		resp.Reasons = resp.Reasons[:limit]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// MetricsResetResponse represents the metrics reset response
+type MetricsResetResponse struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+	Profile string `json:"profile,omitempty"`
+}
+
+func (a *API) handleMetricsReset(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if a.metrics == nil {
+		http.Error(w, "Metrics not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	resp := MetricsResetResponse{Success: true, Profile: r.URL.Query().Get("profile")}
+	if resp.Profile == "" {
+		a.metrics.Reset()
+		resp.Message = "All metrics reset"
+	} else {
+		a.poolsMu.RLock()
+		_, registered := a.pools[resp.Profile]
+		a.poolsMu.RUnlock()
+		if !a.metrics.ResetProfile(resp.Profile) && !registered {
+			http.Error(w, "Unknown profile", http.StatusNotFound)
+			return
+		}
+		resp.Message = "Profile metrics reset"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// LearnResetResponse is the response to discarding learned data
+type LearnResetResponse struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+	Profile string `json:"profile"`
+}
+
+// handleLearn serves the allow rules suggested by a profile's learning mode
+// as YAML (GET), or discards what was learned and starts over (DELETE)
+func (a *API) handleLearn(w http.ResponseWriter, r *http.Request) {
+	profileID := strings.TrimPrefix(r.URL.Path, "/learn/")
+	if profileID == "" || strings.Contains(profileID, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	var rec *learning.Recorder
+	if a.learning != nil {
+		rec, _ = a.learning.Lookup(profileID)
+	}
+	if rec == nil {
+		http.Error(w, "Learning mode not enabled for profile", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		minCount := int64(1)
+		if v := r.URL.Query().Get("min_count"); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || n < 1 {
+				http.Error(w, "Invalid min_count", http.StatusBadRequest)
+				return
+			}
+			minCount = n
+		}
+
+		out, err := rec.Summary().SuggestYAML(minCount)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/yaml; charset=utf-8")
+		w.Write(out)
 
-	// Append circuit breaker and health metrics
-	a.writeCircuitBreakerMetrics(w)
+	case http.MethodDelete:
+		rec.Reset()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(LearnResetResponse{
+			Success: true,
+			Message: "Learning data reset",
+			Profile: profileID,
+		})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// maxEvaluateBody bounds the size of an /evaluate request description
+const maxEvaluateBody = 1 << 20
+
+// EvaluateRequest describes a synthetic request to test a profile's rules
+type EvaluateRequest struct {
+	ClientIP   string            `json:"client_ip"`
+	Method     string            `json:"method"` // default: GET
+	Path       string            `json:"path"`   // may include a query string (default: /)
+	Host       string            `json:"host"`
+	Headers    map[string]string `json:"headers"`
+	UserAgent  string            `json:"user_agent"`
+	Country    string            `json:"country"` // ISO code used instead of a GeoIP lookup
+	Body       string            `json:"body"`
+	TLSVersion string            `json:"tls_version"` // e.g. "1.3"; unset for plain HTTP
+	SNI        string            `json:"sni"`
+}
+
+// EvaluateResponse is the decision the profile would make for a request
+type EvaluateResponse struct {
+	Profile        string   `json:"profile"`
+	Action         string   `json:"action"`
+	Reason         string   `json:"reason"`
+	RuleType       string   `json:"rule_type,omitempty"`
+	Labels         []string `json:"labels"`
+	RulesEvaluated int      `json:"rules_evaluated"`
+	RedirectURL    string   `json:"redirect_url,omitempty"`
+}
+
+// handleEvaluate runs a synthetic request through a profile's rules and
+// returns the decision without contacting a backend
+func (a *API) handleEvaluate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	profileID := r.URL.Query().Get("profile")
+	if profileID == "" {
+		http.Error(w, "profile is required", http.StatusBadRequest)
+		return
+	}
+	a.enginesMu.RLock()
+	engine := a.engines[profileID]
+	a.enginesMu.RUnlock()
+	if engine == nil {
+		http.Error(w, "Unknown profile", http.StatusNotFound)
+		return
+	}
+
+	var in EvaluateRequest
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxEvaluateBody))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&in); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	ctx, err := in.context()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	d := engine.EvaluateContext(ctx)
+
+	labels := d.Labels
+	if labels == nil {
+		labels = []string{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(EvaluateResponse{
+		Profile:        profileID,
+		Action:         d.Action.String(),
+		Reason:         d.Reason,
+		RuleType:       d.RuleType,
+		Labels:         labels,
+		RulesEvaluated: d.RulesEvaluated,
+		RedirectURL:    d.RedirectURL,
+	})
+}
+
+// context builds the dry-run rule context for the described request
+func (in *EvaluateRequest) context() (*rules.Context, error) {
+	ip := net.ParseIP(in.ClientIP)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid client_ip %q", in.ClientIP)
+	}
+	method := strings.ToUpper(in.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+	path := in.Path
+	if path == "" {
+		path = "/"
+	}
+	if !strings.HasPrefix(path, "/") {
+		return nil, fmt.Errorf("path must start with /")
+	}
+
+	req, err := http.NewRequest(method, path, strings.NewReader(in.Body))
+	if err != nil {
+		return nil, fmt.Errorf("invalid request: %w", err)
+	}
+	req.Host = in.Host
+	req.RemoteAddr = net.JoinHostPort(ip.String(), "0")
+	for name, value := range in.Headers {
+		req.Header.Set(name, value)
+	}
+	if in.UserAgent != "" {
+		req.Header.Set("User-Agent", in.UserAgent)
+	}
+
+	if in.TLSVersion != "" || in.SNI != "" {
+		version, err := rules.ParseTLSVersion(in.TLSVersion)
+		if err != nil {
+			return nil, err
+		}
+		if version == 0 {
+			version = tls.VersionTLS13
+		}
+		req.TLS = &tls.ConnectionState{Version: version, ServerName: in.SNI}
+	}
+
+	ctx := decision.NewContext(req, ip.String())
+	ctx.Country = in.Country
+	ctx.DryRun = true
+	return ctx, nil
 }
 
 func (a *API) writeCircuitBreakerMetrics(w http.ResponseWriter) {
@@ -333,22 +850,26 @@ type BackendsResponse struct {
 
 // ProfileBackends represents backends for a profile
 type ProfileBackends struct {
-	Total   int                          `json:"total"`
-	Healthy int                          `json:"healthy"`
-	Backends []BackendStatus             `json:"backends"`
+	Total    int             `json:"total"`
+	Healthy  int             `json:"healthy"`
+	Backends []BackendStatus `json:"backends"`
 }
 
 // BackendStatus represents a backend's status
 type BackendStatus struct {
-	Name           string             `json:"name"`
-	URL            string             `json:"url"`
-	Weight         int                `json:"weight"`
-	Healthy        bool               `json:"healthy"`
-	LastCheck      time.Time          `json:"last_check,omitempty"`
-	LastHealthy    time.Time          `json:"last_healthy,omitempty"`
-	CheckCount     int64              `json:"check_count"`
-	FailCount      int64              `json:"fail_count"`
-	CircuitBreaker CircuitBreakerInfo `json:"circuit_breaker"`
+	Name            string              `json:"name"`
+	URL             string              `json:"url"`
+	Weight          int                 `json:"weight"`
+	EffectiveWeight float64             `json:"effective_weight"`
+	ErrorRate       float64             `json:"error_rate"`
+	Priority        int                 `json:"priority"`
+	Healthy         bool                `json:"healthy"`
+	LastCheck       time.Time           `json:"last_check,omitempty"`
+	LastHealthy     time.Time           `json:"last_healthy,omitempty"`
+	CheckCount      int64               `json:"check_count"`
+	FailCount       int64               `json:"fail_count"`
+	CircuitBreaker  CircuitBreakerInfo  `json:"circuit_breaker"`
+	ConnPool        proxy.ConnPoolStats `json:"conn_pool"`
 }
 
 // CircuitBreakerInfo represents circuit breaker status
@@ -356,6 +877,8 @@ type CircuitBreakerInfo struct {
 	State           string    `json:"state"`
 	Failures        int       `json:"failures"`
 	Successes       int       `json:"successes"`
+	Timeouts        int64     `json:"timeouts"`
+	ConnErrors      int64     `json:"connection_errors"`
 	LastStateChange time.Time `json:"last_state_change"`
 }
 
@@ -383,20 +906,26 @@ func (a *API) handleBackends(w http.ResponseWriter, r *http.Request) {
 			}
 			cbStats := b.CircuitBreakerStats()
 			backends = append(backends, BackendStatus{
-				Name:        name,
-				URL:         b.URL.String(),
-				Weight:      b.Weight,
-				Healthy:     status.Healthy,
-				LastCheck:   status.LastCheck,
-				LastHealthy: status.LastHealthy,
-				CheckCount:  status.CheckCount,
-				FailCount:   status.FailCount,
+				Name:            name,
+				URL:             b.URL.String(),
+				Weight:          b.Weight,
+				EffectiveWeight: pool.EffectiveWeight(b),
+				ErrorRate:       b.ErrorRate(),
+				Priority:        b.Priority,
+				Healthy:         status.Healthy,
+				LastCheck:       status.LastCheck,
+				LastHealthy:     status.LastHealthy,
+				CheckCount:      status.CheckCount,
+				FailCount:       status.FailCount,
 				CircuitBreaker: CircuitBreakerInfo{
 					State:           cbStats.State.String(),
 					Failures:        cbStats.Failures,
 					Successes:       cbStats.Successes,
+					Timeouts:        cbStats.Timeouts,
+					ConnErrors:      cbStats.ConnErrors,
 					LastStateChange: cbStats.LastStateChange,
 				},
+				ConnPool: b.ConnPoolStats(),
 			})
 		}
 
@@ -443,3 +972,242 @@ func (a *API) handleReload(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 }
+
+// ReopenLogsResponse represents the reopen-logs endpoint response
+type ReopenLogsResponse struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+}
+
+func (a *API) handleReopenLogs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	resp := ReopenLogsResponse{Success: true, Message: "Log files reopened"}
+	if a.reopenLogs == nil {
+		resp = ReopenLogsResponse{Success: false, Message: "Log reopening not configured"}
+	} else if err := a.reopenLogs(); err != nil {
+		resp = ReopenLogsResponse{Success: false, Message: err.Error()}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// ProfileToggleResponse is the response to enabling or disabling a profile
+type ProfileToggleResponse struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+	Profile string `json:"profile"`
+	Enabled bool   `json:"enabled"`
+}
+
+// handleProfileToggle enables (POST /profiles/{id}/enable) or disables
+// (POST /profiles/{id}/disable) a profile without editing the configuration
+func (a *API) handleProfileToggle(w http.ResponseWriter, r *http.Request) {
+	profileID, action, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/profiles/"), "/")
+	if !ok || profileID == "" || (action != "enable" && action != "disable") {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	enabled := action == "enable"
+	resp := ProfileToggleResponse{Success: true, Profile: profileID, Enabled: enabled}
+	if a.enableFunc == nil {
+		resp = ProfileToggleResponse{Success: false, Message: "Profile toggling not configured", Profile: profileID}
+	} else if err := a.enableFunc(profileID, enabled); errors.Is(err, profile.ErrUnknownProfile) {
+		http.Error(w, "Profile not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		resp.Success = false
+		resp.Message = err.Error()
+	} else if enabled {
+		resp.Message = "Profile enabled"
+	} else {
+		resp.Message = "Profile disabled"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// IsDraining reports whether the gateway has been asked to drain
+func (a *API) IsDraining() bool {
+	return atomic.LoadInt32(&a.draining) == 1
+}
+
+// DrainResponse represents the drain endpoint response
+type DrainResponse struct {
+	Draining          bool             `json:"draining"`
+	ActiveConnections map[string]int64 `json:"active_connections"`
+	TotalConnections  int64            `json:"total_connections"`
+	Message           string           `json:"message,omitempty"`
+}
+
+func (a *API) handleDrain(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	atomic.StoreInt32(&a.draining, 1)
+
+	resp := DrainResponse{
+		Draining:          true,
+		ActiveConnections: make(map[string]int64),
+	}
+
+	if a.drainFunc != nil {
+		counts, err := a.drainFunc()
+		if err != nil {
+			resp.Message = err.Error()
+		}
+		if counts != nil {
+			resp.ActiveConnections = counts
+		}
+	}
+
+	for _, n := range resp.ActiveConnections {
+		resp.TotalConnections += n
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// DefaultRecentRequestsLimit is the number of requests returned by
+// GET /requests/recent without a limit parameter
+const DefaultRecentRequestsLimit = 100
+
+// RecentRequestsResponse lists recently handled requests, newest first
+type RecentRequestsResponse struct {
+	Capacity int                  `json:"capacity"` // requests kept in memory
+	Count    int                  `json:"count"`
+	Requests []logging.RequestLog `json:"requests"`
+}
+
+// handleRecentRequests returns the most recent requests kept in memory. The
+// profile and action query parameters restrict the list to matching
+// requests and limit bounds its length.
+func (a *API) handleRecentRequests(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if a.recent == nil {
+		http.Error(w, "Recent requests not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	limit := DefaultRecentRequestsLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	profileID := r.URL.Query().Get("profile")
+	action := r.URL.Query().Get("action")
+
+	requests := a.recent.List(limit, func(ev logging.RequestLog) bool {
+		return (profileID == "" || ev.ProfileID == profileID) && (action == "" || ev.Action == action)
+	})
+	if requests == nil {
+		requests = []logging.RequestLog{}
+	}
+	resp := RecentRequestsResponse{
+		Capacity: a.recent.Size(),
+		Count:    len(requests),
+		Requests: requests,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// EventsDropped is the payload of a "dropped" event, sent when events were
+// lost because the client did not read the stream fast enough
+type EventsDropped struct {
+	Dropped int64 `json:"dropped"`
+}
+
+// handleEvents streams request decisions as Server-Sent Events. Each
+// "request" event carries a request log entry; the profile and action query
+// parameters restrict the stream to matching requests.
+func (a *API) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if a.events == nil {
+		http.Error(w, "Event streaming not available", http.StatusServiceUnavailable)
+		return
+	}
+	profileID := r.URL.Query().Get("profile")
+	action := r.URL.Query().Get("action")
+
+	sub, ok := a.events.Subscribe()
+	if !ok {
+		http.Error(w, "Too many event subscribers", http.StatusServiceUnavailable)
+		return
+	}
+	defer sub.Close()
+
+	// The stream outlives the server's write timeout
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	ticker := time.NewTicker(a.keepAlive)
+	defer ticker.Stop()
+
+	for {
+		var err error
+		select {
+		case <-r.Context().Done():
+			return
+		case <-a.done:
+			return
+		case <-ticker.C:
+			_, err = fmt.Fprint(w, ": keep-alive\n\n")
+		case ev := <-sub.Events():
+			if n := sub.Dropped(); n > 0 {
+				err = writeEvent(w, "dropped", EventsDropped{Dropped: n})
+			}
+			if err == nil && (profileID == "" || ev.ProfileID == profileID) && (action == "" || ev.Action == action) {
+				err = writeEvent(w, "request", ev)
+			}
+		}
+		if err == nil {
+			err = rc.Flush()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// writeEvent writes one Server-Sent Event with a JSON payload
+func writeEvent(w http.ResponseWriter, name string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, data)
+	return err
+}
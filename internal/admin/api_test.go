@@ -1,14 +1,25 @@
 package admin
 
 import (
+	"bufio"
+	"context"
 	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
+	"shadowgate/internal/decision"
+	"shadowgate/internal/events"
+	"shadowgate/internal/learning"
+	"shadowgate/internal/logging"
 	"shadowgate/internal/metrics"
+	"shadowgate/internal/profile"
 	"shadowgate/internal/proxy"
+	"shadowgate/internal/rules"
 )
 
 func TestHealthEndpoint(t *testing.T) {
@@ -80,6 +91,54 @@ func TestMetricsEndpoint(t *testing.T) {
 	}
 }
 
+func TestTopDenialsEndpoint(t *testing.T) {
+	m := metrics.New()
+	m.RecordRequestWithRule("test", "10.0.0.1", "allow_forward", "", 1.0)
+	for i := 0; i < 3; i++ {
+		m.RecordRequestWithRule("test", "10.0.0.2", "deny_decoy", "geo_deny", 1.0)
+	}
+	m.RecordRequestWithRule("test", "10.0.0.3", "drop", "rate_limit", 1.0)
+	m.RecordRequestWithRule("test", "10.0.0.4", "block", "waf", 1.0)
+
+	api := New(Config{
+		Addr:    ":0",
+		Metrics: m,
+	})
+
+	req := httptest.NewRequest("GET", "/denials/top?limit=2", nil)
+	rr := httptest.NewRecorder()
+	api.handleTopDenials(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rr.Code)
+	}
+
+	var resp TopDenialsResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.Total != 5 {
+		t.Errorf("expected 5 denials, got %d", resp.Total)
+	}
+	if len(resp.Reasons) != 2 {
+		t.Fatalf("expected 2 reasons, got %+v", resp.Reasons)
+	}
+	if resp.Reasons[0].RuleType != "geo_deny" || resp.Reasons[0].Count != 3 || resp.Reasons[0].Percent != 60 {
+		t.Errorf("unexpected top reason: %+v", resp.Reasons[0])
+	}
+	// Ties are broken by rule type
+	if resp.Reasons[1].RuleType != "rate_limit" {
+		t.Errorf("expected rate_limit second, got %+v", resp.Reasons[1])
+	}
+
+	req = httptest.NewRequest("GET", "/denials/top?limit=0", nil)
+	rr = httptest.NewRecorder()
+	api.handleTopDenials(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for invalid limit, got %d", rr.Code)
+	}
+}
+
 func TestBackendsEndpoint(t *testing.T) {
 	api := New(Config{
 		Addr: ":0",
@@ -119,6 +178,10 @@ func TestBackendsEndpoint(t *testing.T) {
 	if profile.Healthy != 1 {
 		t.Errorf("expected 1 healthy backend, got %d", profile.Healthy)
 	}
+
+	if pool := profile.Backends[0].ConnPool; pool.MaxIdleConnsPerHost != proxy.DefaultMaxIdleConnsPerHost || pool.IdleConnTimeout == "" {
+		t.Errorf("expected connection pool stats, got %+v", pool)
+	}
 }
 
 func TestReloadEndpoint(t *testing.T) {
@@ -152,6 +215,41 @@ func TestReloadEndpoint(t *testing.T) {
 	}
 }
 
+func TestReopenLogsEndpoint(t *testing.T) {
+	reopened := false
+	api := New(Config{
+		Addr: ":0",
+		ReopenLogsFunc: func() error {
+			reopened = true
+			return nil
+		},
+	})
+
+	rr := httptest.NewRecorder()
+	api.handleReopenLogs(rr, httptest.NewRequest("POST", "/reopen-logs", nil))
+
+	var resp ReopenLogsResponse
+	json.NewDecoder(rr.Body).Decode(&resp)
+	if !reopened || !resp.Success {
+		t.Errorf("expected logs to be reopened, got %+v", resp)
+	}
+
+	rr = httptest.NewRecorder()
+	api.handleReopenLogs(rr, httptest.NewRequest("GET", "/reopen-logs", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected status 405, got %d", rr.Code)
+	}
+
+	// Without a reopen function the endpoint reports failure
+	rr = httptest.NewRecorder()
+	New(Config{Addr: ":0"}).handleReopenLogs(rr, httptest.NewRequest("POST", "/reopen-logs", nil))
+	resp = ReopenLogsResponse{}
+	json.NewDecoder(rr.Body).Decode(&resp)
+	if resp.Success {
+		t.Error("expected failure without reopen function")
+	}
+}
+
 func TestReloadEndpointWrongMethod(t *testing.T) {
 	api := New(Config{
 		Addr: ":0",
@@ -391,3 +489,469 @@ func TestCircuitBreakerMetricsWithOpenCircuit(t *testing.T) {
 		t.Error("expected prod profile in metrics")
 	}
 }
+
+func TestDrainEndpoint(t *testing.T) {
+	drained := false
+	api := New(Config{
+		Addr: ":0",
+		DrainFunc: func() (map[string]int64, error) {
+			drained = true
+			return map[string]int64{"0.0.0.0:443": 3, "0.0.0.0:80": 1}, nil
+		},
+	})
+
+	// Wrong method
+	req := httptest.NewRequest("GET", "/drain", nil)
+	rr := httptest.NewRecorder()
+	api.handleDrain(rr, req)
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected status 405, got %d", rr.Code)
+	}
+
+	req = httptest.NewRequest("POST", "/drain", nil)
+	rr = httptest.NewRecorder()
+	api.handleDrain(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected status 200, got %d", rr.Code)
+	}
+	if !drained {
+		t.Error("expected drain function to be called")
+	}
+
+	var resp DrainResponse
+	json.NewDecoder(rr.Body).Decode(&resp)
+	if !resp.Draining {
+		t.Error("expected draining=true")
+	}
+	if resp.TotalConnections != 4 {
+		t.Errorf("expected 4 total connections, got %d", resp.TotalConnections)
+	}
+
+	// Health now fails
+	req = httptest.NewRequest("GET", "/health", nil)
+	rr = httptest.NewRecorder()
+	api.handleHealth(rr, req)
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected health status 503 while draining, got %d", rr.Code)
+	}
+}
+
+func TestReadinessEndpoint(t *testing.T) {
+	listeners := map[string]bool{"127.0.0.1:8080": true}
+	api := New(Config{
+		Addr:          ":0",
+		AuthToken:     "secret",
+		ListenersFunc: func() map[string]bool { return listeners },
+	})
+
+	pool := proxy.NewPool()
+	b1, _ := proxy.NewBackend("backend1", "http://127.0.0.1:8001", 1)
+	b2, _ := proxy.NewBackend("backend2", "http://127.0.0.1:8002", 1)
+	pool.Add(b1)
+	pool.Add(b2)
+	api.RegisterPool("api", pool)
+
+	// Decoy-only profiles have no backends and do not affect readiness
+	api.RegisterPool("decoy", proxy.NewPool())
+
+	get := func(target string, auth bool) (int, ReadinessResponse) {
+		req := httptest.NewRequest("GET", target, nil)
+		if auth {
+			req.Header.Set("Authorization", "Bearer secret")
+		}
+		rr := httptest.NewRecorder()
+		api.handleReadiness(rr, req)
+		var resp ReadinessResponse
+		json.NewDecoder(rr.Body).Decode(&resp)
+		return rr.Code, resp
+	}
+
+	code, resp := get("/healthz?verbose=1", true)
+	if code != http.StatusOK || resp.Status != "ready" {
+		t.Fatalf("expected ready, got %d %q (%v)", code, resp.Status, resp.Reasons)
+	}
+	if resp.Profiles["api"].Healthy != 2 || resp.GeoIP != "not_configured" {
+		t.Errorf("unexpected verbose details: %+v", resp)
+	}
+
+	// One unhealthy backend still leaves the profile usable
+	b1.SetHealthy(false)
+	if code, _ := get("/healthz", false); code != http.StatusOK {
+		t.Errorf("expected 200 with one healthy backend, got %d", code)
+	}
+
+	b2.SetHealthy(false)
+	code, resp = get("/healthz", false)
+	if code != http.StatusServiceUnavailable || resp.Status != "not_ready" {
+		t.Errorf("expected 503 not_ready, got %d %q", code, resp.Status)
+	}
+	if len(resp.Reasons) != 0 || resp.Profiles != nil {
+		t.Error("expected details to be omitted without verbose")
+	}
+
+	// Verbose details require credentials
+	if _, resp := get("/healthz?verbose=1", false); resp.Profiles != nil {
+		t.Error("expected details to be omitted without credentials")
+	}
+	_, resp = get("/healthz?verbose=1", true)
+	if len(resp.Reasons) != 1 || !strings.Contains(resp.Reasons[0], "profile api") {
+		t.Errorf("expected profile api to be reported, got %v", resp.Reasons)
+	}
+
+	b1.SetHealthy(true)
+	b2.SetHealthy(true)
+	listeners["127.0.0.1:8080"] = false
+	code, resp = get("/healthz?verbose=1", true)
+	if code != http.StatusServiceUnavailable || len(resp.Reasons) != 1 || !strings.Contains(resp.Reasons[0], "listener") {
+		t.Errorf("expected listener failure, got %d %v", code, resp.Reasons)
+	}
+}
+
+func TestReadinessOpenCircuit(t *testing.T) {
+	api := New(Config{Addr: ":0"})
+
+	pool := proxy.NewPool()
+	b, _ := proxy.NewBackend("down", "http://127.0.0.1:1", 1)
+	pool.Add(b)
+	api.RegisterPool("api", pool)
+
+	for i := 0; i < 10 && b.CircuitBreakerState() != proxy.CircuitOpen; i++ {
+		b.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	}
+	if b.CircuitBreakerState() != proxy.CircuitOpen {
+		t.Fatal("expected circuit breaker to open")
+	}
+
+	rr := httptest.NewRecorder()
+	api.handleReadiness(rr, httptest.NewRequest("GET", "/healthz?verbose=1", nil))
+
+	var resp ReadinessResponse
+	json.NewDecoder(rr.Body).Decode(&resp)
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 when only backend has an open circuit, got %d", rr.Code)
+	}
+	if got := resp.Profiles["api"].OpenCircuits; len(got) != 1 || got[0] != "down" {
+		t.Errorf("expected open circuit to be reported, got %v", got)
+	}
+}
+
+func TestMetricsResetEndpoint(t *testing.T) {
+	m := metrics.New()
+	isolated := m.Profile("team-a")
+	isolated.RecordRequest("team-a", "10.0.0.1", "allow_forward", 1)
+	m.RecordRequest("team-a", "10.0.0.1", "allow_forward", 1)
+	m.RecordRequest("team-b", "10.0.0.2", "allow_forward", 1)
+
+	api := New(Config{Addr: ":0", Metrics: m})
+
+	// Isolated collector is selected with ?profile=
+	rr := httptest.NewRecorder()
+	api.handleMetrics(rr, httptest.NewRequest("GET", "/metrics?profile=team-a", nil))
+	var snapshot metrics.Snapshot
+	json.NewDecoder(rr.Body).Decode(&snapshot)
+	if rr.Code != http.StatusOK || snapshot.TotalRequests != 1 {
+		t.Errorf("expected team-a snapshot with 1 request, got %d %+v", rr.Code, snapshot)
+	}
+
+	rr = httptest.NewRecorder()
+	api.handlePrometheusMetrics(rr, httptest.NewRequest("GET", "/metrics/prometheus?profile=team-b", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for profile without isolated metrics, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	api.handleMetricsReset(rr, httptest.NewRequest("GET", "/metrics/reset", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected status 405, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	api.handleMetricsReset(rr, httptest.NewRequest("POST", "/metrics/reset?profile=team-a", nil))
+	var resp MetricsResetResponse
+	json.NewDecoder(rr.Body).Decode(&resp)
+	if rr.Code != http.StatusOK || !resp.Success || resp.Profile != "team-a" {
+		t.Errorf("unexpected reset response: %d %+v", rr.Code, resp)
+	}
+	if isolated.GetSnapshot().TotalRequests != 0 {
+		t.Error("expected team-a collector to be reset")
+	}
+	if m.GetSnapshot().ProfileRequests["team-b"] != 1 {
+		t.Error("expected team-b counters untouched")
+	}
+
+	rr = httptest.NewRecorder()
+	api.handleMetricsReset(rr, httptest.NewRequest("POST", "/metrics/reset?profile=nope", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown profile, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	api.handleMetricsReset(rr, httptest.NewRequest("POST", "/metrics/reset", nil))
+	if rr.Code != http.StatusOK || m.GetSnapshot().TotalRequests != 0 {
+		t.Errorf("expected full reset, got %d", rr.Code)
+	}
+}
+
+func TestLearnEndpoint(t *testing.T) {
+	registry := learning.NewRegistry()
+	rec := registry.Recorder("team-a", learning.DefaultOptions())
+	rec.Observe(learning.Observation{ClientIP: "203.0.113.7", UserAgent: "curl/8.0", Path: "/api/users"})
+	rec.Observe(learning.Observation{ClientIP: "203.0.113.9", UserAgent: "curl/8.0", Path: "/api/orders"})
+
+	api := New(Config{Addr: ":0", Learning: registry})
+
+	rr := httptest.NewRecorder()
+	api.handleLearn(rr, httptest.NewRequest("GET", "/learn/team-a", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rr.Code)
+	}
+	if ct := rr.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/yaml") {
+		t.Errorf("expected YAML content type, got %q", ct)
+	}
+	for _, want := range []string{"ip_allow", "203.0.113.0/24", "ua_whitelist", "path_allow"} {
+		if !strings.Contains(rr.Body.String(), want) {
+			t.Errorf("expected suggestion to contain %q, got:\n%s", want, rr.Body.String())
+		}
+	}
+
+	rr = httptest.NewRecorder()
+	api.handleLearn(rr, httptest.NewRequest("GET", "/learn/team-a?min_count=zero", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for invalid min_count, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	api.handleLearn(rr, httptest.NewRequest("GET", "/learn/team-b", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for profile without learning, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	api.handleLearn(rr, httptest.NewRequest("DELETE", "/learn/team-a", nil))
+	if rr.Code != http.StatusOK || rec.Summary().Requests != 0 {
+		t.Errorf("expected learning data reset, got %d", rr.Code)
+	}
+}
+
+func TestEvaluateEndpoint(t *testing.T) {
+	office, _ := rules.NewIPRule([]string{"10.0.0.0/8"}, "allow")
+	scanners, _ := rules.NewUARule([]string{"(?i)sqlmap"}, "blacklist")
+	geo, _ := rules.NewGeoRule([]string{"KP"}, "deny")
+	limit := rules.NewRateLimitRule(1, time.Minute)
+	defer limit.Stop()
+	engine := decision.NewEngine(
+		&rules.Group{And: []rules.Rule{office, limit}},
+		&rules.Group{Or: []rules.Rule{scanners, geo}},
+	)
+
+	api := New(Config{Addr: ":0"})
+	api.RegisterEngine("team-a", engine)
+
+	evaluate := func(query, body string) (*httptest.ResponseRecorder, EvaluateResponse) {
+		rr := httptest.NewRecorder()
+		api.handleEvaluate(rr, httptest.NewRequest("POST", "/evaluate"+query, strings.NewReader(body)))
+		var resp EvaluateResponse
+		if rr.Code == http.StatusOK {
+			if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+		}
+		return rr, resp
+	}
+
+	tests := []struct {
+		name     string
+		body     string
+		action   string
+		ruleType string
+	}{
+		{"allowed", `{"client_ip": "10.1.2.3", "path": "/api/users"}`, "allow_forward", "rate_limit"},
+		{"outside allow list", `{"client_ip": "203.0.113.7"}`, "deny_decoy", "ip_allow"},
+		{"scanner user agent", `{"client_ip": "10.1.2.3", "user_agent": "sqlmap/1.7"}`, "deny_decoy", "ua_blacklist"},
+		{"country override", `{"client_ip": "10.1.2.3", "country": "KP"}`, "deny_decoy", "geo_deny"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr, resp := evaluate("?profile=team-a", tt.body)
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+			}
+			if resp.Action != tt.action || resp.RuleType != tt.ruleType {
+				t.Errorf("expected %s by %s, got %+v", tt.action, tt.ruleType, resp)
+			}
+		})
+	}
+
+	// Synthetic requests are not counted by stateful rules
+	if stats := limit.GetStats(); len(stats) != 0 {
+		t.Errorf("expected evaluation not to be rate limited, got %v", stats)
+	}
+
+	for _, tc := range []struct {
+		query, body string
+		code        int
+	}{
+		{"", `{"client_ip": "10.1.2.3"}`, http.StatusBadRequest},
+		{"?profile=team-b", `{"client_ip": "10.1.2.3"}`, http.StatusNotFound},
+		{"?profile=team-a", `{"client_ip": "not-an-ip"}`, http.StatusBadRequest},
+		{"?profile=team-a", `{"client_ip": "10.1.2.3", "path": "api"}`, http.StatusBadRequest},
+		{"?profile=team-a", `{"client_ip": "10.1.2.3", "tls_version": "2.0"}`, http.StatusBadRequest},
+		{"?profile=team-a", `{"clientip": "10.1.2.3"}`, http.StatusBadRequest},
+	} {
+		if rr, _ := evaluate(tc.query, tc.body); rr.Code != tc.code {
+			t.Errorf("%s %s: expected status %d, got %d", tc.query, tc.body, tc.code, rr.Code)
+		}
+	}
+}
+
+func TestProfileToggleEndpoint(t *testing.T) {
+	state := map[string]bool{"seasonal": false}
+	api := New(Config{
+		Addr: ":0",
+		ProfileEnableFunc: func(profileID string, enabled bool) error {
+			if _, ok := state[profileID]; !ok {
+				return fmt.Errorf("%w: %s", profile.ErrUnknownProfile, profileID)
+			}
+			state[profileID] = enabled
+			return nil
+		},
+	})
+
+	rr := httptest.NewRecorder()
+	api.handleProfileToggle(rr, httptest.NewRequest("POST", "/profiles/seasonal/enable", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rr.Code)
+	}
+	var resp ProfileToggleResponse
+	json.NewDecoder(rr.Body).Decode(&resp)
+	if !resp.Success || !resp.Enabled || !state["seasonal"] {
+		t.Errorf("expected profile to be enabled, got %+v", resp)
+	}
+
+	rr = httptest.NewRecorder()
+	api.handleProfileToggle(rr, httptest.NewRequest("POST", "/profiles/seasonal/disable", nil))
+	if state["seasonal"] {
+		t.Error("expected profile to be disabled")
+	}
+
+	tests := []struct {
+		method string
+		path   string
+		status int
+	}{
+		{"GET", "/profiles/seasonal/enable", http.StatusMethodNotAllowed},
+		{"POST", "/profiles/missing/enable", http.StatusNotFound},
+		{"POST", "/profiles/seasonal/pause", http.StatusNotFound},
+		{"POST", "/profiles/seasonal", http.StatusNotFound},
+	}
+	for _, tc := range tests {
+		rr := httptest.NewRecorder()
+		api.handleProfileToggle(rr, httptest.NewRequest(tc.method, tc.path, nil))
+		if rr.Code != tc.status {
+			t.Errorf("%s %s: expected status %d, got %d", tc.method, tc.path, tc.status, rr.Code)
+		}
+	}
+}
+
+func TestEventsEndpoint(t *testing.T) {
+	bus := events.NewBus()
+	api := New(Config{Addr: ":0", Events: bus})
+	srv := httptest.NewServer(http.HandlerFunc(api.handleEvents))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/events?profile=web")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("expected event stream, got %q", ct)
+	}
+	for bus.Subscribers() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	bus.Publish(logging.RequestLog{ProfileID: "api", RequestID: "skipped"})
+	bus.Publish(logging.RequestLog{ProfileID: "web", RequestID: "r1", Action: "deny_decoy", ClientIP: "192.0.2.1"})
+
+	r := bufio.NewReader(resp.Body)
+	name, _ := r.ReadString('\n')
+	data, _ := r.ReadString('\n')
+	if name != "event: request\n" {
+		t.Fatalf("expected request event, got %q", name)
+	}
+	var ev logging.RequestLog
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(data, "data: ")), &ev); err != nil {
+		t.Fatalf("invalid event data %q: %v", data, err)
+	}
+	if ev.RequestID != "r1" || ev.Action != "deny_decoy" || ev.ClientIP != "192.0.2.1" {
+		t.Errorf("unexpected event %+v", ev)
+	}
+
+	// Stop ends open streams and releases the subscription
+	api.Stop(context.Background())
+	io.Copy(io.Discard, r)
+	if n := bus.Subscribers(); n != 0 {
+		t.Errorf("expected no subscribers after stop, got %d", n)
+	}
+
+	rr := httptest.NewRecorder()
+	New(Config{Addr: ":0"}).handleEvents(rr, httptest.NewRequest("GET", "/events", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 without an event bus, got %d", rr.Code)
+	}
+}
+
+func TestRecentRequestsEndpoint(t *testing.T) {
+	recent := events.NewRecent(10)
+	recent.Add(logging.RequestLog{ProfileID: "web", RequestID: "r1", Action: "allow_forward"})
+	recent.Add(logging.RequestLog{ProfileID: "api", RequestID: "r2", Action: "deny_decoy"})
+	recent.Add(logging.RequestLog{ProfileID: "web", RequestID: "r3", Action: "deny_decoy"})
+	recent.Add(logging.RequestLog{ProfileID: "web", RequestID: "r4", Action: "deny_decoy"})
+	api := New(Config{Addr: ":0", Recent: recent})
+
+	get := func(target string) (*httptest.ResponseRecorder, RecentRequestsResponse) {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		api.handleRecentRequests(rr, httptest.NewRequest("GET", target, nil))
+		var resp RecentRequestsResponse
+		if rr.Code == http.StatusOK {
+			if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("invalid response: %v", err)
+			}
+		}
+		return rr, resp
+	}
+
+	_, resp := get("/requests/recent?profile=web&action=deny_decoy&limit=1")
+	if resp.Capacity != 10 || resp.Count != 1 || resp.Requests[0].RequestID != "r4" {
+		t.Errorf("unexpected response %+v", resp)
+	}
+
+	_, resp = get("/requests/recent?action=deny_decoy")
+	if resp.Count != 3 || resp.Requests[2].RequestID != "r2" {
+		t.Errorf("expected 3 denied requests newest first, got %+v", resp)
+	}
+
+	_, resp = get("/requests/recent?profile=none")
+	if resp.Count != 0 || resp.Requests == nil {
+		t.Errorf("expected empty request list, got %+v", resp)
+	}
+
+	if rr, _ := get("/requests/recent?limit=0"); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for invalid limit, got %d", rr.Code)
+	}
+
+	rr := httptest.NewRecorder()
+	api.handleRecentRequests(rr, httptest.NewRequest("POST", "/requests/recent", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	New(Config{Addr: ":0"}).handleRecentRequests(rr, httptest.NewRequest("GET", "/requests/recent", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 without a recent request buffer, got %d", rr.Code)
+	}
+}
@@ -5,8 +5,11 @@ import (
 	"net"
 	"net/url"
 	"os"
+	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -21,6 +24,81 @@ func Load(path string) (*Config, error) {
 	return Parse(data)
 }
 
+// LoadDir reads every .yaml and .yml file in dir, in name order, and merges
+// them into one configuration. Profiles are concatenated; the global section
+// may appear in at most one file. Profile IDs must be unique across files.
+func LoadDir(dir string) (*Config, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config directory: %w", err)
+	}
+
+	var cfg Config
+	var files int
+	var globalFile string
+	profileFiles := make(map[string]string)
+
+	for _, e := range entries {
+		name := e.Name()
+		ext := filepath.Ext(name)
+		if e.IsDir() || strings.HasPrefix(name, ".") || (ext != ".yaml" && ext != ".yml") {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config file: %w", err)
+		}
+		var part struct {
+			Global   *GlobalConfig   `yaml:"global"`
+			Profiles []ProfileConfig `yaml:"profiles"`
+		}
+		if err := yaml.Unmarshal(data, &part); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", name, err)
+		}
+		files++
+
+		if part.Global != nil {
+			if globalFile != "" {
+				return nil, fmt.Errorf("global section defined in both %s and %s", globalFile, name)
+			}
+			globalFile = name
+			cfg.Global = *part.Global
+		}
+
+		for _, p := range part.Profiles {
+			if err := p.Validate(); err != nil {
+				return nil, fmt.Errorf("%s: profile %q: %w", name, p.ID, err)
+			}
+			if prev, ok := profileFiles[p.ID]; ok {
+				return nil, fmt.Errorf("duplicate profile ID %s in %s and %s", p.ID, prev, name)
+			}
+			profileFiles[p.ID] = name
+			cfg.Profiles = append(cfg.Profiles, p)
+		}
+	}
+
+	if files == 0 {
+		return nil, fmt.Errorf("no .yaml files found in %s", dir)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("config validation failed: %w", err)
+	}
+
+	return &cfg, nil
+}
+
+// LoadPath loads a configuration file, or merges a directory of files with
+// LoadDir
+func LoadPath(path string) (*Config, error) {
+	info, err := os.Stat(path)
+	if err == nil && info.IsDir() {
+		return LoadDir(path)
+	}
+	return Load(path)
+}
+
 // Parse parses configuration from YAML bytes
 func Parse(data []byte) (*Config, error) {
 	var cfg Config
@@ -56,6 +134,50 @@ func (c *Config) Validate() error {
 		profileIDs[p.ID] = true
 	}
 
+	if err := c.validateSharedListeners(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// validateSharedListeners checks listeners that share an address across
+// profiles. Sharing is only possible for HTTPS listeners routed by SNI, with
+// at most one listener (the default route) omitting sni_hosts.
+func (c *Config) validateSharedListeners() error {
+	byAddr := make(map[string][]ListenerConfig)
+	for _, p := range c.Profiles {
+		for _, l := range p.ExpandListeners() {
+			byAddr[l.Addr] = append(byAddr[l.Addr], l)
+		}
+	}
+
+	for addr, listeners := range byAddr {
+		if len(listeners) < 2 {
+			continue
+		}
+		defaults := 0
+		hosts := make(map[string]bool)
+		for _, l := range listeners {
+			if strings.ToLower(l.Protocol) != "https" {
+				return fmt.Errorf("listener %s: address shared by multiple listeners must use https with sni_hosts", addr)
+			}
+			if len(l.SNIHosts) == 0 {
+				defaults++
+			}
+			for _, h := range l.SNIHosts {
+				h = strings.ToLower(h)
+				if hosts[h] {
+					return fmt.Errorf("listener %s: duplicate sni_hosts entry: %s", addr, h)
+				}
+				hosts[h] = true
+			}
+		}
+		if defaults > 1 {
+			return fmt.Errorf("listener %s: at most one shared listener may omit sni_hosts", addr)
+		}
+	}
+
 	return nil
 }
 
@@ -77,6 +199,74 @@ func (g *GlobalConfig) Validate() error {
 		}
 	}
 
+	if g.XFFTrustedHops && len(g.TrustedProxies) == 0 {
+		return fmt.Errorf("xff_trusted_hops requires trusted_proxies")
+	}
+	if g.TrustedProxyCount < 0 {
+		return fmt.Errorf("trusted_proxy_count cannot be negative")
+	}
+	if g.TrustedProxyCount > 0 && g.XFFTrustedHops {
+		return fmt.Errorf("trusted_proxy_count and xff_trusted_hops cannot be combined")
+	}
+
+	validXFFModes := map[string]bool{"": true, "append": true, "overwrite": true, "remove": true}
+	if !validXFFModes[strings.ToLower(g.XFFMode)] {
+		return fmt.Errorf("invalid xff_mode: %s (must be append, overwrite, or remove)", g.XFFMode)
+	}
+
+	if err := ValidateErrorPages(g.ErrorPages); err != nil {
+		return err
+	}
+
+	if err := ValidateHeaderNames(g.ClientIPHeaders); err != nil {
+		return fmt.Errorf("client_ip_headers: %w", err)
+	}
+
+	if g.MetricsLimits.MaxKeys < 0 || g.MetricsLimits.MaxUniqueIPs < 0 {
+		return fmt.Errorf("metrics_limits cannot be negative")
+	}
+
+	if g.AdminAPI.RecentRequests < 0 {
+		return fmt.Errorf("admin_api recent_requests cannot be negative")
+	}
+
+	if g.RuleTimingSampleRate < 0 || g.RuleTimingSampleRate > 1 {
+		return fmt.Errorf("rule_timing_sample_rate must be between 0 and 1")
+	}
+
+	if err := g.RateLimitStore.Validate(); err != nil {
+		return fmt.Errorf("rate_limit_store: %w", err)
+	}
+
+	if g.GeoIPRequired && g.GeoIPDBPath == "" {
+		return fmt.Errorf("geoip_required is set but geoip_db_path is empty")
+	}
+
+	return nil
+}
+
+// Validate checks the rate limit store configuration
+func (s *RateLimitStoreConfig) Validate() error {
+	switch s.Type {
+	case "", "memory":
+		return nil
+	case "redis":
+	default:
+		return fmt.Errorf("invalid type: %s (expected memory or redis)", s.Type)
+	}
+
+	r := s.Redis
+	if _, _, err := net.SplitHostPort(r.Addr); err != nil {
+		return fmt.Errorf("redis addr must be host:port: %q", r.Addr)
+	}
+	if r.DB < 0 || r.PoolSize < 0 {
+		return fmt.Errorf("redis db and pool_size cannot be negative")
+	}
+	if r.Timeout != "" {
+		if d, err := time.ParseDuration(r.Timeout); err != nil || d <= 0 {
+			return fmt.Errorf("invalid redis timeout: %s", r.Timeout)
+		}
+	}
 	return nil
 }
 
@@ -92,6 +282,10 @@ func (l *LogConfig) Validate() error {
 		return fmt.Errorf("invalid log format: %s", l.Format)
 	}
 
+	if l.MaxSizeMB < 0 || l.MaxBackups < 0 || l.MaxAgeDays < 0 {
+		return fmt.Errorf("log rotation settings cannot be negative")
+	}
+
 	return nil
 }
 
@@ -121,22 +315,152 @@ func (p *ProfileConfig) Validate() error {
 		}
 	}
 
+	if err := p.Rules.Validate(); err != nil {
+		return fmt.Errorf("rules: %w", err)
+	}
+
 	if err := p.Decoy.Validate(); err != nil {
 		return fmt.Errorf("decoy: %w", err)
 	}
 
+	if err := ValidateErrorPages(p.ErrorPages); err != nil {
+		return err
+	}
+
+	if p.RequestTimeout != "" {
+		d, err := time.ParseDuration(p.RequestTimeout)
+		if err != nil {
+			return fmt.Errorf("invalid request_timeout %q: %w", p.RequestTimeout, err)
+		}
+		if d < 0 {
+			return fmt.Errorf("request_timeout cannot be negative")
+		}
+	}
+
+	if p.MaxRetries < 0 {
+		return fmt.Errorf("max_retries cannot be negative")
+	}
+	if p.RetryBackoff != "" {
+		d, err := time.ParseDuration(p.RetryBackoff)
+		if err != nil {
+			return fmt.Errorf("invalid retry_backoff %q: %w", p.RetryBackoff, err)
+		}
+		if d < 0 {
+			return fmt.Errorf("retry_backoff cannot be negative")
+		}
+	}
+
+	if p.Compression.MinSize < 0 {
+		return fmt.Errorf("compression min_size cannot be negative")
+	}
+	if p.Compression.Level != 0 && (p.Compression.Level < 1 || p.Compression.Level > 9) {
+		return fmt.Errorf("invalid compression level: %d (must be 1-9)", p.Compression.Level)
+	}
+
+	if p.BackendQueue.MaxWait != "" {
+		d, err := time.ParseDuration(p.BackendQueue.MaxWait)
+		if err != nil {
+			return fmt.Errorf("invalid backend_queue max_wait %q: %w", p.BackendQueue.MaxWait, err)
+		}
+		if d <= 0 {
+			return fmt.Errorf("backend_queue max_wait must be positive")
+		}
+	}
+	if p.BackendQueue.QueueSize < 0 {
+		return fmt.Errorf("backend_queue queue_size cannot be negative")
+	}
+
+	validBalancing := map[string]bool{"": true, "round_robin": true, "failover": true, "weighted": true}
+	if !validBalancing[strings.ToLower(p.LoadBalancing)] {
+		return fmt.Errorf("invalid load_balancing: %s (expected round_robin, failover or weighted)", p.LoadBalancing)
+	}
+	if p.AdaptiveWeight.ErrorThreshold < 0 || p.AdaptiveWeight.ErrorThreshold >= 0.5 {
+		return fmt.Errorf("adaptive_weight error_threshold must be at least 0 and below 0.5")
+	}
+	if p.AdaptiveWeight.MinFactor < 0 || p.AdaptiveWeight.MinFactor > 1 {
+		return fmt.Errorf("adaptive_weight min_factor must be between 0 and 1")
+	}
+	if p.AdaptiveWeight.Enabled && strings.ToLower(p.LoadBalancing) != "weighted" {
+		return fmt.Errorf("adaptive_weight requires load_balancing: weighted")
+	}
+
+	if p.MaxRequestBody < 0 {
+		return fmt.Errorf("max_request_body cannot be negative")
+	}
+
+	if err := p.ExposeBackendHeader.Validate(); err != nil {
+		return fmt.Errorf("expose_backend_header: %w", err)
+	}
+
+	if p.MaxHeaders < 0 || p.MaxHeaderValueSize < 0 {
+		return fmt.Errorf("max_headers and max_header_value_size cannot be negative")
+	}
+
+	if p.Learning.MaxEntries < 0 {
+		return fmt.Errorf("learning max_entries cannot be negative")
+	}
+
+	if err := ValidateHeaderNames(p.ClientIPHeaders); err != nil {
+		return fmt.Errorf("client_ip_headers: %w", err)
+	}
+
+	validDenyActions := map[string]bool{"": true, "decoy": true, "block": true, "tarpit": true, "drop": true}
+	if !validDenyActions[strings.ToLower(p.DenyAction)] {
+		return fmt.Errorf("invalid deny_action: %s", p.DenyAction)
+	}
+
+	if p.BlockStatus != 0 && (p.BlockStatus < 100 || p.BlockStatus > 599) {
+		return fmt.Errorf("invalid block_status: %d", p.BlockStatus)
+	}
+
+	validDropModes := map[string]bool{"": true, "close": true, "hold": true, "reset": true}
+	if !validDropModes[strings.ToLower(p.DropMode)] {
+		return fmt.Errorf("invalid drop_mode: %s", p.DropMode)
+	}
+
+	if p.DropHold != "" {
+		d, err := time.ParseDuration(p.DropHold)
+		if err != nil {
+			return fmt.Errorf("invalid drop_hold %q: %w", p.DropHold, err)
+		}
+		if d <= 0 {
+			return fmt.Errorf("drop_hold must be positive")
+		}
+	}
+
+	if p.BypassToken != "" && len(p.BypassToken) < MinBypassTokenLength {
+		return fmt.Errorf("bypass_token must be at least %d characters", MinBypassTokenLength)
+	}
+
 	return nil
 }
 
+// MinBypassTokenLength is the minimum length of a profile bypass token
+const MinBypassTokenLength = 32
+
 // Validate checks listener configuration
 func (l *ListenerConfig) Validate() error {
-	if l.Addr == "" {
-		return fmt.Errorf("listener address is required")
+	if len(l.Addrs) > 0 {
+		if l.Addr != "" {
+			return fmt.Errorf("addr and addrs cannot both be set")
+		}
+		seen := make(map[string]bool, len(l.Addrs))
+		for _, addr := range l.Addrs {
+			if seen[addr] {
+				return fmt.Errorf("duplicate listener address %q", addr)
+			}
+			seen[addr] = true
+			c := *l
+			c.Addr, c.Addrs = addr, nil
+			if err := c.Validate(); err != nil {
+				return err
+			}
+		}
+		return nil
 	}
 
-	_, _, err := net.SplitHostPort(l.Addr)
-	if err != nil {
-		return fmt.Errorf("invalid listener address %q: %w", l.Addr, err)
+	if l.Addr == "" {
+		return fmt.Errorf("listener address is required")
 	}
 
 	validProtocols := map[string]bool{"http": true, "https": true, "tcp": true}
@@ -144,15 +468,102 @@ func (l *ListenerConfig) Validate() error {
 		return fmt.Errorf("invalid protocol: %s", l.Protocol)
 	}
 
+	if path, ok := strings.CutPrefix(l.Addr, "unix:"); ok {
+		if path == "" {
+			return fmt.Errorf("invalid listener address %q: empty socket path", l.Addr)
+		}
+		if strings.ToLower(l.Protocol) == "tcp" {
+			return fmt.Errorf("unix socket listeners require http or https protocol")
+		}
+		if _, err := l.SocketFileMode(); err != nil {
+			return err
+		}
+	} else {
+		if _, _, err := net.SplitHostPort(l.Addr); err != nil {
+			return fmt.Errorf("invalid listener address %q: %w", l.Addr, err)
+		}
+		if l.SocketMode != "" {
+			return fmt.Errorf("socket_mode only applies to unix socket listeners")
+		}
+	}
+
 	if strings.ToLower(l.Protocol) == "https" {
 		if l.TLS.CertFile == "" || l.TLS.KeyFile == "" {
 			return fmt.Errorf("TLS cert_file and key_file required for HTTPS")
 		}
+		if l.TLS.SessionCacheSize < 0 {
+			return fmt.Errorf("TLS session_cache_size cannot be negative")
+		}
+		if l.TLS.SessionTicketKeyFile != "" && l.TLS.SessionCacheSize > 0 {
+			return fmt.Errorf("TLS session_ticket_key_file and session_cache_size cannot be combined")
+		}
+		if l.TLS.DisableSessionTickets && (l.TLS.SessionTicketKeyFile != "" || l.TLS.SessionCacheSize > 0) {
+			return fmt.Errorf("TLS disable_session_tickets conflicts with session_ticket_key_file and session_cache_size")
+		}
+		if l.TLS.SessionTicketKeyFile != "" {
+			if _, err := os.Stat(l.TLS.SessionTicketKeyFile); err != nil {
+				return fmt.Errorf("TLS session_ticket_key_file: %w", err)
+			}
+		}
+		if l.TLS.OCSPStapleFile != "" {
+			if _, err := os.Stat(l.TLS.OCSPStapleFile); err != nil {
+				return fmt.Errorf("TLS ocsp_staple_file: %w", err)
+			}
+		}
+	}
+
+	if len(l.SNIHosts) > 0 && strings.ToLower(l.Protocol) != "https" {
+		return fmt.Errorf("sni_hosts requires https protocol")
+	}
+
+	rl := l.ConnRateLimit
+	if rl.GlobalRate < 0 || rl.PerIPRate < 0 || rl.GlobalBurst < 0 || rl.PerIPBurst < 0 {
+		return fmt.Errorf("conn_rate_limit values cannot be negative")
+	}
+
+	if l.ProxyProtocol && len(l.ProxyProtocolTrusted) == 0 && !strings.HasPrefix(l.Addr, "unix:") {
+		return fmt.Errorf("proxy_protocol requires proxy_protocol_trusted")
+	}
+	for _, cidr := range l.ProxyProtocolTrusted {
+		if _, _, err := net.ParseCIDR(cidr); err != nil && net.ParseIP(cidr) == nil {
+			return fmt.Errorf("invalid proxy_protocol_trusted CIDR or IP: %s", cidr)
+		}
+	}
+
+	timeouts := []struct{ name, value string }{
+		{"read_timeout", l.ReadTimeout},
+		{"write_timeout", l.WriteTimeout},
+		{"idle_timeout", l.IdleTimeout},
+		{"read_header_timeout", l.ReadHeaderTimeout},
+	}
+	for _, t := range timeouts {
+		if t.value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(t.value)
+		if err != nil {
+			return fmt.Errorf("invalid %s %q: %w", t.name, t.value, err)
+		}
+		if d <= 0 {
+			return fmt.Errorf("%s must be positive", t.name)
+		}
 	}
 
 	return nil
 }
 
+// SocketFileMode parses SocketMode as octal permissions (0 if unset)
+func (l *ListenerConfig) SocketFileMode() (os.FileMode, error) {
+	if l.SocketMode == "" {
+		return 0, nil
+	}
+	mode, err := strconv.ParseUint(l.SocketMode, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("invalid socket_mode %q: must be octal permissions such as 0660", l.SocketMode)
+	}
+	return os.FileMode(mode), nil
+}
+
 // Validate checks backend configuration
 func (b *BackendConfig) Validate() error {
 	if b.Name == "" {
@@ -183,16 +594,325 @@ func (b *BackendConfig) Validate() error {
 		return fmt.Errorf("backend weight cannot be negative")
 	}
 
+	if b.MaxIdleConns < 0 || b.MaxIdleConnsPerHost < 0 {
+		return fmt.Errorf("max_idle_conns and max_idle_conns_per_host cannot be negative")
+	}
+	if b.IdleConnTimeout != "" {
+		if d, err := time.ParseDuration(b.IdleConnTimeout); err != nil || d <= 0 {
+			return fmt.Errorf("invalid idle_conn_timeout %q", b.IdleConnTimeout)
+		}
+	}
+
+	if b.TLS != nil {
+		if u.Scheme != "https" {
+			return fmt.Errorf("backend tls settings require an https URL: %s", b.URL)
+		}
+		if (b.TLS.CertFile == "") != (b.TLS.KeyFile == "") {
+			return fmt.Errorf("backend tls cert_file and key_file must be set together")
+		}
+		files := []struct{ field, path string }{
+			{"ca_file", b.TLS.CAFile},
+			{"cert_file", b.TLS.CertFile},
+			{"key_file", b.TLS.KeyFile},
+		}
+		for _, f := range files {
+			if f.path == "" {
+				continue
+			}
+			if _, err := os.Stat(f.path); err != nil {
+				return fmt.Errorf("backend tls %s: %w", f.field, err)
+			}
+		}
+	}
+
+	if b.StripPrefix != "" && !strings.HasPrefix(b.StripPrefix, "/") {
+		return fmt.Errorf("strip_prefix must start with /: %s", b.StripPrefix)
+	}
+	if b.RewritePath != nil {
+		if b.RewritePath.Pattern == "" {
+			return fmt.Errorf("rewrite_path pattern is required")
+		}
+		if _, err := regexp.Compile(b.RewritePath.Pattern); err != nil {
+			return fmt.Errorf("invalid rewrite_path pattern %q: %w", b.RewritePath.Pattern, err)
+		}
+	}
+
 	return nil
 }
 
+// Validate checks the allow and deny rule groups
+func (r *RulesConfig) Validate() error {
+	if r.Allow != nil {
+		if err := r.Allow.Validate(); err != nil {
+			return fmt.Errorf("allow: %w", err)
+		}
+	}
+	if r.Deny != nil {
+		if err := r.Deny.Validate(); err != nil {
+			return fmt.Errorf("deny: %w", err)
+		}
+	}
+	if r.Suspicious != nil {
+		if err := r.Suspicious.Validate(); err != nil {
+			return fmt.Errorf("suspicious: %w", err)
+		}
+	}
+	if r.SlowForwardDelay != "" {
+		d, err := time.ParseDuration(r.SlowForwardDelay)
+		if err != nil {
+			return fmt.Errorf("invalid slow_forward_delay %q: %w", r.SlowForwardDelay, err)
+		}
+		if d < 0 {
+			return fmt.Errorf("slow_forward_delay cannot be negative")
+		}
+	}
+	return nil
+}
+
+// Validate checks every rule in the group
+func (g *RuleGroup) Validate() error {
+	for i := range g.And {
+		if err := g.And[i].Validate(); err != nil {
+			return fmt.Errorf("and[%d]: %w", i, err)
+		}
+	}
+	for i := range g.Or {
+		if err := g.Or[i].Validate(); err != nil {
+			return fmt.Errorf("or[%d]: %w", i, err)
+		}
+	}
+	if g.Not != nil {
+		if err := g.Not.Validate(); err != nil {
+			return fmt.Errorf("not: %w", err)
+		}
+	}
+	if g.Rule != nil {
+		if err := g.Rule.Validate(); err != nil {
+			return fmt.Errorf("rule: %w", err)
+		}
+	}
+	return nil
+}
+
+// Validate checks regex-bearing fields of a rule
+func (r *Rule) Validate() error {
+	if err := ValidateRegexPatterns(r.Patterns); err != nil {
+		return fmt.Errorf("%s patterns: %w", r.Type, err)
+	}
+	if err := ValidateRegexPatterns(r.Paths); err != nil {
+		return fmt.Errorf("%s paths: %w", r.Type, err)
+	}
+	if err := ValidateRegexPatterns(r.SNIPatterns); err != nil {
+		return fmt.Errorf("%s sni_patterns: %w", r.Type, err)
+	}
+	if err := ValidateRegexPatterns(r.HostPatterns); err != nil {
+		return fmt.Errorf("%s host_patterns: %w", r.Type, err)
+	}
+	for i, h := range r.Headers {
+		if _, err := regexp.Compile(h.Pattern); err != nil {
+			return fmt.Errorf("%s headers[%d]: invalid regex pattern %q: %w", r.Type, i, h.Pattern, err)
+		}
+	}
+	if (r.Type == "rate_limit" || r.Type == "asn_rate_limit") && r.KeySource != "" && r.KeySource != "ip" {
+		kind, name, _ := strings.Cut(r.KeySource, ":")
+		if (kind != "header" && kind != "cookie") || strings.TrimSpace(name) == "" {
+			return fmt.Errorf("%s: invalid key_source %q (expected ip, header:<name> or cookie:<name>)", r.Type, r.KeySource)
+		}
+	}
+	if r.Type == "asn_rate_limit" {
+		if len(r.ASNLimits) == 0 {
+			return fmt.Errorf("asn_rate_limit: asn_limits is required")
+		}
+		for asn, limit := range r.ASNLimits {
+			if limit <= 0 {
+				return fmt.Errorf("asn_rate_limit: limit for AS%d must be positive", asn)
+			}
+		}
+	}
+	if r.Type == "header_set" {
+		if r.HeaderSetMode != "require_all" && r.HeaderSetMode != "require_any" {
+			return fmt.Errorf("header_set: invalid header_set_mode %q (expected require_all or require_any)", r.HeaderSetMode)
+		}
+		if len(r.HeaderNames) == 0 {
+			return fmt.Errorf("header_set: header_names is required")
+		}
+		for _, n := range r.HeaderNames {
+			if strings.TrimSpace(n) == "" {
+				return fmt.Errorf("header_set: empty header_names entry")
+			}
+		}
+	}
+	if (r.Type == "query_allow" || r.Type == "query_deny") && r.QueryParam == "" {
+		return fmt.Errorf("%s: query_param is required", r.Type)
+	}
+	if (r.Type == "cookie_allow" || r.Type == "cookie_deny") && r.CookieName == "" {
+		return fmt.Errorf("%s: cookie_name is required", r.Type)
+	}
+	if r.Type == "alpn_allow" || r.Type == "alpn_deny" {
+		if len(r.ALPNProtocols) == 0 {
+			return fmt.Errorf("%s: alpn_protocols is required", r.Type)
+		}
+		for _, p := range r.ALPNProtocols {
+			if p == "" {
+				return fmt.Errorf("%s: empty alpn_protocols entry", r.Type)
+			}
+		}
+	}
+	if r.GeoIPFailMode != "" {
+		switch r.Type {
+		case "geo_allow", "geo_deny", "asn_allow", "asn_deny":
+		default:
+			return fmt.Errorf("%s: geoip_fail_mode only applies to geo and asn rules", r.Type)
+		}
+		if r.GeoIPFailMode != "open" && r.GeoIPFailMode != "closed" {
+			return fmt.Errorf("%s: invalid geoip_fail_mode %q (expected open or closed)", r.Type, r.GeoIPFailMode)
+		}
+	}
+	if r.Type == "auth" {
+		switch strings.ToLower(r.AuthScheme) {
+		case "basic":
+			if r.Htpasswd == "" && len(r.Users) == 0 {
+				return fmt.Errorf("auth: basic scheme requires htpasswd or users")
+			}
+			if r.Htpasswd != "" {
+				if _, err := os.Stat(r.Htpasswd); err != nil {
+					return fmt.Errorf("auth: htpasswd: %w", err)
+				}
+			}
+			for user, hash := range r.Users {
+				if !strings.HasPrefix(hash, "$apr1$") && !strings.HasPrefix(hash, "{SHA}") {
+					return fmt.Errorf("auth: unsupported password hash for user %q (use htpasswd -m or -s)", user)
+				}
+			}
+		case "bearer":
+			if len(r.Tokens) == 0 {
+				return fmt.Errorf("auth: bearer scheme requires tokens")
+			}
+			for _, t := range r.Tokens {
+				if t == "" {
+					return fmt.Errorf("auth: empty bearer token")
+				}
+			}
+		default:
+			return fmt.Errorf("auth: invalid auth_scheme %q (expected basic or bearer)", r.AuthScheme)
+		}
+	}
+	if r.Type == "waf" {
+		if r.Ruleset != "" && r.Ruleset != "basic" {
+			return fmt.Errorf("waf: unknown ruleset %q (expected basic)", r.Ruleset)
+		}
+		validCategories := map[string]bool{"sqli": true, "xss": true, "traversal": true, "scanner": true}
+		for _, c := range r.Categories {
+			if !validCategories[strings.ToLower(c)] {
+				return fmt.Errorf("waf: unknown category %q (expected sqli, xss, traversal or scanner)", c)
+			}
+		}
+	}
+	if r.Type == "scanner_score" {
+		if r.MaxErrors < 0 {
+			return fmt.Errorf("scanner_score: max_errors must not be negative")
+		}
+		if r.Window != "" {
+			if d, err := time.ParseDuration(r.Window); err != nil || d <= 0 {
+				return fmt.Errorf("scanner_score: invalid window %q", r.Window)
+			}
+		}
+		for _, s := range r.Statuses {
+			s = strings.ToLower(strings.TrimSpace(s))
+			if len(s) == 3 && strings.HasSuffix(s, "xx") && s[0] >= '1' && s[0] <= '5' {
+				continue
+			}
+			if code, err := strconv.Atoi(s); err != nil || code < 100 || code > 599 {
+				return fmt.Errorf("scanner_score: invalid status %q (expected a code such as 404 or a class such as 4xx)", s)
+			}
+		}
+	}
+	if r.Type == "jwt" {
+		if r.JWTSecret != "" && r.JWTPublicKeyFile != "" {
+			return fmt.Errorf("jwt: jwt_secret and jwt_public_key_file cannot both be set")
+		}
+		if r.JWTPublicKeyFile != "" {
+			if _, err := os.Stat(r.JWTPublicKeyFile); err != nil {
+				return fmt.Errorf("jwt: jwt_public_key_file: %w", err)
+			}
+		}
+		for name, pattern := range r.JWTClaims {
+			if _, err := regexp.Compile(pattern); err != nil {
+				return fmt.Errorf("jwt: invalid regex pattern %q for claim %q: %w", pattern, name, err)
+			}
+		}
+		if r.MaxSkew != "" {
+			if d, err := time.ParseDuration(r.MaxSkew); err != nil || d < 0 {
+				return fmt.Errorf("jwt: invalid max_skew %q", r.MaxSkew)
+			}
+		}
+	}
+	if r.Type == "nonce" {
+		if r.NonceHeader == "" {
+			return fmt.Errorf("nonce: nonce_header is required")
+		}
+		for name, v := range map[string]string{"window": r.Window, "max_skew": r.MaxSkew} {
+			if v == "" {
+				continue
+			}
+			if d, err := time.ParseDuration(v); err != nil || d <= 0 {
+				return fmt.Errorf("nonce: invalid %s %q", name, v)
+			}
+		}
+	}
+	return nil
+}
+
+// MaxDecoyPadding bounds the padded size of decoy bodies, which are built
+// in memory for every response
+const MaxDecoyPadding = 10 << 20
+
 // Validate checks decoy configuration
 func (d *DecoyConfig) Validate() error {
+	for name, value := range d.Headers {
+		if err := ValidateHeaderNames([]string{name}); err != nil {
+			return fmt.Errorf("headers: %w", err)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("headers: invalid value for %s", name)
+		}
+	}
+
+	if d.PaddingMin < 0 || d.PaddingMax < 0 {
+		return fmt.Errorf("padding_min and padding_max must not be negative")
+	}
+	if d.PaddingMax > 0 && d.PaddingMax < d.PaddingMin {
+		return fmt.Errorf("padding_max must not be less than padding_min")
+	}
+	if d.PaddingMin > MaxDecoyPadding || d.PaddingMax > MaxDecoyPadding {
+		return fmt.Errorf("padding cannot exceed %d bytes", MaxDecoyPadding)
+	}
+	var jitter [2]time.Duration
+	for i, v := range []string{d.JitterMin, d.JitterMax} {
+		if v == "" {
+			continue
+		}
+		dur, err := time.ParseDuration(v)
+		if err != nil || dur < 0 {
+			return fmt.Errorf("invalid jitter duration: %s", v)
+		}
+		jitter[i] = dur
+	}
+	if d.JitterMax != "" && jitter[1] < jitter[0] {
+		return fmt.Errorf("jitter_max must not be less than jitter_min")
+	}
+
+	for i, t := range d.Targets {
+		if err := t.Validate(); err != nil {
+			return fmt.Errorf("targets[%d]: %w", i, err)
+		}
+	}
+
 	if d.Mode == "" {
 		return nil // decoy is optional
 	}
 
-	validModes := map[string]bool{"static": true, "redirect": true, "proxy": true}
+	validModes := map[string]bool{"static": true, "redirect": true, "proxy": true, "honeypot": true}
 	if !validModes[strings.ToLower(d.Mode)] {
 		return fmt.Errorf("invalid decoy mode: %s", d.Mode)
 	}
@@ -201,6 +921,91 @@ func (d *DecoyConfig) Validate() error {
 		return fmt.Errorf("redirect_to is required for redirect mode")
 	}
 
+	if d.Mode == "honeypot" {
+		u, err := url.Parse(d.HoneypotURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("honeypot mode requires an http or https honeypot_url")
+		}
+		if d.MarkerHeader != "" {
+			if err := ValidateHeaderNames([]string{d.MarkerHeader}); err != nil {
+				return fmt.Errorf("marker_header: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Validate checks a decoy target
+func (t *DecoyTargetConfig) Validate() error {
+	if len(t.Labels) == 0 {
+		return fmt.Errorf("at least one label is required")
+	}
+	if len(t.Decoys) == 0 {
+		return fmt.Errorf("at least one decoy is required")
+	}
+	for i, d := range t.Decoys {
+		if d.Weight < 0 {
+			return fmt.Errorf("decoys[%d]: weight cannot be negative", i)
+		}
+		if d.Mode == "" {
+			return fmt.Errorf("decoys[%d]: mode is required", i)
+		}
+		if len(d.Targets) > 0 {
+			return fmt.Errorf("decoys[%d]: targets cannot be nested", i)
+		}
+		if err := d.DecoyConfig.Validate(); err != nil {
+			return fmt.Errorf("decoys[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// Validate checks the backend header settings
+func (e *ExposeBackendHeaderConfig) Validate() error {
+	var names []string
+	if e.Header != "" {
+		names = append(names, e.Header)
+	}
+	if e.DebugHeader != "" {
+		names = append(names, e.DebugHeader)
+	}
+	if err := ValidateHeaderNames(names); err != nil {
+		return err
+	}
+	for _, cidr := range e.CIDRs {
+		if _, _, err := net.ParseCIDR(cidr); err != nil && net.ParseIP(cidr) == nil {
+			return fmt.Errorf("invalid CIDR or IP: %s", cidr)
+		}
+	}
+	return nil
+}
+
+// ValidateErrorPages checks error page status codes and sources
+func ValidateErrorPages(pages map[int]ErrorPageConfig) error {
+	for status, page := range pages {
+		if status < 400 || status > 599 {
+			return fmt.Errorf("error_pages: invalid status code %d (must be 400-599)", status)
+		}
+		if (page.Body == "") == (page.BodyFile == "") {
+			return fmt.Errorf("error_pages %d: exactly one of body or body_file is required", status)
+		}
+	}
+	return nil
+}
+
+// ValidateHeaderNames checks that names are valid HTTP header field names
+func ValidateHeaderNames(names []string) error {
+	for _, name := range names {
+		if name == "" {
+			return fmt.Errorf("empty header name")
+		}
+		for _, c := range name {
+			if c <= ' ' || c >= 0x7f || strings.ContainsRune(`"(),/:;<=>?@[\]{}`, c) {
+				return fmt.Errorf("invalid header name %q", name)
+			}
+		}
+	}
 	return nil
 }
 
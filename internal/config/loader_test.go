@@ -1,7 +1,11 @@
 package config
 
 import (
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestParseValidConfig(t *testing.T) {
@@ -187,3 +191,1127 @@ func TestBackendURLValidation(t *testing.T) {
 		})
 	}
 }
+
+func TestParseInvalidRulePattern(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules string
+		want  string
+	}{
+		{"ua pattern", `
+      deny:
+        or:
+          - type: ua_blacklist
+            patterns: ["(?i)nmap", "[invalid"]`, "rules: deny: or[0]: ua_blacklist patterns"},
+		{"path pattern", `
+      allow:
+        rule:
+          type: path_allow
+          paths: ["(unclosed"]`, "rules: allow: rule: path_allow paths"},
+		{"sni pattern", `
+      allow:
+        and:
+          - type: ip_allow
+            cidrs: ["10.0.0.0/8"]
+          - type: sni_allow
+            sni_patterns: ["*.example.com"]`, "rules: allow: and[1]: sni_allow sni_patterns"},
+		{"header pattern", `
+      deny:
+        not:
+          type: header_deny
+          header_name: X-Test
+          patterns: ["a{2,1}"]`, "rules: deny: not: header_deny patterns"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			yaml := `
+global:
+  log:
+    level: info
+profiles:
+  - id: test
+    listeners:
+      - addr: "0.0.0.0:8080"
+        protocol: http
+    backends:
+      - name: primary
+        url: http://127.0.0.1:9000
+    rules:` + tc.rules + "\n"
+			_, err := Parse([]byte(yaml))
+			if err == nil {
+				t.Fatal("expected error for invalid regex pattern")
+			}
+			if !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("expected error to contain %q, got %v", tc.want, err)
+			}
+		})
+	}
+}
+
+func TestProfileDenyActionValidation(t *testing.T) {
+	base := ProfileConfig{
+		ID:        "test",
+		Listeners: []ListenerConfig{{Addr: "0.0.0.0:8080", Protocol: "http"}},
+		Backends:  []BackendConfig{{Name: "primary", URL: "http://127.0.0.1:9000"}},
+	}
+
+	tests := []struct {
+		name        string
+		denyAction  string
+		blockStatus int
+		wantErr     bool
+	}{
+		{"default", "", 0, false},
+		{"decoy", "decoy", 0, false},
+		{"block", "block", 403, false},
+		{"tarpit", "tarpit", 0, false},
+		{"drop", "drop", 0, false},
+		{"unknown action", "reject", 0, true},
+		{"invalid status", "block", 999, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			p := base
+			p.DenyAction = tc.denyAction
+			p.BlockStatus = tc.blockStatus
+			err := p.Validate()
+			if tc.wantErr && err == nil {
+				t.Error("expected error")
+			}
+			if !tc.wantErr && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestProfileHeaderLimitsValidation(t *testing.T) {
+	p := ProfileConfig{
+		ID:                 "test",
+		Listeners:          []ListenerConfig{{Addr: "0.0.0.0:8080", Protocol: "http"}},
+		Backends:           []BackendConfig{{Name: "primary", URL: "http://127.0.0.1:9000"}},
+		MaxHeaders:         100,
+		MaxHeaderValueSize: 8192,
+	}
+	if err := p.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	p.MaxHeaders = -1
+	if err := p.Validate(); err == nil {
+		t.Error("expected error for negative max_headers")
+	}
+}
+
+func TestExposeBackendHeaderValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     ExposeBackendHeaderConfig
+		wantErr bool
+	}{
+		{"defaults", ExposeBackendHeaderConfig{Enabled: true}, false},
+		{"custom", ExposeBackendHeaderConfig{Enabled: true, Header: "X-Upstream", CIDRs: []string{"10.0.0.0/8", "192.0.2.1"}, DebugHeader: "X-Debug"}, false},
+		{"invalid header", ExposeBackendHeaderConfig{Enabled: true, Header: "X Backend"}, true},
+		{"invalid cidr", ExposeBackendHeaderConfig{Enabled: true, CIDRs: []string{"10.0.0.0/33"}}, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.cfg.Validate()
+			if tc.wantErr && err == nil {
+				t.Error("expected error")
+			}
+			if !tc.wantErr && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestProfileDropValidation(t *testing.T) {
+	base := ProfileConfig{
+		ID:         "test",
+		Listeners:  []ListenerConfig{{Addr: "0.0.0.0:8080", Protocol: "http"}},
+		Backends:   []BackendConfig{{Name: "primary", URL: "http://127.0.0.1:9000"}},
+		DenyAction: "drop",
+	}
+
+	tests := []struct {
+		name     string
+		dropMode string
+		dropHold string
+		wantErr  bool
+	}{
+		{"default", "", "", false},
+		{"close", "close", "", false},
+		{"hold", "hold", "30s", false},
+		{"reset", "reset", "", false},
+		{"unknown mode", "tarpit", "", true},
+		{"invalid hold", "hold", "soon", true},
+		{"zero hold", "hold", "0s", true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			p := base
+			p.DropMode = tc.dropMode
+			p.DropHold = tc.dropHold
+			err := p.Validate()
+			if tc.wantErr && err == nil {
+				t.Error("expected error")
+			}
+			if !tc.wantErr && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestParseSharedSNIListeners(t *testing.T) {
+	profile := func(id, protocol, hosts string) string {
+		return `
+  - id: ` + id + `
+    listeners:
+      - addr: "0.0.0.0:443"
+        protocol: ` + protocol + `
+        tls:
+          cert_file: /tmp/` + id + `.crt
+          key_file: /tmp/` + id + `.key
+        sni_hosts: [` + hosts + `]
+    backends:
+      - name: primary
+        url: http://127.0.0.1:9000`
+	}
+
+	tests := []struct {
+		name     string
+		profiles string
+		wantErr  bool
+	}{
+		{"distinct hosts", profile("api", "https", "api.example.com") + profile("admin", "https", "admin.example.com"), false},
+		{"one default", profile("api", "https", "api.example.com") + profile("web", "https", ""), false},
+		{"duplicate host", profile("api", "https", "api.example.com") + profile("admin", "https", "API.example.com"), true},
+		{"two defaults", profile("api", "https", "") + profile("web", "https", ""), true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Parse([]byte("profiles:" + tc.profiles + "\n"))
+			if tc.wantErr && err == nil {
+				t.Error("expected error")
+			}
+			if !tc.wantErr && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestSNIHostsRequireHTTPS(t *testing.T) {
+	l := ListenerConfig{Addr: "0.0.0.0:80", Protocol: "http", SNIHosts: []string{"api.example.com"}}
+	if err := l.Validate(); err == nil {
+		t.Error("expected error for sni_hosts on plain HTTP listener")
+	}
+}
+
+func TestGlobalXFFModeValidation(t *testing.T) {
+	for mode, wantErr := range map[string]bool{"": false, "append": false, "overwrite": false, "remove": false, "replace": true} {
+		g := GlobalConfig{XFFMode: mode}
+		err := g.Validate()
+		if wantErr && err == nil {
+			t.Errorf("xff_mode %q: expected error", mode)
+		}
+		if !wantErr && err != nil {
+			t.Errorf("xff_mode %q: unexpected error: %v", mode, err)
+		}
+	}
+}
+
+func TestGlobalXFFTrustedHopsValidation(t *testing.T) {
+	g := GlobalConfig{XFFTrustedHops: true}
+	if err := g.Validate(); err == nil {
+		t.Error("expected error for xff_trusted_hops without trusted_proxies")
+	}
+
+	g.TrustedProxies = []string{"10.0.0.0/8"}
+	if err := g.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestGlobalTrustedProxyCountValidation(t *testing.T) {
+	g := GlobalConfig{TrustedProxyCount: 2}
+	if err := g.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	g.TrustedProxyCount = -1
+	if err := g.Validate(); err == nil {
+		t.Error("expected error for negative trusted_proxy_count")
+	}
+
+	g = GlobalConfig{TrustedProxyCount: 1, XFFTrustedHops: true, TrustedProxies: []string{"10.0.0.0/8"}}
+	if err := g.Validate(); err == nil {
+		t.Error("expected error for trusted_proxy_count combined with xff_trusted_hops")
+	}
+}
+
+func TestGlobalRuleTimingSampleRateValidation(t *testing.T) {
+	for rate, wantErr := range map[float64]bool{0: false, 0.05: false, 1: false, -0.1: true, 1.5: true} {
+		g := GlobalConfig{RuleTimingSampleRate: rate}
+		err := g.Validate()
+		if wantErr && err == nil {
+			t.Errorf("rule_timing_sample_rate %v: expected error", rate)
+		}
+		if !wantErr && err != nil {
+			t.Errorf("rule_timing_sample_rate %v: unexpected error: %v", rate, err)
+		}
+	}
+}
+
+func TestGlobalRateLimitStoreValidation(t *testing.T) {
+	valid := []RateLimitStoreConfig{
+		{},
+		{Type: "memory"},
+		{Type: "redis", Redis: RedisConfig{Addr: "10.0.0.5:6379", DB: 1, Timeout: "200ms"}},
+	}
+	for _, s := range valid {
+		g := GlobalConfig{RateLimitStore: s}
+		if err := g.Validate(); err != nil {
+			t.Errorf("unexpected error for %+v: %v", s, err)
+		}
+	}
+
+	invalid := []RateLimitStoreConfig{
+		{Type: "memcached"},
+		{Type: "redis"},
+		{Type: "redis", Redis: RedisConfig{Addr: "10.0.0.5"}},
+		{Type: "redis", Redis: RedisConfig{Addr: "10.0.0.5:6379", DB: -1}},
+		{Type: "redis", Redis: RedisConfig{Addr: "10.0.0.5:6379", Timeout: "fast"}},
+	}
+	for _, s := range invalid {
+		g := GlobalConfig{RateLimitStore: s}
+		if err := g.Validate(); err == nil {
+			t.Errorf("expected error for %+v", s)
+		}
+	}
+}
+
+func TestListenerUnixSocketValidation(t *testing.T) {
+	tests := []struct {
+		name     string
+		listener ListenerConfig
+		wantErr  bool
+	}{
+		{"unix http", ListenerConfig{Addr: "unix:/run/shadowgate.sock", Protocol: "http", SocketMode: "0660"}, false},
+		{"empty path", ListenerConfig{Addr: "unix:", Protocol: "http"}, true},
+		{"unix tcp", ListenerConfig{Addr: "unix:/run/shadowgate.sock", Protocol: "tcp"}, true},
+		{"bad mode", ListenerConfig{Addr: "unix:/run/shadowgate.sock", Protocol: "http", SocketMode: "rw-rw----"}, true},
+		{"mode on tcp address", ListenerConfig{Addr: "0.0.0.0:8080", Protocol: "http", SocketMode: "0660"}, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.listener.Validate()
+			if tc.wantErr && err == nil {
+				t.Error("expected error")
+			}
+			if !tc.wantErr && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestNonceRuleValidation(t *testing.T) {
+	valid := Rule{Type: "nonce", NonceHeader: "X-Nonce", Window: "5m", MaxSkew: "30s"}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	missing := Rule{Type: "nonce"}
+	if err := missing.Validate(); err == nil {
+		t.Error("expected error for missing nonce_header")
+	}
+
+	badSkew := Rule{Type: "nonce", NonceHeader: "X-Nonce", MaxSkew: "soon"}
+	if err := badSkew.Validate(); err == nil {
+		t.Error("expected error for invalid max_skew")
+	}
+}
+
+func TestRateLimitKeySourceValidation(t *testing.T) {
+	for _, ks := range []string{"", "ip", "header:X-API-Key", "cookie:session"} {
+		r := Rule{Type: "rate_limit", KeySource: ks}
+		if err := r.Validate(); err != nil {
+			t.Errorf("unexpected error for %q: %v", ks, err)
+		}
+	}
+	for _, ks := range []string{"header:", "query:token", "session"} {
+		r := Rule{Type: "rate_limit", KeySource: ks}
+		if err := r.Validate(); err == nil {
+			t.Errorf("expected error for key_source %q", ks)
+		}
+	}
+}
+
+func TestASNRateLimitValidation(t *testing.T) {
+	r := Rule{Type: "asn_rate_limit", MaxRequests: 300, ASNLimits: map[uint]int{16509: 20, 14061: 20}}
+	if err := r.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	invalid := []Rule{
+		{Type: "asn_rate_limit", MaxRequests: 300},
+		{Type: "asn_rate_limit", ASNLimits: map[uint]int{16509: 0}},
+		{Type: "asn_rate_limit", ASNLimits: map[uint]int{16509: 20}, KeySource: "session"},
+	}
+	for _, r := range invalid {
+		if err := r.Validate(); err == nil {
+			t.Errorf("expected error for %+v", r)
+		}
+	}
+}
+
+func TestParseASNRateLimit(t *testing.T) {
+	yaml := `
+profiles:
+  - id: test
+    listeners:
+      - addr: "0.0.0.0:8080"
+        protocol: http
+    backends:
+      - name: primary
+        url: http://127.0.0.1:9000
+    rules:
+      deny:
+        not:
+          type: asn_rate_limit
+          max_requests: 300
+          asn_limits:
+            16509: 20
+            14061: 30
+`
+	cfg, err := Parse([]byte(yaml))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	limits := cfg.Profiles[0].Rules.Deny.Not.ASNLimits
+	if limits[16509] != 20 || limits[14061] != 30 {
+		t.Errorf("unexpected asn_limits: %v", limits)
+	}
+}
+
+func TestWAFRuleValidation(t *testing.T) {
+	valid := []Rule{
+		{Type: "waf"},
+		{Type: "waf", Ruleset: "basic", Categories: []string{"sqli", "XSS"}},
+	}
+	for _, r := range valid {
+		if err := r.Validate(); err != nil {
+			t.Errorf("unexpected error for %+v: %v", r, err)
+		}
+	}
+
+	invalid := []Rule{
+		{Type: "waf", Ruleset: "owasp"},
+		{Type: "waf", Categories: []string{"rce"}},
+	}
+	for _, r := range invalid {
+		if err := r.Validate(); err == nil {
+			t.Errorf("expected error for %+v", r)
+		}
+	}
+}
+
+func TestAuthRuleValidation(t *testing.T) {
+	htpasswd := filepath.Join(t.TempDir(), "htpasswd")
+	os.WriteFile(htpasswd, []byte("alice:{SHA}87u9ZqY9S/F0eUBXjsPQEDUw4h0=\n"), 0600)
+
+	valid := []Rule{
+		{Type: "auth", AuthScheme: "basic", Htpasswd: htpasswd},
+		{Type: "auth", AuthScheme: "basic", Users: map[string]string{"bob": "$apr1$ab$S8K6Sgp3W8c9Jb6LxgywZ."}},
+		{Type: "auth", AuthScheme: "bearer", Tokens: []string{"secret-token"}},
+	}
+	for _, r := range valid {
+		if err := r.Validate(); err != nil {
+			t.Errorf("unexpected error for %+v: %v", r, err)
+		}
+	}
+
+	invalid := []Rule{
+		{Type: "auth", Tokens: []string{"secret-token"}},
+		{Type: "auth", AuthScheme: "basic"},
+		{Type: "auth", AuthScheme: "basic", Htpasswd: filepath.Join(t.TempDir(), "missing")},
+		{Type: "auth", AuthScheme: "basic", Users: map[string]string{"bob": "plaintext"}},
+		{Type: "auth", AuthScheme: "bearer"},
+	}
+	for _, r := range invalid {
+		if err := r.Validate(); err == nil {
+			t.Errorf("expected error for %+v", r)
+		}
+	}
+}
+
+func TestListenerTLSSessionValidation(t *testing.T) {
+	keys := filepath.Join(t.TempDir(), "ticket.keys")
+	os.WriteFile(keys, []byte(strings.Repeat("ab", 32)+"\n"), 0600)
+	listener := func(tc TLSConfig) ListenerConfig {
+		tc.CertFile, tc.KeyFile = "server.crt", "server.key"
+		return ListenerConfig{Addr: "127.0.0.1:443", Protocol: "https", TLS: tc}
+	}
+
+	valid := []TLSConfig{
+		{SessionTicketKeyFile: keys},
+		{SessionCacheSize: 1000},
+		{DisableSessionTickets: true},
+	}
+	for _, tc := range valid {
+		l := listener(tc)
+		if err := l.Validate(); err != nil {
+			t.Errorf("unexpected error for %+v: %v", tc, err)
+		}
+	}
+
+	invalid := []TLSConfig{
+		{SessionTicketKeyFile: keys, SessionCacheSize: 1000},
+		{SessionCacheSize: -1},
+		{DisableSessionTickets: true, SessionCacheSize: 1000},
+		{SessionTicketKeyFile: filepath.Join(t.TempDir(), "missing")},
+		{OCSPStapleFile: filepath.Join(t.TempDir(), "missing")},
+	}
+	for _, tc := range invalid {
+		l := listener(tc)
+		if err := l.Validate(); err == nil {
+			t.Errorf("expected error for %+v", tc)
+		}
+	}
+}
+
+func TestHeaderSetRuleValidation(t *testing.T) {
+	valid := Rule{Type: "header_set", HeaderSetMode: "require_all", HeaderNames: []string{"Accept", "Accept-Language"}}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	invalid := []Rule{
+		{Type: "header_set", HeaderNames: []string{"Accept"}},
+		{Type: "header_set", HeaderSetMode: "require_none", HeaderNames: []string{"Accept"}},
+		{Type: "header_set", HeaderSetMode: "require_any"},
+		{Type: "header_set", HeaderSetMode: "require_any", HeaderNames: []string{"Accept", " "}},
+	}
+	for _, r := range invalid {
+		if err := r.Validate(); err == nil {
+			t.Errorf("expected error for %+v", r)
+		}
+	}
+}
+
+func TestJWTRuleValidation(t *testing.T) {
+	key := filepath.Join(t.TempDir(), "jwt.pem")
+	os.WriteFile(key, []byte("-----BEGIN PUBLIC KEY-----\n"), 0600)
+
+	valid := []Rule{
+		{Type: "jwt", JWTIssuers: []string{"issuer"}},
+		{Type: "jwt", JWTSecret: "secret", JWTClaims: map[string]string{"scope": "read"}, MaxSkew: "30s"},
+		{Type: "jwt", JWTPublicKeyFile: key},
+	}
+	for _, r := range valid {
+		if err := r.Validate(); err != nil {
+			t.Errorf("unexpected error for %+v: %v", r, err)
+		}
+	}
+
+	invalid := []Rule{
+		{Type: "jwt", JWTSecret: "secret", JWTPublicKeyFile: key},
+		{Type: "jwt", JWTPublicKeyFile: filepath.Join(t.TempDir(), "missing")},
+		{Type: "jwt", JWTClaims: map[string]string{"scope": "("}},
+		{Type: "jwt", MaxSkew: "soon"},
+	}
+	for _, r := range invalid {
+		if err := r.Validate(); err == nil {
+			t.Errorf("expected error for %+v", r)
+		}
+	}
+}
+
+func TestQueryRuleValidation(t *testing.T) {
+	valid := Rule{Type: "query_deny", QueryParam: "debug", QueryValues: []string{"true"}}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	invalid := []Rule{
+		{Type: "query_allow", Patterns: []string{"^v1$"}},
+		{Type: "query_deny", QueryParam: "debug", Patterns: []string{"("}},
+	}
+	for _, r := range invalid {
+		if err := r.Validate(); err == nil {
+			t.Errorf("expected error for %+v", r)
+		}
+	}
+}
+
+func TestCookieRuleValidation(t *testing.T) {
+	valid := Rule{Type: "cookie_allow", CookieName: "session", RequireCookie: true}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	invalid := []Rule{
+		{Type: "cookie_deny", Patterns: []string{"^1$"}},
+		{Type: "cookie_allow", CookieName: "session", Patterns: []string{"("}},
+	}
+	for _, r := range invalid {
+		if err := r.Validate(); err == nil {
+			t.Errorf("expected error for %+v", r)
+		}
+	}
+}
+
+func TestALPNRuleValidation(t *testing.T) {
+	valid := Rule{Type: "alpn_allow", ALPNProtocols: []string{"h2"}}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	invalid := []Rule{
+		{Type: "alpn_deny"},
+		{Type: "alpn_allow", ALPNProtocols: []string{"h2", ""}},
+	}
+	for _, r := range invalid {
+		if err := r.Validate(); err == nil {
+			t.Errorf("expected error for %+v", r)
+		}
+	}
+}
+
+func TestBackendConnPoolValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(b *BackendConfig)
+		wantErr bool
+	}{
+		{"defaults", func(b *BackendConfig) {}, false},
+		{"custom pool", func(b *BackendConfig) {
+			b.MaxIdleConns = 50
+			b.MaxIdleConnsPerHost = 10
+			b.IdleConnTimeout = "30s"
+			b.ShareTransport = true
+		}, false},
+		{"negative max_idle_conns", func(b *BackendConfig) { b.MaxIdleConns = -1 }, true},
+		{"negative max_idle_conns_per_host", func(b *BackendConfig) { b.MaxIdleConnsPerHost = -1 }, true},
+		{"invalid idle_conn_timeout", func(b *BackendConfig) { b.IdleConnTimeout = "soon" }, true},
+		{"zero idle_conn_timeout", func(b *BackendConfig) { b.IdleConnTimeout = "0s" }, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			b := BackendConfig{Name: "test", URL: "http://127.0.0.1:9000", Weight: 1}
+			tc.modify(&b)
+			err := b.Validate()
+			if (err != nil) != tc.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestScannerScoreRuleValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    Rule
+		wantErr bool
+	}{
+		{"defaults", Rule{Type: "scanner_score"}, false},
+		{"custom", Rule{Type: "scanner_score", MaxErrors: 30, Window: "5m", Statuses: []string{"404", "4xx"}}, false},
+		{"negative max_errors", Rule{Type: "scanner_score", MaxErrors: -1}, true},
+		{"invalid window", Rule{Type: "scanner_score", Window: "often"}, true},
+		{"invalid status", Rule{Type: "scanner_score", Statuses: []string{"4x"}}, true},
+		{"status out of range", Rule{Type: "scanner_score", Statuses: []string{"600"}}, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.rule.Validate()
+			if (err != nil) != tc.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestGeoIPValidation(t *testing.T) {
+	required := GlobalConfig{GeoIPRequired: true}
+	if err := required.Validate(); err == nil {
+		t.Error("expected error for geoip_required without geoip_db_path")
+	}
+	required.GeoIPDBPath = "/var/lib/GeoIP/GeoLite2-City.mmdb"
+	if err := required.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	valid := Rule{Type: "geo_allow", Countries: []string{"US"}, GeoIPFailMode: "closed"}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	for _, r := range []Rule{
+		{Type: "geo_deny", Countries: []string{"RU"}, GeoIPFailMode: "maybe"},
+		{Type: "ip_allow", CIDRs: []string{"10.0.0.0/8"}, GeoIPFailMode: "open"},
+	} {
+		if err := r.Validate(); err == nil {
+			t.Errorf("expected error for %+v", r)
+		}
+	}
+}
+
+func TestClientIPHeadersValidation(t *testing.T) {
+	valid := GlobalConfig{ClientIPHeaders: []string{"CF-Connecting-IP", "X-Forwarded-For"}}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	for _, headers := range [][]string{{""}, {"CF Connecting IP"}, {"X-Client-IP:"}} {
+		g := GlobalConfig{ClientIPHeaders: headers}
+		if err := g.Validate(); err == nil {
+			t.Errorf("expected error for client_ip_headers %q", headers)
+		}
+	}
+
+	p := ProfileConfig{
+		ID:              "test",
+		Listeners:       []ListenerConfig{{Addr: "0.0.0.0:8080", Protocol: "http"}},
+		Backends:        []BackendConfig{{Name: "primary", URL: "http://127.0.0.1:9000"}},
+		ClientIPHeaders: []string{"True Client IP"},
+	}
+	if err := p.Validate(); err == nil {
+		t.Error("expected error for invalid profile client_ip_headers")
+	}
+}
+
+func TestProfileRetryValidation(t *testing.T) {
+	base := ProfileConfig{
+		ID:        "test",
+		Listeners: []ListenerConfig{{Addr: "0.0.0.0:8080", Protocol: "http"}},
+		Backends:  []BackendConfig{{Name: "primary", URL: "http://127.0.0.1:9000"}},
+	}
+
+	valid := base
+	valid.MaxRetries = 2
+	valid.RetryBackoff = "100ms"
+	if err := valid.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	negative := base
+	negative.MaxRetries = -1
+	if err := negative.Validate(); err == nil {
+		t.Error("expected error for negative max_retries")
+	}
+
+	badBackoff := base
+	badBackoff.RetryBackoff = "later"
+	if err := badBackoff.Validate(); err == nil {
+		t.Error("expected error for invalid retry_backoff")
+	}
+}
+
+func TestBackendTLSValidation(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	if err := os.WriteFile(certFile, []byte("x"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		url     string
+		tls     *BackendTLSConfig
+		wantErr bool
+	}{
+		{"ca file", "https://10.0.0.1", &BackendTLSConfig{CAFile: certFile, ServerName: "internal"}, false},
+		{"client cert", "https://10.0.0.1", &BackendTLSConfig{CertFile: certFile, KeyFile: certFile}, false},
+		{"skip verify", "https://10.0.0.1", &BackendTLSConfig{InsecureSkipVerify: true}, false},
+		{"http backend", "http://10.0.0.1", &BackendTLSConfig{InsecureSkipVerify: true}, true},
+		{"cert without key", "https://10.0.0.1", &BackendTLSConfig{CertFile: certFile}, true},
+		{"missing ca file", "https://10.0.0.1", &BackendTLSConfig{CAFile: filepath.Join(dir, "missing.pem")}, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			b := BackendConfig{Name: "test", URL: tc.url, Weight: 1, TLS: tc.tls}
+			err := b.Validate()
+			if (err != nil) != tc.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestProfileBackendQueueValidation(t *testing.T) {
+	base := ProfileConfig{
+		ID:        "test",
+		Listeners: []ListenerConfig{{Addr: "0.0.0.0:8080", Protocol: "http"}},
+		Backends:  []BackendConfig{{Name: "primary", URL: "http://127.0.0.1:9000"}},
+	}
+
+	valid := base
+	valid.BackendQueue = BackendQueueConfig{Enabled: true, MaxWait: "500ms", QueueSize: 50}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	for _, bq := range []BackendQueueConfig{
+		{Enabled: true, MaxWait: "soon"},
+		{Enabled: true, MaxWait: "0s"},
+		{Enabled: true, QueueSize: -1},
+	} {
+		invalid := base
+		invalid.BackendQueue = bq
+		if err := invalid.Validate(); err == nil {
+			t.Errorf("expected error for %+v", bq)
+		}
+	}
+}
+
+func TestProfileLoadBalancingValidation(t *testing.T) {
+	p := ProfileConfig{
+		ID:        "test",
+		Listeners: []ListenerConfig{{Addr: "0.0.0.0:8080", Protocol: "http"}},
+		Backends: []BackendConfig{
+			{Name: "primary", URL: "http://127.0.0.1:9000", Priority: 10},
+			{Name: "standby", URL: "http://127.0.0.1:9001"},
+		},
+		LoadBalancing: "failover",
+	}
+	if err := p.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	p.LoadBalancing = "random"
+	if err := p.Validate(); err == nil {
+		t.Error("expected error for invalid load_balancing")
+	}
+}
+
+func TestProfileAdaptiveWeightValidation(t *testing.T) {
+	p := ProfileConfig{
+		ID:             "test",
+		Listeners:      []ListenerConfig{{Addr: "0.0.0.0:8080", Protocol: "http"}},
+		Backends:       []BackendConfig{{Name: "b1", URL: "http://127.0.0.1:9000"}},
+		LoadBalancing:  "weighted",
+		AdaptiveWeight: AdaptiveWeightConfig{Enabled: true, ErrorThreshold: 0.1, MinFactor: 0.2},
+	}
+	if err := p.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	p.AdaptiveWeight.ErrorThreshold = 0.5
+	if err := p.Validate(); err == nil {
+		t.Error("expected error for error_threshold of 0.5")
+	}
+	p.AdaptiveWeight.ErrorThreshold = 0.1
+
+	p.AdaptiveWeight.MinFactor = 1.5
+	if err := p.Validate(); err == nil {
+		t.Error("expected error for min_factor above 1")
+	}
+	p.AdaptiveWeight.MinFactor = 0.2
+
+	p.LoadBalancing = "round_robin"
+	if err := p.Validate(); err == nil {
+		t.Error("expected error for adaptive_weight without weighted load balancing")
+	}
+}
+
+func TestListenerProxyProtocolValidation(t *testing.T) {
+	l := ListenerConfig{Addr: "0.0.0.0:8080", Protocol: "http", ProxyProtocol: true}
+	if err := l.Validate(); err == nil {
+		t.Error("expected error for proxy_protocol without trusted CIDRs")
+	}
+
+	l.ProxyProtocolTrusted = []string{"10.0.0.0/8", "192.0.2.10"}
+	if err := l.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	l.ProxyProtocolTrusted = []string{"not-an-ip"}
+	if err := l.Validate(); err == nil {
+		t.Error("expected error for invalid proxy_protocol_trusted entry")
+	}
+
+	unix := ListenerConfig{Addr: "unix:/run/shadowgate.sock", Protocol: "http", ProxyProtocol: true}
+	if err := unix.Validate(); err != nil {
+		t.Errorf("unix socket listeners should not need trusted CIDRs: %v", err)
+	}
+}
+
+func TestListenerTimeoutValidation(t *testing.T) {
+	l := ListenerConfig{
+		Addr:              "0.0.0.0:8080",
+		Protocol:          "http",
+		ReadTimeout:       "5m",
+		WriteTimeout:      "10m",
+		IdleTimeout:       "60s",
+		ReadHeaderTimeout: "2s",
+	}
+	if err := l.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if read, write, idle, header := l.Timeouts(); read != 5*time.Minute || write != 10*time.Minute || idle != time.Minute || header != 2*time.Second {
+		t.Errorf("unexpected timeouts: %v %v %v %v", read, write, idle, header)
+	}
+
+	for _, bad := range []ListenerConfig{
+		{Addr: "0.0.0.0:8080", Protocol: "http", ReadTimeout: "soon"},
+		{Addr: "0.0.0.0:8080", Protocol: "http", WriteTimeout: "0s"},
+		{Addr: "0.0.0.0:8080", Protocol: "http", IdleTimeout: "-1s"},
+		{Addr: "0.0.0.0:8080", Protocol: "http", ReadHeaderTimeout: "10"},
+	} {
+		if err := bad.Validate(); err == nil {
+			t.Errorf("expected error for %+v", bad)
+		}
+	}
+}
+
+func TestListenerAddrsValidation(t *testing.T) {
+	cfg, err := Parse([]byte(`
+profiles:
+  - id: dual-stack
+    listeners:
+      - addrs: ["0.0.0.0:8080", "[::]:8080", "0.0.0.0:8081"]
+        protocol: http
+    backends:
+      - name: primary
+        url: http://127.0.0.1:9000
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expanded := cfg.Profiles[0].ExpandListeners()
+	if len(expanded) != 3 || expanded[1].Addr != "[::]:8080" || expanded[1].Protocol != "http" || expanded[1].Addrs != nil {
+		t.Errorf("expected one listener per address, got %+v", expanded)
+	}
+
+	for _, bad := range []ListenerConfig{
+		{Addr: "0.0.0.0:8080", Addrs: []string{"0.0.0.0:8081"}, Protocol: "http"},
+		{Addrs: []string{"0.0.0.0:8080", "0.0.0.0:8080"}, Protocol: "http"},
+		{Addrs: []string{"0.0.0.0:8080", "invalid"}, Protocol: "http"},
+		{Addrs: []string{"0.0.0.0:8080", ""}, Protocol: "http"},
+	} {
+		if err := bad.Validate(); err == nil {
+			t.Errorf("expected error for %+v", bad)
+		}
+	}
+}
+
+func TestProfileLearningValidation(t *testing.T) {
+	p := ProfileConfig{
+		ID:        "test",
+		Listeners: []ListenerConfig{{Addr: "0.0.0.0:8080", Protocol: "http"}},
+		Backends:  []BackendConfig{{Name: "primary", URL: "http://127.0.0.1:9000"}},
+		Learning:  LearningConfig{Enabled: true, MaxEntries: 500},
+	}
+	if err := p.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	p.Learning.MaxEntries = -1
+	if err := p.Validate(); err == nil {
+		t.Error("expected error for negative learning max_entries")
+	}
+}
+
+func TestProfileBypassTokenLength(t *testing.T) {
+	p := ProfileConfig{
+		ID:          "test",
+		Listeners:   []ListenerConfig{{Addr: "0.0.0.0:8080", Protocol: "http"}},
+		Backends:    []BackendConfig{{Name: "primary", URL: "http://127.0.0.1:9000"}},
+		BypassToken: "short",
+	}
+	if err := p.Validate(); err == nil {
+		t.Error("expected error for short bypass_token")
+	}
+
+	p.BypassToken = strings.Repeat("x", MinBypassTokenLength)
+	if err := p.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestLoadDir(t *testing.T) {
+	profile := func(id, addr string) string {
+		return `
+profiles:
+  - id: ` + id + `
+    listeners:
+      - addr: "` + addr + `"
+        protocol: http
+    backends:
+      - name: primary
+        url: http://127.0.0.1:9000
+`
+	}
+	write := func(dir, name, data string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dir := t.TempDir()
+	write(dir, "00-base.yaml", "global:\n  log:\n    level: debug\n")
+	write(dir, "team-b.yaml", profile("b", "0.0.0.0:8082"))
+	write(dir, "team-a.yml", profile("a", "0.0.0.0:8081"))
+	write(dir, "README.md", "not config")
+	write(dir, ".hidden.yaml", "{{{")
+
+	cfg, err := LoadDir(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Global.Log.Level != "debug" {
+		t.Errorf("expected global section from base file, got %q", cfg.Global.Log.Level)
+	}
+	if len(cfg.Profiles) != 2 || cfg.Profiles[0].ID != "a" || cfg.Profiles[1].ID != "b" {
+		t.Errorf("expected profiles a, b in file order, got %+v", cfg.Profiles)
+	}
+
+	if cfg, err := LoadPath(dir); err != nil || len(cfg.Profiles) != 2 {
+		t.Errorf("expected LoadPath to load the directory, got %v", err)
+	}
+
+	// Duplicate IDs across files name both files
+	write(dir, "team-c.yaml", profile("a", "0.0.0.0:8083"))
+	_, err = LoadDir(dir)
+	if err == nil || !strings.Contains(err.Error(), "team-a.yml") || !strings.Contains(err.Error(), "team-c.yaml") {
+		t.Errorf("expected duplicate profile error naming both files, got %v", err)
+	}
+	os.Remove(filepath.Join(dir, "team-c.yaml"))
+
+	// Only one file may define the global section
+	write(dir, "zz-global.yaml", "global:\n  log:\n    level: info\n")
+	if _, err := LoadDir(dir); err == nil {
+		t.Error("expected error for multiple global sections")
+	}
+	os.Remove(filepath.Join(dir, "zz-global.yaml"))
+
+	// The merged result is validated (shared plain HTTP address)
+	write(dir, "team-d.yaml", profile("d", "0.0.0.0:8081"))
+	if _, err := LoadDir(dir); err == nil {
+		t.Error("expected merged config validation error")
+	}
+
+	if _, err := LoadDir(t.TempDir()); err == nil {
+		t.Error("expected error for directory without yaml files")
+	}
+}
+
+func TestDecoyHeadersValidation(t *testing.T) {
+	valid := DecoyConfig{
+		Mode:        "static",
+		ContentType: "text/html",
+		Headers:     map[string]string{"Server": "nginx", "X-Powered-By": "PHP/8.2"},
+	}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	for _, headers := range []map[string]string{
+		{"Bad Header": "x"},
+		{"Server": "nginx\r\nSet-Cookie: x=y"},
+	} {
+		d := DecoyConfig{Headers: headers}
+		if err := d.Validate(); err == nil {
+			t.Errorf("expected error for headers %q", headers)
+		}
+	}
+}
+
+func TestDecoyHoneypotValidation(t *testing.T) {
+	valid := DecoyConfig{Mode: "honeypot", HoneypotURL: "http://10.0.5.10:8080", MarkerHeader: "X-Deception"}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	for _, d := range []DecoyConfig{
+		{Mode: "honeypot"},
+		{Mode: "honeypot", HoneypotURL: "10.0.5.10:8080"},
+		{Mode: "honeypot", HoneypotURL: "http://10.0.5.10", MarkerHeader: "Bad Header"},
+	} {
+		if err := d.Validate(); err == nil {
+			t.Errorf("expected error for %+v", d)
+		}
+	}
+}
+
+func TestDecoyPaddingJitterValidation(t *testing.T) {
+	for _, d := range []DecoyConfig{
+		{Mode: "static", PaddingMin: 2048, PaddingMax: 8192, JitterMin: "20ms", JitterMax: "150ms"},
+		{Mode: "static", PaddingMin: 4096, JitterMin: "50ms"},
+	} {
+		if err := d.Validate(); err != nil {
+			t.Errorf("unexpected error for %+v: %v", d, err)
+		}
+	}
+
+	for _, d := range []DecoyConfig{
+		{Mode: "static", PaddingMin: -1},
+		{Mode: "static", PaddingMin: 8192, PaddingMax: 2048},
+		{Mode: "static", PaddingMax: MaxDecoyPadding + 1},
+		{Mode: "static", JitterMin: "soon"},
+		{Mode: "static", JitterMin: "-5ms"},
+		{Mode: "static", JitterMin: "150ms", JitterMax: "20ms"},
+	} {
+		if err := d.Validate(); err == nil {
+			t.Errorf("expected error for %+v", d)
+		}
+	}
+}
+
+func TestDecoyTargetsValidation(t *testing.T) {
+	static := func(weight int) WeightedDecoyConfig {
+		return WeightedDecoyConfig{Weight: weight, DecoyConfig: DecoyConfig{Mode: "static", Body: "ok"}}
+	}
+
+	valid := DecoyConfig{Mode: "static", Targets: []DecoyTargetConfig{
+		{Labels: []string{"scanner"}, Decoys: []WeightedDecoyConfig{static(3), static(0)}},
+	}}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	nested := static(1)
+	nested.Targets = valid.Targets
+	for _, target := range []DecoyTargetConfig{
+		{Decoys: []WeightedDecoyConfig{static(1)}},
+		{Labels: []string{"waf"}},
+		{Labels: []string{"waf"}, Decoys: []WeightedDecoyConfig{static(-1)}},
+		{Labels: []string{"waf"}, Decoys: []WeightedDecoyConfig{{DecoyConfig: DecoyConfig{Body: "ok"}}}},
+		{Labels: []string{"waf"}, Decoys: []WeightedDecoyConfig{{DecoyConfig: DecoyConfig{Mode: "redirect"}}}},
+		{Labels: []string{"waf"}, Decoys: []WeightedDecoyConfig{nested}},
+	} {
+		d := DecoyConfig{Targets: []DecoyTargetConfig{target}}
+		if err := d.Validate(); err == nil {
+			t.Errorf("expected error for %+v", target)
+		}
+	}
+}
+
+func TestValidateErrorPages(t *testing.T) {
+	valid := map[int]ErrorPageConfig{502: {Body: "down"}, 504: {BodyFile: "/etc/shadowgate/504.html"}}
+	if err := ValidateErrorPages(valid); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	invalid := []map[int]ErrorPageConfig{
+		{200: {Body: "ok"}},
+		{502: {}},
+		{502: {Body: "down", BodyFile: "/etc/shadowgate/502.html"}},
+	}
+	for _, pages := range invalid {
+		if err := ValidateErrorPages(pages); err == nil {
+			t.Errorf("expected error for %+v", pages)
+		}
+	}
+}
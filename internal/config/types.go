@@ -4,25 +4,84 @@ import "time"
 
 // Config is the root configuration structure
 type Config struct {
-	Global   GlobalConfig   `yaml:"global"`
+	Global   GlobalConfig    `yaml:"global"`
 	Profiles []ProfileConfig `yaml:"profiles"`
 }
 
 // GlobalConfig contains global settings
 type GlobalConfig struct {
-	Log              LogConfig   `yaml:"log"`
-	GeoIPDBPath      string      `yaml:"geoip_db_path"`       // Path to MaxMind GeoIP database
-	MetricsAddr      string      `yaml:"metrics_addr"`        // Address for metrics endpoint (e.g., ":9090")
-	AdminAPI         AdminConfig `yaml:"admin_api"`           // Admin API configuration
-	TrustedProxies   []string    `yaml:"trusted_proxies"`     // CIDRs of trusted proxies for X-Forwarded-For
-	MaxRequestBody   int64       `yaml:"max_request_body"`    // Maximum request body size in bytes (default: 10MB)
-	ShutdownTimeout  int         `yaml:"shutdown_timeout"`    // Graceful shutdown timeout in seconds (default: 30)
+	Log             LogConfig           `yaml:"log"`
+	GeoIPDBPath     string              `yaml:"geoip_db_path"`    // Path to MaxMind GeoIP database
+	GeoIPRequired   bool                `yaml:"geoip_required"`   // Refuse to start if the GeoIP database cannot be loaded
+	MetricsAddr     string              `yaml:"metrics_addr"`     // Address for metrics endpoint (e.g., ":9090")
+	MetricsLimits   MetricsLimitsConfig `yaml:"metrics_limits"`   // Bounds on metrics memory use
+	AdminAPI        AdminConfig         `yaml:"admin_api"`        // Admin API configuration
+	TrustedProxies  []string            `yaml:"trusted_proxies"`  // CIDRs of trusted proxies for X-Forwarded-For
+	XFFTrustedHops  bool                `yaml:"xff_trusted_hops"` // Resolve the client as the rightmost X-Forwarded-For entry that is not a trusted proxy
+	XFFMode         string              `yaml:"xff_mode"`         // X-Forwarded-For handling when forwarding: append, overwrite, remove
+	MaxRequestBody  int64               `yaml:"max_request_body"` // Maximum request body size in bytes (default: 10MB)
+	ShutdownTimeout int                 `yaml:"shutdown_timeout"` // Graceful shutdown timeout in seconds (default: 30)
+
+	// ErrorPages replaces the empty body of gateway-generated error responses
+	// (e.g., 502, 503, 504), keyed by status code
+	ErrorPages map[int]ErrorPageConfig `yaml:"error_pages"`
+
+	// ClientIPHeaders are the request headers carrying the client IP, checked
+	// in order (default: X-Forwarded-For, X-Real-IP). Subject to TrustedProxies.
+	ClientIPHeaders []string `yaml:"client_ip_headers"`
+
+	// RateLimitStore selects where rate_limit rules keep their counters
+	RateLimitStore RateLimitStoreConfig `yaml:"rate_limit_store"`
+
+	// TrustedProxyCount is the number of proxies in front of ShadowGate. When
+	// set, the client is the X-Forwarded-For entry that many hops from the
+	// right, the one appended by the outermost proxy.
+	TrustedProxyCount int `yaml:"trusted_proxy_count"`
+
+	// RuleTimingSampleRate is the fraction of rule evaluations timed for the
+	// per-rule-type latency metrics (default: 0.01)
+	RuleTimingSampleRate float64 `yaml:"rule_timing_sample_rate"`
+}
+
+// RateLimitStoreConfig selects the rate limit counter backend
+type RateLimitStoreConfig struct {
+	Type  string      `yaml:"type"` // memory (default) or redis, shared by all instances
+	Redis RedisConfig `yaml:"redis"`
+}
+
+// RedisConfig configures a Redis connection
+type RedisConfig struct {
+	Addr      string `yaml:"addr"` // host:port
+	Password  string `yaml:"password"`
+	DB        int    `yaml:"db"`
+	KeyPrefix string `yaml:"key_prefix"` // prepended to every key (default: shadowgate:ratelimit:)
+	Timeout   string `yaml:"timeout"`    // dial and command timeout (default: 100ms)
+	PoolSize  int    `yaml:"pool_size"`  // idle connections kept open (default: 10)
 }
 
 // AdminConfig configures the admin API security
 type AdminConfig struct {
-	Token       string   `yaml:"token"`         // Bearer token for authentication (required for non-health endpoints)
-	AllowedIPs  []string `yaml:"allowed_ips"`   // CIDRs allowed to access admin API
+	Token      string   `yaml:"token"`       // Bearer token for authentication (required for non-health endpoints)
+	AllowedIPs []string `yaml:"allowed_ips"` // CIDRs allowed to access admin API
+
+	// RecentRequests is the number of requests kept in memory for
+	// GET /requests/recent (default: 1000)
+	RecentRequests int `yaml:"recent_requests"`
+}
+
+// ExposeBackendHeaderConfig controls which clients are told the backend
+// that served their request
+type ExposeBackendHeaderConfig struct {
+	Enabled     bool     `yaml:"enabled"`
+	Header      string   `yaml:"header"`       // response header (default: X-Backend)
+	CIDRs       []string `yaml:"cidrs"`        // clients shown the header (default: private and loopback addresses)
+	DebugHeader string   `yaml:"debug_header"` // when set, the request must also carry this header
+}
+
+// MetricsLimitsConfig bounds the number of distinct keys metrics keep
+type MetricsLimitsConfig struct {
+	MaxKeys      int `yaml:"max_keys"`       // keys per labelled counter before overflowing to "other" (default: 1000)
+	MaxUniqueIPs int `yaml:"max_unique_ips"` // client IPs tracked before the unique IP set is cleared (default: 100000)
 }
 
 // LogConfig configures logging behavior
@@ -30,44 +89,254 @@ type LogConfig struct {
 	Level  string `yaml:"level"`  // debug, info, warn, error
 	Format string `yaml:"format"` // json, text
 	Output string `yaml:"output"` // stdout, stderr, or file path
+
+	// File rotation (only applies when output is a file path)
+	MaxSizeMB  int  `yaml:"max_size_mb"`  // rotate when the file exceeds this size (0 = no rotation)
+	MaxBackups int  `yaml:"max_backups"`  // rotated files to keep (0 = unlimited)
+	MaxAgeDays int  `yaml:"max_age_days"` // delete rotated files older than this (0 = unlimited)
+	Compress   bool `yaml:"compress"`     // gzip rotated files
 }
 
 // ProfileConfig defines a traffic handling profile
 type ProfileConfig struct {
-	ID        string           `yaml:"id"`
+	ID string `yaml:"id"`
+
+	// Enabled set to false keeps the profile in the configuration without
+	// binding its listeners (default: true)
+	Enabled *bool `yaml:"enabled"`
+
 	Listeners []ListenerConfig `yaml:"listeners"`
 	Backends  []BackendConfig  `yaml:"backends"`
 	Rules     RulesConfig      `yaml:"rules"`
 	Decoy     DecoyConfig      `yaml:"decoy"`
 	Shaping   ShapingConfig    `yaml:"shaping"`
+
+	// ErrorPages overrides global error pages for this profile, by status code
+	ErrorPages map[int]ErrorPageConfig `yaml:"error_pages"`
+
+	// Compression gzips uncompressed backend responses for clients that accept it
+	Compression CompressionConfig `yaml:"compression"`
+
+	// BackendQueue holds requests while no backend is available instead of
+	// failing them immediately
+	BackendQueue BackendQueueConfig `yaml:"backend_queue"`
+
+	// RequestTimeout bounds the total time spent proxying a request (e.g., "60s")
+	RequestTimeout string `yaml:"request_timeout"`
+
+	// MaxRequestBody overrides the global request body limit in bytes, e.g.
+	// for a profile receiving large uploads
+	MaxRequestBody int64 `yaml:"max_request_body"`
+
+	// Request header limits; requests exceeding them are answered with 431
+	// before any rule runs (0 = unlimited)
+	MaxHeaders         int `yaml:"max_headers"`           // header fields per request
+	MaxHeaderValueSize int `yaml:"max_header_value_size"` // bytes per header value
+
+	// ExposeBackendHeader names the backend that served a request in a
+	// response header, for debugging load balancing
+	ExposeBackendHeader ExposeBackendHeaderConfig `yaml:"expose_backend_header"`
+
+	// IsolatedMetrics also records this profile's requests in a separate
+	// collector that can be queried and reset on its own
+	IsolatedMetrics bool `yaml:"isolated_metrics"`
+
+	// LoadBalancing selects how backends are chosen: round_robin (default),
+	// failover, which only uses lower priority backends when all higher
+	// priority ones are unhealthy, or weighted
+	LoadBalancing string `yaml:"load_balancing"`
+
+	// AdaptiveWeight scales backend weights down by their recent error rate
+	// (requires load_balancing: weighted)
+	AdaptiveWeight AdaptiveWeightConfig `yaml:"adaptive_weight"`
+
+	// Learning records observed traffic and suggests allow rules for it
+	Learning LearningConfig `yaml:"learning"`
+
+	// ClientIPHeaders overrides the global client IP headers for this profile
+	ClientIPHeaders []string `yaml:"client_ip_headers"`
+
+	// Backend retries (only idempotent methods are retried by default)
+	MaxRetries   int      `yaml:"max_retries"`   // additional attempts on other backends after a 5xx (default: 0)
+	RetryMethods []string `yaml:"retry_methods"` // default: GET, HEAD, PUT, DELETE, OPTIONS
+	RetryBackoff string   `yaml:"retry_backoff"` // delay before the first retry, doubled per retry (default: 50ms)
+
+	// Deny handling
+	DenyAction  string `yaml:"deny_action"`  // decoy (default), block, tarpit or drop
+	BlockStatus int    `yaml:"block_status"` // HTTP status code for block action (default: 403)
+	BlockBody   string `yaml:"block_body"`   // response body for block action
+	DropMode    string `yaml:"drop_mode"`    // drop action: close (default), hold or reset
+	DropHold    string `yaml:"drop_hold"`    // how long drop_mode hold keeps the connection (default: 10s)
+
+	// Break-glass bypass: requests presenting this token skip all rules
+	BypassToken  string `yaml:"bypass_token"`
+	BypassHeader string `yaml:"bypass_header"` // default: X-ShadowGate-Bypass
+}
+
+// IsEnabled reports whether the profile should be served
+func (p *ProfileConfig) IsEnabled() bool {
+	return p.Enabled == nil || *p.Enabled
+}
+
+// LearningConfig configures learning mode for a profile
+type LearningConfig struct {
+	Enabled    bool `yaml:"enabled"`
+	MaxEntries int  `yaml:"max_entries"` // distinct values kept per dimension (default: 1000)
 }
 
 // ListenerConfig defines a network listener
 type ListenerConfig struct {
-	Addr     string    `yaml:"addr"`     // e.g., "0.0.0.0:443"
-	Protocol string    `yaml:"protocol"` // http, https, tcp
-	TLS      TLSConfig `yaml:"tls"`
+	Addr       string    `yaml:"addr"`     // e.g., "0.0.0.0:443" or "unix:/run/shadowgate.sock"
+	Addrs      []string  `yaml:"addrs"`    // several addresses sharing these settings, instead of addr
+	Protocol   string    `yaml:"protocol"` // http, https, tcp
+	TLS        TLSConfig `yaml:"tls"`
+	SNIHosts   []string  `yaml:"sni_hosts"`   // hostnames routed to this profile on a shared HTTPS listener
+	SocketMode string    `yaml:"socket_mode"` // octal permissions for unix sockets, e.g. "0660"
+
+	// ConnRateLimit closes new connections arriving faster than these rates
+	ConnRateLimit ConnRateLimitConfig `yaml:"conn_rate_limit"`
+
+	// ProxyProtocol reads the client address from a PROXY protocol (v1/v2)
+	// header sent by the load balancers in ProxyProtocolTrusted
+	ProxyProtocol        bool     `yaml:"proxy_protocol"`
+	ProxyProtocolTrusted []string `yaml:"proxy_protocol_trusted"` // CIDRs or IPs of load balancers
+
+	// Server timeouts, e.g. "30s" (defaults: read 30s, write 30s, idle 120s,
+	// read_header 10s)
+	ReadTimeout       string `yaml:"read_timeout"`
+	WriteTimeout      string `yaml:"write_timeout"`
+	IdleTimeout       string `yaml:"idle_timeout"`
+	ReadHeaderTimeout string `yaml:"read_header_timeout"`
+
+	// KeepAlive reuses client connections for further requests (default:
+	// true); when false each connection serves one request
+	KeepAlive *bool `yaml:"keep_alive"`
+}
+
+// KeepAliveEnabled reports whether client connections are kept open
+// between requests
+func (l *ListenerConfig) KeepAliveEnabled() bool {
+	return l.KeepAlive == nil || *l.KeepAlive
+}
+
+// Addresses returns the addresses the listener binds, from addrs or addr
+func (l *ListenerConfig) Addresses() []string {
+	if len(l.Addrs) > 0 {
+		return l.Addrs
+	}
+	return []string{l.Addr}
+}
+
+// ExpandListeners returns the profile's listeners with one entry per
+// address: a listener with several addrs becomes a copy for each of them
+func (p *ProfileConfig) ExpandListeners() []ListenerConfig {
+	var out []ListenerConfig
+	for _, l := range p.Listeners {
+		for _, addr := range l.Addresses() {
+			c := l
+			c.Addr, c.Addrs = addr, nil
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// Timeouts returns the server timeouts, with zero values when unset
+func (l *ListenerConfig) Timeouts() (read, write, idle, readHeader time.Duration) {
+	read, _ = time.ParseDuration(l.ReadTimeout)
+	write, _ = time.ParseDuration(l.WriteTimeout)
+	idle, _ = time.ParseDuration(l.IdleTimeout)
+	readHeader, _ = time.ParseDuration(l.ReadHeaderTimeout)
+	return read, write, idle, readHeader
+}
+
+// ConnRateLimitConfig limits new connections per second (0 = unlimited)
+type ConnRateLimitConfig struct {
+	GlobalRate  float64 `yaml:"global_rate"`  // across all clients
+	GlobalBurst int     `yaml:"global_burst"` // default: global_rate rounded up
+	PerIPRate   float64 `yaml:"per_ip_rate"`  // per client IP
+	PerIPBurst  int     `yaml:"per_ip_burst"` // default: per_ip_rate rounded up
 }
 
 // TLSConfig configures TLS settings
 type TLSConfig struct {
 	CertFile string `yaml:"cert_file"`
 	KeyFile  string `yaml:"key_file"`
+
+	// Session resumption
+	SessionTicketKeyFile  string `yaml:"session_ticket_key_file"` // hex-encoded 32-byte keys, one per line; the first encrypts new tickets
+	SessionCacheSize      int    `yaml:"session_cache_size"`      // keep sessions in memory instead of encrypting them into tickets
+	DisableSessionTickets bool   `yaml:"disable_session_tickets"`
+
+	// OCSPStapleFile is a DER-encoded OCSP response stapled to the certificate
+	OCSPStapleFile string `yaml:"ocsp_staple_file"`
 }
 
 // BackendConfig defines an upstream backend
 type BackendConfig struct {
 	Name            string `yaml:"name"`
-	URL             string `yaml:"url"`              // e.g., "https://127.0.0.1:8443"
-	Weight          int    `yaml:"weight"`           // for load balancing
+	URL             string `yaml:"url"`      // e.g., "https://127.0.0.1:8443"
+	Weight          int    `yaml:"weight"`   // for load balancing
+	Priority        int    `yaml:"priority"` // failover tier; higher is preferred (default: 0)
 	Timeout         string `yaml:"timeout"`
 	HealthCheckPath string `yaml:"health_check_path"` // Health check endpoint (default: "/")
+
+	// Connection pooling
+	MaxIdleConns        int    `yaml:"max_idle_conns"`          // idle connections kept in total (default: 100)
+	MaxIdleConnsPerHost int    `yaml:"max_idle_conns_per_host"` // idle connections kept per host (default: 20)
+	IdleConnTimeout     string `yaml:"idle_conn_timeout"`       // close idle connections after this long (default: 90s)
+	ShareTransport      bool   `yaml:"share_transport"`         // share the pool with backends on the same host
+
+	// TLS to HTTPS backends
+	TLS *BackendTLSConfig `yaml:"tls"`
+
+	// Path rewriting applied to forwarded requests (strip_prefix first)
+	StripPrefix string             `yaml:"strip_prefix"` // e.g. "/api/v1" forwards /api/v1/users as /users
+	RewritePath *PathRewriteConfig `yaml:"rewrite_path"`
+}
+
+// BackendTLSConfig configures TLS connections to an HTTPS backend
+type BackendTLSConfig struct {
+	CAFile             string `yaml:"ca_file"`              // PEM CA bundle verifying the backend instead of the system roots
+	CertFile           string `yaml:"cert_file"`            // client certificate for mutual TLS
+	KeyFile            string `yaml:"key_file"`             // client certificate key
+	ServerName         string `yaml:"server_name"`          // SNI and verified name (default: URL host)
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"` // do not verify the backend certificate
+}
+
+// ConnPool returns the connection pool settings, with zero values when unset
+func (b *BackendConfig) ConnPool() (maxIdle, maxIdlePerHost int, idleTimeout time.Duration) {
+	idleTimeout, _ = time.ParseDuration(b.IdleConnTimeout)
+	return b.MaxIdleConns, b.MaxIdleConnsPerHost, idleTimeout
+}
+
+// PathRewriteConfig replaces a regex match in the forwarded path
+type PathRewriteConfig struct {
+	Pattern     string `yaml:"pattern"`
+	Replacement string `yaml:"replacement"` // may reference capture groups, e.g. "/v2/$1"
+}
+
+// PathRewrite returns the strip prefix, pattern and replacement, with empty
+// strings when unset
+func (b *BackendConfig) PathRewrite() (stripPrefix, pattern, replacement string) {
+	if b.RewritePath != nil {
+		pattern, replacement = b.RewritePath.Pattern, b.RewritePath.Replacement
+	}
+	return b.StripPrefix, pattern, replacement
 }
 
 // RulesConfig contains allow and deny rule groups
 type RulesConfig struct {
 	Allow *RuleGroup `yaml:"allow"`
 	Deny  *RuleGroup `yaml:"deny"`
+
+	// Suspicious marks allowed requests that are forwarded only after
+	// SlowForwardDelay, so borderline clients are slowed rather than denied
+	Suspicious       *RuleGroup `yaml:"suspicious"`
+	SlowForwardDelay string     `yaml:"slow_forward_delay"` // default 2s
+
+	// OptimizeOrder sorts AND rules so cheap rules run before expensive ones
+	OptimizeOrder bool `yaml:"optimize_order"`
 }
 
 // RuleGroup represents a group of rules with boolean logic
@@ -96,25 +365,82 @@ type Rule struct {
 	Paths   []string `yaml:"paths,omitempty"`   // path patterns (regex)
 	Headers []Header `yaml:"headers,omitempty"` // header checks
 
+	// HTTP protocol version rules
+	HTTPVersions []string `yaml:"http_versions,omitempty"` // 1.0, 1.1, 2, 3
+
+	// Host header rules
+	Hosts        []string `yaml:"hosts,omitempty"`         // exact hostnames, "*." wildcard allowed
+	HostPatterns []string `yaml:"host_patterns,omitempty"` // regex patterns
+
 	// GeoIP rules
 	Countries []string `yaml:"countries,omitempty"` // ISO country codes
 
 	// ASN rules
 	ASNs []uint `yaml:"asns,omitempty"` // AS numbers
 
+	// How geo and ASN rules evaluate without a GeoIP database: open or
+	// closed (default: never match)
+	GeoIPFailMode string `yaml:"geoip_fail_mode,omitempty"`
+
 	// TLS rules
-	TLSMinVersion string `yaml:"tls_min_version,omitempty"` // 1.2, 1.3
-	TLSMaxVersion string `yaml:"tls_max_version,omitempty"`
+	TLSMinVersion string   `yaml:"tls_min_version,omitempty"` // 1.2, 1.3
+	TLSMaxVersion string   `yaml:"tls_max_version,omitempty"`
 	SNIPatterns   []string `yaml:"sni_patterns,omitempty"`
 	RequireSNI    bool     `yaml:"require_sni,omitempty"`
+	ALPNProtocols []string `yaml:"alpn_protocols,omitempty"` // h2, http/1.1, or none
 
 	// Rate limiting
-	MaxRequests int    `yaml:"max_requests,omitempty"`
-	Window      string `yaml:"window,omitempty"` // e.g., "1m", "1h"
+	MaxRequests int          `yaml:"max_requests,omitempty"`
+	Window      string       `yaml:"window,omitempty"`     // e.g., "1m", "1h"
+	KeySource   string       `yaml:"key_source,omitempty"` // ip (default), header:<name> or cookie:<name>
+	ASNLimits   map[uint]int `yaml:"asn_limits,omitempty"` // asn_rate_limit: max_requests per ASN, replacing max_requests
+
+	// Replay protection (nonce rule; also uses Window)
+	NonceHeader     string `yaml:"nonce_header,omitempty"`
+	TimestampHeader string `yaml:"timestamp_header,omitempty"` // Unix seconds or RFC 3339
+	MaxSkew         string `yaml:"max_skew,omitempty"`         // allowed clock skew (default: window)
+	MaxNonces       int    `yaml:"max_nonces,omitempty"`       // nonce cache bound (default: 100000)
+
+	// Scanner detection (scanner_score rule; also uses Window)
+	MaxErrors int      `yaml:"max_errors,omitempty"` // error responses allowed per window (default: 20)
+	Statuses  []string `yaml:"statuses,omitempty"`   // counted statuses, e.g. 404 or 4xx (default: 4xx)
 
 	// Header rule specifics
 	HeaderName    string `yaml:"header_name,omitempty"`
 	RequireHeader bool   `yaml:"require_header,omitempty"`
+
+	// Header set rule
+	HeaderNames   []string `yaml:"header_names,omitempty"`
+	HeaderSetMode string   `yaml:"header_set_mode,omitempty"` // require_all or require_any
+
+	// Query rule specifics (also uses Patterns)
+	QueryParam   string   `yaml:"query_param,omitempty"`
+	QueryValues  []string `yaml:"query_values,omitempty"`  // exact values
+	RequireParam bool     `yaml:"require_param,omitempty"` // reject requests without the parameter
+
+	// Cookie rule specifics (also uses Patterns)
+	CookieName    string `yaml:"cookie_name,omitempty"`
+	RequireCookie bool   `yaml:"require_cookie,omitempty"` // reject requests without the cookie
+
+	// Body rules (patterns are matched against the decompressed body)
+	MaxBodyBytes int64 `yaml:"max_body_bytes,omitempty"` // inspection cap (default: 1MB)
+
+	// Auth rule
+	AuthScheme string            `yaml:"auth_scheme,omitempty"` // basic or bearer
+	Htpasswd   string            `yaml:"htpasswd,omitempty"`    // htpasswd file with basic auth users
+	Users      map[string]string `yaml:"users,omitempty"`       // inline basic auth users: name -> htpasswd hash
+	Tokens     []string          `yaml:"tokens,omitempty"`      // accepted bearer tokens
+
+	// JWT rule (also uses MaxSkew as the leeway for exp and nbf)
+	JWTIssuers       []string          `yaml:"jwt_issuers,omitempty"`         // accepted iss values
+	JWTAudiences     []string          `yaml:"jwt_audiences,omitempty"`       // accepted aud values
+	JWTClaims        map[string]string `yaml:"jwt_claims,omitempty"`          // claim name -> regex
+	JWTSecret        string            `yaml:"jwt_secret,omitempty"`          // HMAC key (HS256/384/512)
+	JWTPublicKeyFile string            `yaml:"jwt_public_key_file,omitempty"` // PEM RSA key or certificate (RS256/384/512)
+
+	// WAF rule
+	Ruleset    string   `yaml:"ruleset,omitempty"`    // signature set (default: basic)
+	Categories []string `yaml:"categories,omitempty"` // sqli, xss, traversal, scanner (default: all)
 }
 
 // TimeWindow defines an allowed time window
@@ -132,11 +458,82 @@ type Header struct {
 
 // DecoyConfig configures deception behavior
 type DecoyConfig struct {
-	Mode       string `yaml:"mode"`        // static, redirect, proxy
+	Mode       string `yaml:"mode"`        // static, redirect, proxy, honeypot
 	StatusCode int    `yaml:"status_code"` // HTTP status code for static mode
 	Body       string `yaml:"body"`        // inline body content
 	BodyFile   string `yaml:"body_file"`   // path to body file
 	RedirectTo string `yaml:"redirect_to"` // URL for redirect mode
+
+	// Honeypot mode forwards denied requests to an external honeypot,
+	// falling back to the static settings above while it is unreachable
+	HoneypotURL  string `yaml:"honeypot_url"`
+	MarkerHeader string `yaml:"marker_header"` // set to "true" on forwarded requests (default: X-Honeypot)
+
+	// ContentType of static decoys (default: text/html, or detected from body_file)
+	ContentType string `yaml:"content_type"`
+
+	// Headers are added to decoy responses, e.g. a fake Server header
+	Headers map[string]string `yaml:"headers"`
+
+	// Static decoys are padded to a random body size and delayed by a random
+	// jitter so they cannot be told apart from real responses by size or timing
+	PaddingMin int    `yaml:"padding_min"` // bytes
+	PaddingMax int    `yaml:"padding_max"` // bytes (default: padding_min)
+	JitterMin  string `yaml:"jitter_min"`  // e.g. "20ms"
+	JitterMax  string `yaml:"jitter_max"`  // e.g. "150ms" (default: jitter_min)
+
+	// Targets serve their own decoys to requests denied with matching rule
+	// labels, checked in order; other requests get the decoy above
+	Targets []DecoyTargetConfig `yaml:"targets"`
+}
+
+// DecoyTargetConfig selects the decoys for requests whose deny decision
+// carries any of Labels. One of Decoys is picked at random by weight.
+type DecoyTargetConfig struct {
+	Labels []string              `yaml:"labels"`
+	Decoys []WeightedDecoyConfig `yaml:"decoys"`
+}
+
+// WeightedDecoyConfig is a decoy with a selection weight
+type WeightedDecoyConfig struct {
+	Weight      int `yaml:"weight"` // relative to the other decoys of the target (default: 1)
+	DecoyConfig `yaml:",inline"`
+}
+
+// Jitter returns the static decoy delay range, with zero values when unset
+func (d *DecoyConfig) Jitter() (min, max time.Duration) {
+	min, _ = time.ParseDuration(d.JitterMin)
+	max, _ = time.ParseDuration(d.JitterMax)
+	return min, max
+}
+
+// ErrorPageConfig defines the body served with a gateway-generated error
+type ErrorPageConfig struct {
+	Body        string `yaml:"body"`         // inline body content
+	BodyFile    string `yaml:"body_file"`    // path to body file
+	ContentType string `yaml:"content_type"` // default: text/html, or detected from body_file
+}
+
+// CompressionConfig configures gateway response compression
+type CompressionConfig struct {
+	Enabled      bool     `yaml:"enabled"`
+	MinSize      int      `yaml:"min_size"`      // smallest body to compress in bytes (default: 1024)
+	ContentTypes []string `yaml:"content_types"` // media types to compress, "text/*" allowed (default: text, JSON, JS, XML, SVG)
+	Level        int      `yaml:"level"`         // gzip level 1-9 (default: 6)
+}
+
+// BackendQueueConfig configures waiting for a backend to become available
+type BackendQueueConfig struct {
+	Enabled   bool   `yaml:"enabled"`
+	MaxWait   string `yaml:"max_wait"`   // longest a request waits before a 503 (default: 2s)
+	QueueSize int    `yaml:"queue_size"` // requests allowed to wait at once (default: 100)
+}
+
+// AdaptiveWeightConfig configures error rate based backend weight adjustment
+type AdaptiveWeightConfig struct {
+	Enabled        bool    `yaml:"enabled"`
+	ErrorThreshold float64 `yaml:"error_threshold"` // error rate tolerated before reducing weight (default: 0.05)
+	MinFactor      float64 `yaml:"min_factor"`      // smallest fraction of the configured weight kept (default: 0.1)
 }
 
 // ShapingConfig configures traffic shaping
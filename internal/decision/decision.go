@@ -1,6 +1,8 @@
 package decision
 
 import (
+	"crypto/sha256"
+	"crypto/subtle"
 	"net/http"
 
 	"shadowgate/internal/rules"
@@ -20,6 +22,10 @@ const (
 	Tarpit
 	// Redirect sends a 3xx redirect
 	Redirect
+	// Block returns a configured status code and body instead of a decoy
+	Block
+	// SlowForward forwards the request to the backend after a delay
+	SlowForward
 )
 
 // String returns the string representation of an action
@@ -35,6 +41,10 @@ func (a Action) String() string {
 		return "tarpit"
 	case Redirect:
 		return "redirect"
+	case Block:
+		return "block"
+	case SlowForward:
+		return "slow_forward"
 	default:
 		return "unknown"
 	}
@@ -46,45 +56,147 @@ type Decision struct {
 	Reason      string
 	Labels      []string
 	RedirectURL string // for Redirect action
+	// RulesEvaluated is the number of individual rules evaluated
+	RulesEvaluated int
+	// RuleType is the type of the rule that decided the outcome ("" if none)
+	RuleType string
 }
 
 // Engine evaluates requests and returns decisions
 type Engine struct {
-	allowRules *rules.Group
-	denyRules  *rules.Group
-	evaluator  *rules.Evaluator
+	allowRules   *rules.Group
+	denyRules    *rules.Group
+	suspicious   *rules.Group
+	evaluator    *rules.Evaluator
+	denyAction   Action
+	bypassHeader string
+	bypassHash   [sha256.Size]byte
+	bypass       bool
 }
 
-// NewEngine creates a new decision engine
+// DefaultBypassHeader carries the break-glass bypass token
+const DefaultBypassHeader = "X-ShadowGate-Bypass"
+
+// EngineOptions contains optional engine configuration
+type EngineOptions struct {
+	// DenyAction is the action returned for denied requests (default: DenyDecoy)
+	DenyAction Action
+	// BypassToken, when set, lets requests presenting it in BypassHeader
+	// skip all rules and be forwarded
+	BypassToken  string
+	BypassHeader string
+	// Suspicious rules turn requests that would be forwarded into
+	// SlowForward decisions when they match
+	Suspicious *rules.Group
+	// Timing, when its Observe hook is set, samples how long each rule
+	// type takes to evaluate
+	Timing rules.EvaluatorOptions
+}
+
+// DefaultEngineOptions returns default engine options
+func DefaultEngineOptions() EngineOptions {
+	return EngineOptions{
+		DenyAction:   DenyDecoy,
+		BypassHeader: DefaultBypassHeader,
+	}
+}
+
+// NewEngine creates a new decision engine with default options
 func NewEngine(allowRules, denyRules *rules.Group) *Engine {
-	return &Engine{
+	return NewEngineWithOptions(allowRules, denyRules, DefaultEngineOptions())
+}
+
+// NewEngineWithOptions creates a new decision engine with custom options
+func NewEngineWithOptions(allowRules, denyRules *rules.Group, opts EngineOptions) *Engine {
+	e := &Engine{
 		allowRules: allowRules,
 		denyRules:  denyRules,
-		evaluator:  rules.NewEvaluator(),
+		suspicious: opts.Suspicious,
+		evaluator:  rules.NewEvaluatorWithOptions(opts.Timing),
+		denyAction: opts.DenyAction,
+	}
+
+	if opts.BypassToken != "" {
+		e.bypass = true
+		e.bypassHeader = opts.BypassHeader
+		if e.bypassHeader == "" {
+			e.bypassHeader = DefaultBypassHeader
+		}
+		e.bypassHash = sha256.Sum256([]byte(opts.BypassToken))
 	}
+
+	return e
 }
 
-// Evaluate evaluates a request and returns a decision
-func (e *Engine) Evaluate(req *http.Request, clientIP string) Decision {
+// BypassHeader returns the header carrying the bypass token ("" if disabled)
+func (e *Engine) BypassHeader() string {
+	return e.bypassHeader
+}
+
+// hasBypassToken reports whether the request presents the bypass token.
+// Both values are hashed first so the comparison is constant-time
+// regardless of the presented token's length.
+func (e *Engine) hasBypassToken(req *http.Request) bool {
+	if !e.bypass {
+		return false
+	}
+	presented := req.Header.Get(e.bypassHeader)
+	if presented == "" {
+		return false
+	}
+	hash := sha256.Sum256([]byte(presented))
+	return subtle.ConstantTimeCompare(hash[:], e.bypassHash[:]) == 1
+}
+
+// NewContext builds the rule context for a request from clientIP
+func NewContext(req *http.Request, clientIP string) *rules.Context {
 	ctx := &rules.Context{
-		Request:  req,
-		ClientIP: clientIP,
+		Request:    req,
+		ClientIP:   clientIP,
+		ProtoMajor: req.ProtoMajor,
+		ProtoMinor: req.ProtoMinor,
 	}
 
 	// Extract TLS information if available
 	if req.TLS != nil {
 		ctx.TLSVersion = req.TLS.Version
 		ctx.SNI = req.TLS.ServerName
+		ctx.ALPN = req.TLS.NegotiatedProtocol
+	}
+	return ctx
+}
+
+// Evaluate evaluates a request and returns a decision
+func (e *Engine) Evaluate(req *http.Request, clientIP string) Decision {
+	return e.EvaluateContext(NewContext(req, clientIP))
+}
+
+// EvaluateContext evaluates a prepared rule context and returns a decision
+func (e *Engine) EvaluateContext(ctx *rules.Context) Decision {
+	req := ctx.Request
+
+	// Break-glass bypass skips all rules
+	if e.hasBypassToken(req) {
+		return Decision{
+			Action:   AllowForward,
+			Reason:   "bypass token presented",
+			Labels:   []string{"bypass"},
+			RuleType: "bypass",
+		}
 	}
 
 	// Check deny rules first (deny takes precedence)
+	evaluated := 0
 	if e.denyRules != nil {
 		result := e.evaluator.EvaluateGroup(e.denyRules, ctx)
+		evaluated += result.Evaluated
 		if result.Matched {
 			return Decision{
-				Action: DenyDecoy,
-				Reason: result.Reason,
-				Labels: result.Labels,
+				Action:         e.denyAction,
+				Reason:         result.Reason,
+				Labels:         result.Labels,
+				RulesEvaluated: evaluated,
+				RuleType:       result.RuleType,
 			}
 		}
 	}
@@ -92,25 +204,51 @@ func (e *Engine) Evaluate(req *http.Request, clientIP string) Decision {
 	// Check allow rules
 	if e.allowRules != nil {
 		result := e.evaluator.EvaluateGroup(e.allowRules, ctx)
+		evaluated += result.Evaluated
 		if result.Matched {
-			return Decision{
-				Action: AllowForward,
-				Reason: result.Reason,
-				Labels: result.Labels,
-			}
+			return e.forward(ctx, Decision{
+				Action:         AllowForward,
+				Reason:         result.Reason,
+				Labels:         result.Labels,
+				RulesEvaluated: evaluated,
+				RuleType:       result.RuleType,
+			})
 		}
 		// Allow rules exist but didn't match - deny by default
 		return Decision{
-			Action: DenyDecoy,
-			Reason: "no allow rules matched",
-			Labels: []string{"default-deny"},
+			Action:         e.denyAction,
+			Reason:         "no allow rules matched",
+			Labels:         []string{"default-deny"},
+			RulesEvaluated: evaluated,
+			RuleType:       result.RuleType,
 		}
 	}
 
 	// No rules configured - allow by default (permissive mode)
+	return e.forward(ctx, Decision{
+		Action:         AllowForward,
+		Reason:         "no rules configured",
+		Labels:         []string{"no-rules"},
+		RulesEvaluated: evaluated,
+	})
+}
+
+// forward returns d for an allowed request, or a SlowForward decision when
+// the request also matches the suspicious rules
+func (e *Engine) forward(ctx *rules.Context, d Decision) Decision {
+	if e.suspicious == nil {
+		return d
+	}
+	result := e.evaluator.EvaluateGroup(e.suspicious, ctx)
+	d.RulesEvaluated += result.Evaluated
+	if !result.Matched {
+		return d
+	}
 	return Decision{
-		Action: AllowForward,
-		Reason: "no rules configured",
-		Labels: []string{"no-rules"},
+		Action:         SlowForward,
+		Reason:         result.Reason,
+		Labels:         append([]string{"suspicious"}, result.Labels...),
+		RulesEvaluated: d.RulesEvaluated,
+		RuleType:       result.RuleType,
 	}
 }
@@ -74,6 +74,7 @@ func TestActionString(t *testing.T) {
 		{Drop, "drop"},
 		{Tarpit, "tarpit"},
 		{Redirect, "redirect"},
+		{SlowForward, "slow_forward"},
 	}
 
 	for _, tc := range tests {
@@ -82,3 +83,110 @@ func TestActionString(t *testing.T) {
 		}
 	}
 }
+
+func TestEngineBlockDenyAction(t *testing.T) {
+	denyIP, _ := rules.NewIPRule([]string{"10.0.0.0/8"}, "deny")
+	allowIP, _ := rules.NewIPRule([]string{"192.168.0.0/16"}, "allow")
+
+	engine := NewEngineWithOptions(
+		&rules.Group{And: []rules.Rule{allowIP}},
+		&rules.Group{Single: denyIP},
+		EngineOptions{DenyAction: Block},
+	)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	if d := engine.Evaluate(req, "10.1.2.3"); d.Action != Block {
+		t.Errorf("expected Block for deny rule match, got %s", d.Action)
+	}
+	if d := engine.Evaluate(req, "8.8.8.8"); d.Action != Block {
+		t.Errorf("expected Block when allow rules don't match, got %s", d.Action)
+	}
+	if d := engine.Evaluate(req, "192.168.1.1"); d.Action != AllowForward {
+		t.Errorf("expected AllowForward, got %s", d.Action)
+	}
+}
+
+func TestEngineSuspiciousSlowForward(t *testing.T) {
+	allowIP, _ := rules.NewIPRule([]string{"10.0.0.0/8"}, "allow")
+	suspectIP, _ := rules.NewIPRule([]string{"10.9.0.0/16"}, "allow")
+
+	engine := NewEngineWithOptions(
+		&rules.Group{Single: allowIP},
+		nil,
+		EngineOptions{DenyAction: DenyDecoy, Suspicious: &rules.Group{Single: suspectIP}},
+	)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	d := engine.Evaluate(req, "10.9.1.1")
+	if d.Action != SlowForward {
+		t.Fatalf("expected SlowForward for suspicious client, got %s", d.Action)
+	}
+	if len(d.Labels) == 0 || d.Labels[0] != "suspicious" {
+		t.Errorf("expected suspicious label, got %v", d.Labels)
+	}
+	if d.RulesEvaluated != 2 {
+		t.Errorf("expected 2 rules evaluated, got %d", d.RulesEvaluated)
+	}
+	if d := engine.Evaluate(req, "10.1.1.1"); d.Action != AllowForward {
+		t.Errorf("expected AllowForward for unsuspicious client, got %s", d.Action)
+	}
+	// Suspicion never turns a denied request into a forwarded one
+	if d := engine.Evaluate(req, "8.8.8.8"); d.Action != DenyDecoy {
+		t.Errorf("expected DenyDecoy when allow rules don't match, got %s", d.Action)
+	}
+
+	permissive := NewEngineWithOptions(nil, nil, EngineOptions{Suspicious: &rules.Group{Single: suspectIP}})
+	if d := permissive.Evaluate(req, "10.9.1.1"); d.Action != SlowForward {
+		t.Errorf("expected SlowForward without allow rules, got %s", d.Action)
+	}
+}
+
+func TestEngineBypassToken(t *testing.T) {
+	denyIP, _ := rules.NewIPRule([]string{"10.0.0.0/8"}, "deny")
+
+	opts := DefaultEngineOptions()
+	opts.BypassToken = "0123456789abcdef0123456789abcdef"
+	engine := NewEngineWithOptions(nil, &rules.Group{Single: denyIP}, opts)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(DefaultBypassHeader, "0123456789abcdef0123456789abcdef")
+	d := engine.Evaluate(req, "10.1.2.3")
+	if d.Action != AllowForward {
+		t.Errorf("expected AllowForward with bypass token, got %s", d.Action)
+	}
+	if len(d.Labels) != 1 || d.Labels[0] != "bypass" {
+		t.Errorf("expected bypass label, got %v", d.Labels)
+	}
+
+	req.Header.Set(DefaultBypassHeader, "wrong")
+	if d := engine.Evaluate(req, "10.1.2.3"); d.Action != DenyDecoy {
+		t.Errorf("expected DenyDecoy with wrong token, got %s", d.Action)
+	}
+
+	// Without a configured token the header is ignored
+	plain := NewEngine(nil, &rules.Group{Single: denyIP})
+	req.Header.Set(DefaultBypassHeader, "")
+	if d := plain.Evaluate(req, "10.1.2.3"); d.Action != DenyDecoy {
+		t.Errorf("expected DenyDecoy without bypass configured, got %s", d.Action)
+	}
+	if plain.BypassHeader() != "" {
+		t.Error("expected no bypass header when bypass is disabled")
+	}
+}
+
+func TestEngineRuleType(t *testing.T) {
+	denyIP, _ := rules.NewIPRule([]string{"10.0.0.0/8"}, "deny")
+	allowMethod, _ := rules.NewMethodRule([]string{"GET"}, "allow")
+
+	engine := NewEngine(&rules.Group{And: []rules.Rule{allowMethod}}, &rules.Group{Single: denyIP})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	if d := engine.Evaluate(req, "10.1.2.3"); d.RuleType != "ip_deny" {
+		t.Errorf("expected deny attributed to ip_deny, got %q", d.RuleType)
+	}
+
+	post := httptest.NewRequest("POST", "/", nil)
+	if d := engine.Evaluate(post, "8.8.8.8"); d.Action != DenyDecoy || d.RuleType != "method_allow" {
+		t.Errorf("expected default deny attributed to method_allow, got %s/%q", d.Action, d.RuleType)
+	}
+}
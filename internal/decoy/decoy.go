@@ -1,10 +1,14 @@
 package decoy
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"math/rand"
+	"net"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 )
 
@@ -19,6 +23,17 @@ type StaticDecoy struct {
 	Body        []byte
 	ContentType string
 	Headers     map[string]string
+
+	// PaddingMin and PaddingMax pad the body to a random size in this range
+	// (bytes), so decoys do not share one telltale length. Bodies already
+	// that large are sent unchanged. Zero disables padding.
+	PaddingMin int
+	PaddingMax int
+
+	// JitterMin and JitterMax delay each response by a random duration in
+	// this range, mimicking the processing time of a real backend
+	JitterMin time.Duration
+	JitterMax time.Duration
 }
 
 // NewStaticDecoy creates a static decoy from inline content
@@ -53,20 +68,97 @@ func NewStaticDecoyFromFile(statusCode int, filePath string, contentType string)
 	}, nil
 }
 
+// RequestIDPlaceholder is replaced with the request's X-Request-ID in static bodies
+const RequestIDPlaceholder = "{{request_id}}"
+
 // Serve serves the static decoy content
 func (d *StaticDecoy) Serve(w http.ResponseWriter, r *http.Request) {
+	if delay := randomDuration(d.JitterMin, d.JitterMax); delay > 0 {
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-r.Context().Done():
+			timer.Stop()
+			return
+		}
+	}
+
 	for k, v := range d.Headers {
 		w.Header().Set(k, v)
 	}
 	w.Header().Set("Content-Type", d.ContentType)
 	w.WriteHeader(d.StatusCode)
-	w.Write(d.Body)
+	w.Write(d.pad(d.render(r)))
+}
+
+// pad extends body to a random size between PaddingMin and PaddingMax
+func (d *StaticDecoy) pad(body []byte) []byte {
+	size := d.PaddingMin
+	if d.PaddingMax > size {
+		size += rand.Intn(d.PaddingMax - size + 1)
+	}
+	if size <= len(body) {
+		return body
+	}
+	padded := make([]byte, len(body), size)
+	copy(padded, body)
+	return append(padded, filler(d.ContentType, size-len(body))...)
+}
+
+// filler returns n bytes that can follow a body of the given content type
+// without changing how it is parsed: an HTML comment of random text for
+// HTML, whitespace otherwise, which JSON, XML and plain text tolerate
+func filler(contentType string, n int) []byte {
+	const open, end = "\n<!-- ", " -->"
+	if !strings.HasPrefix(contentType, "text/html") || n <= len(open)+len(end) {
+		return bytes.Repeat([]byte(" "), n)
+	}
+
+	const alphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	b := make([]byte, 0, n)
+	b = append(b, open...)
+	for len(b) < n-len(end) {
+		b = append(b, alphabet[rand.Intn(len(alphabet))])
+	}
+	return append(b, end...)
+}
+
+// randomDuration returns a random duration in [min, max], or min when max
+// is not larger
+func randomDuration(min, max time.Duration) time.Duration {
+	if max > min {
+		return min + time.Duration(rand.Int63n(int64(max-min)+1))
+	}
+	return min
+}
+
+// render substitutes template placeholders in the body
+func (d *StaticDecoy) render(r *http.Request) []byte {
+	placeholder := []byte(RequestIDPlaceholder)
+	if !bytes.Contains(d.Body, placeholder) {
+		return d.Body
+	}
+	return bytes.ReplaceAll(d.Body, placeholder, []byte(sanitizeRequestID(r.Header.Get("X-Request-ID"))))
+}
+
+// sanitizeRequestID keeps only characters that are safe to embed in HTML or
+// JSON bodies, since clients may supply their own X-Request-ID
+func sanitizeRequestID(id string) string {
+	return strings.Map(func(c rune) rune {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9',
+			c == '-', c == '_', c == '.', c == ':':
+			return c
+		}
+		return -1
+	}, id)
 }
 
 // RedirectDecoy sends a redirect response
 type RedirectDecoy struct {
-	StatusCode int    // 301, 302, 307, 308
+	StatusCode int // 301, 302, 307, 308
 	Location   string
+	Headers    map[string]string
 }
 
 // NewRedirectDecoy creates a redirect decoy
@@ -77,11 +169,15 @@ func NewRedirectDecoy(statusCode int, location string) *RedirectDecoy {
 	return &RedirectDecoy{
 		StatusCode: statusCode,
 		Location:   location,
+		Headers:    make(map[string]string),
 	}
 }
 
 // Serve sends the redirect response
 func (d *RedirectDecoy) Serve(w http.ResponseWriter, r *http.Request) {
+	for k, v := range d.Headers {
+		w.Header().Set(k, v)
+	}
 	http.Redirect(w, r, d.Location, d.StatusCode)
 }
 
@@ -116,10 +212,31 @@ func (d *TarpitDecoy) Serve(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// DropDecoy silently drops the connection by not responding
-type DropDecoy struct{}
+// Drop modes
+const (
+	DropClose = "close" // close the connection without a response
+	DropHold  = "hold"  // keep the connection open, then close it
+	DropReset = "reset" // abort the connection with a TCP RST
+)
+
+// DefaultDropHold is how long DropHold keeps a connection open by default
+const DefaultDropHold = 10 * time.Second
 
-// Serve hijacks and closes the connection
+// DropDecoy drops the connection without responding
+type DropDecoy struct {
+	Mode string        // DropClose (default), DropHold or DropReset
+	Hold time.Duration // how long DropHold keeps the connection (default: 10s)
+}
+
+// NewDropDecoy creates a drop decoy using mode
+func NewDropDecoy(mode string, hold time.Duration) *DropDecoy {
+	if hold <= 0 {
+		hold = DefaultDropHold
+	}
+	return &DropDecoy{Mode: mode, Hold: hold}
+}
+
+// Serve hijacks the connection and drops it according to the mode
 func (d *DropDecoy) Serve(w http.ResponseWriter, r *http.Request) {
 	hj, ok := w.(http.Hijacker)
 	if !ok {
@@ -130,9 +247,39 @@ func (d *DropDecoy) Serve(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		return
 	}
+
+	switch d.Mode {
+	case DropHold:
+		// Swallow whatever the client sends until the hold expires
+		hold := d.Hold
+		if hold <= 0 {
+			hold = DefaultDropHold
+		}
+		conn.SetDeadline(time.Now().Add(hold))
+		io.Copy(io.Discard, conn)
+	case DropReset:
+		if tcp, ok := tcpConn(conn); ok {
+			tcp.SetLinger(0)
+		}
+	}
 	conn.Close()
 }
 
+// tcpConn returns the TCP connection beneath conn, unwrapping TLS and
+// other wrappers exposing NetConn
+func tcpConn(conn net.Conn) (*net.TCPConn, bool) {
+	for {
+		switch c := conn.(type) {
+		case *net.TCPConn:
+			return c, true
+		case interface{ NetConn() net.Conn }:
+			conn = c.NetConn()
+		default:
+			return nil, false
+		}
+	}
+}
+
 func detectContentType(filePath string) string {
 	switch {
 	case hasExtension(filePath, ".html", ".htm"):
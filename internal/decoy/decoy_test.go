@@ -1,9 +1,14 @@
 package decoy
 
 import (
+	"context"
+	"errors"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"syscall"
 	"testing"
 	"time"
 )
@@ -43,6 +48,28 @@ func TestStaticDecoyDefaultContentType(t *testing.T) {
 	}
 }
 
+func TestStaticDecoyRequestIDPlaceholder(t *testing.T) {
+	d := NewStaticDecoy(403, `{"error":"blocked","request_id":"{{request_id}}"}`, "application/json")
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Request-ID", "abc123")
+	rr := httptest.NewRecorder()
+	d.Serve(rr, req)
+
+	if got := rr.Body.String(); got != `{"error":"blocked","request_id":"abc123"}` {
+		t.Errorf("unexpected body: %s", got)
+	}
+
+	// Client-supplied IDs are sanitized before being embedded
+	req.Header.Set("X-Request-ID", `<script>"x"</script>`)
+	rr = httptest.NewRecorder()
+	d.Serve(rr, req)
+
+	if got := rr.Body.String(); got != `{"error":"blocked","request_id":"scriptxscript"}` {
+		t.Errorf("expected sanitized request ID, got %s", got)
+	}
+}
+
 func TestRedirectDecoy(t *testing.T) {
 	decoy := NewRedirectDecoy(http.StatusFound, "https://example.com")
 
@@ -61,6 +88,19 @@ func TestRedirectDecoy(t *testing.T) {
 	}
 }
 
+func TestRedirectDecoyHeaders(t *testing.T) {
+	decoy := NewRedirectDecoy(http.StatusFound, "https://example.com")
+	decoy.Headers["Server"] = "Apache"
+
+	req := httptest.NewRequest("GET", "/", nil)
+	rr := httptest.NewRecorder()
+	decoy.Serve(rr, req)
+
+	if server := rr.Header().Get("Server"); server != "Apache" {
+		t.Errorf("expected Server header, got %q", server)
+	}
+}
+
 func TestRedirectDecoyDefaultStatus(t *testing.T) {
 	// Invalid status should default to 302
 	decoy := NewRedirectDecoy(999, "https://example.com")
@@ -112,3 +152,204 @@ func TestDetectContentType(t *testing.T) {
 		}
 	}
 }
+
+func TestHoneypotDecoy(t *testing.T) {
+	honeypot := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Seen-Marker", r.Header.Get("X-Honeypot"))
+		w.Header().Set("X-Seen-Host", r.Host)
+		w.Header().Set("X-Seen-Agent", r.UserAgent())
+		io.WriteString(w, "honeypot:"+r.URL.Path)
+	}))
+	defer honeypot.Close()
+
+	d, err := NewHoneypotDecoy(honeypot.URL, "", NewStaticDecoy(http.StatusNotFound, "fallback", ""))
+	if err != nil {
+		t.Fatalf("failed to create honeypot decoy: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "http://target.example.com/admin", nil)
+	req.Header.Set("User-Agent", "scanner/1.0")
+	req.Header.Set("X-Honeypot", "false")
+	rr := httptest.NewRecorder()
+	d.Serve(rr, req)
+
+	if body := rr.Body.String(); body != "honeypot:/admin" {
+		t.Errorf("expected request to reach the honeypot, got %q", body)
+	}
+	if got := rr.Header().Get("X-Seen-Marker"); got != "true" {
+		t.Errorf("expected marker header true, got %q", got)
+	}
+	if got := rr.Header().Get("X-Seen-Host"); got != "target.example.com" {
+		t.Errorf("expected original Host, got %q", got)
+	}
+	if got := rr.Header().Get("X-Seen-Agent"); got != "scanner/1.0" {
+		t.Errorf("expected original headers, got User-Agent %q", got)
+	}
+}
+
+func TestHoneypotDecoyFallback(t *testing.T) {
+	honeypot := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	url := honeypot.URL
+	honeypot.Close()
+
+	d, err := NewHoneypotDecoy(url, "X-Deception", NewStaticDecoy(http.StatusNotFound, "fallback", ""))
+	if err != nil {
+		t.Fatalf("failed to create honeypot decoy: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	d.Serve(rr, httptest.NewRequest("GET", "/", nil))
+
+	if rr.Code != http.StatusNotFound || rr.Body.String() != "fallback" {
+		t.Errorf("expected fallback decoy while honeypot is down, got %d %q", rr.Code, rr.Body.String())
+	}
+}
+
+func TestHoneypotDecoyInvalidURL(t *testing.T) {
+	for _, u := range []string{"", "ftp://honeypot", "honeypot:8080"} {
+		if _, err := NewHoneypotDecoy(u, "", nil); err == nil {
+			t.Errorf("expected error for URL %q", u)
+		}
+	}
+}
+
+func TestStaticDecoyPadding(t *testing.T) {
+	tests := []struct {
+		contentType string
+		body        string
+	}{
+		{"text/html; charset=utf-8", "<html>Not Found</html>"},
+		{"application/json", `{"error":"not found"}`},
+	}
+
+	for _, tc := range tests {
+		d := NewStaticDecoy(http.StatusNotFound, tc.body, tc.contentType)
+		d.PaddingMin, d.PaddingMax = 500, 1000
+
+		for i := 0; i < 20; i++ {
+			rr := httptest.NewRecorder()
+			d.Serve(rr, httptest.NewRequest("GET", "/", nil))
+			body := rr.Body.String()
+
+			if len(body) < 500 || len(body) > 1000 {
+				t.Fatalf("%s: expected padded size in [500, 1000], got %d", tc.contentType, len(body))
+			}
+			if !strings.HasPrefix(body, tc.body) {
+				t.Fatalf("%s: expected original body first, got %q", tc.contentType, body[:40])
+			}
+			if tc.contentType == "application/json" && strings.TrimSpace(body) != tc.body {
+				t.Fatalf("expected JSON to be padded with whitespace only")
+			}
+			if strings.HasPrefix(tc.contentType, "text/html") && !strings.HasSuffix(body, " -->") {
+				t.Fatalf("expected HTML to be padded with a comment")
+			}
+		}
+	}
+
+	// Bodies already past the padding size are left alone
+	d := NewStaticDecoy(http.StatusOK, "long enough", "text/plain")
+	d.PaddingMin = 4
+	rr := httptest.NewRecorder()
+	d.Serve(rr, httptest.NewRequest("GET", "/", nil))
+	if rr.Body.String() != "long enough" {
+		t.Errorf("expected body unchanged, got %q", rr.Body.String())
+	}
+}
+
+func TestStaticDecoyJitter(t *testing.T) {
+	d := NewStaticDecoy(http.StatusOK, "ok", "")
+	d.JitterMin, d.JitterMax = 30*time.Millisecond, 60*time.Millisecond
+
+	start := time.Now()
+	rr := httptest.NewRecorder()
+	d.Serve(rr, httptest.NewRequest("GET", "/", nil))
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Errorf("expected at least 30ms delay, got %v", elapsed)
+	}
+
+	// A client that goes away during the delay gets no response
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rr = httptest.NewRecorder()
+	d.Serve(rr, httptest.NewRequest("GET", "/", nil).WithContext(ctx))
+	if rr.Body.Len() != 0 {
+		t.Error("expected no response after the client went away")
+	}
+}
+
+func TestSelector(t *testing.T) {
+	fallback := NewStaticDecoy(http.StatusOK, "login", "")
+	slow := NewStaticDecoy(http.StatusOK, "slow", "")
+	vulnA := NewStaticDecoy(http.StatusOK, "vuln-a", "")
+	vulnB := NewStaticDecoy(http.StatusOK, "vuln-b", "")
+
+	sel := NewSelector(fallback)
+	sel.AddTarget([]string{"scanner"}, []Weighted{{Strategy: slow}})
+	sel.AddTarget([]string{"waf", "scanner"}, []Weighted{{Strategy: vulnA, Weight: 3}, {Strategy: vulnB}})
+	sel.AddTarget([]string{"empty"}, nil)
+
+	if sel.Select([]string{"ua-deny", "scanner"}) != slow {
+		t.Error("expected the first matching target to win")
+	}
+	if sel.Select([]string{"ua-deny"}) != fallback || sel.Select([]string{"empty"}) != fallback {
+		t.Error("expected the default decoy without a matching target")
+	}
+
+	counts := make(map[Strategy]int)
+	for i := 0; i < 4000; i++ {
+		counts[sel.Select([]string{"waf", "waf-sqli"})]++
+	}
+	if counts[vulnA]+counts[vulnB] != 4000 || counts[vulnA] < 2700 || counts[vulnA] > 3300 {
+		t.Errorf("expected a 3:1 split, got %d:%d", counts[vulnA], counts[vulnB])
+	}
+
+	rec := httptest.NewRecorder()
+	sel.Serve(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Body.String() != "login" {
+		t.Errorf("expected Serve to use the default decoy, got %q", rec.Body.String())
+	}
+}
+
+func TestDropDecoyModes(t *testing.T) {
+	send := func(t *testing.T, d *DropDecoy) (time.Duration, error) {
+		srv := httptest.NewServer(http.HandlerFunc(d.Serve))
+		defer srv.Close()
+
+		conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+		if err != nil {
+			t.Fatalf("dial failed: %v", err)
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+		start := time.Now()
+		io.WriteString(conn, "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n")
+		n, err := conn.Read(make([]byte, 1))
+		if n != 0 {
+			t.Errorf("expected no response, read %d bytes", n)
+		}
+		return time.Since(start), err
+	}
+
+	t.Run("close", func(t *testing.T) {
+		if _, err := send(t, NewDropDecoy(DropClose, 0)); err != io.EOF {
+			t.Errorf("expected EOF, got %v", err)
+		}
+	})
+
+	t.Run("hold", func(t *testing.T) {
+		elapsed, err := send(t, NewDropDecoy(DropHold, 200*time.Millisecond))
+		if err != io.EOF {
+			t.Errorf("expected EOF, got %v", err)
+		}
+		if elapsed < 200*time.Millisecond {
+			t.Errorf("expected connection held for 200ms, closed after %v", elapsed)
+		}
+	})
+
+	t.Run("reset", func(t *testing.T) {
+		if _, err := send(t, NewDropDecoy(DropReset, 0)); !errors.Is(err, syscall.ECONNRESET) {
+			t.Errorf("expected connection reset, got %v", err)
+		}
+	})
+}
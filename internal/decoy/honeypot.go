@@ -0,0 +1,77 @@
+package decoy
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"time"
+)
+
+// Honeypot decoy defaults
+const (
+	DefaultHoneypotMarkerHeader = "X-Honeypot"
+	DefaultHoneypotTimeout      = 10 * time.Second
+)
+
+// HoneypotDecoy forwards denied requests to an external honeypot service,
+// keeping the original headers and Host and adding a marker header so the
+// honeypot can tell deception traffic apart. If the honeypot cannot be
+// reached or is too slow, the fallback strategy serves the request instead.
+type HoneypotDecoy struct {
+	Upstream     *url.URL
+	MarkerHeader string
+	proxy        *httputil.ReverseProxy
+	fallback     Strategy
+}
+
+// NewHoneypotDecoy creates a decoy that proxies to the honeypot at upstream.
+// markerHeader defaults to DefaultHoneypotMarkerHeader; a nil fallback
+// serves an empty 200 OK.
+func NewHoneypotDecoy(upstream, markerHeader string, fallback Strategy) (*HoneypotDecoy, error) {
+	u, err := url.Parse(upstream)
+	if err != nil {
+		return nil, fmt.Errorf("invalid honeypot URL: %w", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid honeypot URL %q: expected an http or https URL", upstream)
+	}
+	if markerHeader == "" {
+		markerHeader = DefaultHoneypotMarkerHeader
+	}
+	if fallback == nil {
+		fallback = NewStaticDecoy(http.StatusOK, "", "")
+	}
+
+	d := &HoneypotDecoy{
+		Upstream:     u,
+		MarkerHeader: markerHeader,
+		fallback:     fallback,
+	}
+
+	proxy := httputil.NewSingleHostReverseProxy(u)
+	director := proxy.Director
+	proxy.Director = func(req *http.Request) {
+		director(req)
+		req.Header.Set(markerHeader, "true")
+	}
+	proxy.Transport = &http.Transport{
+		DialContext:           (&net.Dialer{Timeout: 5 * time.Second}).DialContext,
+		ResponseHeaderTimeout: DefaultHoneypotTimeout,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+	}
+	// A down honeypot must not reveal itself; serve the fallback instead
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		d.fallback.Serve(w, r)
+	}
+	d.proxy = proxy
+
+	return d, nil
+}
+
+// Serve forwards the request to the honeypot
+func (d *HoneypotDecoy) Serve(w http.ResponseWriter, r *http.Request) {
+	d.proxy.ServeHTTP(w, r)
+}
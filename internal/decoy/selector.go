@@ -0,0 +1,79 @@
+package decoy
+
+import (
+	"math/rand"
+	"net/http"
+)
+
+// Weighted is a decoy chosen with a probability proportional to its weight
+type Weighted struct {
+	Strategy Strategy
+	Weight   int // values below 1 count as 1
+}
+
+// Selector serves targeted decoys keyed on the labels of the deny decision.
+// Targets are checked in order; the first sharing a label with the decision
+// picks one of its decoys at random by weight. Requests matching no target
+// get the default decoy.
+type Selector struct {
+	defaultDecoy Strategy
+	targets      []selectorTarget
+}
+
+type selectorTarget struct {
+	labels map[string]bool
+	decoys []Weighted
+	total  int
+}
+
+// NewSelector creates a selector serving defaultDecoy until targets are added
+func NewSelector(defaultDecoy Strategy) *Selector {
+	return &Selector{defaultDecoy: defaultDecoy}
+}
+
+// AddTarget serves one of decoys to requests denied with any of labels
+func (s *Selector) AddTarget(labels []string, decoys []Weighted) {
+	t := selectorTarget{labels: make(map[string]bool, len(labels))}
+	for _, l := range labels {
+		t.labels[l] = true
+	}
+	for _, d := range decoys {
+		if d.Weight < 1 {
+			d.Weight = 1
+		}
+		t.decoys = append(t.decoys, d)
+		t.total += d.Weight
+	}
+	if len(t.decoys) > 0 {
+		s.targets = append(s.targets, t)
+	}
+}
+
+// Select returns the decoy for a request denied with labels
+func (s *Selector) Select(labels []string) Strategy {
+	for _, t := range s.targets {
+		for _, l := range labels {
+			if t.labels[l] {
+				return t.pick()
+			}
+		}
+	}
+	return s.defaultDecoy
+}
+
+// Serve serves the default decoy, for callers without decision labels
+func (s *Selector) Serve(w http.ResponseWriter, r *http.Request) {
+	s.defaultDecoy.Serve(w, r)
+}
+
+// pick chooses a decoy at random by weight
+func (t *selectorTarget) pick() Strategy {
+	n := rand.Intn(t.total)
+	for _, d := range t.decoys {
+		if n < d.Weight {
+			return d.Strategy
+		}
+		n -= d.Weight
+	}
+	return t.decoys[len(t.decoys)-1].Strategy
+}
@@ -0,0 +1,126 @@
+// Package events fans out request decisions to live subscribers, such as
+// the admin API's event stream, without slowing down the request path.
+package events
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"shadowgate/internal/logging"
+)
+
+// Default bus settings
+const (
+	DefaultBuffer         = 256
+	DefaultMaxSubscribers = 16
+)
+
+// Options configures a Bus
+type Options struct {
+	// Buffer is the number of events queued per subscriber; events arriving
+	// while the queue is full are dropped (default: 256)
+	Buffer int
+	// MaxSubscribers bounds the number of concurrent subscribers (default: 16)
+	MaxSubscribers int
+}
+
+// DefaultOptions returns default bus options
+func DefaultOptions() Options {
+	return Options{
+		Buffer:         DefaultBuffer,
+		MaxSubscribers: DefaultMaxSubscribers,
+	}
+}
+
+// Bus delivers published request events to every subscriber. Publishing
+// never blocks: a subscriber that does not keep up loses events instead.
+type Bus struct {
+	opts Options
+	subs map[*Subscription]struct{}
+	mu   sync.RWMutex
+}
+
+// Subscription receives events from a Bus until it is closed
+type Subscription struct {
+	bus     *Bus
+	ch      chan logging.RequestLog
+	dropped int64 // atomic
+	once    sync.Once
+}
+
+// NewBus creates a bus with default options
+func NewBus() *Bus {
+	return NewBusWithOptions(DefaultOptions())
+}
+
+// NewBusWithOptions creates a bus with custom options
+func NewBusWithOptions(opts Options) *Bus {
+	defaults := DefaultOptions()
+	if opts.Buffer <= 0 {
+		opts.Buffer = defaults.Buffer
+	}
+	if opts.MaxSubscribers <= 0 {
+		opts.MaxSubscribers = defaults.MaxSubscribers
+	}
+	return &Bus{
+		opts: opts,
+		subs: make(map[*Subscription]struct{}),
+	}
+}
+
+// Publish hands an event to each subscriber with room in its queue
+func (b *Bus) Publish(ev logging.RequestLog) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for sub := range b.subs {
+		select {
+		case sub.ch <- ev:
+		default:
+			atomic.AddInt64(&sub.dropped, 1)
+		}
+	}
+}
+
+// Subscribe registers a new subscriber. It returns false when the bus
+// already has the maximum number of subscribers.
+func (b *Bus) Subscribe() (*Subscription, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.subs) >= b.opts.MaxSubscribers {
+		return nil, false
+	}
+	sub := &Subscription{bus: b, ch: make(chan logging.RequestLog, b.opts.Buffer)}
+	b.subs[sub] = struct{}{}
+	return sub, true
+}
+
+// Subscribers returns the number of active subscribers
+func (b *Bus) Subscribers() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.subs)
+}
+
+// Events returns the channel events are delivered on. It is closed when the
+// subscription is closed.
+func (s *Subscription) Events() <-chan logging.RequestLog {
+	return s.ch
+}
+
+// Dropped returns and resets the number of events lost because the queue
+// was full
+func (s *Subscription) Dropped() int64 {
+	return atomic.SwapInt64(&s.dropped, 0)
+}
+
+// Close unsubscribes from the bus. It is safe to call more than once.
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		s.bus.mu.Lock()
+		delete(s.bus.subs, s)
+		s.bus.mu.Unlock()
+		close(s.ch)
+	})
+}
@@ -0,0 +1,60 @@
+package events
+
+import (
+	"testing"
+
+	"shadowgate/internal/logging"
+)
+
+func TestBusDelivers(t *testing.T) {
+	b := NewBus()
+	s1, _ := b.Subscribe()
+	s2, _ := b.Subscribe()
+	defer s2.Close()
+
+	b.Publish(logging.RequestLog{RequestID: "a", Action: "allow_forward"})
+	for _, s := range []*Subscription{s1, s2} {
+		if ev := <-s.Events(); ev.RequestID != "a" {
+			t.Errorf("expected event a, got %+v", ev)
+		}
+	}
+
+	s1.Close()
+	s1.Close()
+	if _, open := <-s1.Events(); open {
+		t.Error("expected channel closed after Close")
+	}
+	if b.Subscribers() != 1 {
+		t.Errorf("expected 1 subscriber, got %d", b.Subscribers())
+	}
+	b.Publish(logging.RequestLog{RequestID: "b"})
+	if ev := <-s2.Events(); ev.RequestID != "b" {
+		t.Errorf("expected event b, got %+v", ev)
+	}
+}
+
+func TestBusDropsWhenFull(t *testing.T) {
+	b := NewBusWithOptions(Options{Buffer: 2, MaxSubscribers: 1})
+	s, ok := b.Subscribe()
+	if !ok {
+		t.Fatal("expected subscription")
+	}
+	defer s.Close()
+	if _, ok := b.Subscribe(); ok {
+		t.Error("expected subscriber limit to be enforced")
+	}
+
+	// Nobody reads, so publishing must not block
+	for i := 0; i < 5; i++ {
+		b.Publish(logging.RequestLog{})
+	}
+	if n := s.Dropped(); n != 3 {
+		t.Errorf("expected 3 dropped events, got %d", n)
+	}
+	if n := s.Dropped(); n != 0 {
+		t.Errorf("expected dropped count reset, got %d", n)
+	}
+	if len(s.Events()) != 2 {
+		t.Errorf("expected 2 queued events, got %d", len(s.Events()))
+	}
+}
@@ -0,0 +1,68 @@
+package events
+
+import (
+	"sync/atomic"
+
+	"shadowgate/internal/logging"
+)
+
+// DefaultRecentSize is the number of requests kept by a Recent buffer
+const DefaultRecentSize = 1000
+
+// Recent keeps the most recent request events in a fixed-size ring, so they
+// can be inspected after the fact. Adding never blocks or allocates beyond
+// the entry itself: writers claim a slot with an atomic counter and replace
+// its contents, so the oldest entries are overwritten once the ring is full.
+type Recent struct {
+	slots []atomic.Pointer[logging.RequestLog]
+	next  uint64 // atomic; total entries added
+}
+
+// NewRecent creates a buffer holding the last size requests
+// (default: DefaultRecentSize)
+func NewRecent(size int) *Recent {
+	if size <= 0 {
+		size = DefaultRecentSize
+	}
+	return &Recent{slots: make([]atomic.Pointer[logging.RequestLog], size)}
+}
+
+// Add records a request, replacing the oldest one when the buffer is full
+func (r *Recent) Add(ev logging.RequestLog) {
+	i := atomic.AddUint64(&r.next, 1) - 1
+	r.slots[i%uint64(len(r.slots))].Store(&ev)
+}
+
+// Size returns the number of requests the buffer holds when full
+func (r *Recent) Size() int {
+	return len(r.slots)
+}
+
+// List returns up to limit recorded requests for which match returns true,
+// newest first. A nil match accepts every request and a limit of zero or
+// less returns all matches. Entries added while List runs may or may not
+// be included.
+func (r *Recent) List(limit int, match func(logging.RequestLog) bool) []logging.RequestLog {
+	n := atomic.LoadUint64(&r.next)
+	size := uint64(len(r.slots))
+	count := n
+	if count > size {
+		count = size
+	}
+
+	var out []logging.RequestLog
+	for i := uint64(0); i < count; i++ {
+		ev := r.slots[(n-1-i)%size].Load()
+		if ev == nil {
+			continue // slot claimed but not yet written
+		}
+		if match != nil && !match(*ev) {
+			continue
+		}
+		out = append(out, *ev)
+		if limit > 0 && len(out) >= limit {
+			break
+		}
+	}
+	return out
+}
@@ -0,0 +1,73 @@
+package events
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"shadowgate/internal/logging"
+)
+
+func TestRecentKeepsNewest(t *testing.T) {
+	r := NewRecent(3)
+	if got := r.List(0, nil); len(got) != 0 {
+		t.Fatalf("expected empty buffer, got %d entries", len(got))
+	}
+
+	for i := 0; i < 5; i++ {
+		r.Add(logging.RequestLog{RequestID: fmt.Sprint(i)})
+	}
+
+	got := r.List(0, nil)
+	if len(got) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(got))
+	}
+	for i, want := range []string{"4", "3", "2"} {
+		if got[i].RequestID != want {
+			t.Errorf("entry %d: expected %s, got %s", i, want, got[i].RequestID)
+		}
+	}
+}
+
+func TestRecentFilterAndLimit(t *testing.T) {
+	r := NewRecent(10)
+	for i := 0; i < 6; i++ {
+		action := "allow_forward"
+		if i%2 == 0 {
+			action = "deny_decoy"
+		}
+		r.Add(logging.RequestLog{RequestID: fmt.Sprint(i), Action: action})
+	}
+
+	denied := func(ev logging.RequestLog) bool { return ev.Action == "deny_decoy" }
+	got := r.List(2, denied)
+	if len(got) != 2 || got[0].RequestID != "4" || got[1].RequestID != "2" {
+		t.Errorf("expected newest two denied requests, got %+v", got)
+	}
+	if got := r.List(0, denied); len(got) != 3 {
+		t.Errorf("expected 3 denied requests, got %d", len(got))
+	}
+}
+
+func TestRecentConcurrent(t *testing.T) {
+	r := NewRecent(64)
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				r.Add(logging.RequestLog{RequestID: "x"})
+				r.List(10, nil)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := r.List(0, nil); len(got) != 64 {
+		t.Errorf("expected full buffer of 64, got %d", len(got))
+	}
+	if NewRecent(0).Size() != DefaultRecentSize {
+		t.Error("expected default size for zero")
+	}
+}
@@ -0,0 +1,276 @@
+package gateway
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultCompressionMinSize is the smallest response body compressed by default
+const DefaultCompressionMinSize = 1024
+
+// DefaultCompressionTypes are the content types compressed by default
+var DefaultCompressionTypes = []string{
+	"text/*",
+	"application/json",
+	"application/javascript",
+	"application/xml",
+	"application/x-javascript",
+	"image/svg+xml",
+}
+
+// CompressionOptions configures gateway response compression
+type CompressionOptions struct {
+	MinSize      int      // bodies smaller than this are sent uncompressed
+	ContentTypes []string // media types to compress; "type/*" matches a whole type
+	Level        int      // gzip level (gzip.BestSpeed to gzip.BestCompression)
+}
+
+// DefaultCompressionOptions returns default compression options
+func DefaultCompressionOptions() CompressionOptions {
+	return CompressionOptions{
+		MinSize:      DefaultCompressionMinSize,
+		ContentTypes: DefaultCompressionTypes,
+		Level:        gzip.DefaultCompression,
+	}
+}
+
+// compressor gzips backend responses for clients that accept it
+type compressor struct {
+	minSize  int
+	types    map[string]bool
+	prefixes []string // "text/" for "text/*"
+	writers  sync.Pool
+	level    int
+}
+
+func newCompressor(opts CompressionOptions) (*compressor, error) {
+	if opts.Level != gzip.DefaultCompression && (opts.Level < gzip.BestSpeed || opts.Level > gzip.BestCompression) {
+		return nil, fmt.Errorf("invalid gzip level: %d", opts.Level)
+	}
+
+	c := &compressor{
+		minSize: opts.MinSize,
+		types:   make(map[string]bool),
+		level:   opts.Level,
+	}
+	for _, t := range opts.ContentTypes {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if prefix, ok := strings.CutSuffix(t, "*"); ok {
+			c.prefixes = append(c.prefixes, prefix)
+			continue
+		}
+		c.types[t] = true
+	}
+	return c, nil
+}
+
+// wrap returns a writer compressing the response, or w unchanged when the
+// client does not accept gzip. The returned function must be called once
+// the response is complete.
+func (c *compressor) wrap(w http.ResponseWriter, r *http.Request) (http.ResponseWriter, func()) {
+	if r.Method == http.MethodHead || !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+		return w, func() {}
+	}
+	gw := &gzipResponseWriter{ResponseWriter: w, c: c}
+	return gw, gw.close
+}
+
+// compressible reports whether a response with these headers may be compressed
+func (c *compressor) compressible(h http.Header) bool {
+	if h.Get("Content-Encoding") != "" || h.Get("Content-Range") != "" {
+		return false
+	}
+	if strings.Contains(strings.ToLower(h.Get("Cache-Control")), "no-transform") {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	if c.types[mediaType] {
+		return true
+	}
+	for _, p := range c.prefixes {
+		if strings.HasPrefix(mediaType, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *compressor) getWriter(w http.ResponseWriter) *gzip.Writer {
+	if zw, ok := c.writers.Get().(*gzip.Writer); ok {
+		zw.Reset(w)
+		return zw
+	}
+	zw, _ := gzip.NewWriterLevel(w, c.level) // level validated in newCompressor
+	return zw
+}
+
+// acceptsGzip reports whether an Accept-Encoding value allows gzip
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+				continue
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// gzipResponseWriter buffers the start of a response until it knows whether
+// the body is large enough to compress, then either gzips or passes through
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	c *compressor
+
+	status      int
+	wroteHeader bool // WriteHeader called by the backend proxy
+	decided     bool
+	buf         []byte
+	zw          *gzip.Writer
+}
+
+func (gw *gzipResponseWriter) WriteHeader(code int) {
+	if gw.wroteHeader {
+		return
+	}
+	// Informational responses (including protocol upgrades) pass through
+	if code < http.StatusOK {
+		gw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	gw.wroteHeader = true
+	gw.status = code
+
+	h := gw.Header()
+	if code == http.StatusNoContent || code == http.StatusNotModified || !gw.c.compressible(h) {
+		gw.passThrough()
+		return
+	}
+	h.Add("Vary", "Accept-Encoding")
+
+	// Decide now if the backend declared the body length
+	if cl := h.Get("Content-Length"); cl != "" {
+		if n, err := strconv.Atoi(cl); err == nil {
+			if n >= gw.c.minSize {
+				gw.startGzip()
+			} else {
+				gw.passThrough()
+			}
+		}
+	}
+}
+
+func (gw *gzipResponseWriter) Write(b []byte) (int, error) {
+	if !gw.wroteHeader {
+		gw.WriteHeader(http.StatusOK)
+	}
+	if gw.decided {
+		if gw.zw != nil {
+			return gw.zw.Write(b)
+		}
+		return gw.ResponseWriter.Write(b)
+	}
+
+	gw.buf = append(gw.buf, b...)
+	if len(gw.buf) >= gw.c.minSize {
+		gw.startGzip()
+		if err := gw.flushBuffer(); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// Flush commits to compressing a streamed response and flushes it to the client
+func (gw *gzipResponseWriter) Flush() {
+	if gw.wroteHeader && !gw.decided {
+		gw.startGzip()
+		gw.flushBuffer()
+	}
+	if gw.zw != nil {
+		gw.zw.Flush()
+	}
+	if f, ok := gw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack passes through to the underlying writer (used for upgrades)
+func (gw *gzipResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := gw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not support hijacking")
+	}
+	return hj.Hijack()
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (gw *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return gw.ResponseWriter
+}
+
+func (gw *gzipResponseWriter) startGzip() {
+	gw.decided = true
+
+	h := gw.Header()
+	h.Del("Content-Length")
+	h.Set("Content-Encoding", "gzip")
+	// The compressed representation differs byte-for-byte from the original
+	if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		h.Set("ETag", "W/"+etag)
+	}
+	gw.ResponseWriter.WriteHeader(gw.status)
+	gw.zw = gw.c.getWriter(gw.ResponseWriter)
+}
+
+func (gw *gzipResponseWriter) passThrough() {
+	gw.decided = true
+	gw.ResponseWriter.WriteHeader(gw.status)
+}
+
+func (gw *gzipResponseWriter) flushBuffer() error {
+	if len(gw.buf) == 0 {
+		return nil
+	}
+	var err error
+	if gw.zw != nil {
+		_, err = gw.zw.Write(gw.buf)
+	} else {
+		_, err = gw.ResponseWriter.Write(gw.buf)
+	}
+	gw.buf = nil
+	return err
+}
+
+// close sends any buffered body and finishes the gzip stream
+func (gw *gzipResponseWriter) close() {
+	if !gw.wroteHeader {
+		return
+	}
+	if !gw.decided {
+		// The whole body fit below the threshold
+		gw.passThrough()
+	}
+	gw.flushBuffer()
+	if gw.zw != nil {
+		gw.zw.Close()
+		gw.c.writers.Put(gw.zw)
+		gw.zw = nil
+	}
+}
@@ -0,0 +1,153 @@
+package gateway
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"shadowgate/internal/config"
+)
+
+func TestAcceptsGzip(t *testing.T) {
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{"gzip", true},
+		{"deflate, gzip;q=0.8", true},
+		{"GZIP", true},
+		{"*", true},
+		{"gzip;q=0", false},
+		{"br, deflate", false},
+		{"", false},
+	}
+
+	for _, tc := range tests {
+		if got := acceptsGzip(tc.header); got != tc.want {
+			t.Errorf("acceptsGzip(%q) = %v, want %v", tc.header, got, tc.want)
+		}
+	}
+}
+
+func TestCompressorWrap(t *testing.T) {
+	c, err := newCompressor(CompressionOptions{MinSize: 16, ContentTypes: []string{"text/*", "application/json"}, Level: gzip.DefaultCompression})
+	if err != nil {
+		t.Fatalf("failed to create compressor: %v", err)
+	}
+
+	large := strings.Repeat("a", 64)
+	tests := []struct {
+		name        string
+		contentType string
+		encoding    string
+		body        string
+		compressed  bool
+	}{
+		{"large text", "text/html; charset=utf-8", "", large, true},
+		{"large json", "application/json", "", large, true},
+		{"below threshold", "text/plain", "", "short", false},
+		{"type not listed", "image/png", "", large, false},
+		{"already encoded", "text/plain", "br", large, false},
+	}
+
+	for _, tc := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		rr := httptest.NewRecorder()
+
+		w, done := c.wrap(rr, req)
+		w.Header().Set("Content-Type", tc.contentType)
+		if tc.encoding != "" {
+			w.Header().Set("Content-Encoding", tc.encoding)
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(tc.body))
+		done()
+
+		gotGzip := rr.Header().Get("Content-Encoding") == "gzip"
+		if gotGzip != tc.compressed {
+			t.Errorf("%s: expected compressed=%v, got Content-Encoding %q", tc.name, tc.compressed, rr.Header().Get("Content-Encoding"))
+			continue
+		}
+
+		body := rr.Body.String()
+		if gotGzip {
+			zr, err := gzip.NewReader(rr.Body)
+			if err != nil {
+				t.Errorf("%s: invalid gzip body: %v", tc.name, err)
+				continue
+			}
+			data, _ := io.ReadAll(zr)
+			body = string(data)
+			if rr.Header().Get("ETag") != `W/"v1"` {
+				t.Errorf("%s: expected weak ETag, got %q", tc.name, rr.Header().Get("ETag"))
+			}
+		}
+		if body != tc.body {
+			t.Errorf("%s: body mismatch, got %q", tc.name, body)
+		}
+	}
+
+	// Clients that do not accept gzip get the original writer
+	req := httptest.NewRequest("GET", "/", nil)
+	rr := httptest.NewRecorder()
+	if w, _ := c.wrap(rr, req); w != http.ResponseWriter(rr) {
+		t.Error("expected writer to be unchanged without Accept-Encoding")
+	}
+
+	if _, err := newCompressor(CompressionOptions{Level: 12}); err == nil {
+		t.Error("expected error for invalid level")
+	}
+}
+
+func TestHandlerCompression(t *testing.T) {
+	payload := strings.Repeat(`{"key":"value"}`, 200)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(payload))
+	}))
+	defer backend.Close()
+
+	handler, err := NewHandler(Config{
+		ProfileID: "test",
+		Profile: config.ProfileConfig{
+			Backends: []config.BackendConfig{
+				{Name: "primary", URL: backend.URL, Weight: 1},
+			},
+			Compression: config.CompressionConfig{Enabled: true},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/data", nil)
+	req.RemoteAddr = "10.0.0.1:12345"
+	req.Header.Set("Accept-Encoding", "gzip")
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("expected gzip response, got headers %v", rr.Header())
+	}
+	if rr.Header().Get("Content-Length") != "" {
+		t.Error("expected Content-Length to be removed")
+	}
+	if rr.Body.Len() >= len(payload) {
+		t.Errorf("expected compressed body smaller than %d, got %d", len(payload), rr.Body.Len())
+	}
+
+	zr, err := gzip.NewReader(rr.Body)
+	if err != nil {
+		t.Fatalf("invalid gzip body: %v", err)
+	}
+	data, _ := io.ReadAll(zr)
+	if string(data) != payload {
+		t.Error("decompressed body does not match backend response")
+	}
+}
@@ -0,0 +1,87 @@
+package gateway
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+)
+
+// countingResponseWriter counts the response body bytes written to the
+// client and records the response status
+type countingResponseWriter struct {
+	http.ResponseWriter
+	bytes  int64
+	status int // 0 until the response header is written
+}
+
+func (cw *countingResponseWriter) WriteHeader(code int) {
+	// Informational responses are followed by the real status
+	if cw.status == 0 && code >= 200 {
+		cw.status = code
+	}
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+func (cw *countingResponseWriter) Write(b []byte) (int, error) {
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+	n, err := cw.ResponseWriter.Write(b)
+	cw.bytes += int64(n)
+	return n, err
+}
+
+// Flush passes through to the underlying writer so streamed responses still flush
+func (cw *countingResponseWriter) Flush() {
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack passes through to the underlying writer (used by the drop action)
+func (cw *countingResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := cw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not support hijacking")
+	}
+	return hj.Hijack()
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (cw *countingResponseWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// countingReader counts the request body bytes read by rules and the backend
+// and notes whether the body went over the size limit
+type countingReader struct {
+	io.ReadCloser
+	bytes    int64
+	tooLarge bool
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.ReadCloser.Read(p)
+	cr.bytes += int64(n)
+	var maxErr *http.MaxBytesError
+	if err != nil && errors.As(err, &maxErr) {
+		cr.tooLarge = true
+	}
+	return n, err
+}
+
+// requestBytes returns the request body size, preferring the bytes actually
+// read and falling back to the declared Content-Length when the body was
+// never consumed (e.g. a decoy response)
+func requestBytes(r *http.Request, body *countingReader) int64 {
+	if body != nil && body.bytes > 0 {
+		return body.bytes
+	}
+	if r.ContentLength > 0 {
+		return r.ContentLength
+	}
+	return 0
+}
@@ -1,18 +1,26 @@
 package gateway
 
 import (
+	"context"
 	"crypto/rand"
+	"crypto/tls"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net"
 	"net/http"
+	"runtime/debug"
 	"strings"
 	"time"
 
 	"shadowgate/internal/config"
 	"shadowgate/internal/decision"
 	"shadowgate/internal/decoy"
+	"shadowgate/internal/events"
+	"shadowgate/internal/learning"
+	"shadowgate/internal/listener"
 	"shadowgate/internal/logging"
 	"shadowgate/internal/metrics"
 	"shadowgate/internal/proxy"
@@ -31,14 +39,43 @@ const DefaultMaxRequestBody = 10 * 1024 * 1024
 
 // Handler is the main HTTP handler for the gateway
 type Handler struct {
-	profileID      string
-	decisionEngine *decision.Engine
-	backendPool    *proxy.Pool
-	decoyStrategy  decoy.Strategy
-	logger         *logging.Logger
-	metrics        *metrics.Metrics
-	trustedProxies []*net.IPNet
-	maxRequestBody int64
+	profileID         string
+	decisionEngine    *decision.Engine
+	backendPool       *proxy.Pool
+	decoyStrategy     decoy.Strategy
+	blockResponse     *decoy.StaticDecoy
+	dropDecoy         *decoy.DropDecoy
+	headerLimits      headerLimits
+	backendHeader     *backendHeader // nil unless backends are named in responses
+	logger            *logging.Logger
+	metrics           *metrics.Metrics
+	profileMetrics    *metrics.Metrics // isolated collector, if enabled
+	trustedProxies    []*net.IPNet
+	trustedHops       bool
+	trustedCount      int
+	clientIPHeaders   []string
+	maxRequestBody    int64
+	requestTimeout    time.Duration
+	retry             proxy.RetryOptions
+	compressor        *compressor        // nil when compression is disabled
+	backendQueue      *backendQueue      // nil unless requests wait for a backend
+	stoppers          []stopper          // stateful rules torn down by Close
+	responseObservers []responseObserver // rules scoring clients on their responses
+	errorPages        map[int]*decoy.StaticDecoy
+	learner           *learning.Recorder // nil unless learning mode is enabled
+	events            *events.Bus        // nil unless decisions are streamed
+	recent            *events.Recent     // nil unless recent requests are kept
+}
+
+// stopper is implemented by rules that run background goroutines
+type stopper interface {
+	Stop()
+}
+
+// responseObserver is implemented by rules that score clients on the
+// responses they receive, such as scanner_score
+type responseObserver interface {
+	ObserveResponse(clientIP string, status int)
 }
 
 // Config configures the gateway handler
@@ -47,65 +84,192 @@ type Config struct {
 	Profile        config.ProfileConfig
 	Logger         *logging.Logger
 	Metrics        *metrics.Metrics
-	BackendPool    *proxy.Pool  // Optional: if nil, will be created from Profile.Backends
-	TrustedProxies []string     // CIDRs of trusted proxies for X-Forwarded-For
-	MaxRequestBody int64        // Maximum request body size in bytes (0 = default 10MB)
+	BackendPool    *proxy.Pool   // Optional: if nil, will be created from Profile.Backends
+	TrustedProxies []string      // CIDRs of trusted proxies for X-Forwarded-For
+	TrustedHops    bool          // take the rightmost untrusted entry of list headers instead of the first
+	TrustedCount   int           // take the entry this many hops from the right of list headers instead of the first
+	XFFMode        string        // X-Forwarded-For handling for backends created from Profile.Backends
+	MaxRequestBody int64         // Maximum request body size in bytes (0 = default 10MB; Profile.MaxRequestBody takes precedence)
+	RequestTimeout time.Duration // Overall backend request timeout (0 = use Profile.RequestTimeout)
+
+	// ErrorPages are global error pages; Profile.ErrorPages take precedence
+	ErrorPages map[int]config.ErrorPageConfig
+
+	// Learning holds learning mode recorders; used when Profile.Learning is enabled
+	Learning *learning.Registry
+
+	// ClientIPHeaders are the headers carrying the client IP, checked in
+	// order (nil = DefaultClientIPHeaders); Profile.ClientIPHeaders take
+	// precedence
+	ClientIPHeaders []string
+
+	// RateLimitStore, when set, holds the counters of rate_limit rules so
+	// they are shared with other instances (nil = in memory)
+	RateLimitStore rules.RateLimitStore
+
+	// Events, when set, receives every logged request for live subscribers
+	Events *events.Bus
+
+	// Recent, when set, keeps every logged request for later inspection
+	Recent *events.Recent
+
+	// RuleTimingSampleRate is the fraction of rule evaluations timed for
+	// Metrics (0 = rules.DefaultTimingSampleRate)
+	RuleTimingSampleRate float64
 }
 
+// DefaultClientIPHeaders are the headers the client IP is read from by default
+var DefaultClientIPHeaders = []string{"X-Forwarded-For", "X-Real-IP"}
+
 // NewHandler creates a new gateway handler
 func NewHandler(cfg Config) (*Handler, error) {
 	maxBody := cfg.MaxRequestBody
+	if cfg.Profile.MaxRequestBody > 0 {
+		maxBody = cfg.Profile.MaxRequestBody
+	}
 	if maxBody <= 0 {
 		maxBody = DefaultMaxRequestBody
 	}
 
+	requestTimeout := cfg.RequestTimeout
+	if requestTimeout == 0 && cfg.Profile.RequestTimeout != "" {
+		d, err := time.ParseDuration(cfg.Profile.RequestTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid request timeout: %w", err)
+		}
+		requestTimeout = d
+	}
+
+	retry := proxy.DefaultRetryOptions()
+	retry.MaxRetries = cfg.Profile.MaxRetries
+	if len(cfg.Profile.RetryMethods) > 0 {
+		retry.Methods = cfg.Profile.RetryMethods
+	}
+	if cfg.Profile.RetryBackoff != "" {
+		d, err := time.ParseDuration(cfg.Profile.RetryBackoff)
+		if err != nil {
+			return nil, fmt.Errorf("invalid retry backoff: %w", err)
+		}
+		retry.Backoff = d
+	}
+
+	var dropHold time.Duration
+	if cfg.Profile.DropHold != "" {
+		d, err := time.ParseDuration(cfg.Profile.DropHold)
+		if err != nil {
+			return nil, fmt.Errorf("invalid drop hold: %w", err)
+		}
+		dropHold = d
+	}
+
 	h := &Handler{
 		profileID:      cfg.ProfileID,
 		logger:         cfg.Logger,
 		metrics:        cfg.Metrics,
 		maxRequestBody: maxBody,
+		requestTimeout: requestTimeout,
+		retry:          retry,
+		events:         cfg.Events,
+		recent:         cfg.Recent,
+		dropDecoy:      decoy.NewDropDecoy(strings.ToLower(cfg.Profile.DropMode), dropHold),
+		headerLimits: headerLimits{
+			maxCount:     cfg.Profile.MaxHeaders,
+			maxValueSize: cfg.Profile.MaxHeaderValueSize,
+		},
+	}
+	if cfg.Metrics != nil && cfg.Profile.IsolatedMetrics {
+		h.profileMetrics = cfg.Metrics.Profile(cfg.ProfileID)
+	}
+	if cfg.Learning != nil && cfg.Profile.Learning.Enabled {
+		opts := learning.DefaultOptions()
+		if cfg.Profile.Learning.MaxEntries > 0 {
+			opts.MaxEntries = cfg.Profile.Learning.MaxEntries
+		}
+		h.learner = cfg.Learning.Recorder(cfg.ProfileID, opts)
+	}
+
+	if cc := cfg.Profile.Compression; cc.Enabled {
+		opts := DefaultCompressionOptions()
+		if cc.MinSize > 0 {
+			opts.MinSize = cc.MinSize
+		}
+		if len(cc.ContentTypes) > 0 {
+			opts.ContentTypes = cc.ContentTypes
+		}
+		if cc.Level != 0 {
+			opts.Level = cc.Level
+		}
+		c, err := newCompressor(opts)
+		if err != nil {
+			return nil, fmt.Errorf("invalid compression config: %w", err)
+		}
+		h.compressor = c
+	}
+
+	errorPages, err := buildErrorPages(cfg.ErrorPages, cfg.Profile.ErrorPages)
+	if err != nil {
+		return nil, err
+	}
+	h.errorPages = errorPages
+
+	h.clientIPHeaders = cfg.Profile.ClientIPHeaders
+	if len(h.clientIPHeaders) == 0 {
+		h.clientIPHeaders = cfg.ClientIPHeaders
 	}
 
 	// Parse trusted proxies
+	h.trustedHops = cfg.TrustedHops
+	h.trustedCount = cfg.TrustedCount
 	for _, cidr := range cfg.TrustedProxies {
-		_, network, err := net.ParseCIDR(cidr)
+		network, err := parseNetwork(cidr)
 		if err != nil {
-			// Try as single IP
-			ip := net.ParseIP(cidr)
-			if ip == nil {
-				return nil, fmt.Errorf("invalid trusted proxy: %s", cidr)
-			}
-			bits := 32
-			if ip.To4() == nil {
-				bits = 128
-			}
-			network = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+			return nil, fmt.Errorf("invalid trusted proxy: %s", cidr)
 		}
 		h.trustedProxies = append(h.trustedProxies, network)
 	}
 
-	// Build rule groups from config
-	var allowRules, denyRules *rules.Group
-	if cfg.Profile.Rules.Allow != nil {
-		allowRules = buildRuleGroup(cfg.Profile.Rules.Allow)
-	}
-	if cfg.Profile.Rules.Deny != nil {
-		denyRules = buildRuleGroup(cfg.Profile.Rules.Deny)
+	bh, err := newBackendHeader(cfg.Profile.ExposeBackendHeader)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expose_backend_header: %w", err)
 	}
-
-	h.decisionEngine = decision.NewEngine(allowRules, denyRules)
+	h.backendHeader = bh
 
 	// Use provided backend pool or create one
 	if cfg.BackendPool != nil {
 		h.backendPool = cfg.BackendPool
 	} else {
+		xffMode, err := proxy.ParseXFFMode(cfg.XFFMode)
+		if err != nil {
+			return nil, err
+		}
+		mode, err := proxy.ParseBalanceMode(cfg.Profile.LoadBalancing)
+		if err != nil {
+			return nil, err
+		}
 		h.backendPool = proxy.NewPool()
+		h.backendPool.SetMode(mode)
+		if aw := cfg.Profile.AdaptiveWeight; aw.Enabled {
+			h.backendPool.SetAdaptiveWeight(proxy.AdaptiveWeightOptions{
+				Enabled:        true,
+				ErrorThreshold: aw.ErrorThreshold,
+				MinFactor:      aw.MinFactor,
+			})
+		}
 		for _, bc := range cfg.Profile.Backends {
 			weight := bc.Weight
 			if weight == 0 {
 				weight = 1
 			}
-			backend, err := proxy.NewBackend(bc.Name, bc.URL, weight)
+			opts := proxy.DefaultBackendOptions()
+			opts.XFFMode = xffMode
+			opts.Priority = bc.Priority
+			opts.MaxIdleConns, opts.MaxIdleConnsPerHost, opts.IdleConnTimeout = bc.ConnPool()
+			opts.ShareTransport = bc.ShareTransport
+			opts.PathRewrite, err = proxy.NewPathRewrite(bc.PathRewrite())
+			if err != nil {
+				return nil, fmt.Errorf("backend %s: %w", bc.Name, err)
+			}
+			backend, err := proxy.NewBackendWithOptions(bc.Name, bc.URL, weight, opts)
 			if err != nil {
 				return nil, err
 			}
@@ -113,13 +277,155 @@ func NewHandler(cfg Config) (*Handler, error) {
 		}
 	}
 
+	if bq := cfg.Profile.BackendQueue; bq.Enabled {
+		opts := DefaultBackendQueueOptions()
+		if bq.MaxWait != "" {
+			d, err := time.ParseDuration(bq.MaxWait)
+			if err != nil {
+				return nil, fmt.Errorf("invalid backend queue max wait: %w", err)
+			}
+			opts.MaxWait = d
+		}
+		if bq.QueueSize > 0 {
+			opts.Size = bq.QueueSize
+		}
+		h.backendQueue = newBackendQueue(h.backendPool, opts)
+	}
+
+	// Build rule groups from config. Rules may start background goroutines,
+	// so this comes after everything that can fail; Close stops them.
+	allowRules, denyRules := buildRules(cfg.Profile)
+	if cfg.RateLimitStore != nil {
+		shareRateLimits(cfg.RateLimitStore, cfg.Profile.ID, allowRules, denyRules)
+	}
+	timing := rules.EvaluatorOptions{SampleRate: cfg.RuleTimingSampleRate}
+	if h.metrics != nil || h.profileMetrics != nil {
+		timing.Observe = func(ruleType string, d time.Duration) {
+			h.recordMetrics(func(m *metrics.Metrics) { m.RecordRuleEvalDuration(ruleType, d) })
+		}
+	}
+	h.decisionEngine = newDecisionEngine(cfg.Profile, allowRules, denyRules, timing)
+	h.stoppers = stoppableRules(allowRules, denyRules)
+	h.responseObservers = responseObservingRules(allowRules, denyRules)
+
 	// Build decoy strategy
 	h.decoyStrategy = buildDecoyStrategy(cfg.Profile.Decoy)
+	h.blockResponse = buildBlockResponse(cfg.Profile.BlockStatus, cfg.Profile.BlockBody)
 
 	return h, nil
 }
 
-func buildRuleGroup(cfg *config.RuleGroup) *rules.Group {
+// NewDecisionEngine builds the decision engine for a profile's rules alone,
+// without backends or decoys, for evaluating requests offline. Background
+// work started by stateful rules such as rate_limit is never stopped, so
+// it is meant for short-lived tools rather than the gateway itself.
+func NewDecisionEngine(p config.ProfileConfig) *decision.Engine {
+	allowRules, denyRules := buildRules(p)
+	return newDecisionEngine(p, allowRules, denyRules, rules.EvaluatorOptions{})
+}
+
+// buildRules builds the allow and deny rule groups of a profile
+func buildRules(p config.ProfileConfig) (allowRules, denyRules *rules.Group) {
+	optimize := p.Rules.OptimizeOrder
+	if p.Rules.Allow != nil {
+		allowRules = buildRuleGroup(p.Rules.Allow, optimize)
+	}
+	if p.Rules.Deny != nil {
+		denyRules = buildRuleGroup(p.Rules.Deny, optimize)
+	}
+	return allowRules, denyRules
+}
+
+// newDecisionEngine creates the engine evaluating a profile's rule groups
+// with the profile's deny action and bypass token, timing rules as configured
+func newDecisionEngine(p config.ProfileConfig, allowRules, denyRules *rules.Group, timing rules.EvaluatorOptions) *decision.Engine {
+	engineOpts := decision.DefaultEngineOptions()
+	switch strings.ToLower(p.DenyAction) {
+	case "block":
+		engineOpts.DenyAction = decision.Block
+	case "tarpit":
+		engineOpts.DenyAction = decision.Tarpit
+	case "drop":
+		engineOpts.DenyAction = decision.Drop
+	}
+	engineOpts.BypassToken = p.BypassToken
+	if p.BypassHeader != "" {
+		engineOpts.BypassHeader = p.BypassHeader
+	}
+	engineOpts.Timing = timing
+	return decision.NewEngineWithOptions(allowRules, denyRules, engineOpts)
+}
+
+// DecisionEngine returns the engine that evaluates the profile's rules
+func (h *Handler) DecisionEngine() *decision.Engine {
+	return h.decisionEngine
+}
+
+// Close stops background work started by the handler's rules, such as rate
+// limit cleanup. The handler keeps serving requests afterwards, so it is
+// safe to close a handler that a listener may still be using while it is
+// replaced.
+func (h *Handler) Close() error {
+	for _, s := range h.stoppers {
+		s.Stop()
+	}
+	return nil
+}
+
+// stoppableRules returns the rules in groups that need to be stopped
+func stoppableRules(groups ...*rules.Group) []stopper {
+	var stoppers []stopper
+	walkRules(groups, func(r rules.Rule) {
+		if s, ok := r.(stopper); ok {
+			stoppers = append(stoppers, s)
+		}
+	})
+	return stoppers
+}
+
+// responseObservingRules returns the rules in groups that want to see
+// response statuses
+func responseObservingRules(groups ...*rules.Group) []responseObserver {
+	var observers []responseObserver
+	walkRules(groups, func(r rules.Rule) {
+		if o, ok := r.(responseObserver); ok {
+			observers = append(observers, o)
+		}
+	})
+	return observers
+}
+
+// shareRateLimits moves the counters of rate_limit rules in groups to
+// store. Rules are namespaced by profile and position, which match across
+// instances running the same configuration.
+func shareRateLimits(store rules.RateLimitStore, profileID string, groups ...*rules.Group) {
+	n := 0
+	walkRules(groups, func(r rules.Rule) {
+		if rl, ok := r.(*rules.RateLimitRule); ok {
+			rl.SetStore(store, fmt.Sprintf("%s:%d:", profileID, n))
+			n++
+		}
+	})
+}
+
+// walkRules calls visit for every rule in groups
+func walkRules(groups []*rules.Group, visit func(r rules.Rule)) {
+	for _, g := range groups {
+		if g == nil {
+			continue
+		}
+		for _, r := range g.And {
+			visit(r)
+		}
+		for _, r := range g.Or {
+			visit(r)
+		}
+		visit(g.Not)
+		visit(g.Single)
+	}
+}
+
+func buildRuleGroup(cfg *config.RuleGroup, optimize bool) *rules.Group {
 	if cfg == nil {
 		return nil
 	}
@@ -150,6 +456,11 @@ func buildRuleGroup(cfg *config.RuleGroup) *rules.Group {
 		group.Single = buildRule(*cfg.Rule)
 	}
 
+	// Run cheap AND rules before expensive ones
+	if optimize {
+		group.OptimizeOrder()
+	}
+
 	return group
 }
 
@@ -167,13 +478,13 @@ func buildRule(rc config.Rule) rules.Rule {
 	case "ua_blacklist":
 		r, err = rules.NewUARule(rc.Patterns, "blacklist")
 	case "geo_allow":
-		r, err = rules.NewGeoRule(rc.Countries, "allow")
+		r, err = rules.NewGeoRuleWithFailMode(rc.Countries, "allow", rc.GeoIPFailMode)
 	case "geo_deny":
-		r, err = rules.NewGeoRule(rc.Countries, "deny")
+		r, err = rules.NewGeoRuleWithFailMode(rc.Countries, "deny", rc.GeoIPFailMode)
 	case "asn_allow":
-		r, err = rules.NewASNRule(rc.ASNs, "allow")
+		r, err = rules.NewASNRuleWithFailMode(rc.ASNs, "allow", rc.GeoIPFailMode)
 	case "asn_deny":
-		r, err = rules.NewASNRule(rc.ASNs, "deny")
+		r, err = rules.NewASNRuleWithFailMode(rc.ASNs, "deny", rc.GeoIPFailMode)
 	case "method_allow":
 		r, err = rules.NewMethodRule(rc.Methods, "allow")
 	case "method_deny":
@@ -182,16 +493,73 @@ func buildRule(rc config.Rule) rules.Rule {
 		r, err = rules.NewPathRule(rc.Paths, "allow")
 	case "path_deny":
 		r, err = rules.NewPathRule(rc.Paths, "deny")
+	case "http_version_allow":
+		r, err = rules.NewProtocolRule(rc.HTTPVersions, "allow")
+	case "http_version_deny":
+		r, err = rules.NewProtocolRule(rc.HTTPVersions, "deny")
+	case "host_allow":
+		r, err = rules.NewHostRule(rc.Hosts, rc.HostPatterns, "allow")
+	case "host_deny":
+		r, err = rules.NewHostRule(rc.Hosts, rc.HostPatterns, "deny")
 	case "header_allow":
 		r, err = rules.NewHeaderRule(rc.HeaderName, rc.Patterns, rc.RequireHeader, "allow")
 	case "header_deny":
 		r, err = rules.NewHeaderRule(rc.HeaderName, rc.Patterns, rc.RequireHeader, "deny")
+	case "header_set":
+		r, err = rules.NewHeaderSetRule(rc.HeaderNames, rc.HeaderSetMode)
+	case "query_allow":
+		r, err = rules.NewQueryRule(rc.QueryParam, rc.QueryValues, rc.Patterns, rc.RequireParam, "allow")
+	case "query_deny":
+		r, err = rules.NewQueryRule(rc.QueryParam, rc.QueryValues, rc.Patterns, rc.RequireParam, "deny")
+	case "cookie_allow":
+		r, err = rules.NewCookieRule(rc.CookieName, rc.Patterns, rc.RequireCookie, "allow")
+	case "cookie_deny":
+		r, err = rules.NewCookieRule(rc.CookieName, rc.Patterns, rc.RequireCookie, "deny")
+	case "body_allow":
+		r, err = rules.NewBodyRule(rc.Patterns, rc.MaxBodyBytes, "allow")
+	case "body_deny":
+		r, err = rules.NewBodyRule(rc.Patterns, rc.MaxBodyBytes, "deny")
+	case "waf":
+		r, err = rules.NewWAFRule(rc.Ruleset, rc.Categories)
+	case "auth":
+		users := make(map[string]string, len(rc.Users))
+		if rc.Htpasswd != "" {
+			users, err = rules.LoadHtpasswd(rc.Htpasswd)
+			if err != nil {
+				break
+			}
+		}
+		for user, hash := range rc.Users {
+			users[user] = hash
+		}
+		r, err = rules.NewAuthRule(rc.AuthScheme, users, rc.Tokens)
+	case "jwt":
+		cfg := rules.JWTConfig{
+			Issuers:   rc.JWTIssuers,
+			Audiences: rc.JWTAudiences,
+			Claims:    rc.JWTClaims,
+			Secret:    []byte(rc.JWTSecret),
+		}
+		cfg.Leeway, _ = time.ParseDuration(rc.MaxSkew)
+		if rc.JWTPublicKeyFile != "" {
+			cfg.PublicKey, err = rules.LoadRSAPublicKey(rc.JWTPublicKeyFile)
+			if err != nil {
+				break
+			}
+		}
+		r, err = rules.NewJWTRule(cfg)
 	case "tls_version":
 		r, err = rules.NewTLSVersionRule(rc.TLSMinVersion, rc.TLSMaxVersion)
+	case "require_tls":
+		r = rules.NewRequireTLSRule()
 	case "sni_allow":
 		r, err = rules.NewSNIRule(rc.SNIPatterns, rc.RequireSNI, "allow")
 	case "sni_deny":
 		r, err = rules.NewSNIRule(rc.SNIPatterns, rc.RequireSNI, "deny")
+	case "alpn_allow":
+		r, err = rules.NewALPNRule(rc.ALPNProtocols, "allow")
+	case "alpn_deny":
+		r, err = rules.NewALPNRule(rc.ALPNProtocols, "deny")
 	case "rate_limit":
 		window, _ := time.ParseDuration(rc.Window)
 		if window == 0 {
@@ -201,7 +569,27 @@ func buildRule(rc config.Rule) rules.Rule {
 		if maxReqs == 0 {
 			maxReqs = 100
 		}
-		return rules.NewRateLimitRule(maxReqs, window)
+		r, err = rules.NewRateLimitRuleWithKey(maxReqs, window, rc.KeySource)
+	case "asn_rate_limit":
+		window, _ := time.ParseDuration(rc.Window)
+		if window == 0 {
+			window = time.Minute
+		}
+		maxReqs := rc.MaxRequests
+		if maxReqs == 0 {
+			maxReqs = 100
+		}
+		r, err = rules.NewASNRateLimitRule(maxReqs, window, rc.KeySource, rc.ASNLimits)
+	case "scanner_score":
+		window, _ := time.ParseDuration(rc.Window)
+		r, err = rules.NewScannerScoreRule(rc.MaxErrors, window, rc.Statuses)
+	case "nonce":
+		window, _ := time.ParseDuration(rc.Window)
+		if window == 0 {
+			window = 5 * time.Minute
+		}
+		maxSkew, _ := time.ParseDuration(rc.MaxSkew)
+		r, err = rules.NewNonceRule(rc.NonceHeader, rc.TimestampHeader, window, maxSkew, rc.MaxNonces)
 	case "time_window":
 		windows := make([]rules.TimeWindow, 0, len(rc.TimeWindows))
 		for _, tw := range rc.TimeWindows {
@@ -225,33 +613,149 @@ func buildRule(rc config.Rule) rules.Rule {
 	return r
 }
 
+// buildDecoyStrategy creates the profile decoy, wrapped in a selector when
+// decoy targets are configured
 func buildDecoyStrategy(cfg config.DecoyConfig) decoy.Strategy {
+	if len(cfg.Targets) == 0 {
+		return buildDecoy(cfg)
+	}
+	sel := decoy.NewSelector(buildDecoy(cfg))
+	for _, t := range cfg.Targets {
+		decoys := make([]decoy.Weighted, len(t.Decoys))
+		for i, d := range t.Decoys {
+			decoys[i] = decoy.Weighted{Strategy: buildDecoy(d.DecoyConfig), Weight: d.Weight}
+		}
+		sel.AddTarget(t.Labels, decoys)
+	}
+	return sel
+}
+
+// buildDecoy creates the decoy for a single decoy mode
+func buildDecoy(cfg config.DecoyConfig) decoy.Strategy {
 	switch cfg.Mode {
 	case "static":
-		body := cfg.Body
-		if cfg.BodyFile != "" {
-			d, err := decoy.NewStaticDecoyFromFile(cfg.StatusCode, cfg.BodyFile, "")
-			if err == nil {
-				return d
-			}
-		}
-		statusCode := cfg.StatusCode
-		if statusCode == 0 {
-			statusCode = http.StatusOK
+		return buildStaticDecoy(cfg)
+
+	case "honeypot":
+		// The static settings serve requests while the honeypot is down
+		fallback := buildStaticDecoy(cfg)
+		d, err := decoy.NewHoneypotDecoy(cfg.HoneypotURL, cfg.MarkerHeader, fallback)
+		if err != nil {
+			log.Printf("Warning: honeypot decoy disabled: %v", err)
+			return fallback
 		}
-		return decoy.NewStaticDecoy(statusCode, body, "")
+		return d
 
 	case "redirect":
-		return decoy.NewRedirectDecoy(http.StatusFound, cfg.RedirectTo)
+		d := decoy.NewRedirectDecoy(http.StatusFound, cfg.RedirectTo)
+		copyHeaders(d.Headers, cfg.Headers)
+		return d
 
 	default:
 		// Default: simple 200 OK
-		return decoy.NewStaticDecoy(http.StatusOK, "", "")
+		d := decoy.NewStaticDecoy(http.StatusOK, "", cfg.ContentType)
+		copyHeaders(d.Headers, cfg.Headers)
+		return d
+	}
+}
+
+// buildStaticDecoy creates a static decoy from the body settings of cfg
+func buildStaticDecoy(cfg config.DecoyConfig) *decoy.StaticDecoy {
+	statusCode := cfg.StatusCode
+	if statusCode == 0 {
+		statusCode = http.StatusOK
+	}
+	var d *decoy.StaticDecoy
+	if cfg.BodyFile != "" {
+		d, _ = decoy.NewStaticDecoyFromFile(statusCode, cfg.BodyFile, cfg.ContentType)
 	}
+	if d == nil {
+		d = decoy.NewStaticDecoy(statusCode, cfg.Body, cfg.ContentType)
+	}
+	copyHeaders(d.Headers, cfg.Headers)
+	d.PaddingMin, d.PaddingMax = cfg.PaddingMin, cfg.PaddingMax
+	d.JitterMin, d.JitterMax = cfg.Jitter()
+	return d
+}
+
+// copyHeaders copies configured decoy headers into dst
+func copyHeaders(dst, src map[string]string) {
+	for k, v := range src {
+		dst[k] = v
+	}
+}
+
+// buildErrorPages loads the configured error pages, with profile pages
+// overriding global ones for the same status
+func buildErrorPages(global, profile map[int]config.ErrorPageConfig) (map[int]*decoy.StaticDecoy, error) {
+	merged := make(map[int]config.ErrorPageConfig, len(global)+len(profile))
+	for status, page := range global {
+		merged[status] = page
+	}
+	for status, page := range profile {
+		merged[status] = page
+	}
+
+	pages := make(map[int]*decoy.StaticDecoy, len(merged))
+	for status, page := range merged {
+		var d *decoy.StaticDecoy
+		if page.BodyFile != "" {
+			var err error
+			d, err = decoy.NewStaticDecoyFromFile(status, page.BodyFile, page.ContentType)
+			if err != nil {
+				return nil, fmt.Errorf("error page %d: %w", status, err)
+			}
+		} else {
+			d = decoy.NewStaticDecoy(status, page.Body, page.ContentType)
+		}
+		// Outage pages must not be cached past the outage
+		d.Headers["Cache-Control"] = "no-store"
+		pages[status] = d
+	}
+	return pages, nil
+}
+
+// writeError writes a gateway-generated error, using the configured error
+// page for status if there is one
+func (h *Handler) writeError(w http.ResponseWriter, r *http.Request, status int) {
+	if page, ok := h.errorPages[status]; ok {
+		page.Serve(w, r)
+		return
+	}
+	w.WriteHeader(status)
+}
+
+// buildBlockResponse builds the plain response served by the block deny action
+func buildBlockResponse(statusCode int, body string) *decoy.StaticDecoy {
+	if statusCode == 0 {
+		statusCode = http.StatusForbidden
+	}
+	if body == "" {
+		body = http.StatusText(statusCode)
+	}
+	contentType := "text/plain; charset=utf-8"
+	if json.Valid([]byte(body)) {
+		contentType = "application/json"
+	}
+	return decoy.NewStaticDecoy(statusCode, body, contentType)
 }
 
 // ServeHTTP handles incoming HTTP requests
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.headerLimits.enabled() {
+		if reason := h.headerLimits.check(r); reason != "" {
+			h.rejectHeaders(w, r, reason)
+			return
+		}
+	}
+
+	// A body declared larger than the limit is refused before anything
+	// reads it; bodies without a length are caught while being read
+	if r.ContentLength > h.maxRequestBody {
+		h.rejectBody(w, r)
+		return
+	}
+
 	start := time.Now()
 
 	// Generate or extract request ID for tracing
@@ -265,129 +769,429 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	r.Header.Set("X-Request-ID", requestID)
 
 	// Limit request body size to prevent DoS attacks
+	var body *countingReader
 	if r.Body != nil {
-		r.Body = http.MaxBytesReader(w, r.Body, h.maxRequestBody)
+		body = &countingReader{ReadCloser: http.MaxBytesReader(w, r.Body, h.maxRequestBody)}
+		r.Body = body
 	}
 
+	// Count response bytes for bandwidth metrics
+	cw := &countingResponseWriter{ResponseWriter: w}
+	w = cw
+
+	defer h.recoverPanic(cw, r, requestID)
+
 	// Extract client IP
 	clientIP := h.extractClientIP(r)
 
+	if h.learner != nil {
+		h.learner.Observe(learning.Observation{
+			ClientIP:  clientIP,
+			UserAgent: r.UserAgent(),
+			Path:      r.URL.Path,
+		})
+	}
+
 	// Evaluate rules
 	d := h.decisionEngine.Evaluate(r, clientIP)
+	h.recordMetrics(func(m *metrics.Metrics) { m.RecordRulesEvaluated(d.RulesEvaluated) })
+
+	if isBypass(d) {
+		h.auditBypass(r, requestID, clientIP)
+	}
 
 	// Execute action
 	var statusCode int
 	switch d.Action {
 	case decision.AllowForward:
-		backend := h.backendPool.NextHealthy()
-		if backend != nil {
-			backend.ServeHTTP(w, r)
-			statusCode = http.StatusOK // approximate
-		} else {
-			w.WriteHeader(http.StatusBadGateway)
-			statusCode = http.StatusBadGateway
+		statusCode = h.forward(w, r, clientIP)
+		if cw.status != 0 {
+			for _, o := range h.responseObservers {
+				o.ObserveResponse(clientIP, cw.status)
+			}
 		}
 
 	case decision.DenyDecoy:
-		h.decoyStrategy.Serve(w, r)
+		h.decoyFor(d).Serve(w, r)
 		statusCode = http.StatusOK // approximate
 
+	case decision.Block:
+		h.blockResponse.Serve(w, r)
+		statusCode = h.blockResponse.StatusCode
+
 	case decision.Drop:
-		drop := &decoy.DropDecoy{}
-		drop.Serve(w, r)
-		return // don't log for dropped connections
+		h.dropDecoy.Serve(w, r)
+		statusCode = 0 // no response was sent
 
 	case decision.Redirect:
 		http.Redirect(w, r, d.RedirectURL, http.StatusFound)
 		statusCode = http.StatusFound
 
 	case decision.Tarpit:
-		tarpit := decoy.NewTarpitDecoy(5*time.Second, 30*time.Second, h.decoyStrategy)
+		tarpit := decoy.NewTarpitDecoy(5*time.Second, 30*time.Second, h.decoyFor(d))
 		tarpit.Serve(w, r)
 		statusCode = http.StatusOK
 
 	default:
-		w.WriteHeader(http.StatusInternalServerError)
+		h.writeError(w, r, http.StatusInternalServerError)
 		statusCode = http.StatusInternalServerError
 	}
 
+	if body != nil && body.tooLarge {
+		h.recordMetrics(func(m *metrics.Metrics) { m.RecordOversizedBody() })
+		if d.Action == decision.AllowForward {
+			statusCode = http.StatusRequestEntityTooLarge
+		}
+	}
+
 	duration := float64(time.Since(start).Microseconds()) / 1000.0
 
+	var tlsVersion, tlsCipher, sni string
+	if r.TLS != nil {
+		tlsVersion = tls.VersionName(r.TLS.Version)
+		tlsCipher = tls.CipherSuiteName(r.TLS.CipherSuite)
+		sni = r.TLS.ServerName
+	}
+
 	// Record metrics
-	if h.metrics != nil {
-		h.metrics.RecordRequest(h.profileID, clientIP, d.Action.String(), duration)
+	bytesIn := requestBytes(r, body)
+	h.recordMetrics(func(m *metrics.Metrics) {
+		m.RecordRequestWithRule(h.profileID, clientIP, d.Action.String(), d.RuleType, duration)
+		m.RecordBytes(h.profileID, bytesIn, cw.bytes)
+		if tlsVersion != "" {
+			m.RecordTLSVersion(tlsVersion)
+		}
+	})
+
+	// Log the request, publish it to live subscribers and keep it for
+	// inspection
+	if h.logger == nil && h.events == nil && h.recent == nil {
+		return
+	}
+	entry := logging.RequestLog{
+		Timestamp:  start,
+		RequestID:  requestID,
+		ProfileID:  h.profileID,
+		ClientIP:   clientIP,
+		Method:     r.Method,
+		Path:       r.URL.Path,
+		UserAgent:  r.Header.Get("User-Agent"),
+		Action:     d.Action.String(),
+		Reason:     d.Reason,
+		Labels:     d.Labels,
+		StatusCode: statusCode,
+		Duration:   duration,
+		TLSVersion: tlsVersion,
+		TLSCipher:  tlsCipher,
+		SNI:        sni,
+	}
+	if h.logger != nil {
+		h.logger.LogRequest(entry)
+	}
+	if h.events != nil {
+		h.events.Publish(entry)
+	}
+	if h.recent != nil {
+		h.recent.Add(entry)
+	}
+}
+
+// decoyFor returns the decoy for a denied request, chosen by the labels of
+// its decision when decoy targets are configured
+func (h *Handler) decoyFor(d decision.Decision) decoy.Strategy {
+	if sel, ok := h.decoyStrategy.(*decoy.Selector); ok {
+		return sel.Select(d.Labels)
+	}
+	return h.decoyStrategy
+}
+
+// recoverPanic turns a panic in a rule, decoy or backend into a logged 500
+// so one bad request cannot take down the serving goroutine silently
+func (h *Handler) recoverPanic(w *countingResponseWriter, r *http.Request, requestID string) {
+	p := recover()
+	if p == nil {
+		return
+	}
+	if p == http.ErrAbortHandler {
+		// Deliberate abort (e.g. the backend response failed mid-body)
+		panic(p)
+	}
+
+	h.recordMetrics(func(m *metrics.Metrics) { m.RecordPanic() })
+	fields := map[string]interface{}{
+		"profile":     h.profileID,
+		"request_id":  requestID,
+		"method":      r.Method,
+		"path":        r.URL.Path,
+		"remote_addr": r.RemoteAddr,
+		"panic":       fmt.Sprint(p),
+		"stack":       string(debug.Stack()),
+	}
+	if h.logger != nil {
+		h.logger.Error("Panic while handling request", fields)
+	} else {
+		log.Printf("panic while handling request %s: %v\n%s", requestID, p, fields["stack"])
+	}
+
+	if w.status != 0 {
+		// Part of the response is already out; abort the connection rather
+		// than let a truncated response look complete
+		panic(http.ErrAbortHandler)
+	}
+	h.writeError(w, r, http.StatusInternalServerError)
+}
+
+// isBypass reports whether the decision came from the bypass token
+func isBypass(d decision.Decision) bool {
+	for _, l := range d.Labels {
+		if l == "bypass" {
+			return true
+		}
 	}
+	return false
+}
 
-	// Log the request
+// rejectHeaders answers a request whose headers exceed the profile limits
+// before any rule runs
+func (h *Handler) rejectHeaders(w http.ResponseWriter, r *http.Request, reason string) {
 	if h.logger != nil {
-		h.logger.LogRequest(logging.RequestLog{
-			Timestamp:  start,
-			RequestID:  requestID,
-			ProfileID:  h.profileID,
-			ClientIP:   clientIP,
-			Method:     r.Method,
-			Path:       r.URL.Path,
-			UserAgent:  r.Header.Get("User-Agent"),
-			Action:     d.Action.String(),
-			Reason:     d.Reason,
-			Labels:     d.Labels,
-			StatusCode: statusCode,
-			Duration:   duration,
+		h.logger.Warn("Request headers over limit", map[string]interface{}{
+			"profile":     h.profileID,
+			"remote_addr": r.RemoteAddr,
+			"method":      r.Method,
+			"path":        r.URL.Path,
+			"reason":      reason,
 		})
 	}
+	h.writeError(w, r, http.StatusRequestHeaderFieldsTooLarge)
+}
+
+// rejectBody answers a request whose declared body size is over the limit
+func (h *Handler) rejectBody(w http.ResponseWriter, r *http.Request) {
+	h.recordMetrics(func(m *metrics.Metrics) { m.RecordOversizedBody() })
+	if h.logger != nil {
+		h.logger.Warn("Request body over limit", map[string]interface{}{
+			"profile":        h.profileID,
+			"remote_addr":    r.RemoteAddr,
+			"method":         r.Method,
+			"path":           r.URL.Path,
+			"content_length": r.ContentLength,
+			"limit":          h.maxRequestBody,
+		})
+	}
+	// The unread body would otherwise be drained before the next request
+	w.Header().Set("Connection", "close")
+	h.writeError(w, r, http.StatusRequestEntityTooLarge)
+}
+
+// auditBypass logs use of the break-glass token and strips it so the secret
+// is never forwarded to the backend
+func (h *Handler) auditBypass(r *http.Request, requestID, clientIP string) {
+	r.Header.Del(h.decisionEngine.BypassHeader())
+	if h.logger != nil {
+		h.logger.Warn("Bypass token used", map[string]interface{}{
+			"profile":    h.profileID,
+			"request_id": requestID,
+			"client_ip":  clientIP,
+			"method":     r.Method,
+			"path":       r.URL.Path,
+			"user_agent": r.Header.Get("User-Agent"),
+		})
+	}
+}
+
+// forward proxies the request to a backend, enforcing the request timeout
+// and retrying idempotent requests on other backends when configured
+func (h *Handler) forward(w http.ResponseWriter, r *http.Request, clientIP string) int {
+	if h.backendPool.Len() == 0 {
+		h.writeError(w, r, http.StatusBadGateway)
+		return http.StatusBadGateway
+	}
+
+	if h.backendQueue != nil && !h.backendQueue.wait(r.Context()) {
+		h.writeError(w, r, http.StatusServiceUnavailable)
+		return http.StatusServiceUnavailable
+	}
+
+	ctx := proxy.WithClientIP(r.Context(), clientIP)
+	if len(h.errorPages) > 0 {
+		ctx = proxy.WithErrorWriter(ctx, h.writeError)
+	}
+	if h.metrics != nil {
+		ctx = proxy.WithObserver(ctx, h.observeBackend)
+	}
+	if h.backendHeader != nil && h.backendHeader.applies(r, clientIP) {
+		ctx = proxy.WithBackendHeader(ctx, h.backendHeader.header)
+	}
+	if h.requestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.requestTimeout)
+		defer cancel()
+	}
+	r = r.WithContext(ctx)
+
+	if h.compressor != nil {
+		var done func()
+		w, done = h.compressor.wrap(w, r)
+		defer done()
+	}
+
+	if h.retry.MaxRetries > 0 {
+		h.backendPool.ServeHTTPWithRetryOptions(w, r, h.retry)
+	} else {
+		h.backendPool.NextBackend().ServeHTTP(w, r)
+	}
+
+	if h.requestTimeout > 0 && errors.Is(r.Context().Err(), context.DeadlineExceeded) {
+		h.recordMetrics(func(m *metrics.Metrics) { m.RecordTimeout() })
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusOK // approximate
+}
+
+// observeBackend records the outcome of a request proxied to a backend
+func (h *Handler) observeBackend(backend string, status int, latency time.Duration, failure proxy.Failure) {
+	h.recordMetrics(func(m *metrics.Metrics) {
+		m.RecordBackendRequest(backend, latency.Microseconds(), status)
+		switch failure {
+		case proxy.FailureTimeout:
+			m.RecordBackendTimeout(backend)
+		case proxy.FailureConnection:
+			m.RecordBackendConnectionError(backend)
+		}
+	})
+}
+
+// recordMetrics applies record to the shared collector and, when enabled,
+// the profile's isolated collector
+func (h *Handler) recordMetrics(record func(m *metrics.Metrics)) {
+	if h.metrics != nil {
+		record(h.metrics)
+	}
+	if h.profileMetrics != nil {
+		record(h.profileMetrics)
+	}
 }
 
 // extractClientIP extracts the client IP from the request.
 // If trusted proxies are configured, X-Forwarded-For is only trusted when
 // the request comes from a trusted proxy.
 func (h *Handler) extractClientIP(r *http.Request) string {
+	// A PROXY header from a trusted load balancer names the direct client.
+	// The balancer works below HTTP and never sets client IP headers, so
+	// they are only believed when that client is itself a trusted proxy.
+	if src, ok := listener.ProxySource(r.Context()); ok {
+		if h.isTrustedProxy(src) {
+			if ip := h.headerClientIP(r); ip != "" {
+				return ip
+			}
+		}
+		return src
+	}
+
 	// Get the direct connection IP
 	directIP, _, err := net.SplitHostPort(r.RemoteAddr)
 	if err != nil {
 		directIP = r.RemoteAddr
 	}
 
-	// If no trusted proxies configured, use legacy behavior (trust XFF)
-	// For backwards compatibility
+	// If no trusted proxies configured, use legacy behavior (trust the
+	// client IP headers). For backwards compatibility
 	if len(h.trustedProxies) == 0 {
-		if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-			parts := strings.Split(xff, ",")
-			if len(parts) > 0 {
-				return strings.TrimSpace(parts[0])
-			}
-		}
-		if xri := r.Header.Get("X-Real-IP"); xri != "" {
-			return xri
+		if ip := h.headerClientIP(r); ip != "" {
+			return ip
 		}
 		return directIP
 	}
 
-	// Check if the direct connection is from a trusted proxy
-	directParsed := net.ParseIP(directIP)
-	if directParsed == nil {
-		return directIP
+	// Only trust the client IP headers if request is from a trusted proxy
+	if h.isTrustedProxy(directIP) {
+		if ip := h.headerClientIP(r); ip != "" {
+			return ip
+		}
 	}
 
-	isTrusted := false
+	return directIP
+}
+
+// isTrustedProxy reports whether ip falls within a trusted proxy range
+func (h *Handler) isTrustedProxy(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
 	for _, network := range h.trustedProxies {
-		if network.Contains(directParsed) {
-			isTrusted = true
-			break
+		if network.Contains(parsed) {
+			return true
 		}
 	}
+	return false
+}
 
-	// Only trust X-Forwarded-For if request is from a trusted proxy
-	if isTrusted {
-		if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-			parts := strings.Split(xff, ",")
-			if len(parts) > 0 {
-				return strings.TrimSpace(parts[0])
+// headerClientIP returns the client IP from the first configured header
+// present on the request. Headers holding a list, like X-Forwarded-For,
+// yield their first (original client) entry, with trustedHops their
+// rightmost entry that is not a trusted proxy, or with trustedCount the
+// entry added by the outermost of that many proxies.
+func (h *Handler) headerClientIP(r *http.Request) string {
+	headers := h.clientIPHeaders
+	if len(headers) == 0 {
+		headers = DefaultClientIPHeaders
+	}
+	for _, name := range headers {
+		if h.trustedHops || h.trustedCount > 0 {
+			values := r.Header.Values(name)
+			if len(values) == 0 {
+				continue
 			}
+			if h.trustedHops {
+				return h.rightmostUntrusted(strings.Join(values, ","))
+			}
+			return nthFromRight(strings.Join(values, ","), h.trustedCount)
 		}
-		if xri := r.Header.Get("X-Real-IP"); xri != "" {
-			return xri
+		if v := r.Header.Get(name); v != "" {
+			first, _, _ := strings.Cut(v, ",")
+			return strings.TrimSpace(first)
 		}
 	}
+	return ""
+}
 
-	return directIP
+// rightmostUntrusted walks a comma-separated address list from the right,
+// skipping trusted proxies, and returns the first address that is not one.
+// Entries left of it were supplied by the client and may be forged. If every
+// entry is trusted the leftmost is returned.
+func (h *Handler) rightmostUntrusted(list string) string {
+	entries := strings.Split(list, ",")
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := strings.TrimSpace(entries[i])
+		if entry == "" {
+			continue
+		}
+		if !h.isTrustedProxy(entry) {
+			return entry
+		}
+	}
+	return strings.TrimSpace(entries[0])
+}
+
+// nthFromRight returns the nth non-empty entry from the right of a
+// comma-separated address list. Behind exactly n proxies, the outermost one
+// appended the client address there and everything to its left was supplied
+// by the client. A shorter list was written entirely by the proxies, so its
+// leftmost entry is returned.
+func nthFromRight(list string, n int) string {
+	var entries []string
+	for _, e := range strings.Split(list, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			entries = append(entries, e)
+		}
+	}
+	if len(entries) == 0 {
+		return ""
+	}
+	if n > len(entries) {
+		n = len(entries)
+	}
+	return entries[len(entries)-n]
 }
@@ -1,13 +1,29 @@
 package gateway
 
 import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
 	"io"
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 
 	"shadowgate/internal/config"
+	"shadowgate/internal/decision"
+	"shadowgate/internal/events"
+	"shadowgate/internal/listener"
+	"shadowgate/internal/logging"
+	"shadowgate/internal/metrics"
+	"shadowgate/internal/rules"
 )
 
 func TestHandlerAllowForward(t *testing.T) {
@@ -104,6 +120,400 @@ func TestHandlerDenyDecoy(t *testing.T) {
 	}
 }
 
+func TestHandlerDecoyTargets(t *testing.T) {
+	handler, err := NewHandler(Config{
+		ProfileID: "test",
+		Profile: config.ProfileConfig{
+			Rules: config.RulesConfig{
+				Allow: &config.RuleGroup{
+					And: []config.Rule{{Type: "ip_allow", CIDRs: []string{"192.168.0.0/16"}}},
+				},
+				Deny: &config.RuleGroup{
+					Or: []config.Rule{{Type: "ua_blacklist", Patterns: []string{"sqlmap"}}},
+				},
+			},
+			Backends: []config.BackendConfig{{Name: "primary", URL: "http://127.0.0.1:9999", Weight: 10}},
+			Decoy: config.DecoyConfig{
+				Mode: "static",
+				Body: "login page",
+				Targets: []config.DecoyTargetConfig{{
+					Labels: []string{"ua-blacklist"},
+					Decoys: []config.WeightedDecoyConfig{
+						{DecoyConfig: config.DecoyConfig{Mode: "static", StatusCode: 500, Body: "sql error"}},
+					},
+				}},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+
+	tests := []struct {
+		remoteAddr string
+		userAgent  string
+		body       string
+	}{
+		{"192.168.1.1:12345", "sqlmap/1.7", "sql error"},
+		{"8.8.8.8:12345", "curl/8.0", "login page"},
+	}
+	for _, tc := range tests {
+		req := httptest.NewRequest("GET", "/test", nil)
+		req.RemoteAddr = tc.remoteAddr
+		req.Header.Set("User-Agent", tc.userAgent)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Body.String() != tc.body {
+			t.Errorf("%s: expected %q, got %q", tc.userAgent, tc.body, rr.Body.String())
+		}
+	}
+}
+
+func TestHandlerDecoyHeaders(t *testing.T) {
+	cfg := Config{
+		ProfileID: "test",
+		Profile: config.ProfileConfig{
+			Rules: config.RulesConfig{
+				Allow: &config.RuleGroup{
+					And: []config.Rule{
+						{Type: "ip_allow", CIDRs: []string{"192.168.0.0/16"}},
+					},
+				},
+			},
+			Decoy: config.DecoyConfig{
+				Mode:        "static",
+				StatusCode:  404,
+				Body:        `{"error":"not found"}`,
+				ContentType: "application/json",
+				Headers:     map[string]string{"Server": "nginx/1.24.0"},
+			},
+		},
+	}
+
+	handler, err := NewHandler(cfg)
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/test", nil)
+	req.RemoteAddr = "8.8.8.8:12345"
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected status 404, got %d", rr.Code)
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("expected JSON content type, got %q", ct)
+	}
+	if server := rr.Header().Get("Server"); server != "nginx/1.24.0" {
+		t.Errorf("expected fake Server header, got %q", server)
+	}
+}
+
+func TestHandlerDenyBlock(t *testing.T) {
+	cfg := Config{
+		ProfileID: "test",
+		Profile: config.ProfileConfig{
+			Rules: config.RulesConfig{
+				Allow: &config.RuleGroup{
+					And: []config.Rule{
+						{Type: "ip_allow", CIDRs: []string{"192.168.0.0/16"}},
+					},
+				},
+			},
+			Backends: []config.BackendConfig{
+				{Name: "primary", URL: "http://127.0.0.1:9999", Weight: 10},
+			},
+			Decoy: config.DecoyConfig{
+				Mode:       "static",
+				StatusCode: 200,
+				Body:       "decoy response",
+			},
+			DenyAction: "block",
+			BlockBody:  `{"error":"forbidden"}`,
+		},
+	}
+
+	handler, err := NewHandler(cfg)
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/test", nil)
+	req.RemoteAddr = "8.8.8.8:12345"
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("expected status 403, got %d", rr.Code)
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("expected JSON content type, got %q", ct)
+	}
+
+	body, _ := io.ReadAll(rr.Body)
+	if string(body) != `{"error":"forbidden"}` {
+		t.Errorf("expected block body, got %q", string(body))
+	}
+}
+
+func TestNewDecisionEngine(t *testing.T) {
+	engine := NewDecisionEngine(config.ProfileConfig{
+		Rules: config.RulesConfig{
+			Allow: &config.RuleGroup{
+				Rule: &config.Rule{Type: "ip_allow", CIDRs: []string{"10.0.0.0/8"}},
+			},
+			Deny: &config.RuleGroup{
+				Rule: &config.Rule{Type: "path_deny", Paths: []string{"^/admin"}},
+			},
+		},
+		DenyAction: "block",
+	})
+
+	tests := []struct {
+		ip     string
+		path   string
+		action decision.Action
+	}{
+		{"10.1.2.3", "/", decision.AllowForward},
+		{"10.1.2.3", "/admin", decision.Block},
+		{"8.8.8.8", "/", decision.Block},
+	}
+	for _, tc := range tests {
+		d := engine.Evaluate(httptest.NewRequest("GET", tc.path, nil), tc.ip)
+		if d.Action != tc.action {
+			t.Errorf("%s %s: expected %s, got %s (%s)", tc.ip, tc.path, tc.action, d.Action, d.Reason)
+		}
+	}
+}
+
+// countingStore records the keys rate limit rules count under
+type countingStore map[string]int
+
+func (s countingStore) Increment(key string, window time.Duration) (int, error) {
+	s[key]++
+	return s[key], nil
+}
+
+func (s countingStore) Count(key string) (int, error) {
+	return s[key], nil
+}
+
+func TestShareRateLimits(t *testing.T) {
+	allow := buildRuleGroup(&config.RuleGroup{And: []config.Rule{
+		{Type: "rate_limit", MaxRequests: 10, Window: "1m"},
+		{Type: "ip_allow", CIDRs: []string{"0.0.0.0/0"}},
+	}}, false)
+	deny := buildRuleGroup(&config.RuleGroup{Rule: &config.Rule{Type: "rate_limit", MaxRequests: 1, Window: "1m", KeySource: "header:X-API-Key"}}, false)
+	defer func() {
+		for _, s := range stoppableRules(allow, deny) {
+			s.Stop()
+		}
+	}()
+
+	store := countingStore{}
+	shareRateLimits(store, "api", allow, deny)
+
+	ctx := &rules.Context{Request: httptest.NewRequest("GET", "/", nil), ClientIP: "192.0.2.1"}
+	allow.And[0].Evaluate(ctx)
+	deny.Single.Evaluate(ctx)
+	if store["api:0:192.0.2.1"] != 1 || store["api:1:192.0.2.1"] != 1 {
+		t.Errorf("expected one key per rule namespaced by profile and position, got %v", store)
+	}
+}
+
+func TestHandlerRequestTimeout(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(2 * time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer backend.Close()
+
+	m := metrics.New()
+	handler, err := NewHandler(Config{
+		ProfileID: "test",
+		Profile: config.ProfileConfig{
+			Backends: []config.BackendConfig{
+				{Name: "slow", URL: backend.URL, Weight: 1},
+			},
+			RequestTimeout: "50ms",
+		},
+		Metrics: m,
+	})
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/test", nil)
+	req.RemoteAddr = "10.0.0.1:12345"
+	rr := httptest.NewRecorder()
+
+	start := time.Now()
+	handler.ServeHTTP(rr, req)
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected request to be cancelled quickly, took %v", elapsed)
+	}
+	if rr.Code != http.StatusGatewayTimeout {
+		t.Errorf("expected status 504, got %d", rr.Code)
+	}
+	if got := m.GetSnapshot().TimeoutRequests; got != 1 {
+		t.Errorf("expected 1 timeout recorded, got %d", got)
+	}
+}
+
+func TestHandlerRecordsBytes(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.Write([]byte("backend response"))
+	}))
+	defer backend.Close()
+
+	m := metrics.New()
+	handler, err := NewHandler(Config{
+		ProfileID: "test",
+		Profile: config.ProfileConfig{
+			Backends: []config.BackendConfig{
+				{Name: "primary", URL: backend.URL, Weight: 1},
+			},
+		},
+		Metrics: m,
+	})
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+
+	req := httptest.NewRequest("POST", "/upload", strings.NewReader("0123456789"))
+	req.RemoteAddr = "10.0.0.1:12345"
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	snapshot := m.GetSnapshot()
+	if got := snapshot.ProfileBytesIn["test"]; got != 10 {
+		t.Errorf("expected 10 bytes in, got %d", got)
+	}
+	if got := snapshot.ProfileBytesOut["test"]; got != int64(len("backend response")) {
+		t.Errorf("expected %d bytes out, got %d", len("backend response"), got)
+	}
+}
+
+func TestHandlerRecordsRuleEvalDuration(t *testing.T) {
+	m := metrics.New()
+	handler, err := NewHandler(Config{
+		ProfileID: "test",
+		Profile: config.ProfileConfig{
+			Rules: config.RulesConfig{
+				Deny: &config.RuleGroup{
+					And: []config.Rule{
+						{Type: "ip_deny", CIDRs: []string{"10.0.0.0/8"}},
+					},
+				},
+			},
+		},
+		Metrics:              m,
+		RuleTimingSampleRate: 1,
+	})
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.1:12345"
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if got := m.GetSnapshot().RuleEvalDuration["ip_deny"].Samples; got != 1 {
+		t.Errorf("expected 1 timed ip_deny evaluation, got %d", got)
+	}
+}
+
+func TestHandlerRecordsBackendResponses(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+
+	m := metrics.New()
+	handler, err := NewHandler(Config{
+		ProfileID: "test",
+		Profile: config.ProfileConfig{
+			Backends: []config.BackendConfig{
+				{Name: "primary", URL: backend.URL, Weight: 1},
+			},
+		},
+		Metrics: m,
+	})
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+
+	for _, path := range []string{"/", "/missing", "/missing"} {
+		req := httptest.NewRequest("GET", path, nil)
+		req.RemoteAddr = "10.0.0.1:12345"
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	stats := m.GetSnapshot().BackendStats["primary"]
+	if stats.Requests != 3 || stats.Errors != 0 {
+		t.Errorf("expected 3 requests without errors, got %+v", stats)
+	}
+	if stats.Responses["2xx"] != 1 || stats.Responses["4xx"] != 2 {
+		t.Errorf("unexpected status classes: %v", stats.Responses)
+	}
+}
+
+func TestHandlerBypassToken(t *testing.T) {
+	var forwardedToken string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwardedToken = r.Header.Get("X-Break-Glass")
+		w.Write([]byte("backend response"))
+	}))
+	defer backend.Close()
+
+	token := "0123456789abcdef0123456789abcdef"
+	handler, err := NewHandler(Config{
+		ProfileID: "test",
+		Profile: config.ProfileConfig{
+			Rules: config.RulesConfig{
+				Deny: &config.RuleGroup{
+					Rule: &config.Rule{Type: "ip_deny", CIDRs: []string{"0.0.0.0/0"}},
+				},
+			},
+			Backends: []config.BackendConfig{
+				{Name: "primary", URL: backend.URL, Weight: 1},
+			},
+			Decoy:        config.DecoyConfig{Mode: "static", StatusCode: 200, Body: "decoy"},
+			BypassToken:  token,
+			BypassHeader: "X-Break-Glass",
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.1:12345"
+	req.Header.Set("X-Break-Glass", token)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Body.String() != "backend response" {
+		t.Errorf("expected bypass to reach backend, got %q", rr.Body.String())
+	}
+	if forwardedToken != "" {
+		t.Error("expected bypass token to be stripped before forwarding")
+	}
+}
+
 func TestExtractClientIP(t *testing.T) {
 	// Test without trusted proxies (legacy behavior - trust XFF)
 	t.Run("without trusted proxies", func(t *testing.T) {
@@ -206,31 +616,288 @@ func TestExtractClientIP(t *testing.T) {
 	})
 }
 
-func TestRequestIDGeneration(t *testing.T) {
-	// Create a test backend that echoes back the request ID
-	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		reqID := r.Header.Get("X-Request-ID")
-		w.Header().Set("X-Backend-Received-ID", reqID)
-		w.WriteHeader(http.StatusOK)
-	}))
-	defer backend.Close()
+func TestExtractClientIPTrustedHops(t *testing.T) {
+	_, lbNet, _ := net.ParseCIDR("10.0.0.0/8")
+	_, cdnNet, _ := net.ParseCIDR("198.51.100.0/24")
+	h := &Handler{
+		trustedProxies: []*net.IPNet{lbNet, cdnNet},
+		trustedHops:    true,
+	}
 
-	cfg := Config{
-		ProfileID: "test",
-		Profile: config.ProfileConfig{
-			Rules: config.RulesConfig{
-				Allow: &config.RuleGroup{
-					And: []config.Rule{
-						{Type: "ip_allow", CIDRs: []string{"0.0.0.0/0"}},
-					},
-				},
-			},
-			Backends: []config.BackendConfig{
-				{Name: "primary", URL: backend.URL, Weight: 10},
-			},
-			Decoy: config.DecoyConfig{
-				Mode:       "static",
-				StatusCode: 200,
+	tests := []struct {
+		name       string
+		remoteAddr string
+		xff        []string
+		expected   string
+	}{
+		{
+			name:       "skips trusted hops",
+			remoteAddr: "10.0.0.5:12345",
+			xff:        []string{"203.0.113.9, 198.51.100.7, 10.0.0.4"},
+			expected:   "203.0.113.9",
+		},
+		{
+			name:       "spoofed leftmost entry ignored",
+			remoteAddr: "10.0.0.5:12345",
+			xff:        []string{"1.2.3.4, 203.0.113.9, 198.51.100.7"},
+			expected:   "203.0.113.9",
+		},
+		{
+			name:       "multiple header lines",
+			remoteAddr: "10.0.0.5:12345",
+			xff:        []string{"1.2.3.4", "203.0.113.9, 10.0.0.4"},
+			expected:   "203.0.113.9",
+		},
+		{
+			name:       "all entries trusted",
+			remoteAddr: "10.0.0.5:12345",
+			xff:        []string{"10.0.0.3, 10.0.0.4"},
+			expected:   "10.0.0.3",
+		},
+		{
+			name:       "untrusted source ignores XFF",
+			remoteAddr: "192.168.1.1:12345",
+			xff:        []string{"203.0.113.9"},
+			expected:   "192.168.1.1",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tc.remoteAddr
+			for _, v := range tc.xff {
+				req.Header.Add("X-Forwarded-For", v)
+			}
+
+			if result := h.extractClientIP(req); result != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestExtractClientIPTrustedCount(t *testing.T) {
+	_, lbNet, _ := net.ParseCIDR("10.0.0.0/8")
+
+	tests := []struct {
+		name       string
+		trusted    []*net.IPNet
+		count      int
+		remoteAddr string
+		xff        []string
+		expected   string
+	}{
+		{
+			name:       "one proxy",
+			count:      1,
+			remoteAddr: "10.0.0.5:12345",
+			xff:        []string{"1.2.3.4, 203.0.113.9"},
+			expected:   "203.0.113.9",
+		},
+		{
+			name:       "two proxies",
+			count:      2,
+			remoteAddr: "10.0.0.5:12345",
+			xff:        []string{"1.2.3.4, 203.0.113.9, 198.51.100.7"},
+			expected:   "203.0.113.9",
+		},
+		{
+			name:       "multiple header lines",
+			count:      2,
+			remoteAddr: "10.0.0.5:12345",
+			xff:        []string{"1.2.3.4, 203.0.113.9", "198.51.100.7"},
+			expected:   "203.0.113.9",
+		},
+		{
+			name:       "chain shorter than count",
+			count:      3,
+			remoteAddr: "10.0.0.5:12345",
+			xff:        []string{"203.0.113.9, 198.51.100.7"},
+			expected:   "203.0.113.9",
+		},
+		{
+			name:       "trusted source",
+			trusted:    []*net.IPNet{lbNet},
+			count:      1,
+			remoteAddr: "10.0.0.5:12345",
+			xff:        []string{"1.2.3.4, 203.0.113.9"},
+			expected:   "203.0.113.9",
+		},
+		{
+			name:       "untrusted source ignores XFF",
+			trusted:    []*net.IPNet{lbNet},
+			count:      1,
+			remoteAddr: "192.168.1.1:12345",
+			xff:        []string{"203.0.113.9"},
+			expected:   "192.168.1.1",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			h := &Handler{trustedProxies: tc.trusted, trustedCount: tc.count}
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tc.remoteAddr
+			for _, v := range tc.xff {
+				req.Header.Add("X-Forwarded-For", v)
+			}
+
+			if result := h.extractClientIP(req); result != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestExtractClientIPProxyProtocol(t *testing.T) {
+	_, cdnNet, _ := net.ParseCIDR("198.51.100.0/24")
+
+	tests := []struct {
+		name     string
+		trusted  []*net.IPNet
+		source   string
+		expected string
+	}{
+		// Without trusted proxies, client IP headers are normally believed;
+		// behind a PROXY protocol balancer they came from the client
+		{"headers ignored without trusted proxies", nil, "203.0.113.7", "203.0.113.7"},
+		{"headers ignored from untrusted source", []*net.IPNet{cdnNet}, "203.0.113.7", "203.0.113.7"},
+		{"headers used from trusted source", []*net.IPNet{cdnNet}, "198.51.100.9", "192.0.2.44"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			h := &Handler{trustedProxies: tc.trusted}
+			l := listener.NewHTTPListener(listener.HTTPListenerConfig{
+				Addr: "127.0.0.1:0",
+				Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Write([]byte(h.extractClientIP(r)))
+				}),
+				ProxyProtocol: listener.ProxyProtocolConfig{Enabled: true, Trusted: []string{"127.0.0.1"}},
+			})
+			if err := l.Start(context.Background()); err != nil {
+				t.Fatalf("failed to start listener: %v", err)
+			}
+			defer l.Stop(context.Background())
+
+			conn, err := net.Dial("tcp", l.Addr())
+			if err != nil {
+				t.Fatalf("dial failed: %v", err)
+			}
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(2 * time.Second))
+			fmt.Fprintf(conn, "PROXY TCP4 %s 127.0.0.1 51234 80\r\n", tc.source)
+			conn.Write([]byte("GET / HTTP/1.1\r\nHost: example.com\r\nX-Forwarded-For: 192.0.2.44\r\nConnection: close\r\n\r\n"))
+
+			resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+			if err != nil {
+				t.Fatalf("failed to read response: %v", err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			if string(body) != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, string(body))
+			}
+		})
+	}
+}
+
+func TestExtractClientIPCustomHeaders(t *testing.T) {
+	_, trustedNet, _ := net.ParseCIDR("127.0.0.0/8")
+	h := &Handler{
+		trustedProxies:  []*net.IPNet{trustedNet},
+		clientIPHeaders: []string{"CF-Connecting-IP", "True-Client-IP"},
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		expected   string
+	}{
+		{
+			name:       "first configured header",
+			remoteAddr: "127.0.0.1:12345",
+			headers:    map[string]string{"CF-Connecting-IP": "203.0.113.5", "True-Client-IP": "203.0.113.6"},
+			expected:   "203.0.113.5",
+		},
+		{
+			name:       "falls through to later header",
+			remoteAddr: "127.0.0.1:12345",
+			headers:    map[string]string{"True-Client-IP": " 203.0.113.6 "},
+			expected:   "203.0.113.6",
+		},
+		{
+			name:       "default headers not consulted",
+			remoteAddr: "127.0.0.1:12345",
+			headers:    map[string]string{"X-Forwarded-For": "10.0.0.1"},
+			expected:   "127.0.0.1",
+		},
+		{
+			name:       "untrusted source ignores header",
+			remoteAddr: "192.168.1.1:12345",
+			headers:    map[string]string{"CF-Connecting-IP": "203.0.113.5"},
+			expected:   "192.168.1.1",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tc.remoteAddr
+			for k, v := range tc.headers {
+				req.Header.Set(k, v)
+			}
+
+			if result := h.extractClientIP(req); result != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, result)
+			}
+		})
+	}
+
+	// Profile headers take precedence over the global list
+	handler, err := NewHandler(Config{
+		ProfileID: "test",
+		Profile: config.ProfileConfig{
+			Backends:        []config.BackendConfig{{Name: "primary", URL: "http://127.0.0.1:9000", Weight: 1}},
+			ClientIPHeaders: []string{"X-Client-IP"},
+		},
+		ClientIPHeaders: []string{"CF-Connecting-IP"},
+	})
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+	if len(handler.clientIPHeaders) != 1 || handler.clientIPHeaders[0] != "X-Client-IP" {
+		t.Errorf("expected profile client IP headers, got %v", handler.clientIPHeaders)
+	}
+}
+
+func TestRequestIDGeneration(t *testing.T) {
+	// Create a test backend that echoes back the request ID
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reqID := r.Header.Get("X-Request-ID")
+		w.Header().Set("X-Backend-Received-ID", reqID)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	cfg := Config{
+		ProfileID: "test",
+		Profile: config.ProfileConfig{
+			Rules: config.RulesConfig{
+				Allow: &config.RuleGroup{
+					And: []config.Rule{
+						{Type: "ip_allow", CIDRs: []string{"0.0.0.0/0"}},
+					},
+				},
+			},
+			Backends: []config.BackendConfig{
+				{Name: "primary", URL: backend.URL, Weight: 10},
+			},
+			Decoy: config.DecoyConfig{
+				Mode:       "static",
+				StatusCode: 200,
 				Body:       "decoy",
 			},
 		},
@@ -288,3 +955,613 @@ func TestRequestIDGeneration(t *testing.T) {
 		}
 	})
 }
+
+func TestHandlerLogsTLS(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+
+	logPath := filepath.Join(t.TempDir(), "access.log")
+	logger, err := logging.New(logging.Config{Level: "info", Output: logPath})
+	if err != nil {
+		t.Fatalf("failed to create logger: %v", err)
+	}
+
+	m := metrics.New()
+	handler, err := NewHandler(Config{
+		ProfileID: "test",
+		Profile: config.ProfileConfig{
+			Backends: []config.BackendConfig{{Name: "primary", URL: backend.URL, Weight: 1}},
+		},
+		Logger:  logger,
+		Metrics: m,
+	})
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "https://example.com/", nil)
+	req.RemoteAddr = "10.0.0.1:12345"
+	req.TLS = &tls.ConnectionState{
+		Version:     tls.VersionTLS12,
+		CipherSuite: tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+		ServerName:  "example.com",
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	logger.Close()
+
+	data, _ := os.ReadFile(logPath)
+	var entry logging.RequestLog
+	if err := json.Unmarshal(data, &entry); err != nil {
+		t.Fatalf("failed to parse request log %q: %v", data, err)
+	}
+	if entry.TLSVersion != "TLS 1.2" || entry.TLSCipher != "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256" || entry.SNI != "example.com" {
+		t.Errorf("unexpected TLS log fields: %+v", entry)
+	}
+
+	if got := m.GetSnapshot().TLSVersions["TLS 1.2"]; got != 1 {
+		t.Errorf("expected 1 TLS 1.2 request recorded, got %d", got)
+	}
+}
+
+func TestHandlerRequireTLS(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+
+	handler, err := NewHandler(Config{
+		ProfileID: "test",
+		Profile: config.ProfileConfig{
+			Rules: config.RulesConfig{
+				Deny: &config.RuleGroup{Rule: &config.Rule{Type: "require_tls"}},
+			},
+			Backends: []config.BackendConfig{{Name: "primary", URL: backend.URL, Weight: 1}},
+			Decoy: config.DecoyConfig{
+				Mode: "static",
+				Targets: []config.DecoyTargetConfig{{
+					Labels: []string{"plaintext"},
+					Decoys: []config.WeightedDecoyConfig{
+						{DecoyConfig: config.DecoyConfig{Mode: "redirect", RedirectTo: "https://example.com/"}},
+					},
+				}},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "http://example.com/", nil)
+	req.RemoteAddr = "10.0.0.1:12345"
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusFound || rr.Header().Get("Location") != "https://example.com/" {
+		t.Errorf("expected plaintext request redirected to HTTPS, got %d %q", rr.Code, rr.Header().Get("Location"))
+	}
+
+	req = httptest.NewRequest("GET", "https://example.com/", nil)
+	req.RemoteAddr = "10.0.0.1:12345"
+	req.TLS = &tls.ConnectionState{Version: tls.VersionTLS13}
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected TLS request forwarded, got %d", rr.Code)
+	}
+}
+
+func TestHandlerExposeBackendHeader(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+
+	newHandler := func(cfg config.ExposeBackendHeaderConfig) *Handler {
+		handler, err := NewHandler(Config{
+			ProfileID: "test",
+			Profile: config.ProfileConfig{
+				Backends:            []config.BackendConfig{{Name: "primary", URL: backend.URL, Weight: 1}},
+				ExposeBackendHeader: cfg,
+			},
+		})
+		if err != nil {
+			t.Fatalf("failed to create handler: %v", err)
+		}
+		return handler
+	}
+
+	tests := []struct {
+		name       string
+		cfg        config.ExposeBackendHeaderConfig
+		remoteAddr string
+		debug      bool
+		want       string
+	}{
+		{"disabled", config.ExposeBackendHeaderConfig{}, "10.0.0.1:1234", false, ""},
+		{"private client", config.ExposeBackendHeaderConfig{Enabled: true}, "10.0.0.1:1234", false, "primary"},
+		{"public client", config.ExposeBackendHeaderConfig{Enabled: true}, "8.8.8.8:1234", false, ""},
+		{"listed client", config.ExposeBackendHeaderConfig{Enabled: true, CIDRs: []string{"8.8.8.0/24"}}, "8.8.8.8:1234", false, "primary"},
+		{"debug header missing", config.ExposeBackendHeaderConfig{Enabled: true, DebugHeader: "X-Debug"}, "10.0.0.1:1234", false, ""},
+		{"debug header present", config.ExposeBackendHeaderConfig{Enabled: true, DebugHeader: "X-Debug"}, "10.0.0.1:1234", true, "primary"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tc.remoteAddr
+			if tc.debug {
+				req.Header.Set("X-Debug", "1")
+			}
+			rr := httptest.NewRecorder()
+			newHandler(tc.cfg).ServeHTTP(rr, req)
+			if got := rr.Header().Get(DefaultBackendHeader); got != tc.want {
+				t.Errorf("expected %s %q, got %q", DefaultBackendHeader, tc.want, got)
+			}
+		})
+	}
+}
+
+func TestHandlerPublishesEvents(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+
+	bus := events.NewBus()
+	sub, _ := bus.Subscribe()
+	defer sub.Close()
+	recent := events.NewRecent(10)
+
+	handler, err := NewHandler(Config{
+		ProfileID: "test",
+		Profile: config.ProfileConfig{
+			Backends: []config.BackendConfig{{Name: "primary", URL: backend.URL, Weight: 1}},
+		},
+		Events: bus,
+		Recent: recent,
+	})
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/orders", nil)
+	req.RemoteAddr = "10.0.0.1:12345"
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	select {
+	case ev := <-sub.Events():
+		if ev.ProfileID != "test" || ev.ClientIP != "10.0.0.1" || ev.Path != "/orders" || ev.Action != "allow_forward" {
+			t.Errorf("unexpected event %+v", ev)
+		}
+	default:
+		t.Fatal("expected the request to be published")
+	}
+	if got := recent.List(0, nil); len(got) != 1 || got[0].Path != "/orders" {
+		t.Errorf("expected the request to be kept in the recent buffer, got %+v", got)
+	}
+}
+
+func TestHandlerLogsDrops(t *testing.T) {
+	bus := events.NewBus()
+	sub, _ := bus.Subscribe()
+	defer sub.Close()
+
+	m := metrics.New()
+	handler, err := NewHandler(Config{
+		ProfileID: "test",
+		Profile: config.ProfileConfig{
+			Rules: config.RulesConfig{
+				Deny: &config.RuleGroup{
+					And: []config.Rule{
+						{Type: "ip_deny", CIDRs: []string{"10.0.0.0/8"}},
+					},
+				},
+			},
+			DenyAction: "drop",
+			DropMode:   "hold",
+			DropHold:   "1s",
+		},
+		Metrics: m,
+		Events:  bus,
+	})
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/admin", nil)
+	req.RemoteAddr = "10.0.0.1:12345"
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	select {
+	case ev := <-sub.Events():
+		if ev.Action != "drop" || ev.StatusCode != 0 {
+			t.Errorf("expected a drop without status, got %+v", ev)
+		}
+	default:
+		t.Fatal("expected the drop to be logged")
+	}
+	if n := m.GetSnapshot().DroppedRequests; n != 1 {
+		t.Errorf("expected 1 dropped request, got %d", n)
+	}
+}
+
+func TestHandlerIsolatedMetrics(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+
+	m := metrics.New()
+	handler, err := NewHandler(Config{
+		ProfileID: "team-a",
+		Profile: config.ProfileConfig{
+			Backends:        []config.BackendConfig{{Name: "primary", URL: backend.URL, Weight: 1}},
+			IsolatedMetrics: true,
+		},
+		Metrics: m,
+	})
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.1:12345"
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	isolated, ok := m.LookupProfile("team-a")
+	if !ok {
+		t.Fatal("expected isolated collector to be registered")
+	}
+	if got := isolated.GetSnapshot().TotalRequests; got != 1 {
+		t.Errorf("expected 1 request in isolated collector, got %d", got)
+	}
+	if got := m.GetSnapshot().TotalRequests; got != 1 {
+		t.Errorf("expected 1 request in shared collector, got %d", got)
+	}
+}
+
+// panicRule is a rule with a bug
+type panicRule struct{}
+
+func (panicRule) Evaluate(ctx *rules.Context) rules.Result {
+	var m map[string]int
+	m["boom"]++
+	return rules.Result{}
+}
+
+func (panicRule) Type() string { return "panic" }
+
+func TestHandlerRecoversPanic(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "error.log")
+	logger, err := logging.New(logging.Config{Level: "info", Output: logPath})
+	if err != nil {
+		t.Fatalf("failed to create logger: %v", err)
+	}
+
+	m := metrics.New()
+	handler, err := NewHandler(Config{
+		ProfileID: "test",
+		Profile: config.ProfileConfig{
+			Backends: []config.BackendConfig{{Name: "primary", URL: "http://127.0.0.1:9000", Weight: 1}},
+		},
+		Logger:  logger,
+		Metrics: m,
+	})
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+	handler.decisionEngine = decision.NewEngine(nil, &rules.Group{Single: panicRule{}})
+
+	req := httptest.NewRequest("GET", "/probe", nil)
+	req.Header.Set("X-Request-ID", "req-123")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	logger.Close()
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("expected status 500, got %d", rr.Code)
+	}
+	if got := m.GetSnapshot().Panics; got != 1 {
+		t.Errorf("expected 1 panic recorded, got %d", got)
+	}
+
+	data, _ := os.ReadFile(logPath)
+	var entry struct {
+		Fields map[string]interface{} `json:"fields"`
+	}
+	if err := json.Unmarshal(data, &entry); err != nil {
+		t.Fatalf("failed to parse log %q: %v", data, err)
+	}
+	if entry.Fields["request_id"] != "req-123" || entry.Fields["path"] != "/probe" {
+		t.Errorf("expected request details in log, got %v", entry.Fields)
+	}
+	if stack, _ := entry.Fields["stack"].(string); !strings.Contains(stack, "panicRule.Evaluate") {
+		t.Errorf("expected stack trace naming the rule, got %q", stack)
+	}
+}
+
+func TestHandlerCloseStopsRules(t *testing.T) {
+	rateLimit := config.Rule{Type: "rate_limit", MaxRequests: 10, Window: "1m"}
+	cfg := Config{
+		ProfileID: "test",
+		Profile: config.ProfileConfig{
+			Backends: []config.BackendConfig{{Name: "primary", URL: "http://127.0.0.1:9000", Weight: 1}},
+			Rules: config.RulesConfig{
+				Allow: &config.RuleGroup{And: []config.Rule{rateLimit, {Type: "ip_allow", CIDRs: []string{"10.0.0.0/8"}}}},
+				Deny:  &config.RuleGroup{Rule: &rateLimit},
+			},
+		},
+	}
+
+	baseline := runtime.NumGoroutine()
+	handlers := make([]*Handler, 10)
+	for i := range handlers {
+		h, err := NewHandler(cfg)
+		if err != nil {
+			t.Fatalf("failed to create handler: %v", err)
+		}
+		if len(h.stoppers) != 2 {
+			t.Fatalf("expected 2 stateful rules, got %d", len(h.stoppers))
+		}
+		handlers[i] = h
+	}
+
+	for _, h := range handlers {
+		if err := h.Close(); err != nil {
+			t.Errorf("unexpected close error: %v", err)
+		}
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > baseline && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > baseline {
+		t.Errorf("expected rule goroutines to exit, have %d (baseline %d)", n, baseline)
+	}
+}
+
+func TestHandlerScannerScore(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("home"))
+	}))
+	defer backend.Close()
+
+	handler, err := NewHandler(Config{
+		ProfileID: "test",
+		Profile: config.ProfileConfig{
+			Backends: []config.BackendConfig{{Name: "primary", URL: backend.URL, Weight: 1}},
+			Rules: config.RulesConfig{
+				Deny: &config.RuleGroup{Rule: &config.Rule{Type: "scanner_score", MaxErrors: 3, Window: "1m", Statuses: []string{"404"}}},
+			},
+			DenyAction: "block",
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+	defer handler.Close()
+
+	get := func(path, ip string) int {
+		req := httptest.NewRequest("GET", path, nil)
+		req.RemoteAddr = ip + ":12345"
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	for _, path := range []string{"/admin", "/.git/config", "/wp-login.php", "/backup.zip"} {
+		if code := get(path, "198.51.100.7"); code != http.StatusNotFound {
+			t.Fatalf("expected probe for %s to reach the backend, got %d", path, code)
+		}
+	}
+
+	// The scanner is blocked even for paths that exist
+	if code := get("/", "198.51.100.7"); code != http.StatusForbidden {
+		t.Errorf("expected scanner to be blocked, got %d", code)
+	}
+	if code := get("/", "198.51.100.8"); code != http.StatusOK {
+		t.Errorf("expected other client to be allowed, got %d", code)
+	}
+}
+
+func TestHandlerErrorPages(t *testing.T) {
+	// A closed server gives a backend that refuses connections
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	down.Close()
+
+	pageFile := filepath.Join(t.TempDir(), "504.json")
+	os.WriteFile(pageFile, []byte(`{"error":"timeout"}`), 0644)
+
+	handler, err := NewHandler(Config{
+		ProfileID: "test",
+		Profile: config.ProfileConfig{
+			Backends: []config.BackendConfig{{Name: "down", URL: down.URL, Weight: 1}},
+			ErrorPages: map[int]config.ErrorPageConfig{
+				502: {Body: "<h1>Back soon</h1>"},
+			},
+		},
+		ErrorPages: map[int]config.ErrorPageConfig{
+			502: {Body: "global"},
+			504: {BodyFile: pageFile},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.1:12345"
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusBadGateway || rr.Body.String() != "<h1>Back soon</h1>" {
+		t.Errorf("expected profile 502 page, got %d %q", rr.Code, rr.Body.String())
+	}
+	if ct := rr.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("expected text/html content type, got %q", ct)
+	}
+	if rr.Header().Get("Cache-Control") != "no-store" {
+		t.Error("expected error page not to be cacheable")
+	}
+
+	if page := handler.errorPages[504]; page == nil || page.ContentType != "application/json" {
+		t.Errorf("expected global 504 page loaded from file, got %+v", page)
+	}
+
+	// Missing files fail handler creation
+	_, err = NewHandler(Config{
+		ProfileID:  "test",
+		ErrorPages: map[int]config.ErrorPageConfig{503: {BodyFile: "/nonexistent/503.html"}},
+	})
+	if err == nil {
+		t.Error("expected error for missing error page file")
+	}
+}
+
+func TestHandlerErrorPageNoBackends(t *testing.T) {
+	handler, err := NewHandler(Config{
+		ProfileID: "test",
+		Profile: config.ProfileConfig{
+			ErrorPages: map[int]config.ErrorPageConfig{502: {Body: "no backends"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.1:12345"
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusBadGateway || rr.Body.String() != "no backends" {
+		t.Errorf("expected 502 error page, got %d %q", rr.Code, rr.Body.String())
+	}
+}
+
+// zeroReader is an endless source of zero bytes
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+func TestHandlerStreamsLargeUpload(t *testing.T) {
+	if testing.Short() {
+		t.Skip("streams 1GB")
+	}
+	const size = 1 << 30
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n, _ := io.Copy(io.Discard, r.Body)
+		fmt.Fprint(w, n)
+	}))
+	defer backend.Close()
+
+	// Retries are enabled but must not buffer a body this large
+	handler, err := NewHandler(Config{
+		ProfileID: "uploads",
+		Profile: config.ProfileConfig{
+			Rules: config.RulesConfig{
+				Allow: &config.RuleGroup{And: []config.Rule{{Type: "ip_allow", CIDRs: []string{"10.0.0.0/8"}}}},
+			},
+			Backends: []config.BackendConfig{
+				{Name: "a", URL: backend.URL, Weight: 1},
+				{Name: "b", URL: backend.URL, Weight: 1},
+			},
+			MaxRetries:     1,
+			MaxRequestBody: 2 * size,
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+
+	runtime.GC()
+	var before runtime.MemStats
+	runtime.ReadMemStats(&before)
+
+	// Sample the heap while the upload streams through
+	done := make(chan struct{})
+	peak := make(chan uint64)
+	go func() {
+		var max uint64
+		var m runtime.MemStats
+		for {
+			runtime.ReadMemStats(&m)
+			if m.HeapInuse > max {
+				max = m.HeapInuse
+			}
+			select {
+			case <-done:
+				peak <- max
+				return
+			case <-time.After(20 * time.Millisecond):
+			}
+		}
+	}()
+
+	req := httptest.NewRequest("PUT", "/upload", io.LimitReader(zeroReader{}, size))
+	req.RemoteAddr = "10.0.0.1:12345"
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	close(done)
+
+	if rr.Code != http.StatusOK || rr.Body.String() != fmt.Sprint(size) {
+		t.Fatalf("expected backend to receive %d bytes, got %d %q", size, rr.Code, rr.Body.String())
+	}
+	if grown := int64(<-peak) - int64(before.HeapInuse); grown > 64<<20 {
+		t.Errorf("expected upload to stream with constant memory, heap grew by %d MB", grown>>20)
+	}
+}
+
+func TestHandlerOversizedBody(t *testing.T) {
+	var received int
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received++
+		io.Copy(io.Discard, r.Body)
+	}))
+	defer backend.Close()
+
+	m := metrics.New()
+	handler, err := NewHandler(Config{
+		ProfileID: "uploads",
+		Profile: config.ProfileConfig{
+			Backends:       []config.BackendConfig{{Name: "a", URL: backend.URL, Weight: 1}},
+			MaxRequestBody: 1024,
+		},
+		Metrics: m,
+	})
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+
+	// A declared length over the limit is refused before forwarding
+	req := httptest.NewRequest("POST", "/upload", strings.NewReader(strings.Repeat("x", 2048)))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected 413, got %d", rr.Code)
+	}
+	if received != 0 {
+		t.Errorf("expected the backend not to be called, got %d requests", received)
+	}
+
+	// A body without a length is cut off while streaming to the backend
+	req = httptest.NewRequest("POST", "/upload", io.LimitReader(zeroReader{}, 2048))
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected 413 for a streamed body, got %d", rr.Code)
+	}
+
+	if n := m.GetSnapshot().OversizedBodies; n != 2 {
+		t.Errorf("expected 2 oversized bodies, got %d", n)
+	}
+
+	// Bodies within the limit are forwarded
+	req = httptest.NewRequest("POST", "/upload", strings.NewReader("small"))
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || received == 0 {
+		t.Errorf("expected small body to be forwarded, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,107 @@
+package gateway
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+
+	"shadowgate/internal/config"
+)
+
+// headerLimits bounds the request headers accepted by a profile. The HTTP
+// server caps their total size; these limits also catch floods of small
+// headers and single oversized values.
+type headerLimits struct {
+	maxCount     int // header fields per request (0 = unlimited)
+	maxValueSize int // bytes per header value (0 = unlimited)
+}
+
+func (l headerLimits) enabled() bool {
+	return l.maxCount > 0 || l.maxValueSize > 0
+}
+
+// check returns why r exceeds the limits, or "" if it does not
+func (l headerLimits) check(r *http.Request) string {
+	count := 0
+	for name, values := range r.Header {
+		count += len(values)
+		if l.maxCount > 0 && count > l.maxCount {
+			return fmt.Sprintf("more than %d headers", l.maxCount)
+		}
+		if l.maxValueSize > 0 {
+			for _, v := range values {
+				if len(v) > l.maxValueSize {
+					return fmt.Sprintf("header %s longer than %d bytes", name, l.maxValueSize)
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// DefaultBackendHeader is the response header naming the backend
+const DefaultBackendHeader = "X-Backend"
+
+// backendHeader decides which requests are told the backend serving them.
+// The header reveals internal topology, so by default only clients on
+// private or loopback addresses get it.
+type backendHeader struct {
+	header      string
+	networks    []*net.IPNet // nil = private and loopback addresses
+	debugHeader string       // when set, must be present on the request
+}
+
+// newBackendHeader returns nil when the header is disabled
+func newBackendHeader(cfg config.ExposeBackendHeaderConfig) (*backendHeader, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	b := &backendHeader{header: cfg.Header, debugHeader: cfg.DebugHeader}
+	if b.header == "" {
+		b.header = DefaultBackendHeader
+	}
+	for _, cidr := range cfg.CIDRs {
+		network, err := parseNetwork(cidr)
+		if err != nil {
+			return nil, err
+		}
+		b.networks = append(b.networks, network)
+	}
+	return b, nil
+}
+
+// applies reports whether the response to r from clientIP names the backend
+func (b *backendHeader) applies(r *http.Request, clientIP string) bool {
+	if b.debugHeader != "" && r.Header.Get(b.debugHeader) == "" {
+		return false
+	}
+	ip := net.ParseIP(clientIP)
+	if ip == nil {
+		return false
+	}
+	if b.networks == nil {
+		return ip.IsPrivate() || ip.IsLoopback()
+	}
+	for _, network := range b.networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseNetwork parses a CIDR, or a single IP as a host network
+func parseNetwork(cidr string) (*net.IPNet, error) {
+	if _, network, err := net.ParseCIDR(cidr); err == nil {
+		return network, nil
+	}
+	ip := net.ParseIP(cidr)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid CIDR or IP: %s", cidr)
+	}
+	bits := 32
+	if ip.To4() == nil {
+		bits = 128
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
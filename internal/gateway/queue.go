@@ -0,0 +1,93 @@
+package gateway
+
+import (
+	"context"
+	"time"
+
+	"shadowgate/internal/proxy"
+)
+
+// Backend queue defaults
+const (
+	DefaultBackendQueueMaxWait = 2 * time.Second
+	DefaultBackendQueueSize    = 100
+)
+
+// backendQueuePollInterval is how often waiting requests recheck the pool.
+// Backends recover through health checks and circuit breaker timeouts, so
+// there is no event to wait on.
+const backendQueuePollInterval = 10 * time.Millisecond
+
+// BackendQueueOptions configures waiting for a backend to become available
+type BackendQueueOptions struct {
+	MaxWait time.Duration // longest a request waits for a backend
+	Size    int           // requests allowed to wait at once
+}
+
+// DefaultBackendQueueOptions returns default backend queue options
+func DefaultBackendQueueOptions() BackendQueueOptions {
+	return BackendQueueOptions{
+		MaxWait: DefaultBackendQueueMaxWait,
+		Size:    DefaultBackendQueueSize,
+	}
+}
+
+// backendQueue holds requests while a pool has no available backend, so
+// brief failover gaps delay clients rather than failing them
+type backendQueue struct {
+	pool    *proxy.Pool
+	maxWait time.Duration
+	slots   chan struct{}
+}
+
+func newBackendQueue(pool *proxy.Pool, opts BackendQueueOptions) *backendQueue {
+	if opts.MaxWait <= 0 {
+		opts.MaxWait = DefaultBackendQueueMaxWait
+	}
+	if opts.Size <= 0 {
+		opts.Size = DefaultBackendQueueSize
+	}
+	return &backendQueue{
+		pool:    pool,
+		maxWait: opts.MaxWait,
+		slots:   make(chan struct{}, opts.Size),
+	}
+}
+
+// wait blocks until a backend is available, reporting false if the queue is
+// full or none became available within maxWait or before ctx ended
+func (q *backendQueue) wait(ctx context.Context) bool {
+	if q.pool.HasAvailable() {
+		return true
+	}
+
+	select {
+	case q.slots <- struct{}{}:
+		defer func() { <-q.slots }()
+	default:
+		return false
+	}
+
+	timer := time.NewTimer(q.maxWait)
+	defer timer.Stop()
+	ticker := time.NewTicker(backendQueuePollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if q.pool.HasAvailable() {
+				return true
+			}
+		case <-timer.C:
+			return false
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// waiting returns the number of requests currently queued
+func (q *backendQueue) waiting() int {
+	return len(q.slots)
+}
@@ -0,0 +1,98 @@
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"shadowgate/internal/config"
+	"shadowgate/internal/proxy"
+)
+
+func TestBackendQueueWait(t *testing.T) {
+	pool := proxy.NewPool()
+	backend, _ := proxy.NewBackend("b1", "http://127.0.0.1:1", 1)
+	pool.Add(backend)
+
+	q := newBackendQueue(pool, BackendQueueOptions{MaxWait: time.Second, Size: 1})
+
+	// Available backends don't queue
+	if !q.wait(context.Background()) {
+		t.Fatal("expected healthy pool to be available")
+	}
+
+	backend.SetHealthy(false)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		backend.SetHealthy(true)
+	}()
+	start := time.Now()
+	if !q.wait(context.Background()) {
+		t.Fatal("expected backend recovery within max wait")
+	}
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("expected request to wait for recovery, returned after %v", elapsed)
+	}
+	if n := q.waiting(); n != 0 {
+		t.Errorf("expected empty queue after wait, got %d", n)
+	}
+
+	// A full queue rejects immediately
+	backend.SetHealthy(false)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan bool)
+	go func() { done <- q.wait(ctx) }()
+	for q.waiting() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if q.wait(context.Background()) {
+		t.Error("expected full queue to reject")
+	}
+	cancel()
+	if <-done {
+		t.Error("expected cancelled request to give up")
+	}
+}
+
+func TestHandlerBackendQueue(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+
+	pool := proxy.NewPool()
+	b, _ := proxy.NewBackend("b1", backend.URL, 1)
+	pool.Add(b)
+	b.SetHealthy(false)
+
+	handler, err := NewHandler(Config{
+		ProfileID: "test",
+		Profile: config.ProfileConfig{
+			BackendQueue: config.BackendQueueConfig{Enabled: true, MaxWait: "50ms"},
+		},
+		BackendPool: pool,
+	})
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+	defer handler.Close()
+
+	req := httptest.NewRequest("GET", "/test", nil)
+	req.RemoteAddr = "10.0.0.1:12345"
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status 503 without a backend, got %d", rr.Code)
+	}
+
+	b.SetHealthy(true)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected status 200 once the backend recovered, got %d", rr.Code)
+	}
+}
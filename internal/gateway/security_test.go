@@ -1,6 +1,7 @@
 package gateway
 
 import (
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -196,6 +197,68 @@ func TestSecurityLargeHeaders(t *testing.T) {
 	}
 }
 
+// TestSecurityHeaderLimits ensures header floods and oversized values are
+// rejected before reaching the backend
+func TestSecurityHeaderLimits(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	cfg := Config{
+		ProfileID: "test",
+		Profile: config.ProfileConfig{
+			ID: "test",
+			Backends: []config.BackendConfig{
+				{Name: "mock", URL: backend.URL, Weight: 10},
+			},
+			MaxHeaders:         20,
+			MaxHeaderValueSize: 1024,
+		},
+		Logger:  testLogger(),
+		Metrics: metrics.New(),
+	}
+
+	h, err := NewHandler(cfg)
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		headers func(http.Header)
+		want    int
+	}{
+		{"within limits", func(hd http.Header) { hd.Set("User-Agent", "Mozilla/5.0") }, http.StatusOK},
+		{"too many headers", func(hd http.Header) {
+			for i := 0; i < 25; i++ {
+				hd.Set(fmt.Sprintf("X-Flood-%d", i), "x")
+			}
+		}, http.StatusRequestHeaderFieldsTooLarge},
+		{"repeated header", func(hd http.Header) {
+			for i := 0; i < 25; i++ {
+				hd.Add("X-Flood", "x")
+			}
+		}, http.StatusRequestHeaderFieldsTooLarge},
+		{"oversized value", func(hd http.Header) { hd.Set("Cookie", strings.Repeat("A", 2048)) }, http.StatusRequestHeaderFieldsTooLarge},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			tc.headers(req.Header)
+			req.RemoteAddr = "10.0.0.1:12345"
+			rr := httptest.NewRecorder()
+
+			h.ServeHTTP(rr, req)
+
+			if rr.Code != tc.want {
+				t.Errorf("expected %d, got %d", tc.want, rr.Code)
+			}
+		})
+	}
+}
+
 // TestSecurityNullBytes ensures null bytes in headers are handled
 func TestSecurityNullBytes(t *testing.T) {
 	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
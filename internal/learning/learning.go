@@ -0,0 +1,355 @@
+// Package learning records the traffic a profile sees and suggests an allow
+// rule group that would admit it, to speed up writing initial allowlists.
+package learning
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"shadowgate/internal/config"
+	"shadowgate/internal/geoip"
+	"shadowgate/internal/rules"
+)
+
+// DefaultMaxEntries bounds each recorded dimension by default
+const DefaultMaxEntries = 1000
+
+// Options configures a Recorder
+type Options struct {
+	// MaxEntries is the number of distinct values kept per dimension; further
+	// values are counted as dropped
+	MaxEntries int
+	// IPv4Prefix and IPv6Prefix are the subnet sizes client IPs are grouped into
+	IPv4Prefix int
+	IPv6Prefix int
+}
+
+// DefaultOptions returns default recorder options
+func DefaultOptions() Options {
+	return Options{
+		MaxEntries: DefaultMaxEntries,
+		IPv4Prefix: 24,
+		IPv6Prefix: 48,
+	}
+}
+
+// Observation is what a Recorder learns from one request
+type Observation struct {
+	ClientIP  string
+	UserAgent string
+	Path      string
+}
+
+// Recorder collects the distinct subnets, ASNs, user agents and path
+// prefixes seen by a profile, each in a bounded set
+type Recorder struct {
+	opts Options
+
+	started  time.Time
+	requests int64
+	subnets  *counter
+	asns     *counter
+	agents   *counter
+	paths    *counter
+	mu       sync.Mutex
+}
+
+// NewRecorder creates a recorder with default options
+func NewRecorder() *Recorder {
+	return NewRecorderWithOptions(DefaultOptions())
+}
+
+// NewRecorderWithOptions creates a recorder with custom options
+func NewRecorderWithOptions(opts Options) *Recorder {
+	defaults := DefaultOptions()
+	if opts.MaxEntries <= 0 {
+		opts.MaxEntries = defaults.MaxEntries
+	}
+	if opts.IPv4Prefix <= 0 || opts.IPv4Prefix > 32 {
+		opts.IPv4Prefix = defaults.IPv4Prefix
+	}
+	if opts.IPv6Prefix <= 0 || opts.IPv6Prefix > 128 {
+		opts.IPv6Prefix = defaults.IPv6Prefix
+	}
+	r := &Recorder{opts: opts}
+	r.Reset()
+	return r
+}
+
+// Reset discards everything recorded and starts a new learning window
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.started = time.Now()
+	r.requests = 0
+	r.subnets = newCounter(r.opts.MaxEntries)
+	r.asns = newCounter(r.opts.MaxEntries)
+	r.agents = newCounter(r.opts.MaxEntries)
+	r.paths = newCounter(r.opts.MaxEntries)
+}
+
+// Observe records a request
+func (r *Recorder) Observe(obs Observation) {
+	subnet := r.subnet(obs.ClientIP)
+
+	var asn string
+	if db := geoip.GetGlobal(); db != nil && obs.ClientIP != "" {
+		if n, _, err := db.LookupASN(obs.ClientIP); err == nil && n != 0 {
+			asn = fmt.Sprint(n)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.requests++
+	r.subnets.add(subnet)
+	r.asns.add(asn)
+	r.agents.add(obs.UserAgent)
+	r.paths.add(pathPrefix(obs.Path))
+}
+
+// subnet returns the CIDR of the configured size containing ip
+func (r *Recorder) subnet(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ""
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		mask := net.CIDRMask(r.opts.IPv4Prefix, 32)
+		return (&net.IPNet{IP: v4.Mask(mask), Mask: mask}).String()
+	}
+	mask := net.CIDRMask(r.opts.IPv6Prefix, 128)
+	return (&net.IPNet{IP: parsed.Mask(mask), Mask: mask}).String()
+}
+
+// pathPrefix reduces a path to its first segment ("/api/v1/users" is
+// "/api/"), which keeps the set small and the suggested rules general
+func pathPrefix(p string) string {
+	if p == "" {
+		return ""
+	}
+	p = rules.NormalizePath(p)
+	if i := strings.Index(p[1:], "/"); i >= 0 {
+		return p[:i+2]
+	}
+	return p
+}
+
+// Entry is a recorded value and the number of requests it was seen in
+type Entry struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+// Summary is a snapshot of what a Recorder has learned
+type Summary struct {
+	Since      time.Time `json:"since"`
+	Requests   int64     `json:"requests"`
+	Subnets    []Entry   `json:"subnets"`
+	ASNs       []Entry   `json:"asns"`
+	UserAgents []Entry   `json:"user_agents"`
+	Paths      []Entry   `json:"paths"`
+	// Dropped counts values not recorded because a set was full, by dimension
+	Dropped map[string]int64 `json:"dropped,omitempty"`
+}
+
+// Summary returns the values recorded so far, most frequent first
+func (r *Recorder) Summary() Summary {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s := Summary{
+		Since:      r.started,
+		Requests:   r.requests,
+		Subnets:    r.subnets.entries(),
+		ASNs:       r.asns.entries(),
+		UserAgents: r.agents.entries(),
+		Paths:      r.paths.entries(),
+	}
+	for name, c := range map[string]*counter{"subnets": r.subnets, "asns": r.asns, "user_agents": r.agents, "paths": r.paths} {
+		if c.dropped > 0 {
+			if s.Dropped == nil {
+				s.Dropped = make(map[string]int64)
+			}
+			s.Dropped[name] = c.dropped
+		}
+	}
+	return s
+}
+
+// Suggest builds an allow rule group admitting the recorded traffic. Values
+// seen in fewer than minCount requests are left out. A dimension is only
+// constrained if every request had a value for it, so the suggestion never
+// rejects traffic that was observed (apart from values dropped from a full
+// set, or left out by minCount).
+func (s Summary) Suggest(minCount int64) config.RulesConfig {
+	group := &config.RuleGroup{}
+
+	if cidrs := values(s.Subnets, minCount); len(cidrs) > 0 && s.covers(s.Subnets, "subnets") {
+		group.And = append(group.And, config.Rule{Type: "ip_allow", CIDRs: cidrs})
+	}
+
+	if s.covers(s.ASNs, "asns") {
+		var asns []uint
+		for _, v := range values(s.ASNs, minCount) {
+			var n uint
+			if _, err := fmt.Sscan(v, &n); err == nil {
+				asns = append(asns, n)
+			}
+		}
+		if len(asns) > 0 {
+			group.And = append(group.And, config.Rule{Type: "asn_allow", ASNs: asns})
+		}
+	}
+
+	if agents := values(s.UserAgents, minCount); len(agents) > 0 && s.covers(s.UserAgents, "user_agents") {
+		patterns := make([]string, len(agents))
+		for i, ua := range agents {
+			patterns[i] = "^" + regexp.QuoteMeta(ua) + "$"
+		}
+		group.And = append(group.And, config.Rule{Type: "ua_whitelist", Patterns: patterns})
+	}
+
+	if prefixes := values(s.Paths, minCount); len(prefixes) > 0 && s.covers(s.Paths, "paths") {
+		patterns := make([]string, len(prefixes))
+		for i, p := range prefixes {
+			patterns[i] = "^" + regexp.QuoteMeta(p)
+			if !strings.HasSuffix(p, "/") {
+				patterns[i] += "$"
+			}
+		}
+		group.And = append(group.And, config.Rule{Type: "path_allow", Paths: patterns})
+	}
+
+	return config.RulesConfig{Allow: group}
+}
+
+// SuggestYAML renders Suggest as a rules section ready to paste into a profile
+func (s Summary) SuggestYAML(minCount int64) ([]byte, error) {
+	var doc struct {
+		Rules struct {
+			Allow *config.RuleGroup `yaml:"allow"`
+		} `yaml:"rules"`
+	}
+	doc.Rules.Allow = s.Suggest(minCount).Allow
+
+	var out bytes.Buffer
+	enc := yaml.NewEncoder(&out)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return nil, fmt.Errorf("failed to render suggestion: %w", err)
+	}
+
+	header := fmt.Sprintf("# Suggested from %d requests since %s\n", s.Requests, s.Since.UTC().Format(time.RFC3339))
+	names := make([]string, 0, len(s.Dropped))
+	for name := range s.Dropped {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		header += fmt.Sprintf("# Warning: %d requests with new %s not recorded (set full)\n", s.Dropped[name], name)
+	}
+	return append([]byte(header), out.Bytes()...), nil
+}
+
+// values returns recorded values seen at least minCount times, sorted
+func values(entries []Entry, minCount int64) []string {
+	var out []string
+	for _, e := range entries {
+		if e.Count >= minCount {
+			out = append(out, e.Value)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// covers reports whether every request had a value for the dimension, i.e.
+// the recorded and dropped values account for all requests
+func (s Summary) covers(entries []Entry, dimension string) bool {
+	total := s.Dropped[dimension]
+	for _, e := range entries {
+		total += e.Count
+	}
+	return s.Requests > 0 && total == s.Requests
+}
+
+// counter counts distinct non-empty values up to a limit
+type counter struct {
+	counts  map[string]int64
+	limit   int
+	dropped int64 // requests whose value did not fit
+}
+
+func newCounter(limit int) *counter {
+	return &counter{counts: make(map[string]int64), limit: limit}
+}
+
+func (c *counter) add(v string) {
+	if v == "" {
+		return
+	}
+	if _, ok := c.counts[v]; !ok && len(c.counts) >= c.limit {
+		c.dropped++
+		return
+	}
+	c.counts[v]++
+}
+
+// entries returns the counted values, most frequent first
+func (c *counter) entries() []Entry {
+	out := make([]Entry, 0, len(c.counts))
+	for v, n := range c.counts {
+		out = append(out, Entry{Value: v, Count: n})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].Value < out[j].Value
+	})
+	return out
+}
+
+// Registry holds a Recorder per profile so learned data survives reloads
+type Registry struct {
+	recorders map[string]*Recorder
+	mu        sync.RWMutex
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{recorders: make(map[string]*Recorder)}
+}
+
+// Recorder returns the recorder for profileID, creating it with opts on first
+// use. An existing recorder keeps its data and original options.
+func (r *Registry) Recorder(profileID string, opts Options) *Recorder {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rec, ok := r.recorders[profileID]
+	if !ok {
+		rec = NewRecorderWithOptions(opts)
+		r.recorders[profileID] = rec
+	}
+	return rec
+}
+
+// Lookup returns the recorder for profileID if learning was enabled for it
+func (r *Registry) Lookup(profileID string) (*Recorder, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	rec, ok := r.recorders[profileID]
+	return rec, ok
+}
@@ -0,0 +1,133 @@
+package learning
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+
+	"shadowgate/internal/config"
+)
+
+func TestRecorderSummary(t *testing.T) {
+	r := NewRecorder()
+	r.Observe(Observation{ClientIP: "198.51.100.20", UserAgent: "app/1.0", Path: "/api/v1/users"})
+	r.Observe(Observation{ClientIP: "198.51.100.30", UserAgent: "app/1.0", Path: "/api/v1/orders"})
+	r.Observe(Observation{ClientIP: "2001:db8:1:2::5", UserAgent: "app/1.1", Path: "/health"})
+
+	s := r.Summary()
+	if s.Requests != 3 {
+		t.Errorf("expected 3 requests, got %d", s.Requests)
+	}
+	if len(s.Subnets) != 2 || s.Subnets[0].Value != "198.51.100.0/24" || s.Subnets[0].Count != 2 {
+		t.Errorf("unexpected subnets: %+v", s.Subnets)
+	}
+	if s.Subnets[1].Value != "2001:db8:1::/48" {
+		t.Errorf("expected IPv6 /48, got %s", s.Subnets[1].Value)
+	}
+	if len(s.Paths) != 2 || s.Paths[0].Value != "/api/" || s.Paths[1].Value != "/health" {
+		t.Errorf("unexpected paths: %+v", s.Paths)
+	}
+	if len(s.UserAgents) != 2 {
+		t.Errorf("unexpected user agents: %+v", s.UserAgents)
+	}
+
+	r.Reset()
+	if s := r.Summary(); s.Requests != 0 || len(s.Subnets) != 0 {
+		t.Errorf("expected empty summary after reset, got %+v", s)
+	}
+}
+
+func TestRecorderBounded(t *testing.T) {
+	r := NewRecorderWithOptions(Options{MaxEntries: 2})
+	for _, ua := range []string{"a", "b", "c", "a"} {
+		r.Observe(Observation{ClientIP: "192.0.2.1", UserAgent: ua, Path: "/"})
+	}
+
+	s := r.Summary()
+	if len(s.UserAgents) != 2 {
+		t.Errorf("expected 2 user agents, got %+v", s.UserAgents)
+	}
+	if s.Dropped["user_agents"] != 1 {
+		t.Errorf("expected 1 dropped user agent, got %v", s.Dropped)
+	}
+
+	out, err := s.SuggestYAML(1)
+	if err != nil {
+		t.Fatalf("SuggestYAML failed: %v", err)
+	}
+	if !strings.Contains(string(out), "# Warning: 1 requests with new user_agents not recorded") {
+		t.Errorf("expected dropped warning, got:\n%s", out)
+	}
+}
+
+func TestSuggestYAML(t *testing.T) {
+	r := NewRecorder()
+	r.Observe(Observation{ClientIP: "198.51.100.20", UserAgent: "app/1.0 (x)", Path: "/api/users"})
+	r.Observe(Observation{ClientIP: "198.51.100.21", UserAgent: "app/1.0 (x)", Path: "/login"})
+	r.Observe(Observation{ClientIP: "203.0.113.5", Path: "/api/users"})
+
+	out, err := r.Summary().SuggestYAML(1)
+	if err != nil {
+		t.Fatalf("SuggestYAML failed: %v", err)
+	}
+
+	var parsed struct {
+		Rules config.RulesConfig `yaml:"rules"`
+	}
+	if err := yaml.Unmarshal(out, &parsed); err != nil {
+		t.Fatalf("suggestion is not valid YAML: %v\n%s", err, out)
+	}
+	if parsed.Rules.Allow == nil {
+		t.Fatalf("expected allow group, got:\n%s", out)
+	}
+
+	byType := make(map[string]config.Rule)
+	for _, rule := range parsed.Rules.Allow.And {
+		if err := rule.Validate(); err != nil {
+			t.Errorf("suggested %s rule is invalid: %v", rule.Type, err)
+		}
+		byType[rule.Type] = rule
+	}
+
+	if got := byType["ip_allow"].CIDRs; len(got) != 2 || got[0] != "198.51.100.0/24" || got[1] != "203.0.113.0/24" {
+		t.Errorf("unexpected CIDRs: %v", got)
+	}
+	if got := byType["path_allow"].Paths; len(got) != 2 || got[0] != "^/api/" || got[1] != "^/login$" {
+		t.Errorf("unexpected paths: %v", got)
+	}
+	// One request had no User-Agent, so constraining it would reject observed traffic
+	if _, ok := byType["ua_whitelist"]; ok {
+		t.Error("expected no ua_whitelist when some requests lacked a User-Agent")
+	}
+	// No GeoIP database is loaded
+	if _, ok := byType["asn_allow"]; ok {
+		t.Error("expected no asn_allow without GeoIP")
+	}
+
+	// min_count leaves out rarely seen values
+	s := r.Summary().Suggest(2)
+	for _, rule := range s.Allow.And {
+		if rule.Type == "ip_allow" && (len(rule.CIDRs) != 1 || rule.CIDRs[0] != "198.51.100.0/24") {
+			t.Errorf("expected only the frequent subnet, got %v", rule.CIDRs)
+		}
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	reg := NewRegistry()
+	if _, ok := reg.Lookup("team-a"); ok {
+		t.Error("expected no recorder before first use")
+	}
+
+	rec := reg.Recorder("team-a", DefaultOptions())
+	rec.Observe(Observation{ClientIP: "192.0.2.1"})
+
+	// Recorders survive handler rebuilds, e.g. on reload
+	if again := reg.Recorder("team-a", DefaultOptions()); again != rec || again.Summary().Requests != 1 {
+		t.Error("expected the existing recorder to be returned")
+	}
+	if got, ok := reg.Lookup("team-a"); !ok || got != rec {
+		t.Error("expected Lookup to find the recorder")
+	}
+}
@@ -0,0 +1,116 @@
+package listener
+
+import (
+	"math"
+	"net"
+	"sync"
+	"time"
+)
+
+// acceptSweepInterval is how often idle per-IP buckets are discarded
+const acceptSweepInterval = time.Minute
+
+// AcceptLimitConfig limits the rate of new connections. Rates are in
+// connections per second; a zero rate disables that limit. A zero burst
+// defaults to the rate rounded up (at least 1).
+type AcceptLimitConfig struct {
+	GlobalRate  float64
+	GlobalBurst int
+	PerIPRate   float64
+	PerIPBurst  int
+}
+
+// Enabled reports whether any limit is configured
+func (c AcceptLimitConfig) Enabled() bool {
+	return c.GlobalRate > 0 || c.PerIPRate > 0
+}
+
+// tokenBucket is a token bucket refilled continuously at rate per second
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func (b *tokenBucket) take(now time.Time, rate float64, burst int) bool {
+	b.tokens = math.Min(float64(burst), b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// acceptLimiter decides whether a new connection may proceed
+type acceptLimiter struct {
+	cfg       AcceptLimitConfig
+	global    tokenBucket
+	perIP     map[string]*tokenBucket
+	lastSweep time.Time
+	mu        sync.Mutex
+	now       func() time.Time
+}
+
+func newAcceptLimiter(cfg AcceptLimitConfig) *acceptLimiter {
+	cfg.GlobalBurst = defaultBurst(cfg.GlobalRate, cfg.GlobalBurst)
+	cfg.PerIPBurst = defaultBurst(cfg.PerIPRate, cfg.PerIPBurst)
+
+	now := time.Now()
+	return &acceptLimiter{
+		cfg:       cfg,
+		global:    tokenBucket{tokens: float64(cfg.GlobalBurst), last: now},
+		perIP:     make(map[string]*tokenBucket),
+		lastSweep: now,
+		now:       time.Now,
+	}
+}
+
+func defaultBurst(rate float64, burst int) int {
+	if burst > 0 {
+		return burst
+	}
+	return int(math.Max(1, math.Ceil(rate)))
+}
+
+// allow consumes a token for a connection from remoteAddr. The per-IP limit
+// is checked first so a single flooding client does not drain the global
+// budget shared by everyone else.
+func (a *acceptLimiter) allow(remoteAddr net.Addr) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := a.now()
+	if now.Sub(a.lastSweep) >= acceptSweepInterval {
+		a.sweep(now)
+	}
+
+	if a.cfg.PerIPRate > 0 {
+		// Unix socket peers have no IP and are only subject to the global limit
+		if host, _, err := net.SplitHostPort(remoteAddr.String()); err == nil {
+			b, ok := a.perIP[host]
+			if !ok {
+				b = &tokenBucket{tokens: float64(a.cfg.PerIPBurst), last: now}
+				a.perIP[host] = b
+			}
+			if !b.take(now, a.cfg.PerIPRate, a.cfg.PerIPBurst) {
+				return false
+			}
+		}
+	}
+
+	if a.cfg.GlobalRate > 0 && !a.global.take(now, a.cfg.GlobalRate, a.cfg.GlobalBurst) {
+		return false
+	}
+	return true
+}
+
+// sweep drops per-IP buckets that have refilled completely, since they are
+// indistinguishable from new ones; caller holds mu
+func (a *acceptLimiter) sweep(now time.Time) {
+	for ip, b := range a.perIP {
+		if b.tokens+now.Sub(b.last).Seconds()*a.cfg.PerIPRate >= float64(a.cfg.PerIPBurst) {
+			delete(a.perIP, ip)
+		}
+	}
+	a.lastSweep = now
+}
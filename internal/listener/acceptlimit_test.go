@@ -0,0 +1,70 @@
+package listener
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestAcceptLimiterPerIP(t *testing.T) {
+	a := newAcceptLimiter(AcceptLimitConfig{PerIPRate: 1, PerIPBurst: 2})
+	now := time.Now()
+	a.now = func() time.Time { return now }
+
+	client := &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 1000}
+	other := &net.TCPAddr{IP: net.ParseIP("192.0.2.2"), Port: 1000}
+
+	if !a.allow(client) || !a.allow(client) {
+		t.Fatal("expected burst of 2 to be allowed")
+	}
+	if a.allow(client) {
+		t.Error("expected third connection within the burst to be rejected")
+	}
+	if !a.allow(other) {
+		t.Error("expected a different client to be unaffected")
+	}
+
+	now = now.Add(time.Second)
+	if !a.allow(client) {
+		t.Error("expected a token to be refilled after one second")
+	}
+}
+
+func TestAcceptLimiterGlobal(t *testing.T) {
+	a := newAcceptLimiter(AcceptLimitConfig{GlobalRate: 2})
+	now := time.Now()
+	a.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		addr := &net.TCPAddr{IP: net.IPv4(192, 0, 2, byte(i+1)), Port: 1000}
+		if !a.allow(addr) {
+			t.Fatalf("connection %d: expected to be allowed", i)
+		}
+	}
+	if a.allow(&net.TCPAddr{IP: net.ParseIP("192.0.2.9"), Port: 1000}) {
+		t.Error("expected global limit to reject a third client")
+	}
+
+	// Unix socket peers have no IP but still count against the global limit
+	now = now.Add(time.Second)
+	if !a.allow(&net.UnixAddr{Name: "@", Net: "unix"}) {
+		t.Error("expected unix peer to be allowed after refill")
+	}
+}
+
+func TestAcceptLimiterSweep(t *testing.T) {
+	a := newAcceptLimiter(AcceptLimitConfig{PerIPRate: 10})
+	now := time.Now()
+	a.now = func() time.Time { return now }
+
+	a.allow(&net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 1000})
+	if len(a.perIP) != 1 {
+		t.Fatalf("expected 1 tracked client, got %d", len(a.perIP))
+	}
+
+	now = now.Add(acceptSweepInterval)
+	a.allow(&net.TCPAddr{IP: net.ParseIP("192.0.2.2"), Port: 1000})
+	if _, ok := a.perIP["192.0.2.1"]; ok {
+		t.Error("expected idle client bucket to be swept")
+	}
+}
@@ -6,61 +6,178 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"os"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 )
 
+// UnixPrefix marks a listener address as a Unix domain socket path
+const UnixPrefix = "unix:"
+
+// Server timeout defaults
+const (
+	DefaultReadTimeout       = 30 * time.Second
+	DefaultWriteTimeout      = 30 * time.Second
+	DefaultIdleTimeout       = 120 * time.Second
+	DefaultReadHeaderTimeout = 10 * time.Second
+)
+
+// Timeouts bounds how long the server waits on clients. Zero values use
+// the defaults.
+type Timeouts struct {
+	Read       time.Duration // reading the whole request, including the body
+	Write      time.Duration // from the end of the request headers to the end of the response
+	Idle       time.Duration // waiting for the next request on a keep-alive connection
+	ReadHeader time.Duration // reading the request headers
+}
+
+// withDefaults returns t with unset timeouts replaced by the defaults
+func (t Timeouts) withDefaults() Timeouts {
+	if t.Read <= 0 {
+		t.Read = DefaultReadTimeout
+	}
+	if t.Write <= 0 {
+		t.Write = DefaultWriteTimeout
+	}
+	if t.Idle <= 0 {
+		t.Idle = DefaultIdleTimeout
+	}
+	if t.ReadHeader <= 0 {
+		t.ReadHeader = DefaultReadHeaderTimeout
+	}
+	return t
+}
+
 // HTTPListener handles HTTP/HTTPS connections
 type HTTPListener struct {
 	addr        string
+	socketMode  os.FileMode
 	tlsConfig   *tls.Config
-	handler     http.Handler
+	handler     atomic.Value // handlerBox; swappable while serving
 	server      *http.Server
 	listener    net.Listener
 	activeConns int64 // atomic counter for active connections
+	draining    int32 // atomic flag set once Drain is called
+	serving     int32 // atomic flag set while the accept loop runs
+
+	acceptLimit   *acceptLimiter // nil when connection-rate limiting is disabled
+	rejectedConns int64          // atomic counter of connections refused by acceptLimit
+
+	proxyProtocol ProxyProtocolConfig
+	timeouts      Timeouts
+	noKeepAlive   bool
+
+	connObserver ConnObserver // nil when connection metrics are not collected
+	connStates   sync.Map     // net.Conn -> last http.ConnState, for connObserver
 }
 
 // HTTPListenerConfig configures the HTTP listener
 type HTTPListenerConfig struct {
-	Addr      string
-	TLSConfig *tls.Config
-	Handler   http.Handler
+	Addr       string      // host:port, or "unix:" followed by a socket path
+	SocketMode os.FileMode // permissions applied to a unix socket (0 = leave as created)
+	TLSConfig  *tls.Config
+	Handler    http.Handler
+
+	// AcceptLimit closes new connections above the configured rates before
+	// any request is read
+	AcceptLimit AcceptLimitConfig
+
+	// ProxyProtocol takes client addresses from PROXY protocol headers sent
+	// by trusted load balancers
+	ProxyProtocol ProxyProtocolConfig
+
+	// Timeouts for the HTTP server (zero values use the defaults)
+	Timeouts Timeouts
+
+	// DisableKeepAlives closes each connection after its first response
+	DisableKeepAlives bool
+
+	// ConnObserver, if set, is told about accepted connections and their
+	// state changes
+	ConnObserver ConnObserver
+}
+
+// handlerBox gives atomic.Value a single concrete type to store
+type handlerBox struct {
+	http.Handler
 }
 
 // NewHTTPListener creates a new HTTP/HTTPS listener
 func NewHTTPListener(cfg HTTPListenerConfig) *HTTPListener {
-	return &HTTPListener{
-		addr:      cfg.Addr,
-		tlsConfig: cfg.TLSConfig,
-		handler:   cfg.Handler,
+	l := &HTTPListener{
+		addr:          cfg.Addr,
+		socketMode:    cfg.SocketMode,
+		tlsConfig:     cfg.TLSConfig,
+		proxyProtocol: cfg.ProxyProtocol,
+		timeouts:      cfg.Timeouts.withDefaults(),
+		noKeepAlive:   cfg.DisableKeepAlives,
+		connObserver:  cfg.ConnObserver,
+	}
+	if cfg.AcceptLimit.Enabled() {
+		l.acceptLimit = newAcceptLimiter(cfg.AcceptLimit)
+	}
+	l.SetHandler(cfg.Handler)
+	return l
+}
+
+// SetHandler replaces the handler for subsequent requests without
+// interrupting accepted connections or in-flight requests
+func (l *HTTPListener) SetHandler(h http.Handler) {
+	l.handler.Store(handlerBox{h})
+}
+
+// ServeHTTP dispatches to the current handler
+func (l *HTTPListener) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h := l.handler.Load().(handlerBox)
+	if h.Handler == nil {
+		http.DefaultServeMux.ServeHTTP(w, r)
+		return
 	}
+	h.ServeHTTP(w, r)
 }
 
 // Start begins accepting HTTP connections
 func (l *HTTPListener) Start(ctx context.Context) error {
 	var err error
-	l.listener, err = net.Listen("tcp", l.addr)
+	if path, ok := strings.CutPrefix(l.addr, UnixPrefix); ok {
+		l.listener, err = listenUnix(path, l.socketMode)
+	} else {
+		l.listener, err = net.Listen("tcp", l.addr)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to listen on %s: %w", l.addr, err)
 	}
 
 	l.server = &http.Server{
-		Handler:           l.handler,
-		ReadTimeout:       30 * time.Second,
-		WriteTimeout:      30 * time.Second,
-		IdleTimeout:       120 * time.Second,
-		ReadHeaderTimeout: 10 * time.Second,
+		Handler:           l,
+		ReadTimeout:       l.timeouts.Read,
+		WriteTimeout:      l.timeouts.Write,
+		IdleTimeout:       l.timeouts.Idle,
+		ReadHeaderTimeout: l.timeouts.ReadHeader,
 		MaxHeaderBytes:    1 << 20, // 1MB
 		ConnState:         l.trackConnState,
 	}
+	if l.noKeepAlive {
+		l.server.SetKeepAlivesEnabled(false)
+	}
+
+	// The PROXY header precedes the TLS handshake
+	if l.proxyProtocol.Enabled {
+		l.listener = newProxyProtoListener(l.listener, l.proxyProtocol)
+		l.server.ConnContext = withProxySource
+	}
 
 	if l.tlsConfig != nil {
 		l.server.TLSConfig = l.tlsConfig
 		l.listener = tls.NewListener(l.listener, l.tlsConfig)
 	}
 
+	atomic.StoreInt32(&l.serving, 1)
 	go func() {
-		if err := l.server.Serve(l.listener); err != nil && err != http.ErrServerClosed {
+		defer atomic.StoreInt32(&l.serving, 0)
+		if err := l.server.Serve(l.listener); err != nil && err != http.ErrServerClosed && !l.IsDraining() {
 			// Log error but don't crash
 			fmt.Printf("HTTP server error: %v\n", err)
 		}
@@ -69,14 +186,75 @@ func (l *HTTPListener) Start(ctx context.Context) error {
 	return nil
 }
 
-// trackConnState tracks connection state changes for monitoring
+// listenUnix binds a Unix domain socket, replacing a stale socket file left
+// behind by an unclean shutdown. The socket file is removed when the
+// listener is closed.
+func listenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("failed to remove stale socket: %w", err)
+		}
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	if mode != 0 {
+		if err := os.Chmod(path, mode); err != nil {
+			ln.Close()
+			return nil, fmt.Errorf("failed to set socket permissions: %w", err)
+		}
+	}
+	return ln, nil
+}
+
+// trackConnState tracks connection state changes for monitoring and
+// enforces the accept limit. It runs in the accept loop for new connections,
+// so a rejected connection is closed before the TLS handshake or any request
+// is read; the server then reports it as closed.
 func (l *HTTPListener) trackConnState(conn net.Conn, state http.ConnState) {
 	switch state {
 	case http.StateNew:
 		atomic.AddInt64(&l.activeConns, 1)
+		if l.acceptLimit != nil && !l.acceptLimit.allow(conn.RemoteAddr()) {
+			atomic.AddInt64(&l.rejectedConns, 1)
+			conn.Close()
+			return
+		}
 	case http.StateClosed, http.StateHijacked:
 		atomic.AddInt64(&l.activeConns, -1)
 	}
+
+	if l.connObserver != nil {
+		l.observeConnState(conn, state)
+	}
+}
+
+// observeConnState reports a state change to the connection observer.
+// Connections rejected by the accept limit were never reported as opened,
+// so their later transitions are ignored.
+func (l *HTTPListener) observeConnState(conn net.Conn, state http.ConnState) {
+	if state == http.StateNew {
+		l.connStates.Store(conn, state)
+		l.connObserver.RecordConnOpened()
+		return
+	}
+
+	prev, ok := l.connStates.Load(conn)
+	if !ok {
+		return
+	}
+	if state == http.StateClosed || state == http.StateHijacked {
+		l.connStates.Delete(conn)
+	} else {
+		l.connStates.Store(conn, state)
+	}
+	l.connObserver.RecordConnState(prev.(http.ConnState), state)
 }
 
 // ActiveConnections returns the number of active connections
@@ -84,12 +262,46 @@ func (l *HTTPListener) ActiveConnections() int64 {
 	return atomic.LoadInt64(&l.activeConns)
 }
 
+// Serving reports whether the listener is accepting connections; it is
+// false before Start and after Drain, Stop or an accept error
+func (l *HTTPListener) Serving() bool {
+	return atomic.LoadInt32(&l.serving) == 1
+}
+
+// RejectedConnections returns the number of connections closed by the accept limit
+func (l *HTTPListener) RejectedConnections() int64 {
+	return atomic.LoadInt64(&l.rejectedConns)
+}
+
+// Drain stops accepting new connections and disables keep-alives so that
+// existing connections close after their in-flight request completes
+func (l *HTTPListener) Drain() error {
+	if l.server == nil || !atomic.CompareAndSwapInt32(&l.draining, 0, 1) {
+		return nil
+	}
+	l.server.SetKeepAlivesEnabled(false)
+	return l.listener.Close()
+}
+
+// IsDraining reports whether Drain has been called
+func (l *HTTPListener) IsDraining() bool {
+	return atomic.LoadInt32(&l.draining) == 1
+}
+
 // Stop gracefully shuts down the HTTP listener
 func (l *HTTPListener) Stop(ctx context.Context) error {
 	if l.server == nil {
 		return nil
 	}
-	return l.server.Shutdown(ctx)
+	err := l.server.Shutdown(ctx)
+
+	// Closing the listener unlinks the socket; make sure nothing is left behind
+	if path, ok := strings.CutPrefix(l.addr, UnixPrefix); ok {
+		if rmErr := os.Remove(path); rmErr != nil && !os.IsNotExist(rmErr) && err == nil {
+			err = fmt.Errorf("failed to remove socket: %w", rmErr)
+		}
+	}
+	return err
 }
 
 // Addr returns the listener address (actual bound address if available)
@@ -102,14 +314,56 @@ func (l *HTTPListener) Addr() string {
 
 // LoadTLSConfig loads TLS configuration from cert and key files
 func LoadTLSConfig(certFile, keyFile string) (*tls.Config, error) {
+	return LoadTLSConfigWithOptions(certFile, keyFile, TLSOptions{})
+}
+
+// LoadTLSConfigWithOptions loads TLS configuration from cert and key files
+// with session resumption and OCSP stapling settings
+func LoadTLSConfigWithOptions(certFile, keyFile string, opts TLSOptions) (*tls.Config, error) {
+	cert, err := LoadCertificateWithOCSP(certFile, keyFile, opts.OCSPStapleFile)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := defaultTLSConfig()
+	cfg.Certificates = []tls.Certificate{*cert}
+	if err := opts.Apply(cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// LoadCertificate loads a certificate and key pair from files
+func LoadCertificate(certFile, keyFile string) (*tls.Certificate, error) {
 	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
 	}
+	return &cert, nil
+}
+
+// LoadCertificateWithOCSP loads a certificate and key pair from files and
+// staples the OCSP response in ocspFile to it, if set
+func LoadCertificateWithOCSP(certFile, keyFile, ocspFile string) (*tls.Certificate, error) {
+	cert, err := LoadCertificate(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	if ocspFile != "" {
+		if cert.OCSPStaple, err = LoadOCSPStaple(ocspFile); err != nil {
+			return nil, err
+		}
+	}
+	return cert, nil
+}
 
+// defaultTLSConfig returns the base TLS settings shared by all listeners
+func defaultTLSConfig() *tls.Config {
 	return &tls.Config{
-		Certificates: []tls.Certificate{cert},
-		MinVersion:   tls.VersionTLS12,
+		MinVersion: tls.VersionTLS12,
+		// Advertising ALPN enables HTTP/2 and lets rules see the
+		// negotiated protocol
+		NextProtos: []string{"h2", "http/1.1"},
 		CipherSuites: []uint16{
 			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
 			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
@@ -118,5 +372,5 @@ func LoadTLSConfig(certFile, keyFile string) (*tls.Config, error) {
 			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
 			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
 		},
-	}, nil
+	}
 }
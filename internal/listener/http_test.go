@@ -3,7 +3,12 @@ package listener
 import (
 	"context"
 	"io"
+	"net"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -122,6 +127,79 @@ func TestHTTPListenerConnectionTracking(t *testing.T) {
 	}
 }
 
+// connRecorder is a ConnObserver keeping current gauges like the metrics
+// collector does
+type connRecorder struct {
+	opened, active, idle int64
+}
+
+func (c *connRecorder) RecordConnOpened() {
+	atomic.AddInt64(&c.opened, 1)
+}
+
+func (c *connRecorder) RecordConnState(from, to http.ConnState) {
+	for state, delta := range map[http.ConnState]int64{from: -1, to: 1} {
+		switch state {
+		case http.StateActive:
+			atomic.AddInt64(&c.active, delta)
+		case http.StateIdle:
+			atomic.AddInt64(&c.idle, delta)
+		}
+	}
+}
+
+func TestHTTPListenerConnObserver(t *testing.T) {
+	obs := &connRecorder{}
+	listener := NewHTTPListener(HTTPListenerConfig{
+		Addr:         "127.0.0.1:0",
+		Handler:      http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		ConnObserver: obs,
+	})
+
+	ctx := context.Background()
+	if err := listener.Start(ctx); err != nil {
+		t.Fatalf("failed to start listener: %v", err)
+	}
+	defer listener.Stop(ctx)
+
+	// Three requests on one keep-alive connection
+	client := &http.Client{Transport: &http.Transport{}}
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get("http://" + listener.Addr())
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+
+	waitFor := func(cond func() bool) bool {
+		deadline := time.Now().Add(2 * time.Second)
+		for time.Now().Before(deadline) {
+			if cond() {
+				return true
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		return false
+	}
+
+	if !waitFor(func() bool { return atomic.LoadInt64(&obs.idle) == 1 }) {
+		t.Errorf("expected 1 idle connection, got %d", atomic.LoadInt64(&obs.idle))
+	}
+	if n := atomic.LoadInt64(&obs.opened); n != 1 {
+		t.Errorf("expected 1 connection opened, got %d", n)
+	}
+	if n := atomic.LoadInt64(&obs.active); n != 0 {
+		t.Errorf("expected no active connections, got %d", n)
+	}
+
+	client.CloseIdleConnections()
+	if !waitFor(func() bool { return atomic.LoadInt64(&obs.idle) == 0 }) {
+		t.Errorf("expected idle gauge to drop after close, got %d", atomic.LoadInt64(&obs.idle))
+	}
+}
+
 func TestHTTPListenerGracefulShutdown(t *testing.T) {
 	requestStarted := make(chan struct{})
 	requestComplete := make(chan struct{})
@@ -171,3 +249,290 @@ func TestHTTPListenerGracefulShutdown(t *testing.T) {
 		t.Error("request did not complete during graceful shutdown")
 	}
 }
+
+func TestHTTPListenerDrain(t *testing.T) {
+	release := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Write([]byte("done"))
+	})
+
+	listener := NewHTTPListener(HTTPListenerConfig{
+		Addr:    "127.0.0.1:0",
+		Handler: handler,
+	})
+
+	ctx := context.Background()
+	if err := listener.Start(ctx); err != nil {
+		t.Fatalf("failed to start listener: %v", err)
+	}
+	defer listener.Stop(ctx)
+	addr := listener.Addr()
+
+	// Start an in-flight request
+	result := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://" + addr)
+		if err != nil {
+			result <- "error: " + err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		result <- string(body)
+	}()
+
+	// Wait for the connection to be tracked
+	deadline := time.Now().Add(time.Second)
+	for listener.ActiveConnections() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := listener.Drain(); err != nil {
+		t.Fatalf("drain failed: %v", err)
+	}
+	if !listener.IsDraining() {
+		t.Error("expected listener to report draining")
+	}
+
+	// New connections are refused
+	client := &http.Client{Timeout: time.Second}
+	if _, err := client.Get("http://" + addr); err == nil {
+		t.Error("expected new connection to be rejected while draining")
+	}
+
+	// In-flight request still completes
+	close(release)
+	if got := <-result; got != "done" {
+		t.Errorf("expected in-flight request to complete, got %q", got)
+	}
+}
+
+func TestHTTPListenerUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "shadowgate.sock")
+
+	// A stale socket file from an unclean shutdown must not block startup
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("failed to create stale socket: %v", err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	listener := NewHTTPListener(HTTPListenerConfig{
+		Addr:       UnixPrefix + path,
+		SocketMode: 0600,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("unix"))
+		}),
+	})
+
+	ctx := context.Background()
+	if err := listener.Start(ctx); err != nil {
+		t.Fatalf("failed to start listener: %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("socket file missing: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("expected socket permissions 0600, got %o", perm)
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", path)
+			},
+		},
+	}
+	resp, err := client.Get("http://unix/")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "unix" {
+		t.Errorf("expected 'unix', got %q", string(body))
+	}
+
+	if err := listener.Stop(ctx); err != nil {
+		t.Fatalf("failed to stop listener: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("expected socket file to be removed on shutdown")
+	}
+}
+
+func TestHTTPListenerUnixRefusesRegularFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "not-a-socket")
+	os.WriteFile(path, []byte("data"), 0644)
+
+	listener := NewHTTPListener(HTTPListenerConfig{Addr: UnixPrefix + path})
+	if err := listener.Start(context.Background()); err == nil {
+		listener.Stop(context.Background())
+		t.Error("expected error when socket path is a regular file")
+	}
+}
+
+func TestHTTPListenerSetHandler(t *testing.T) {
+	respond := func(body string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(body))
+		})
+	}
+
+	listener := NewHTTPListener(HTTPListenerConfig{
+		Addr:    "127.0.0.1:0",
+		Handler: respond("old"),
+	})
+
+	ctx := context.Background()
+	if err := listener.Start(ctx); err != nil {
+		t.Fatalf("failed to start listener: %v", err)
+	}
+	defer listener.Stop(ctx)
+
+	get := func() string {
+		resp, err := http.Get("http://" + listener.Addr())
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	if got := get(); got != "old" {
+		t.Fatalf("expected body 'old', got %q", got)
+	}
+
+	listener.SetHandler(respond("new"))
+
+	if got := get(); got != "new" {
+		t.Errorf("expected body 'new' after swap, got %q", got)
+	}
+}
+
+func TestHTTPListenerAcceptLimit(t *testing.T) {
+	var served int32
+	listener := NewHTTPListener(HTTPListenerConfig{
+		Addr: "127.0.0.1:0",
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&served, 1)
+		}),
+		AcceptLimit: AcceptLimitConfig{PerIPRate: 0.001, PerIPBurst: 1},
+	})
+
+	ctx := context.Background()
+	if err := listener.Start(ctx); err != nil {
+		t.Fatalf("failed to start listener: %v", err)
+	}
+	defer listener.Stop(ctx)
+
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+
+	resp, err := client.Get("http://" + listener.Addr())
+	if err != nil {
+		t.Fatalf("first request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if _, err := client.Get("http://" + listener.Addr()); err == nil {
+		t.Error("expected connection over the rate to be closed")
+	}
+
+	if got := atomic.LoadInt32(&served); got != 1 {
+		t.Errorf("expected handler to run once, ran %d times", got)
+	}
+	if got := listener.RejectedConnections(); got < 1 {
+		t.Errorf("expected rejected connections to be counted, got %d", got)
+	}
+}
+
+func TestHTTPListenerServing(t *testing.T) {
+	listener := NewHTTPListener(HTTPListenerConfig{Addr: "127.0.0.1:0"})
+	if listener.Serving() {
+		t.Error("expected listener not to be serving before Start")
+	}
+
+	ctx := context.Background()
+	if err := listener.Start(ctx); err != nil {
+		t.Fatalf("failed to start listener: %v", err)
+	}
+	if !listener.Serving() {
+		t.Error("expected listener to be serving after Start")
+	}
+
+	listener.Stop(ctx)
+	deadline := time.Now().Add(time.Second)
+	for listener.Serving() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if listener.Serving() {
+		t.Error("expected listener to stop serving after Stop")
+	}
+}
+
+func TestHTTPListenerTimeouts(t *testing.T) {
+	if got := (Timeouts{Write: time.Hour}).withDefaults(); got.Write != time.Hour || got.Read != DefaultReadTimeout || got.ReadHeader != DefaultReadHeaderTimeout {
+		t.Errorf("unexpected timeouts after defaults: %+v", got)
+	}
+
+	listener := NewHTTPListener(HTTPListenerConfig{
+		Addr:     "127.0.0.1:0",
+		Handler:  http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		Timeouts: Timeouts{ReadHeader: 100 * time.Millisecond},
+	})
+	ctx := context.Background()
+	if err := listener.Start(ctx); err != nil {
+		t.Fatalf("failed to start listener: %v", err)
+	}
+	defer listener.Stop(ctx)
+
+	// A client that never finishes its headers is disconnected
+	conn, err := net.Dial("tcp", listener.Addr())
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("GET / HTTP/1.1\r\nHost: example.com\r\n"))
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	start := time.Now()
+	io.ReadAll(conn)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected slow client to be disconnected by the header timeout, waited %v", elapsed)
+	}
+}
+
+func TestHTTPListenerDisableKeepAlives(t *testing.T) {
+	listener := NewHTTPListener(HTTPListenerConfig{
+		Addr:              "127.0.0.1:0",
+		Handler:           http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		DisableKeepAlives: true,
+	})
+	ctx := context.Background()
+	if err := listener.Start(ctx); err != nil {
+		t.Fatalf("failed to start listener: %v", err)
+	}
+	defer listener.Stop(ctx)
+
+	conn, err := net.Dial("tcp", listener.Addr())
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"))
+
+	// The server answers and then closes the connection
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	data, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("expected connection to be closed after the response: %v", err)
+	}
+	if !strings.Contains(string(data), "Connection: close") {
+		t.Errorf("expected Connection: close, got %q", data)
+	}
+}
@@ -13,6 +13,21 @@ type Listener interface {
 	Stop(ctx context.Context) error
 	// Addr returns the listener address
 	Addr() string
+	// Drain stops accepting new connections while in-flight requests finish
+	Drain() error
+	// ActiveConnections returns the number of open connections
+	ActiveConnections() int64
+	// Serving reports whether the listener is accepting connections
+	Serving() bool
+}
+
+// ConnObserver receives connection lifecycle events from a listener, such
+// as a metrics collector tracking keep-alive reuse
+type ConnObserver interface {
+	// RecordConnOpened is called for each accepted connection
+	RecordConnOpened()
+	// RecordConnState is called when an accepted connection changes state
+	RecordConnState(from, to http.ConnState)
 }
 
 // Handler processes incoming requests and returns an action
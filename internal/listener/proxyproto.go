@@ -0,0 +1,305 @@
+package listener
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultProxyHeaderTimeout bounds how long a trusted peer may take to send
+// the PROXY protocol header
+const DefaultProxyHeaderTimeout = 5 * time.Second
+
+// proxyV2Signature starts every PROXY protocol v2 header
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// proxyV1MaxLength is the longest valid v1 header, including CRLF
+const proxyV1MaxLength = 107
+
+// ProxyProtocolConfig enables PROXY protocol (v1 and v2) on a listener.
+// Connections from trusted peers must start with a PROXY header, whose source
+// address then replaces the peer address. Connections from other peers are
+// served as-is, so a header they send is rejected as a malformed request.
+type ProxyProtocolConfig struct {
+	Enabled bool
+	// Trusted lists the CIDRs or IPs of upstream load balancers. Peers on
+	// Unix sockets are always trusted, since socket permissions control them.
+	Trusted []string
+	// HeaderTimeout bounds reading the header (0 = DefaultProxyHeaderTimeout)
+	HeaderTimeout time.Duration
+}
+
+// proxyProtoListener reads PROXY headers off accepted connections. Headers
+// are read in a goroutine per connection so a slow peer cannot stall the
+// accept loop, and Accept returns connections whose header is complete.
+type proxyProtoListener struct {
+	net.Listener
+	trusted []*net.IPNet
+	timeout time.Duration
+
+	conns     chan net.Conn
+	errs      chan error
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newProxyProtoListener(inner net.Listener, cfg ProxyProtocolConfig) *proxyProtoListener {
+	l := &proxyProtoListener{
+		Listener: inner,
+		timeout:  cfg.HeaderTimeout,
+		conns:    make(chan net.Conn),
+		errs:     make(chan error),
+		done:     make(chan struct{}),
+	}
+	if l.timeout <= 0 {
+		l.timeout = DefaultProxyHeaderTimeout
+	}
+	for _, cidr := range cfg.Trusted {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			// Try as single IP
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				continue
+			}
+			bits := 32
+			if ip.To4() == nil {
+				bits = 128
+			}
+			network = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+		}
+		l.trusted = append(l.trusted, network)
+	}
+
+	go l.acceptLoop()
+	return l
+}
+
+func (l *proxyProtoListener) acceptLoop() {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			select {
+			case l.errs <- err:
+			case <-l.done:
+				return
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		go l.readHeader(conn)
+	}
+}
+
+// readHeader delivers conn to Accept once its header has been read, or
+// closes it if a trusted peer sent an invalid header
+func (l *proxyProtoListener) readHeader(conn net.Conn) {
+	if l.isTrusted(conn.RemoteAddr()) {
+		conn.SetReadDeadline(time.Now().Add(l.timeout))
+		br := bufio.NewReader(conn)
+		src, err := readProxyHeader(br)
+		if err != nil {
+			conn.Close()
+			return
+		}
+		conn.SetReadDeadline(time.Time{})
+		conn = &proxyConn{Conn: conn, r: br, remote: src}
+	}
+
+	select {
+	case l.conns <- conn:
+	case <-l.done:
+		conn.Close()
+	}
+}
+
+func (l *proxyProtoListener) isTrusted(addr net.Addr) bool {
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		for _, network := range l.trusted {
+			if network.Contains(a.IP) {
+				return true
+			}
+		}
+		return false
+	case *net.UnixAddr:
+		return true
+	default:
+		return false
+	}
+}
+
+// Accept returns the next connection whose PROXY header has been read
+func (l *proxyProtoListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case err := <-l.errs:
+		return nil, err
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close stops accepting connections and discards those still being read
+func (l *proxyProtoListener) Close() error {
+	l.closeOnce.Do(func() { close(l.done) })
+	return l.Listener.Close()
+}
+
+// proxySourceKey is the request context key for the PROXY header source
+type proxySourceKey struct{}
+
+// ProxySource returns the client IP that a trusted load balancer reported in
+// the PROXY header of the request's connection, or false if the connection
+// carried no source address
+func ProxySource(ctx context.Context) (string, bool) {
+	ip, ok := ctx.Value(proxySourceKey{}).(string)
+	return ip, ok
+}
+
+// withProxySource records a connection's PROXY header source in its context
+// (used as http.Server.ConnContext)
+func withProxySource(ctx context.Context, c net.Conn) context.Context {
+	if tc, ok := c.(*tls.Conn); ok {
+		c = tc.NetConn()
+	}
+	pc, ok := c.(*proxyConn)
+	if !ok || pc.remote == nil {
+		return ctx
+	}
+	host, _, err := net.SplitHostPort(pc.remote.String())
+	if err != nil {
+		return ctx
+	}
+	return context.WithValue(ctx, proxySourceKey{}, host)
+}
+
+// proxyConn is a connection whose source address came from a PROXY header
+type proxyConn struct {
+	net.Conn
+	r      *bufio.Reader // holds any bytes read past the header
+	remote net.Addr      // nil for LOCAL or UNKNOWN headers
+}
+
+func (c *proxyConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+// RemoteAddr returns the client address from the PROXY header
+func (c *proxyConn) RemoteAddr() net.Addr {
+	if c.remote != nil {
+		return c.remote
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// NetConn returns the underlying connection
+func (c *proxyConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+// readProxyHeader reads a v1 or v2 PROXY header and returns the source
+// address it carries. A nil address means the header did not carry one
+// (v1 UNKNOWN, v2 LOCAL or a non-TCP family) and the peer address applies.
+func readProxyHeader(r *bufio.Reader) (net.Addr, error) {
+	sig, err := r.Peek(len(proxyV2Signature))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read PROXY header: %w", err)
+	}
+	if bytes.Equal(sig, proxyV2Signature) {
+		return readProxyV2(r)
+	}
+	if bytes.HasPrefix(sig, []byte("PROXY ")) {
+		return readProxyV1(r)
+	}
+	return nil, errors.New("missing PROXY protocol header")
+}
+
+func readProxyV1(r *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for len(line) < proxyV1MaxLength {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read PROXY v1 header: %w", err)
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, errors.New("PROXY v1 header too long or not CRLF terminated")
+	}
+
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("malformed PROXY v1 header %q", line)
+	}
+
+	ip := net.ParseIP(fields[2])
+	if ip == nil || (ip.To4() != nil) != (fields[1] == "TCP4") {
+		return nil, fmt.Errorf("invalid PROXY v1 source address %q", fields[2])
+	}
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid PROXY v1 source port %q", fields[4])
+	}
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+func readProxyV2(r *bufio.Reader) (net.Addr, error) {
+	var hdr [16]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, fmt.Errorf("failed to read PROXY v2 header: %w", err)
+	}
+	if hdr[12]>>4 != 2 {
+		return nil, fmt.Errorf("unsupported PROXY protocol version %d", hdr[12]>>4)
+	}
+	command := hdr[12] & 0x0f
+	family := hdr[13]
+
+	payload := make([]byte, binary.BigEndian.Uint16(hdr[14:16]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, fmt.Errorf("failed to read PROXY v2 addresses: %w", err)
+	}
+
+	switch command {
+	case 0x0: // LOCAL: health checks from the proxy itself
+		return nil, nil
+	case 0x1: // PROXY
+	default:
+		return nil, fmt.Errorf("unsupported PROXY v2 command %d", command)
+	}
+
+	// Addresses are followed by optional TLVs, which are ignored
+	switch family {
+	case 0x11: // TCP over IPv4
+		if len(payload) < 12 {
+			return nil, errors.New("short PROXY v2 IPv4 address block")
+		}
+		return &net.TCPAddr{IP: net.IP(payload[0:4]), Port: int(binary.BigEndian.Uint16(payload[8:10]))}, nil
+	case 0x21: // TCP over IPv6
+		if len(payload) < 36 {
+			return nil, errors.New("short PROXY v2 IPv6 address block")
+		}
+		return &net.TCPAddr{IP: net.IP(payload[0:16]), Port: int(binary.BigEndian.Uint16(payload[32:34]))}, nil
+	default:
+		return nil, nil
+	}
+}
@@ -0,0 +1,187 @@
+package listener
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// proxyV2Header builds a v2 PROXY header for a TCP source and destination
+func proxyV2Header(src, dst *net.TCPAddr) []byte {
+	var buf bytes.Buffer
+	buf.Write(proxyV2Signature)
+	buf.WriteByte(0x21) // version 2, PROXY
+	addrs := new(bytes.Buffer)
+	if ip4 := src.IP.To4(); ip4 != nil {
+		buf.WriteByte(0x11)
+		addrs.Write(ip4)
+		addrs.Write(dst.IP.To4())
+	} else {
+		buf.WriteByte(0x21)
+		addrs.Write(src.IP.To16())
+		addrs.Write(dst.IP.To16())
+	}
+	binary.Write(addrs, binary.BigEndian, uint16(src.Port))
+	binary.Write(addrs, binary.BigEndian, uint16(dst.Port))
+	addrs.Write([]byte{0x04, 0x00, 0x01, 0xff}) // a TLV, which is skipped
+	binary.Write(&buf, binary.BigEndian, uint16(addrs.Len()))
+	buf.Write(addrs.Bytes())
+	return buf.Bytes()
+}
+
+func TestReadProxyHeader(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string // "" for no address
+		wantErr bool
+	}{
+		{"v1 tcp4", "PROXY TCP4 203.0.113.7 10.0.0.1 51234 443\r\nGET", "203.0.113.7:51234", false},
+		{"v1 tcp6", "PROXY TCP6 2001:db8::7 2001:db8::1 51234 443\r\nGET", "[2001:db8::7]:51234", false},
+		{"v1 unknown", "PROXY UNKNOWN\r\nGET", "", false},
+		{"v1 family mismatch", "PROXY TCP4 2001:db8::7 10.0.0.1 51234 443\r\n", "", true},
+		{"v1 bad port", "PROXY TCP4 203.0.113.7 10.0.0.1 99999 443\r\n", "", true},
+		{"v1 missing CRLF", "PROXY TCP4 203.0.113.7 10.0.0.1 51234 443\n", "", true},
+		{"v1 too long", "PROXY TCP4 " + strings.Repeat("1", 120) + "\r\n", "", true},
+		{"no header", "GET / HTTP/1.1\r\nHost: x\r\n\r\n", "", true},
+		{
+			"v2 tcp4",
+			string(proxyV2Header(&net.TCPAddr{IP: net.ParseIP("198.51.100.9"), Port: 40000}, &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 443})) + "GET",
+			"198.51.100.9:40000", false,
+		},
+		{
+			"v2 tcp6",
+			string(proxyV2Header(&net.TCPAddr{IP: net.ParseIP("2001:db8::9"), Port: 40000}, &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 443})) + "GET",
+			"[2001:db8::9]:40000", false,
+		},
+		{"v2 local", string(proxyV2Signature) + "\x20\x00\x00\x00GET", "", false},
+		{"v2 bad version", string(proxyV2Signature) + "\x11\x11\x00\x00", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := bufio.NewReader(strings.NewReader(tt.input))
+			addr, err := readProxyHeader(r)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readProxyHeader() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			got := ""
+			if addr != nil {
+				got = addr.String()
+			}
+			if got != tt.want {
+				t.Errorf("readProxyHeader() = %q, want %q", got, tt.want)
+			}
+
+			// The request following the header must be left unread
+			if rest, _ := io.ReadAll(r); string(rest) != "GET" {
+				t.Errorf("expected remaining %q, got %q", "GET", rest)
+			}
+		})
+	}
+}
+
+// rawRequest sends prefix followed by a GET request and returns the body
+func rawRequest(t *testing.T, addr string, prefix []byte) string {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+
+	conn.Write(prefix)
+	conn.Write([]byte("GET / HTTP/1.1\r\nHost: example.com\r\nConnection: close\r\n\r\n"))
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		return ""
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return string(body)
+}
+
+func TestHTTPListenerProxyProtocol(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, _ := net.SplitHostPort(r.RemoteAddr)
+		w.Write([]byte(host))
+	})
+
+	start := func(trusted ...string) *HTTPListener {
+		l := NewHTTPListener(HTTPListenerConfig{
+			Addr:    "127.0.0.1:0",
+			Handler: handler,
+			ProxyProtocol: ProxyProtocolConfig{
+				Enabled:       true,
+				Trusted:       trusted,
+				HeaderTimeout: 200 * time.Millisecond,
+			},
+		})
+		if err := l.Start(context.Background()); err != nil {
+			t.Fatalf("failed to start listener: %v", err)
+		}
+		t.Cleanup(func() { l.Stop(context.Background()) })
+		return l
+	}
+
+	trusted := start("127.0.0.1")
+
+	if got := rawRequest(t, trusted.Addr(), []byte("PROXY TCP4 203.0.113.7 127.0.0.1 51234 80\r\n")); got != "203.0.113.7" {
+		t.Errorf("expected v1 client address, got %q", got)
+	}
+	v2 := proxyV2Header(&net.TCPAddr{IP: net.ParseIP("198.51.100.9"), Port: 40000}, &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 80})
+	if got := rawRequest(t, trusted.Addr(), v2); got != "198.51.100.9" {
+		t.Errorf("expected v2 client address, got %q", got)
+	}
+	// Trusted peers must send a header
+	if got := rawRequest(t, trusted.Addr(), nil); got != "" {
+		t.Errorf("expected connection without header to be closed, got %q", got)
+	}
+
+	// Headers from untrusted peers are not honoured
+	untrusted := start("10.0.0.0/8")
+	if got := rawRequest(t, untrusted.Addr(), nil); got != "127.0.0.1" {
+		t.Errorf("expected peer address for untrusted peer, got %q", got)
+	}
+	if got := rawRequest(t, untrusted.Addr(), []byte("PROXY TCP4 203.0.113.7 127.0.0.1 51234 80\r\n")); got == "203.0.113.7" {
+		t.Error("header from untrusted peer must not set the client address")
+	}
+}
+
+func TestProxySourceContext(t *testing.T) {
+	l := NewHTTPListener(HTTPListenerConfig{
+		Addr: "127.0.0.1:0",
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			src, ok := ProxySource(r.Context())
+			if !ok {
+				src = "none"
+			}
+			w.Write([]byte(src))
+		}),
+		ProxyProtocol: ProxyProtocolConfig{Enabled: true, Trusted: []string{"127.0.0.1"}},
+	})
+	if err := l.Start(context.Background()); err != nil {
+		t.Fatalf("failed to start listener: %v", err)
+	}
+	defer l.Stop(context.Background())
+
+	if got := rawRequest(t, l.Addr(), []byte("PROXY TCP4 203.0.113.7 127.0.0.1 51234 80\r\n")); got != "203.0.113.7" {
+		t.Errorf("expected PROXY source in context, got %q", got)
+	}
+	// UNKNOWN headers carry no source, so the peer address applies
+	if got := rawRequest(t, l.Addr(), []byte("PROXY UNKNOWN\r\n")); got != "none" {
+		t.Errorf("expected no PROXY source for UNKNOWN header, got %q", got)
+	}
+}
@@ -0,0 +1,111 @@
+package listener
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// SNIRouter dispatches TLS connections on a shared listener to different
+// handlers based on the Server Name Indication sent in the ClientHello
+type SNIRouter struct {
+	routes       map[string]*sniRoute // exact hostname or "*.suffix" wildcard
+	defaultRoute *sniRoute
+	mu           sync.RWMutex
+}
+
+type sniRoute struct {
+	cert    *tls.Certificate
+	handler http.Handler
+}
+
+// NewSNIRouter creates an empty SNI router
+func NewSNIRouter() *SNIRouter {
+	return &SNIRouter{
+		routes: make(map[string]*sniRoute),
+	}
+}
+
+// Add routes the given hostnames to a certificate and handler.
+// Hostnames may use a leading "*." wildcard to match one subdomain level.
+func (s *SNIRouter) Add(hostnames []string, cert *tls.Certificate, handler http.Handler) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	route := &sniRoute{cert: cert, handler: handler}
+	for _, h := range hostnames {
+		h = strings.ToLower(strings.TrimSuffix(h, "."))
+		if h == "" {
+			return fmt.Errorf("empty SNI hostname")
+		}
+		if _, exists := s.routes[h]; exists {
+			return fmt.Errorf("duplicate SNI hostname: %s", h)
+		}
+		s.routes[h] = route
+	}
+	return nil
+}
+
+// SetDefault sets the route used when no hostname matches (or no SNI is sent)
+func (s *SNIRouter) SetDefault(cert *tls.Certificate, handler http.Handler) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.defaultRoute != nil {
+		return fmt.Errorf("default SNI route already set")
+	}
+	s.defaultRoute = &sniRoute{cert: cert, handler: handler}
+	return nil
+}
+
+// lookup finds the route for a server name
+func (s *SNIRouter) lookup(serverName string) *sniRoute {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	name := strings.ToLower(strings.TrimSuffix(serverName, "."))
+	if name != "" {
+		if route, ok := s.routes[name]; ok {
+			return route
+		}
+		if idx := strings.IndexByte(name, '.'); idx > 0 {
+			if route, ok := s.routes["*"+name[idx:]]; ok {
+				return route
+			}
+		}
+	}
+	return s.defaultRoute
+}
+
+// GetCertificate selects the certificate for a ClientHello by its ServerName
+func (s *SNIRouter) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	route := s.lookup(hello.ServerName)
+	if route == nil || route.cert == nil {
+		return nil, fmt.Errorf("no certificate for server name %q", hello.ServerName)
+	}
+	return route.cert, nil
+}
+
+// TLSConfig returns a TLS configuration that selects certificates by SNI
+func (s *SNIRouter) TLSConfig() *tls.Config {
+	cfg := defaultTLSConfig()
+	cfg.GetCertificate = s.GetCertificate
+	return cfg
+}
+
+// ServeHTTP dispatches the request to the handler matching the connection's SNI
+func (s *SNIRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	serverName := ""
+	if r.TLS != nil {
+		serverName = r.TLS.ServerName
+	}
+
+	route := s.lookup(serverName)
+	if route == nil {
+		w.WriteHeader(http.StatusMisdirectedRequest)
+		return
+	}
+	route.handler.ServeHTTP(w, r)
+}
@@ -0,0 +1,147 @@
+package listener
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func selfSignedCert(t *testing.T, hosts ...string) *tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: hosts[0]},
+		DNSNames:     hosts,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func textHandler(body string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	})
+}
+
+func TestSNIRouterDispatch(t *testing.T) {
+	router := NewSNIRouter()
+	if err := router.Add([]string{"api.example.com"}, selfSignedCert(t, "api.example.com"), textHandler("api")); err != nil {
+		t.Fatalf("failed to add route: %v", err)
+	}
+	if err := router.Add([]string{"*.admin.example.com"}, selfSignedCert(t, "*.admin.example.com"), textHandler("admin")); err != nil {
+		t.Fatalf("failed to add route: %v", err)
+	}
+	if err := router.SetDefault(selfSignedCert(t, "default.example.com"), textHandler("default")); err != nil {
+		t.Fatalf("failed to set default: %v", err)
+	}
+
+	l := NewHTTPListener(HTTPListenerConfig{
+		Addr:      "127.0.0.1:0",
+		TLSConfig: router.TLSConfig(),
+		Handler:   router,
+	})
+	ctx := context.Background()
+	if err := l.Start(ctx); err != nil {
+		t.Fatalf("failed to start listener: %v", err)
+	}
+	defer l.Stop(ctx)
+
+	tests := []struct {
+		serverName string
+		want       string
+	}{
+		{"api.example.com", "api"},
+		{"API.example.com", "api"},
+		{"eu.admin.example.com", "admin"},
+		{"other.example.com", "default"},
+	}
+
+	for _, tc := range tests {
+		client := &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{ServerName: tc.serverName, InsecureSkipVerify: true},
+			},
+		}
+		resp, err := client.Get("https://" + l.Addr())
+		if err != nil {
+			t.Fatalf("%s: request failed: %v", tc.serverName, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != tc.want {
+			t.Errorf("%s: expected %q, got %q", tc.serverName, tc.want, string(body))
+		}
+	}
+}
+
+func TestSNIRouterNoDefault(t *testing.T) {
+	router := NewSNIRouter()
+	router.Add([]string{"api.example.com"}, selfSignedCert(t, "api.example.com"), textHandler("api"))
+
+	if _, err := router.GetCertificate(&tls.ClientHelloInfo{ServerName: "unknown.example.com"}); err == nil {
+		t.Error("expected error for unknown server name without default route")
+	}
+}
+
+func TestSNIRouterDuplicateHost(t *testing.T) {
+	router := NewSNIRouter()
+	cert := selfSignedCert(t, "api.example.com")
+	router.Add([]string{"api.example.com"}, cert, textHandler("a"))
+
+	if err := router.Add([]string{"API.example.com"}, cert, textHandler("b")); err == nil {
+		t.Error("expected error for duplicate hostname")
+	}
+	if err := router.SetDefault(cert, textHandler("c")); err != nil {
+		t.Errorf("unexpected error setting default: %v", err)
+	}
+	if err := router.SetDefault(cert, textHandler("d")); err == nil {
+		t.Error("expected error for second default route")
+	}
+}
+
+func TestTLSListenerNegotiatesALPN(t *testing.T) {
+	router := NewSNIRouter()
+	router.SetDefault(selfSignedCert(t, "default.example.com"), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.TLS.NegotiatedProtocol)
+	}))
+
+	l := NewHTTPListener(HTTPListenerConfig{
+		Addr:      "127.0.0.1:0",
+		TLSConfig: router.TLSConfig(),
+		Handler:   router,
+	})
+	ctx := context.Background()
+	if err := l.Start(ctx); err != nil {
+		t.Fatalf("failed to start listener: %v", err)
+	}
+	defer l.Stop(ctx)
+
+	for _, proto := range []string{"h2", "http/1.1"} {
+		conn, err := tls.Dial("tcp", l.Addr(), &tls.Config{InsecureSkipVerify: true, NextProtos: []string{proto}})
+		if err != nil {
+			t.Fatalf("%s: handshake failed: %v", proto, err)
+		}
+		got := conn.ConnectionState().NegotiatedProtocol
+		conn.Close()
+		if got != proto {
+			t.Errorf("expected ALPN %q, got %q", proto, got)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package listener
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/asn1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// TLSOptions tunes session resumption and OCSP stapling on a TLS listener
+type TLSOptions struct {
+	// SessionTicketKeyFile holds session ticket keys, one hex-encoded
+	// 32-byte key per line. The first key encrypts new tickets and the
+	// others only decrypt, so keys can be rotated without breaking
+	// resumption. Empty uses keys generated and rotated by the server.
+	SessionTicketKeyFile string
+
+	// SessionCacheSize, when positive, stores sessions in memory, keeping
+	// this many, and hands clients a random ID instead of an encrypted
+	// ticket. Conflicts with SessionTicketKeyFile.
+	SessionCacheSize int
+
+	// DisableSessionTickets turns session resumption off
+	DisableSessionTickets bool
+
+	// OCSPStapleFile holds a DER-encoded OCSP response stapled to the
+	// certificate
+	OCSPStapleFile string
+}
+
+// Apply configures session resumption on cfg
+func (o TLSOptions) Apply(cfg *tls.Config) error {
+	if o.DisableSessionTickets {
+		cfg.SessionTicketsDisabled = true
+		return nil
+	}
+	if o.SessionTicketKeyFile != "" && o.SessionCacheSize > 0 {
+		return fmt.Errorf("session ticket keys and a session cache cannot be combined")
+	}
+	if o.SessionTicketKeyFile != "" {
+		keys, err := LoadSessionTicketKeys(o.SessionTicketKeyFile)
+		if err != nil {
+			return err
+		}
+		cfg.SetSessionTicketKeys(keys)
+	}
+	if o.SessionCacheSize > 0 {
+		cache := newSessionCache(o.SessionCacheSize)
+		cfg.WrapSession = cache.wrap
+		cfg.UnwrapSession = cache.unwrap
+	}
+	return nil
+}
+
+// LoadSessionTicketKeys reads hex-encoded 32-byte session ticket keys, one
+// per line. Blank lines and lines starting with "#" are skipped.
+func LoadSessionTicketKeys(path string) ([][32]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read session ticket keys: %w", err)
+	}
+
+	var keys [][32]byte
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		raw, err := hex.DecodeString(text)
+		if err != nil || len(raw) != 32 {
+			return nil, fmt.Errorf("%s:%d: session ticket key must be 32 bytes, hex-encoded", path, line)
+		}
+		var key [32]byte
+		copy(key[:], raw)
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%s: no session ticket keys", path)
+	}
+	return keys, nil
+}
+
+// LoadOCSPStaple reads a DER-encoded OCSP response
+func LoadOCSPStaple(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read OCSP response: %w", err)
+	}
+	var raw asn1.RawValue
+	if rest, err := asn1.Unmarshal(data, &raw); err != nil || len(rest) > 0 {
+		return nil, fmt.Errorf("%s: not a DER-encoded OCSP response", path)
+	}
+	return data, nil
+}
+
+// sessionCache keeps TLS sessions in memory so tickets only carry a random
+// ID. The least recently used session is evicted once size is reached.
+type sessionCache struct {
+	size    int
+	order   *list.List // of *sessionEntry, most recently used first
+	entries map[string]*list.Element
+	mu      sync.Mutex
+}
+
+type sessionEntry struct {
+	id    string
+	state []byte
+}
+
+func newSessionCache(size int) *sessionCache {
+	return &sessionCache{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// wrap stores a session and returns its ID as the ticket
+func (c *sessionCache) wrap(_ tls.ConnectionState, ss *tls.SessionState) ([]byte, error) {
+	state, err := ss.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	c.put(string(id), state)
+	return id, nil
+}
+
+// unwrap looks up the session for a ticket; unknown tickets fall back to a
+// full handshake
+func (c *sessionCache) unwrap(identity []byte, _ tls.ConnectionState) (*tls.SessionState, error) {
+	state, ok := c.get(string(identity))
+	if !ok {
+		return nil, nil
+	}
+	return tls.ParseSessionState(state)
+}
+
+// put stores a session state, evicting the least recently used past size
+func (c *sessionCache) put(id string, state []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[id] = c.order.PushFront(&sessionEntry{id: id, state: state})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*sessionEntry).id)
+	}
+}
+
+// get returns the session state stored for id
+func (c *sessionCache) get(id string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[id]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*sessionEntry).state, true
+}
@@ -0,0 +1,145 @@
+package listener
+
+import (
+	"crypto/tls"
+	"encoding/asn1"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadSessionTicketKeys(t *testing.T) {
+	dir := t.TempDir()
+	key1 := strings.Repeat("ab", 32)
+	key2 := strings.Repeat("cd", 32)
+
+	path := filepath.Join(dir, "keys")
+	os.WriteFile(path, []byte("# current key first\n"+key1+"\n\n"+key2+"\n"), 0600)
+	keys, err := LoadSessionTicketKeys(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(keys) != 2 || keys[0][0] != 0xab || keys[1][0] != 0xcd {
+		t.Errorf("expected keys in file order, got %x", keys)
+	}
+
+	for name, content := range map[string]string{
+		"short": "abcd\n",
+		"hex":   strings.Repeat("zz", 32) + "\n",
+		"empty": "# no keys\n",
+	} {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, []byte(content), 0600)
+		if _, err := LoadSessionTicketKeys(path); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestLoadOCSPStaple(t *testing.T) {
+	dir := t.TempDir()
+	der, _ := asn1.Marshal(struct{ Status asn1.Enumerated }{0})
+
+	valid := filepath.Join(dir, "ocsp.der")
+	os.WriteFile(valid, der, 0600)
+	staple, err := LoadOCSPStaple(valid)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(staple) != string(der) {
+		t.Error("expected staple to be the file contents")
+	}
+
+	invalid := filepath.Join(dir, "ocsp.pem")
+	os.WriteFile(invalid, []byte("-----BEGIN OCSP RESPONSE-----"), 0600)
+	if _, err := LoadOCSPStaple(invalid); err == nil {
+		t.Error("expected error for non-DER response")
+	}
+}
+
+// resumes reports whether a second TLS 1.2 connection to a server using cfg
+// resumes the session of the first
+func resumes(t *testing.T, cfg *tls.Config) bool {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			tlsConn := tls.Server(conn, cfg)
+			tlsConn.Handshake()
+			tlsConn.Close()
+		}
+	}()
+
+	clientCfg := &tls.Config{
+		InsecureSkipVerify: true,
+		MaxVersion:         tls.VersionTLS12,
+		ClientSessionCache: tls.NewLRUClientSessionCache(1),
+	}
+	resumed := false
+	for i := 0; i < 2; i++ {
+		conn, err := tls.Dial("tcp", ln.Addr().String(), clientCfg)
+		if err != nil {
+			t.Fatalf("handshake failed: %v", err)
+		}
+		resumed = conn.ConnectionState().DidResume
+		conn.Close()
+	}
+	return resumed
+}
+
+func TestTLSOptionsSessionResumption(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "keys")
+	os.WriteFile(keyFile, []byte(strings.Repeat("ab", 32)+"\n"), 0600)
+
+	tests := []struct {
+		name    string
+		opts    TLSOptions
+		resumed bool
+	}{
+		{"ticket keys", TLSOptions{SessionTicketKeyFile: keyFile}, true},
+		{"session cache", TLSOptions{SessionCacheSize: 10}, true},
+		{"disabled", TLSOptions{DisableSessionTickets: true}, false},
+	}
+
+	for _, tc := range tests {
+		cfg := defaultTLSConfig()
+		cfg.Certificates = []tls.Certificate{*selfSignedCert(t, "example.com")}
+		if err := tc.opts.Apply(cfg); err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		if got := resumes(t, cfg); got != tc.resumed {
+			t.Errorf("%s: expected resumed=%v, got %v", tc.name, tc.resumed, got)
+		}
+	}
+
+	conflicting := TLSOptions{SessionTicketKeyFile: keyFile, SessionCacheSize: 10}
+	if err := conflicting.Apply(defaultTLSConfig()); err == nil {
+		t.Error("expected error when combining ticket keys and a session cache")
+	}
+}
+
+func TestSessionCacheEviction(t *testing.T) {
+	cache := newSessionCache(2)
+	cache.put("a", []byte("1"))
+	cache.put("b", []byte("2"))
+	cache.get("a") // b is now least recently used
+	cache.put("c", []byte("3"))
+
+	if _, ok := cache.get("b"); ok {
+		t.Error("expected least recently used session to be evicted")
+	}
+	for _, id := range []string{"a", "c"} {
+		if _, ok := cache.get(id); !ok {
+			t.Errorf("expected session %s to be kept", id)
+		}
+	}
+}
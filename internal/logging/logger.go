@@ -62,6 +62,7 @@ type Entry struct {
 // Logger handles structured logging
 type Logger struct {
 	output io.Writer
+	path   string // file output path, empty for stdout and stderr
 	level  Level
 	mu     sync.Mutex
 }
@@ -71,11 +72,15 @@ type Config struct {
 	Level  string
 	Format string // json or text
 	Output string // stdout, stderr, or file path
+
+	// Rotation applies to file output; enabled when MaxSizeMB > 0
+	Rotate RotateConfig
 }
 
 // New creates a new logger
 func New(cfg Config) (*Logger, error) {
 	var output io.Writer
+	var path string
 
 	switch cfg.Output {
 	case "", "stdout":
@@ -83,15 +88,25 @@ func New(cfg Config) (*Logger, error) {
 	case "stderr":
 		output = os.Stderr
 	default:
+		if cfg.Rotate.MaxSizeMB > 0 {
+			rf, err := NewRotatingFile(cfg.Output, cfg.Rotate)
+			if err != nil {
+				return nil, err
+			}
+			output = rf
+			break
+		}
 		f, err := os.OpenFile(cfg.Output, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
 		if err != nil {
 			return nil, fmt.Errorf("failed to open log file: %w", err)
 		}
 		output = f
+		path = cfg.Output
 	}
 
 	return &Logger{
 		output: output,
+		path:   path,
 		level:  ParseLevel(cfg.Level),
 	}, nil
 }
@@ -155,7 +170,8 @@ type RequestLog struct {
 	Labels     []string  `json:"labels,omitempty"`
 	StatusCode int       `json:"status_code"`
 	Duration   float64   `json:"duration_ms"`
-	TLSVersion string    `json:"tls_version,omitempty"`
+	TLSVersion string    `json:"tls_version,omitempty"` // e.g. "TLS 1.3"
+	TLSCipher  string    `json:"tls_cipher,omitempty"`  // e.g. "TLS_AES_128_GCM_SHA256"
 	SNI        string    `json:"sni,omitempty"`
 }
 
@@ -177,6 +193,31 @@ func (l *Logger) LogRequest(req RequestLog) {
 	l.output.Write([]byte("\n"))
 }
 
+// Reopen closes and reopens file output, so logging moves to a fresh file
+// after an external tool such as logrotate renamed the current one. It does
+// nothing for stdout and stderr. If the file cannot be reopened, logging
+// continues to the old file.
+func (l *Logger) Reopen() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	switch out := l.output.(type) {
+	case *RotatingFile:
+		return out.Reopen()
+	case *os.File:
+		if l.path == "" {
+			return nil
+		}
+		f, err := os.OpenFile(l.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to reopen log file: %w", err)
+		}
+		out.Close()
+		l.output = f
+	}
+	return nil
+}
+
 // Close closes the logger output if it's a file
 func (l *Logger) Close() error {
 	if closer, ok := l.output.(io.Closer); ok {
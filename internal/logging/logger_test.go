@@ -3,6 +3,8 @@ package logging
 import (
 	"bytes"
 	"encoding/json"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -161,3 +163,41 @@ func TestLevelString(t *testing.T) {
 		}
 	}
 }
+
+func TestLoggerReopen(t *testing.T) {
+	for _, rotate := range []RotateConfig{{}, {MaxSizeMB: 10}} {
+		path := filepath.Join(t.TempDir(), "app.log")
+		logger, err := New(Config{Level: "info", Output: path, Rotate: rotate})
+		if err != nil {
+			t.Fatalf("failed to create logger: %v", err)
+		}
+
+		logger.Info("before rotation", nil)
+
+		// Simulate logrotate renaming the file
+		rotated := path + ".1"
+		if err := os.Rename(path, rotated); err != nil {
+			t.Fatal(err)
+		}
+		if err := logger.Reopen(); err != nil {
+			t.Fatalf("reopen failed: %v", err)
+		}
+		logger.Info("after rotation", nil)
+		logger.Close()
+
+		old, _ := os.ReadFile(rotated)
+		current, _ := os.ReadFile(path)
+		if !strings.Contains(string(old), "before rotation") || strings.Contains(string(old), "after rotation") {
+			t.Errorf("rotated file has unexpected content: %s", old)
+		}
+		if !strings.Contains(string(current), "after rotation") {
+			t.Errorf("expected new file to receive logs after reopen, got: %s", current)
+		}
+	}
+
+	// Reopening standard output is a no-op
+	logger, _ := New(Config{Output: "stderr"})
+	if err := logger.Reopen(); err != nil {
+		t.Errorf("unexpected error reopening stderr: %v", err)
+	}
+}
@@ -0,0 +1,229 @@
+package logging
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat is used in rotated file names; it sorts chronologically
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// RotateConfig configures log file rotation
+type RotateConfig struct {
+	MaxSizeMB  int  // rotate once the file exceeds this size
+	MaxBackups int  // number of rotated files to keep (0 = unlimited)
+	MaxAgeDays int  // remove rotated files older than this (0 = unlimited)
+	Compress   bool // gzip rotated files
+}
+
+// RotatingFile is an io.WriteCloser that rotates the underlying file by size
+// and prunes old backups by count and age
+type RotatingFile struct {
+	path    string
+	config  RotateConfig
+	maxSize int64
+	file    *os.File
+	size    int64
+	mu      sync.Mutex
+	bg      sync.WaitGroup // compression and pruning in progress
+	bgMu    sync.Mutex     // serializes background work
+	now     func() time.Time
+}
+
+// NewRotatingFile opens (or creates) a log file with rotation
+func NewRotatingFile(path string, cfg RotateConfig) (*RotatingFile, error) {
+	r := &RotatingFile{
+		path:    path,
+		config:  cfg,
+		maxSize: int64(cfg.MaxSizeMB) * 1024 * 1024,
+		now:     time.Now,
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *RotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to stat log file: %w", err)
+	}
+	r.file = f
+	r.size = info.Size()
+	return nil
+}
+
+// Write writes to the current file, rotating first if it would exceed the size limit
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.maxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// Rotate forces a rotation of the current file
+func (r *RotatingFile) Rotate() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.rotate()
+}
+
+func (r *RotatingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return fmt.Errorf("failed to close log file: %w", err)
+	}
+
+	backup := r.path + "." + r.now().Format(backupTimeFormat)
+	if err := os.Rename(r.path, backup); err != nil {
+		return fmt.Errorf("failed to rotate log file: %w", err)
+	}
+
+	if err := r.open(); err != nil {
+		return err
+	}
+
+	r.bg.Add(1)
+	go func() {
+		defer r.bg.Done()
+		r.bgMu.Lock()
+		defer r.bgMu.Unlock()
+
+		if r.config.Compress {
+			if err := compressFile(backup); err != nil {
+				fmt.Fprintf(os.Stderr, "log rotation: %v\n", err)
+			}
+		}
+		r.prune()
+	}()
+
+	return nil
+}
+
+// prune removes backups beyond MaxBackups or older than MaxAgeDays
+func (r *RotatingFile) prune() {
+	if r.config.MaxBackups <= 0 && r.config.MaxAgeDays <= 0 {
+		return
+	}
+
+	backups := r.backups()
+	cutoff := r.now().Add(-time.Duration(r.config.MaxAgeDays) * 24 * time.Hour)
+
+	// backups is sorted newest first
+	for i, b := range backups {
+		expired := r.config.MaxAgeDays > 0 && b.ts.Before(cutoff)
+		excess := r.config.MaxBackups > 0 && i >= r.config.MaxBackups
+		if expired || excess {
+			os.Remove(b.path)
+		}
+	}
+}
+
+type backupFile struct {
+	path string
+	ts   time.Time
+}
+
+// backups lists rotated files for this log, newest first
+func (r *RotatingFile) backups() []backupFile {
+	dir := filepath.Dir(r.path)
+	prefix := filepath.Base(r.path) + "."
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	var result []backupFile
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		stamp := strings.TrimSuffix(strings.TrimPrefix(name, prefix), ".gz")
+		ts, err := time.ParseInLocation(backupTimeFormat, stamp, time.Local)
+		if err != nil {
+			continue
+		}
+		result = append(result, backupFile{path: filepath.Join(dir, name), ts: ts})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ts.After(result[j].ts)
+	})
+	return result
+}
+
+// compressFile gzips path to path.gz and removes the original
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s for compression: %w", path, err)
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create %s.gz: %w", path, err)
+	}
+
+	gz := gzip.NewWriter(dst)
+	if _, err := io.Copy(gz, src); err != nil {
+		gz.Close()
+		dst.Close()
+		os.Remove(path + ".gz")
+		return fmt.Errorf("failed to compress %s: %w", path, err)
+	}
+	if err := gz.Close(); err != nil {
+		dst.Close()
+		os.Remove(path + ".gz")
+		return fmt.Errorf("failed to compress %s: %w", path, err)
+	}
+	if err := dst.Close(); err != nil {
+		return fmt.Errorf("failed to compress %s: %w", path, err)
+	}
+
+	return os.Remove(path)
+}
+
+// Reopen closes the current file and opens the path again, for use after
+// the file was renamed by an external tool
+func (r *RotatingFile) Reopen() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	old := r.file
+	if err := r.open(); err != nil {
+		return err
+	}
+	return old.Close()
+}
+
+// Close waits for background compression and closes the current file
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.bg.Wait()
+	return r.file.Close()
+}
@@ -0,0 +1,127 @@
+package logging
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotatingFileRotatesBySize(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "access.log")
+
+	rf, err := NewRotatingFile(path, RotateConfig{MaxSizeMB: 1})
+	if err != nil {
+		t.Fatalf("failed to create rotating file: %v", err)
+	}
+	rf.maxSize = 100 // keep the test small
+
+	line := []byte(strings.Repeat("x", 60) + "\n")
+	rf.Write(line)
+	rf.Write(line) // exceeds 100 bytes, triggers rotation
+	rf.Close()
+
+	backups := rf.backups()
+	if len(backups) != 1 {
+		t.Fatalf("expected 1 backup, got %d", len(backups))
+	}
+
+	current, _ := os.ReadFile(path)
+	if len(current) != len(line) {
+		t.Errorf("expected current file to contain one line, got %d bytes", len(current))
+	}
+}
+
+func TestRotatingFileCompress(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "access.log")
+
+	rf, err := NewRotatingFile(path, RotateConfig{MaxSizeMB: 1, Compress: true})
+	if err != nil {
+		t.Fatalf("failed to create rotating file: %v", err)
+	}
+
+	rf.Write([]byte("first line\n"))
+	if err := rf.Rotate(); err != nil {
+		t.Fatalf("rotate failed: %v", err)
+	}
+	rf.Close()
+
+	backups := rf.backups()
+	if len(backups) != 1 || !strings.HasSuffix(backups[0].path, ".gz") {
+		t.Fatalf("expected one gzip backup, got %v", backups)
+	}
+
+	f, _ := os.Open(backups[0].path)
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("backup is not valid gzip: %v", err)
+	}
+	data, _ := io.ReadAll(gz)
+	if string(data) != "first line\n" {
+		t.Errorf("unexpected backup content: %q", string(data))
+	}
+}
+
+func TestRotatingFilePrune(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "access.log")
+
+	rf, err := NewRotatingFile(path, RotateConfig{MaxSizeMB: 1, MaxBackups: 2, MaxAgeDays: 7})
+	if err != nil {
+		t.Fatalf("failed to create rotating file: %v", err)
+	}
+
+	// An old backup beyond max age
+	old := path + "." + time.Now().Add(-30*24*time.Hour).Format(backupTimeFormat)
+	os.WriteFile(old, []byte("old"), 0644)
+
+	base := time.Now()
+	for i := 0; i < 3; i++ {
+		ts := base.Add(time.Duration(i) * time.Second)
+		rf.now = func() time.Time { return ts }
+		rf.Write([]byte("line\n"))
+		if err := rf.Rotate(); err != nil {
+			t.Fatalf("rotate failed: %v", err)
+		}
+	}
+	rf.Close()
+
+	backups := rf.backups()
+	if len(backups) != 2 {
+		t.Errorf("expected 2 backups after pruning, got %d", len(backups))
+	}
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Error("expected expired backup to be removed")
+	}
+}
+
+func TestNewLoggerWithRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+
+	logger, err := New(Config{
+		Level:  "info",
+		Output: path,
+		Rotate: RotateConfig{MaxSizeMB: 10},
+	})
+	if err != nil {
+		t.Fatalf("failed to create logger: %v", err)
+	}
+
+	if _, ok := logger.output.(*RotatingFile); !ok {
+		t.Errorf("expected rotating file output, got %T", logger.output)
+	}
+
+	logger.Info("hello", nil)
+	logger.Close()
+
+	data, _ := os.ReadFile(path)
+	if !strings.Contains(string(data), "hello") {
+		t.Error("expected log line in file")
+	}
+}
@@ -0,0 +1,64 @@
+package metrics
+
+// OverflowKey is the key under which values are recorded once a map has
+// reached its key limit
+const OverflowKey = "other"
+
+// boundedMap is a map with a limit on its number of keys. Once the limit is
+// reached, values for new keys are aggregated under OverflowKey, so memory
+// stays bounded whatever keys are recorded. It is not safe for concurrent
+// use; callers hold the lock guarding the map.
+type boundedMap[V any] struct {
+	entries  map[string]V
+	maxKeys  int // 0 means unlimited
+	newValue func() V
+}
+
+func newBoundedMap[V any](maxKeys int, newValue func() V) *boundedMap[V] {
+	return &boundedMap[V]{
+		entries:  make(map[string]V),
+		maxKeys:  maxKeys,
+		newValue: newValue,
+	}
+}
+
+// newCounterMap returns a bounded map of counters
+func newCounterMap(maxKeys int) *boundedMap[*int64] {
+	return newBoundedMap(maxKeys, func() *int64 { return new(int64) })
+}
+
+// get returns the value for key, creating it on first use. Past the key
+// limit, new keys share the OverflowKey value, which does not count against
+// the limit.
+func (b *boundedMap[V]) get(key string) V {
+	if v, ok := b.entries[key]; ok {
+		return v
+	}
+	if b.maxKeys > 0 {
+		n := len(b.entries)
+		overflow, hasOverflow := b.entries[OverflowKey]
+		if hasOverflow {
+			n--
+		}
+		if n >= b.maxKeys {
+			if hasOverflow {
+				return overflow
+			}
+			key = OverflowKey
+		}
+	}
+	v := b.newValue()
+	b.entries[key] = v
+	return v
+}
+
+// lookup returns the value stored for key without creating it
+func (b *boundedMap[V]) lookup(key string) (V, bool) {
+	v, ok := b.entries[key]
+	return v, ok
+}
+
+// delete removes key, freeing its slot
+func (b *boundedMap[V]) delete(key string) {
+	delete(b.entries, key)
+}
@@ -4,33 +4,77 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
 )
 
+// DefaultTopDenialReasons is the number of denial reasons in a Snapshot
+const DefaultTopDenialReasons = 10
+
+// Default collector limits
+const (
+	DefaultMaxKeys      = 1000
+	DefaultMaxUniqueIPs = 100000
+)
+
+// Limits bounds the memory used by a collector, whatever values are
+// recorded. Zero fields use the defaults.
+type Limits struct {
+	// MaxKeys is the number of distinct keys kept per labelled counter
+	// (profiles, decisions, rule types, TLS versions, backends). Further
+	// keys are counted under OverflowKey.
+	MaxKeys int
+
+	// MaxUniqueIPs is the number of client IPs tracked for the unique IP
+	// count before the set is cleared
+	MaxUniqueIPs int
+}
+
 // Metrics tracks gateway metrics
 type Metrics struct {
 	startTime time.Time
+	limits    Limits
 
 	// Request counters
 	totalRequests   int64
 	allowedRequests int64
 	deniedRequests  int64
 	droppedRequests int64
+	timeoutRequests int64
+	panics          int64
+	oversizedBodies int64
+
+	// Client connections, fed by the listeners. The active and idle gauges
+	// describe open connections and survive Reset.
+	connectionsTotal  int64
+	connectionsActive int64
+	connectionsIdle   int64
 
 	// Per-profile counters
-	profileRequests map[string]*int64
+	profileRequests *boundedMap[*int64]
+	profileBytesIn  *boundedMap[*int64]
+	profileBytesOut *boundedMap[*int64]
 	profileMu       sync.RWMutex
 
 	// Decision counters
-	decisions  map[string]*int64
-	decisionMu sync.RWMutex
+	decisions       *boundedMap[*int64]
+	decisionsByRule *boundedMap[*boundedMap[*int64]] // action -> rule type -> count
+	decisionMu      sync.RWMutex
+
+	// HTTPS requests by negotiated TLS version
+	tlsVersions *boundedMap[*int64]
+	tlsMu       sync.RWMutex
 
 	// Rule hit counters
-	ruleHits   map[string]*int64
+	ruleHits   *boundedMap[*int64]
 	ruleHitsMu sync.RWMutex
 
+	// Sampled rule evaluation durations by rule type
+	ruleEval   *boundedMap[*ruleEvalStats]
+	ruleEvalMu sync.RWMutex
+
 	// Unique IPs seen
 	uniqueIPs   map[string]struct{}
 	uniqueIPsMu sync.RWMutex
@@ -39,40 +83,133 @@ type Metrics struct {
 	totalResponseTime int64
 	responseCount     int64
 
+	// Rule evaluation tracking
+	rulesEvaluated int64
+	evaluations    int64
+
 	// Per-backend metrics
-	backendStats   map[string]*BackendStats
+	backendStats   *boundedMap[*BackendStats]
 	backendStatsMu sync.RWMutex
+
+	// Isolated per-profile collectors
+	profiles   *boundedMap[*Metrics]
+	profilesMu sync.RWMutex
 }
 
 // BackendStats tracks per-backend statistics
 type BackendStats struct {
-	Requests      int64
-	Errors        int64
-	TotalLatency  int64 // microseconds
-	MinLatency    int64 // microseconds
-	MaxLatency    int64 // microseconds
+	Requests     int64
+	Errors       int64
+	TotalLatency int64 // microseconds
+	MinLatency   int64 // microseconds
+	MaxLatency   int64 // microseconds
+
+	// Timeouts and ConnectionErrors count requests the backend failed to
+	// answer, split by cause
+	Timeouts         int64
+	ConnectionErrors int64
+
+	// StatusClasses counts responses by status class, indexed by status / 100
+	StatusClasses [6]int64
 }
 
-// New creates a new metrics instance
+// ruleEvalStats accumulates sampled evaluation durations of a rule type
+type ruleEvalStats struct {
+	samples int64
+	totalNs int64
+}
+
+// New creates a new metrics instance with the default limits
 func New() *Metrics {
-	return &Metrics{
-		startTime:       time.Now(),
-		profileRequests: make(map[string]*int64),
-		decisions:       make(map[string]*int64),
-		ruleHits:        make(map[string]*int64),
-		uniqueIPs:       make(map[string]struct{}),
-		backendStats:    make(map[string]*BackendStats),
+	return NewWithLimits(Limits{})
+}
+
+// NewWithLimits creates a new metrics instance bounded by limits
+func NewWithLimits(limits Limits) *Metrics {
+	if limits.MaxKeys <= 0 {
+		limits.MaxKeys = DefaultMaxKeys
+	}
+	if limits.MaxUniqueIPs <= 0 {
+		limits.MaxUniqueIPs = DefaultMaxUniqueIPs
+	}
+	m := &Metrics{
+		startTime: time.Now(),
+		limits:    limits,
+		profiles: newBoundedMap(limits.MaxKeys, func() *Metrics {
+			return NewWithLimits(limits)
+		}),
+	}
+	m.resetMaps()
+	return m
+}
+
+// resetMaps replaces the recorded maps with empty ones. Callers must hold
+// the map locks or have exclusive access to m.
+func (m *Metrics) resetMaps() {
+	maxKeys := m.limits.MaxKeys
+	m.profileRequests = newCounterMap(maxKeys)
+	m.profileBytesIn = newCounterMap(maxKeys)
+	m.profileBytesOut = newCounterMap(maxKeys)
+	m.decisions = newCounterMap(maxKeys)
+	m.decisionsByRule = newBoundedMap(maxKeys, func() *boundedMap[*int64] {
+		return newCounterMap(maxKeys)
+	})
+	m.tlsVersions = newCounterMap(maxKeys)
+	m.ruleHits = newCounterMap(maxKeys)
+	m.ruleEval = newBoundedMap(maxKeys, func() *ruleEvalStats {
+		return &ruleEvalStats{}
+	})
+	m.uniqueIPs = make(map[string]struct{})
+	m.backendStats = newBoundedMap(maxKeys, func() *BackendStats {
+		return &BackendStats{}
+	})
+}
+
+// Profile returns the isolated collector for profileID, creating and
+// registering it on first use. Requests recorded there are independent of m
+// and can be reset without touching other profiles. Past the key limit,
+// new profiles share the OverflowKey collector.
+func (m *Metrics) Profile(profileID string) *Metrics {
+	m.profilesMu.Lock()
+	defer m.profilesMu.Unlock()
+	return m.profiles.get(profileID)
+}
+
+// LookupProfile returns the isolated collector registered for profileID
+func (m *Metrics) LookupProfile(profileID string) (*Metrics, bool) {
+	m.profilesMu.RLock()
+	defer m.profilesMu.RUnlock()
+	return m.profiles.lookup(profileID)
+}
+
+// ProfileIDs returns the sorted IDs of profiles with isolated collectors
+func (m *Metrics) ProfileIDs() []string {
+	m.profilesMu.RLock()
+	defer m.profilesMu.RUnlock()
+
+	ids := make([]string, 0, len(m.profiles.entries))
+	for id := range m.profiles.entries {
+		ids = append(ids, id)
 	}
+	sort.Strings(ids)
+	return ids
 }
 
 // RecordRequest records a request
 func (m *Metrics) RecordRequest(profileID, clientIP, action string, durationMs float64) {
+	m.RecordRequestWithRule(profileID, clientIP, action, "", durationMs)
+}
+
+// RecordRequestWithRule records a request along with the type of the rule
+// that decided it. Rule types have bounded cardinality, unlike reasons, so
+// they are safe to use as a metric label; "" is recorded as "none".
+func (m *Metrics) RecordRequestWithRule(profileID, clientIP, action, ruleType string, durationMs float64) {
 	atomic.AddInt64(&m.totalRequests, 1)
 
 	switch action {
 	case "allow_forward":
 		atomic.AddInt64(&m.allowedRequests, 1)
-	case "deny_decoy":
+	case "deny_decoy", "block":
 		atomic.AddInt64(&m.deniedRequests, 1)
 	case "drop":
 		atomic.AddInt64(&m.droppedRequests, 1)
@@ -80,25 +217,21 @@ func (m *Metrics) RecordRequest(profileID, clientIP, action string, durationMs f
 
 	// Profile counter
 	m.profileMu.Lock()
-	if m.profileRequests[profileID] == nil {
-		var zero int64
-		m.profileRequests[profileID] = &zero
-	}
-	atomic.AddInt64(m.profileRequests[profileID], 1)
+	atomic.AddInt64(m.profileRequests.get(profileID), 1)
 	m.profileMu.Unlock()
 
 	// Decision counter
 	m.decisionMu.Lock()
-	if m.decisions[action] == nil {
-		var zero int64
-		m.decisions[action] = &zero
+	atomic.AddInt64(m.decisions.get(action), 1)
+	if ruleType == "" {
+		ruleType = "none"
 	}
-	atomic.AddInt64(m.decisions[action], 1)
+	atomic.AddInt64(m.decisionsByRule.get(action).get(ruleType), 1)
 	m.decisionMu.Unlock()
 
-	// Unique IPs (cap at 100k to prevent unbounded growth)
+	// Unique IPs (capped to prevent unbounded growth)
 	m.uniqueIPsMu.Lock()
-	if len(m.uniqueIPs) >= 100000 {
+	if len(m.uniqueIPs) >= m.limits.MaxUniqueIPs {
 		// Reset to prevent memory leak
 		m.uniqueIPs = make(map[string]struct{})
 	}
@@ -110,36 +243,101 @@ func (m *Metrics) RecordRequest(profileID, clientIP, action string, durationMs f
 	atomic.AddInt64(&m.responseCount, 1)
 }
 
+// RecordBytes records request (in) and response (out) bytes for a profile
+func (m *Metrics) RecordBytes(profileID string, in, out int64) {
+	m.profileMu.Lock()
+	atomic.AddInt64(m.profileBytesIn.get(profileID), in)
+	atomic.AddInt64(m.profileBytesOut.get(profileID), out)
+	m.profileMu.Unlock()
+}
+
+// RecordTLSVersion records an HTTPS request by negotiated TLS version name
+// (e.g. "TLS 1.3")
+func (m *Metrics) RecordTLSVersion(version string) {
+	m.tlsMu.Lock()
+	atomic.AddInt64(m.tlsVersions.get(version), 1)
+	m.tlsMu.Unlock()
+}
+
+// RecordTimeout records a request that exceeded its deadline
+func (m *Metrics) RecordTimeout() {
+	atomic.AddInt64(&m.timeoutRequests, 1)
+}
+
+// RecordPanic records a request whose handler panicked
+func (m *Metrics) RecordPanic() {
+	atomic.AddInt64(&m.panics, 1)
+}
+
+// RecordOversizedBody records a request rejected because its body exceeded
+// the maximum request body size
+func (m *Metrics) RecordOversizedBody() {
+	atomic.AddInt64(&m.oversizedBodies, 1)
+}
+
+// RecordConnOpened records a client connection accepted by a listener
+func (m *Metrics) RecordConnOpened() {
+	atomic.AddInt64(&m.connectionsTotal, 1)
+}
+
+// RecordConnState records a client connection moving from one server state
+// to another, keeping the active and idle connection gauges current
+func (m *Metrics) RecordConnState(from, to http.ConnState) {
+	m.addConnGauge(from, -1)
+	m.addConnGauge(to, 1)
+}
+
+func (m *Metrics) addConnGauge(state http.ConnState, delta int64) {
+	switch state {
+	case http.StateActive:
+		atomic.AddInt64(&m.connectionsActive, delta)
+	case http.StateIdle:
+		atomic.AddInt64(&m.connectionsIdle, delta)
+	}
+}
+
+// RecordRulesEvaluated records how many rules were evaluated for a request
+func (m *Metrics) RecordRulesEvaluated(n int) {
+	atomic.AddInt64(&m.rulesEvaluated, int64(n))
+	atomic.AddInt64(&m.evaluations, 1)
+}
+
 // RecordRuleHit records a rule hit
 func (m *Metrics) RecordRuleHit(ruleType string) {
 	m.ruleHitsMu.Lock()
-	if m.ruleHits[ruleType] == nil {
-		var zero int64
-		m.ruleHits[ruleType] = &zero
-	}
-	atomic.AddInt64(m.ruleHits[ruleType], 1)
+	atomic.AddInt64(m.ruleHits.get(ruleType), 1)
 	m.ruleHitsMu.Unlock()
 }
 
-// RecordBackendRequest records a backend request with latency
-func (m *Metrics) RecordBackendRequest(backendName string, latencyUs int64, isError bool) {
+// RecordRuleEvalDuration records one sampled evaluation of a rule type
+func (m *Metrics) RecordRuleEvalDuration(ruleType string, d time.Duration) {
+	m.ruleEvalMu.Lock()
+	stats := m.ruleEval.get(ruleType)
+	m.ruleEvalMu.Unlock()
+
+	atomic.AddInt64(&stats.samples, 1)
+	atomic.AddInt64(&stats.totalNs, int64(d))
+}
+
+// statusClasses are the labels of BackendStats.StatusClasses
+var statusClasses = []string{"1xx", "2xx", "3xx", "4xx", "5xx"}
+
+// RecordBackendRequest records a backend request with its latency and the
+// status code returned. 5xx responses count as errors.
+func (m *Metrics) RecordBackendRequest(backendName string, latencyUs int64, statusCode int) {
 	m.backendStatsMu.Lock()
-	stats := m.backendStats[backendName]
-	if stats == nil {
-		stats = &BackendStats{
-			MinLatency: latencyUs,
-			MaxLatency: latencyUs,
-		}
-		m.backendStats[backendName] = stats
-	}
+	stats := m.backendStats.get(backendName)
 	m.backendStatsMu.Unlock()
 
 	atomic.AddInt64(&stats.Requests, 1)
 	atomic.AddInt64(&stats.TotalLatency, latencyUs)
 
-	if isError {
+	if statusCode >= 500 {
 		atomic.AddInt64(&stats.Errors, 1)
 	}
+	if class := statusCode / 100; class >= 1 && class <= 5 {
+		atomic.AddInt64(&stats.StatusClasses[class], 1)
+	}
 
 	// Update min/max latency (these need locking for correctness)
 	m.backendStatsMu.Lock()
@@ -152,6 +350,23 @@ func (m *Metrics) RecordBackendRequest(backendName string, latencyUs int64, isEr
 	m.backendStatsMu.Unlock()
 }
 
+// RecordBackendTimeout records a request the backend did not answer in time
+func (m *Metrics) RecordBackendTimeout(backendName string) {
+	m.backendStatsMu.Lock()
+	stats := m.backendStats.get(backendName)
+	m.backendStatsMu.Unlock()
+	atomic.AddInt64(&stats.Timeouts, 1)
+}
+
+// RecordBackendConnectionError records a request that failed because the
+// backend could not be reached or dropped the connection
+func (m *Metrics) RecordBackendConnectionError(backendName string) {
+	m.backendStatsMu.Lock()
+	stats := m.backendStats.get(backendName)
+	m.backendStatsMu.Unlock()
+	atomic.AddInt64(&stats.ConnectionErrors, 1)
+}
+
 // BackendStatsSnapshot represents per-backend statistics snapshot
 type BackendStatsSnapshot struct {
 	Requests     int64   `json:"requests"`
@@ -160,22 +375,110 @@ type BackendStatsSnapshot struct {
 	AvgLatencyMs float64 `json:"avg_latency_ms"`
 	MinLatencyMs float64 `json:"min_latency_ms"`
 	MaxLatencyMs float64 `json:"max_latency_ms"`
+
+	Timeouts         int64 `json:"timeouts"`
+	ConnectionErrors int64 `json:"connection_errors"`
+
+	// Responses counts responses by status class ("2xx", "5xx", ...)
+	Responses map[string]int64 `json:"responses"`
 }
 
 // Snapshot represents a point-in-time metrics snapshot
 type Snapshot struct {
-	Uptime           string                          `json:"uptime"`
-	TotalRequests    int64                           `json:"total_requests"`
-	AllowedRequests  int64                           `json:"allowed_requests"`
-	DeniedRequests   int64                           `json:"denied_requests"`
-	DroppedRequests  int64                           `json:"dropped_requests"`
-	UniqueIPs        int                             `json:"unique_ips"`
-	AvgResponseMs    float64                         `json:"avg_response_ms"`
-	RequestsPerSec   float64                         `json:"requests_per_sec"`
-	ProfileRequests  map[string]int64                `json:"profile_requests"`
-	Decisions        map[string]int64                `json:"decisions"`
-	RuleHits         map[string]int64                `json:"rule_hits"`
-	BackendStats     map[string]BackendStatsSnapshot `json:"backend_stats"`
+	Uptime            string                          `json:"uptime"`
+	TotalRequests     int64                           `json:"total_requests"`
+	AllowedRequests   int64                           `json:"allowed_requests"`
+	DeniedRequests    int64                           `json:"denied_requests"`
+	DroppedRequests   int64                           `json:"dropped_requests"`
+	TimeoutRequests   int64                           `json:"timeout_requests"`
+	Panics            int64                           `json:"panics"`
+	OversizedBodies   int64                           `json:"oversized_bodies"`
+	UniqueIPs         int                             `json:"unique_ips"`
+	AvgResponseMs     float64                         `json:"avg_response_ms"`
+	RequestsPerSec    float64                         `json:"requests_per_sec"`
+	AvgRulesEvaluated float64                         `json:"avg_rules_evaluated"`
+	ProfileRequests   map[string]int64                `json:"profile_requests"`
+	ProfileBytesIn    map[string]int64                `json:"profile_bytes_in"`
+	ProfileBytesOut   map[string]int64                `json:"profile_bytes_out"`
+	Decisions         map[string]int64                `json:"decisions"`
+	DecisionsByRule   map[string]map[string]int64     `json:"decisions_by_rule"`
+	TLSVersions       map[string]int64                `json:"tls_versions"`
+	RuleHits          map[string]int64                `json:"rule_hits"`
+	RuleEvalDuration  map[string]RuleEvalSnapshot     `json:"rule_eval_duration"`
+	BackendStats      map[string]BackendStatsSnapshot `json:"backend_stats"`
+	TopDenialReasons  []DenialReason                  `json:"top_denial_reasons"`
+	Connections       ConnectionsSnapshot             `json:"connections"`
+}
+
+// ConnectionsSnapshot describes client connections and how well they are
+// reused through keep-alive
+type ConnectionsSnapshot struct {
+	Total  int64 `json:"total"`  // connections accepted
+	Active int64 `json:"active"` // open connections serving a request
+	Idle   int64 `json:"idle"`   // open keep-alive connections between requests
+
+	// RequestsPerConnection is total requests divided by accepted
+	// connections; values near 1 mean clients are not reusing connections
+	RequestsPerConnection float64 `json:"requests_per_connection"`
+}
+
+// RuleEvalSnapshot summarizes the sampled evaluation durations of a rule type
+type RuleEvalSnapshot struct {
+	Samples      int64   `json:"samples"`
+	TotalSeconds float64 `json:"total_seconds"`
+	AvgUs        float64 `json:"avg_us"`
+}
+
+// DenialReason is the number of requests denied by one rule type
+type DenialReason struct {
+	RuleType string  `json:"rule_type"`
+	Count    int64   `json:"count"`
+	Percent  float64 `json:"percent"`
+}
+
+// TopDenialReasons returns up to n rule types ranked by the number of
+// requests they kept from the backend, whatever the deny action. n <= 0
+// returns every rule type.
+func (m *Metrics) TopDenialReasons(n int) []DenialReason {
+	m.decisionMu.RLock()
+	defer m.decisionMu.RUnlock()
+
+	counts := make(map[string]int64)
+	for action, byRule := range m.decisionsByRule.entries {
+		if action == "allow_forward" {
+			continue
+		}
+		for rule, v := range byRule.entries {
+			counts[rule] += atomic.LoadInt64(v)
+		}
+	}
+	return rankDenialReasons(counts, n)
+}
+
+// rankDenialReasons sorts counts by descending count, then rule type
+func rankDenialReasons(counts map[string]int64, n int) []DenialReason {
+	var total int64
+	reasons := make([]DenialReason, 0, len(counts))
+	for rule, count := range counts {
+		if count == 0 {
+			continue
+		}
+		total += count
+		reasons = append(reasons, DenialReason{RuleType: rule, Count: count})
+	}
+	sort.Slice(reasons, func(i, j int) bool {
+		if reasons[i].Count != reasons[j].Count {
+			return reasons[i].Count > reasons[j].Count
+		}
+		return reasons[i].RuleType < reasons[j].RuleType
+	})
+	if n > 0 && len(reasons) > n {
+		reasons = reasons[:n]
+	}
+	for i := range reasons {
+		reasons[i].Percent = float64(reasons[i].Count) / float64(total) * 100
+	}
+	return reasons
 }
 
 // GetSnapshot returns a snapshot of current metrics
@@ -190,35 +493,87 @@ func (m *Metrics) GetSnapshot() *Snapshot {
 		avgResp = float64(respTime) / float64(respCount) / 1000.0
 	}
 
+	var avgRules float64
+	if evals := atomic.LoadInt64(&m.evaluations); evals > 0 {
+		avgRules = float64(atomic.LoadInt64(&m.rulesEvaluated)) / float64(evals)
+	}
+
 	var rps float64
 	if uptime.Seconds() > 0 {
 		rps = float64(total) / uptime.Seconds()
 	}
 
+	conns := ConnectionsSnapshot{
+		Total:  atomic.LoadInt64(&m.connectionsTotal),
+		Active: atomic.LoadInt64(&m.connectionsActive),
+		Idle:   atomic.LoadInt64(&m.connectionsIdle),
+	}
+	if conns.Total > 0 {
+		conns.RequestsPerConnection = float64(total) / float64(conns.Total)
+	}
+
 	// Copy profile requests
 	m.profileMu.RLock()
 	profileReqs := make(map[string]int64)
-	for k, v := range m.profileRequests {
+	for k, v := range m.profileRequests.entries {
 		profileReqs[k] = atomic.LoadInt64(v)
 	}
+	bytesIn := make(map[string]int64)
+	for k, v := range m.profileBytesIn.entries {
+		bytesIn[k] = atomic.LoadInt64(v)
+	}
+	bytesOut := make(map[string]int64)
+	for k, v := range m.profileBytesOut.entries {
+		bytesOut[k] = atomic.LoadInt64(v)
+	}
 	m.profileMu.RUnlock()
 
 	// Copy decisions
 	m.decisionMu.RLock()
 	decisions := make(map[string]int64)
-	for k, v := range m.decisions {
+	for k, v := range m.decisions.entries {
 		decisions[k] = atomic.LoadInt64(v)
 	}
+	decisionsByRule := make(map[string]map[string]int64)
+	for action, byRule := range m.decisionsByRule.entries {
+		counts := make(map[string]int64)
+		for rule, v := range byRule.entries {
+			counts[rule] = atomic.LoadInt64(v)
+		}
+		decisionsByRule[action] = counts
+	}
 	m.decisionMu.RUnlock()
 
+	// Copy TLS versions
+	m.tlsMu.RLock()
+	tlsVersions := make(map[string]int64)
+	for k, v := range m.tlsVersions.entries {
+		tlsVersions[k] = atomic.LoadInt64(v)
+	}
+	m.tlsMu.RUnlock()
+
 	// Copy rule hits
 	m.ruleHitsMu.RLock()
 	ruleHits := make(map[string]int64)
-	for k, v := range m.ruleHits {
+	for k, v := range m.ruleHits.entries {
 		ruleHits[k] = atomic.LoadInt64(v)
 	}
 	m.ruleHitsMu.RUnlock()
 
+	// Summarize rule evaluation durations
+	m.ruleEvalMu.RLock()
+	ruleEval := make(map[string]RuleEvalSnapshot)
+	for k, v := range m.ruleEval.entries {
+		samples := atomic.LoadInt64(&v.samples)
+		totalNs := atomic.LoadInt64(&v.totalNs)
+		snap := RuleEvalSnapshot{Samples: samples, TotalSeconds: float64(totalNs) / 1e9}
+		if samples > 0 {
+			snap.AvgUs = float64(totalNs) / float64(samples) / 1000.0
+		}
+		ruleEval[k] = snap
+	}
+	m.ruleEvalMu.RUnlock()
+
 	// Count unique IPs
 	m.uniqueIPsMu.RLock()
 	uniqueCount := len(m.uniqueIPs)
@@ -227,7 +582,7 @@ func (m *Metrics) GetSnapshot() *Snapshot {
 	// Copy backend stats
 	m.backendStatsMu.RLock()
 	backendStats := make(map[string]BackendStatsSnapshot)
-	for name, stats := range m.backendStats {
+	for name, stats := range m.backendStats.entries {
 		requests := atomic.LoadInt64(&stats.Requests)
 		errors := atomic.LoadInt64(&stats.Errors)
 		totalLatency := atomic.LoadInt64(&stats.TotalLatency)
@@ -242,6 +597,13 @@ func (m *Metrics) GetSnapshot() *Snapshot {
 			avgLatency = float64(totalLatency) / float64(requests) / 1000.0 // us to ms
 		}
 
+		responses := make(map[string]int64)
+		for i, class := range statusClasses {
+			if n := atomic.LoadInt64(&stats.StatusClasses[i+1]); n > 0 {
+				responses[class] = n
+			}
+		}
+
 		backendStats[name] = BackendStatsSnapshot{
 			Requests:     requests,
 			Errors:       errors,
@@ -249,23 +611,38 @@ func (m *Metrics) GetSnapshot() *Snapshot {
 			AvgLatencyMs: avgLatency,
 			MinLatencyMs: float64(stats.MinLatency) / 1000.0,
 			MaxLatencyMs: float64(stats.MaxLatency) / 1000.0,
+
+			Timeouts:         atomic.LoadInt64(&stats.Timeouts),
+			ConnectionErrors: atomic.LoadInt64(&stats.ConnectionErrors),
+			Responses:        responses,
 		}
 	}
 	m.backendStatsMu.RUnlock()
 
 	return &Snapshot{
-		Uptime:          uptime.Round(time.Second).String(),
-		TotalRequests:   total,
-		AllowedRequests: atomic.LoadInt64(&m.allowedRequests),
-		DeniedRequests:  atomic.LoadInt64(&m.deniedRequests),
-		DroppedRequests: atomic.LoadInt64(&m.droppedRequests),
-		UniqueIPs:       uniqueCount,
-		AvgResponseMs:   avgResp,
-		RequestsPerSec:  rps,
-		ProfileRequests: profileReqs,
-		Decisions:       decisions,
-		RuleHits:        ruleHits,
-		BackendStats:    backendStats,
+		Uptime:            uptime.Round(time.Second).String(),
+		TotalRequests:     total,
+		AllowedRequests:   atomic.LoadInt64(&m.allowedRequests),
+		DeniedRequests:    atomic.LoadInt64(&m.deniedRequests),
+		DroppedRequests:   atomic.LoadInt64(&m.droppedRequests),
+		TimeoutRequests:   atomic.LoadInt64(&m.timeoutRequests),
+		Panics:            atomic.LoadInt64(&m.panics),
+		OversizedBodies:   atomic.LoadInt64(&m.oversizedBodies),
+		UniqueIPs:         uniqueCount,
+		AvgResponseMs:     avgResp,
+		RequestsPerSec:    rps,
+		AvgRulesEvaluated: avgRules,
+		ProfileRequests:   profileReqs,
+		ProfileBytesIn:    bytesIn,
+		ProfileBytesOut:   bytesOut,
+		Decisions:         decisions,
+		DecisionsByRule:   decisionsByRule,
+		TLSVersions:       tlsVersions,
+		RuleHits:          ruleHits,
+		RuleEvalDuration:  ruleEval,
+		BackendStats:      backendStats,
+		TopDenialReasons:  m.TopDenialReasons(DefaultTopDenialReasons),
+		Connections:       conns,
 	}
 }
 
@@ -302,6 +679,35 @@ func (m *Metrics) PrometheusHandler() http.HandlerFunc {
 		fmt.Fprintf(w, "# TYPE shadowgate_requests_dropped_total counter\n")
 		fmt.Fprintf(w, "shadowgate_requests_dropped_total %d\n\n", snapshot.DroppedRequests)
 
+		fmt.Fprintf(w, "# HELP shadowgate_requests_timeout_total Total number of requests that exceeded the request timeout\n")
+		fmt.Fprintf(w, "# TYPE shadowgate_requests_timeout_total counter\n")
+		fmt.Fprintf(w, "shadowgate_requests_timeout_total %d\n\n", snapshot.TimeoutRequests)
+
+		fmt.Fprintf(w, "# HELP shadowgate_panics_total Total number of requests whose handling panicked\n")
+		fmt.Fprintf(w, "# TYPE shadowgate_panics_total counter\n")
+		fmt.Fprintf(w, "shadowgate_panics_total %d\n\n", snapshot.Panics)
+
+		fmt.Fprintf(w, "# HELP shadowgate_oversized_bodies_total Total number of requests rejected for exceeding the maximum body size\n")
+		fmt.Fprintf(w, "# TYPE shadowgate_oversized_bodies_total counter\n")
+		fmt.Fprintf(w, "shadowgate_oversized_bodies_total %d\n\n", snapshot.OversizedBodies)
+
+		// Client connections
+		fmt.Fprintf(w, "# HELP shadowgate_connections_total Total number of client connections accepted\n")
+		fmt.Fprintf(w, "# TYPE shadowgate_connections_total counter\n")
+		fmt.Fprintf(w, "shadowgate_connections_total %d\n\n", snapshot.Connections.Total)
+
+		fmt.Fprintf(w, "# HELP shadowgate_connections_active Open client connections serving a request\n")
+		fmt.Fprintf(w, "# TYPE shadowgate_connections_active gauge\n")
+		fmt.Fprintf(w, "shadowgate_connections_active %d\n\n", snapshot.Connections.Active)
+
+		fmt.Fprintf(w, "# HELP shadowgate_connections_idle Open keep-alive client connections waiting for a request\n")
+		fmt.Fprintf(w, "# TYPE shadowgate_connections_idle gauge\n")
+		fmt.Fprintf(w, "shadowgate_connections_idle %d\n\n", snapshot.Connections.Idle)
+
+		fmt.Fprintf(w, "# HELP shadowgate_requests_per_connection Average number of requests served per client connection\n")
+		fmt.Fprintf(w, "# TYPE shadowgate_requests_per_connection gauge\n")
+		fmt.Fprintf(w, "shadowgate_requests_per_connection %.3f\n\n", snapshot.Connections.RequestsPerConnection)
+
 		// Unique IPs
 		fmt.Fprintf(w, "# HELP shadowgate_unique_ips Number of unique client IPs seen\n")
 		fmt.Fprintf(w, "# TYPE shadowgate_unique_ips gauge\n")
@@ -317,6 +723,11 @@ func (m *Metrics) PrometheusHandler() http.HandlerFunc {
 		fmt.Fprintf(w, "# TYPE shadowgate_requests_per_second gauge\n")
 		fmt.Fprintf(w, "shadowgate_requests_per_second %.3f\n\n", snapshot.RequestsPerSec)
 
+		// Average rules evaluated per request
+		fmt.Fprintf(w, "# HELP shadowgate_rules_evaluated_avg Average number of rules evaluated per request\n")
+		fmt.Fprintf(w, "# TYPE shadowgate_rules_evaluated_avg gauge\n")
+		fmt.Fprintf(w, "shadowgate_rules_evaluated_avg %.3f\n\n", snapshot.AvgRulesEvaluated)
+
 		// Per-profile requests
 		fmt.Fprintf(w, "# HELP shadowgate_profile_requests_total Requests per profile\n")
 		fmt.Fprintf(w, "# TYPE shadowgate_profile_requests_total counter\n")
@@ -325,11 +736,36 @@ func (m *Metrics) PrometheusHandler() http.HandlerFunc {
 		}
 		fmt.Fprintf(w, "\n")
 
+		// Per-profile bandwidth
+		fmt.Fprintf(w, "# HELP shadowgate_bytes_in_total Request bytes received per profile\n")
+		fmt.Fprintf(w, "# TYPE shadowgate_bytes_in_total counter\n")
+		for profile, n := range snapshot.ProfileBytesIn {
+			fmt.Fprintf(w, "shadowgate_bytes_in_total{profile=%q} %d\n", profile, n)
+		}
+		fmt.Fprintf(w, "\n")
+
+		fmt.Fprintf(w, "# HELP shadowgate_bytes_out_total Response bytes sent per profile\n")
+		fmt.Fprintf(w, "# TYPE shadowgate_bytes_out_total counter\n")
+		for profile, n := range snapshot.ProfileBytesOut {
+			fmt.Fprintf(w, "shadowgate_bytes_out_total{profile=%q} %d\n", profile, n)
+		}
+		fmt.Fprintf(w, "\n")
+
 		// Per-decision counts
-		fmt.Fprintf(w, "# HELP shadowgate_decisions_total Counts by decision type\n")
+		fmt.Fprintf(w, "# HELP shadowgate_decisions_total Counts by decision type and deciding rule type\n")
 		fmt.Fprintf(w, "# TYPE shadowgate_decisions_total counter\n")
-		for decision, count := range snapshot.Decisions {
-			fmt.Fprintf(w, "shadowgate_decisions_total{decision=%q} %d\n", decision, count)
+		for decision, byRule := range snapshot.DecisionsByRule {
+			for rule, count := range byRule {
+				fmt.Fprintf(w, "shadowgate_decisions_total{decision=%q,rule=%q} %d\n", decision, rule, count)
+			}
+		}
+		fmt.Fprintf(w, "\n")
+
+		// HTTPS requests by TLS version
+		fmt.Fprintf(w, "# HELP shadowgate_tls_requests_total HTTPS requests by negotiated TLS version\n")
+		fmt.Fprintf(w, "# TYPE shadowgate_tls_requests_total counter\n")
+		for version, count := range snapshot.TLSVersions {
+			fmt.Fprintf(w, "shadowgate_tls_requests_total{version=%q} %d\n", version, count)
 		}
 		fmt.Fprintf(w, "\n")
 
@@ -341,6 +777,15 @@ func (m *Metrics) PrometheusHandler() http.HandlerFunc {
 		}
 		fmt.Fprintf(w, "\n")
 
+		// Sampled rule evaluation durations
+		fmt.Fprintf(w, "# HELP shadowgate_rule_eval_duration_seconds Sampled rule evaluation time by rule type\n")
+		fmt.Fprintf(w, "# TYPE shadowgate_rule_eval_duration_seconds summary\n")
+		for rule, stats := range snapshot.RuleEvalDuration {
+			fmt.Fprintf(w, "shadowgate_rule_eval_duration_seconds_sum{rule=%q} %.6f\n", rule, stats.TotalSeconds)
+			fmt.Fprintf(w, "shadowgate_rule_eval_duration_seconds_count{rule=%q} %d\n", rule, stats.Samples)
+		}
+		fmt.Fprintf(w, "\n")
+
 		// Backend metrics
 		fmt.Fprintf(w, "# HELP shadowgate_backend_requests_total Total requests per backend\n")
 		fmt.Fprintf(w, "# TYPE shadowgate_backend_requests_total counter\n")
@@ -356,6 +801,20 @@ func (m *Metrics) PrometheusHandler() http.HandlerFunc {
 		}
 		fmt.Fprintf(w, "\n")
 
+		fmt.Fprintf(w, "# HELP shadowgate_backend_timeouts_total Requests the backend did not answer in time (504)\n")
+		fmt.Fprintf(w, "# TYPE shadowgate_backend_timeouts_total counter\n")
+		for backend, stats := range snapshot.BackendStats {
+			fmt.Fprintf(w, "shadowgate_backend_timeouts_total{backend=%q} %d\n", backend, stats.Timeouts)
+		}
+		fmt.Fprintf(w, "\n")
+
+		fmt.Fprintf(w, "# HELP shadowgate_backend_connection_errors_total Requests that failed to reach the backend (502)\n")
+		fmt.Fprintf(w, "# TYPE shadowgate_backend_connection_errors_total counter\n")
+		for backend, stats := range snapshot.BackendStats {
+			fmt.Fprintf(w, "shadowgate_backend_connection_errors_total{backend=%q} %d\n", backend, stats.ConnectionErrors)
+		}
+		fmt.Fprintf(w, "\n")
+
 		fmt.Fprintf(w, "# HELP shadowgate_backend_latency_ms_avg Average latency per backend in milliseconds\n")
 		fmt.Fprintf(w, "# TYPE shadowgate_backend_latency_ms_avg gauge\n")
 		for backend, stats := range snapshot.BackendStats {
@@ -382,6 +841,17 @@ func (m *Metrics) PrometheusHandler() http.HandlerFunc {
 		for backend, stats := range snapshot.BackendStats {
 			fmt.Fprintf(w, "shadowgate_backend_error_rate{backend=%q} %.2f\n", backend, stats.ErrorRate)
 		}
+		fmt.Fprintf(w, "\n")
+
+		fmt.Fprintf(w, "# HELP shadowgate_backend_responses_total Responses per backend by status class\n")
+		fmt.Fprintf(w, "# TYPE shadowgate_backend_responses_total counter\n")
+		for backend, stats := range snapshot.BackendStats {
+			for _, class := range statusClasses {
+				if n, ok := stats.Responses[class]; ok {
+					fmt.Fprintf(w, "shadowgate_backend_responses_total{backend=%q,class=%q} %d\n", backend, class, n)
+				}
+			}
+		}
 	}
 }
 
@@ -391,28 +861,55 @@ func (m *Metrics) Reset() {
 	atomic.StoreInt64(&m.allowedRequests, 0)
 	atomic.StoreInt64(&m.deniedRequests, 0)
 	atomic.StoreInt64(&m.droppedRequests, 0)
+	atomic.StoreInt64(&m.timeoutRequests, 0)
+	atomic.StoreInt64(&m.panics, 0)
+	atomic.StoreInt64(&m.oversizedBodies, 0)
+	atomic.StoreInt64(&m.connectionsTotal, 0)
 	atomic.StoreInt64(&m.totalResponseTime, 0)
 	atomic.StoreInt64(&m.responseCount, 0)
+	atomic.StoreInt64(&m.rulesEvaluated, 0)
+	atomic.StoreInt64(&m.evaluations, 0)
 
 	m.profileMu.Lock()
-	m.profileRequests = make(map[string]*int64)
-	m.profileMu.Unlock()
-
 	m.decisionMu.Lock()
-	m.decisions = make(map[string]*int64)
-	m.decisionMu.Unlock()
-
+	m.tlsMu.Lock()
 	m.ruleHitsMu.Lock()
-	m.ruleHits = make(map[string]*int64)
-	m.ruleHitsMu.Unlock()
-
+	m.ruleEvalMu.Lock()
 	m.uniqueIPsMu.Lock()
-	m.uniqueIPs = make(map[string]struct{})
-	m.uniqueIPsMu.Unlock()
-
 	m.backendStatsMu.Lock()
-	m.backendStats = make(map[string]*BackendStats)
+	m.resetMaps()
 	m.backendStatsMu.Unlock()
+	m.uniqueIPsMu.Unlock()
+	m.ruleEvalMu.Unlock()
+	m.ruleHitsMu.Unlock()
+	m.tlsMu.Unlock()
+	m.decisionMu.Unlock()
+	m.profileMu.Unlock()
+
+	m.profilesMu.RLock()
+	for _, p := range m.profiles.entries {
+		p.Reset()
+	}
+	m.profilesMu.RUnlock()
 
 	m.startTime = time.Now()
 }
+
+// ResetProfile resets the isolated collector for profileID and drops its
+// per-profile counters from m. Global totals are left untouched since they
+// cannot be attributed after the fact. It reports whether m knew of the
+// profile.
+func (m *Metrics) ResetProfile(profileID string) bool {
+	m.profileMu.Lock()
+	_, known := m.profileRequests.lookup(profileID)
+	m.profileRequests.delete(profileID)
+	m.profileBytesIn.delete(profileID)
+	m.profileBytesOut.delete(profileID)
+	m.profileMu.Unlock()
+
+	if p, ok := m.LookupProfile(profileID); ok {
+		p.Reset()
+		known = true
+	}
+	return known
+}
@@ -2,9 +2,12 @@ package metrics
 
 import (
 	"encoding/json"
+	"fmt"
+	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestMetricsRecordRequest(t *testing.T) {
@@ -59,6 +62,50 @@ func TestMetricsRuleHits(t *testing.T) {
 	}
 }
 
+func TestMetricsRulesEvaluated(t *testing.T) {
+	m := New()
+
+	m.RecordRulesEvaluated(1)
+	m.RecordRulesEvaluated(4)
+
+	snapshot := m.GetSnapshot()
+	if snapshot.AvgRulesEvaluated != 2.5 {
+		t.Errorf("expected 2.5 average rules evaluated, got %f", snapshot.AvgRulesEvaluated)
+	}
+
+	m.Reset()
+	if avg := m.GetSnapshot().AvgRulesEvaluated; avg != 0 {
+		t.Errorf("expected 0 after reset, got %f", avg)
+	}
+}
+
+func TestMetricsRecordBytes(t *testing.T) {
+	m := New()
+
+	m.RecordBytes("web", 100, 2000)
+	m.RecordBytes("web", 50, 500)
+	m.RecordBytes("api", 10, 20)
+
+	snapshot := m.GetSnapshot()
+	if snapshot.ProfileBytesIn["web"] != 150 || snapshot.ProfileBytesOut["web"] != 2500 {
+		t.Errorf("unexpected web bytes: in=%d out=%d", snapshot.ProfileBytesIn["web"], snapshot.ProfileBytesOut["web"])
+	}
+	if snapshot.ProfileBytesIn["api"] != 10 || snapshot.ProfileBytesOut["api"] != 20 {
+		t.Errorf("unexpected api bytes: in=%d out=%d", snapshot.ProfileBytesIn["api"], snapshot.ProfileBytesOut["api"])
+	}
+
+	rr := httptest.NewRecorder()
+	m.PrometheusHandler()(rr, httptest.NewRequest("GET", "/metrics/prometheus", nil))
+	if !strings.Contains(rr.Body.String(), `shadowgate_bytes_out_total{profile="web"} 2500`) {
+		t.Error("expected bytes out counter in prometheus output")
+	}
+
+	m.Reset()
+	if len(m.GetSnapshot().ProfileBytesIn) != 0 {
+		t.Error("expected byte counters cleared after reset")
+	}
+}
+
 func TestMetricsHandler(t *testing.T) {
 	m := New()
 	m.RecordRequest("test", "10.0.0.1", "allow_forward", 10.0)
@@ -103,10 +150,10 @@ func TestBackendMetrics(t *testing.T) {
 	m := New()
 
 	// Record some backend requests
-	m.RecordBackendRequest("backend1", 5000, false)  // 5ms success
-	m.RecordBackendRequest("backend1", 10000, false) // 10ms success
-	m.RecordBackendRequest("backend1", 15000, true)  // 15ms error
-	m.RecordBackendRequest("backend2", 3000, false)  // 3ms success
+	m.RecordBackendRequest("backend1", 5000, 200)  // 5ms success
+	m.RecordBackendRequest("backend1", 10000, 404) // 10ms client error
+	m.RecordBackendRequest("backend1", 15000, 502) // 15ms error
+	m.RecordBackendRequest("backend2", 3000, 200)  // 3ms success
 
 	snapshot := m.GetSnapshot()
 
@@ -144,6 +191,14 @@ func TestBackendMetrics(t *testing.T) {
 		t.Errorf("expected 15ms max latency, got %.2fms", b1Stats.MaxLatencyMs)
 	}
 
+	// Responses by status class
+	if b1Stats.Responses["2xx"] != 1 || b1Stats.Responses["4xx"] != 1 || b1Stats.Responses["5xx"] != 1 {
+		t.Errorf("unexpected status classes for backend1: %v", b1Stats.Responses)
+	}
+	if _, ok := b1Stats.Responses["3xx"]; ok {
+		t.Error("expected no 3xx entry for backend1")
+	}
+
 	// Check backend2 stats
 	b2Stats, ok := snapshot.BackendStats["backend2"]
 	if !ok {
@@ -162,7 +217,7 @@ func TestBackendMetrics(t *testing.T) {
 func TestBackendMetricsReset(t *testing.T) {
 	m := New()
 
-	m.RecordBackendRequest("backend1", 5000, false)
+	m.RecordBackendRequest("backend1", 5000, 200)
 	m.Reset()
 
 	snapshot := m.GetSnapshot()
@@ -174,7 +229,7 @@ func TestBackendMetricsReset(t *testing.T) {
 
 func TestPrometheusBackendMetrics(t *testing.T) {
 	m := New()
-	m.RecordBackendRequest("test-backend", 5000, false)
+	m.RecordBackendRequest("test-backend", 5000, 200)
 
 	req := httptest.NewRequest("GET", "/metrics", nil)
 	rr := httptest.NewRecorder()
@@ -195,4 +250,273 @@ func TestPrometheusBackendMetrics(t *testing.T) {
 	if !strings.Contains(body, "shadowgate_backend_latency_ms_avg{backend=\"test-backend\"}") {
 		t.Error("expected shadowgate_backend_latency_ms_avg metric")
 	}
+
+	if !strings.Contains(body, `shadowgate_backend_responses_total{backend="test-backend",class="2xx"} 1`) {
+		t.Error("expected shadowgate_backend_responses_total metric")
+	}
+}
+
+func TestRuleEvalDuration(t *testing.T) {
+	m := New()
+	m.RecordRuleEvalDuration("geo_allow", 300*time.Microsecond)
+	m.RecordRuleEvalDuration("geo_allow", 100*time.Microsecond)
+
+	stats := m.GetSnapshot().RuleEvalDuration["geo_allow"]
+	if stats.Samples != 2 || stats.AvgUs != 200 {
+		t.Errorf("expected 2 samples averaging 200us, got %+v", stats)
+	}
+
+	rr := httptest.NewRecorder()
+	m.PrometheusHandler()(rr, httptest.NewRequest("GET", "/metrics", nil))
+	body := rr.Body.String()
+	for _, want := range []string{
+		`shadowgate_rule_eval_duration_seconds_sum{rule="geo_allow"} 0.000400`,
+		`shadowgate_rule_eval_duration_seconds_count{rule="geo_allow"} 2`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in output", want)
+		}
+	}
+
+	m.Reset()
+	if len(m.GetSnapshot().RuleEvalDuration) != 0 {
+		t.Error("expected rule eval durations cleared by Reset")
+	}
+}
+
+func TestBackendFailureMetrics(t *testing.T) {
+	m := New()
+	m.RecordBackendRequest("api", 5000, 504)
+	m.RecordBackendTimeout("api")
+	m.RecordBackendRequest("api", 100, 502)
+	m.RecordBackendConnectionError("api")
+	m.RecordBackendRequest("api", 100, 502)
+	m.RecordBackendConnectionError("api")
+
+	stats := m.GetSnapshot().BackendStats["api"]
+	if stats.Timeouts != 1 || stats.ConnectionErrors != 2 || stats.Errors != 3 {
+		t.Errorf("expected 1 timeout and 2 connection errors out of 3 errors, got %+v", stats)
+	}
+
+	rr := httptest.NewRecorder()
+	m.PrometheusHandler()(rr, httptest.NewRequest("GET", "/metrics", nil))
+	body := rr.Body.String()
+	if !strings.Contains(body, `shadowgate_backend_timeouts_total{backend="api"} 1`) {
+		t.Error("expected shadowgate_backend_timeouts_total metric")
+	}
+	if !strings.Contains(body, `shadowgate_backend_connection_errors_total{backend="api"} 2`) {
+		t.Error("expected shadowgate_backend_connection_errors_total metric")
+	}
+}
+
+func TestMetricsDecisionsByRule(t *testing.T) {
+	m := New()
+
+	m.RecordRequestWithRule("test", "10.0.0.1", "deny_decoy", "geo_deny", 1.0)
+	m.RecordRequestWithRule("test", "10.0.0.2", "deny_decoy", "geo_deny", 1.0)
+	m.RecordRequestWithRule("test", "10.0.0.3", "deny_decoy", "rate_limit", 1.0)
+	m.RecordRequest("test", "10.0.0.4", "allow_forward", 1.0)
+
+	snapshot := m.GetSnapshot()
+	if got := snapshot.DecisionsByRule["deny_decoy"]["geo_deny"]; got != 2 {
+		t.Errorf("expected 2 geo_deny denials, got %d", got)
+	}
+	if got := snapshot.DecisionsByRule["allow_forward"]["none"]; got != 1 {
+		t.Errorf("expected unattributed decision recorded as 'none', got %d", got)
+	}
+	if got := snapshot.Decisions["deny_decoy"]; got != 3 {
+		t.Errorf("expected 3 denials in total, got %d", got)
+	}
+
+	rr := httptest.NewRecorder()
+	m.PrometheusHandler()(rr, httptest.NewRequest("GET", "/metrics/prometheus", nil))
+	if !strings.Contains(rr.Body.String(), `shadowgate_decisions_total{decision="deny_decoy",rule="rate_limit"} 1`) {
+		t.Error("expected rule label on decisions counter")
+	}
+}
+
+func TestMetricsTopDenialReasons(t *testing.T) {
+	m := New()
+	m.RecordRequestWithRule("test", "10.0.0.1", "allow_forward", "ip_allow", 1.0)
+	m.RecordRequestWithRule("test", "10.0.0.2", "deny_decoy", "rate_limit", 1.0)
+	m.RecordRequestWithRule("test", "10.0.0.3", "tarpit", "rate_limit", 1.0)
+	m.RecordRequestWithRule("test", "10.0.0.4", "deny_decoy", "ip_deny", 1.0)
+
+	reasons := m.GetSnapshot().TopDenialReasons
+	if len(reasons) != 2 {
+		t.Fatalf("expected 2 denial reasons, got %+v", reasons)
+	}
+	// Counts are merged across deny actions and allows are excluded
+	if reasons[0].RuleType != "rate_limit" || reasons[0].Count != 2 {
+		t.Errorf("expected rate_limit ranked first with 2, got %+v", reasons[0])
+	}
+	if reasons[1].RuleType != "ip_deny" || reasons[1].Percent < 33 || reasons[1].Percent > 34 {
+		t.Errorf("unexpected second reason: %+v", reasons[1])
+	}
+
+	if got := m.TopDenialReasons(1); len(got) != 1 || got[0].Percent < 66 || got[0].Percent > 67 {
+		t.Errorf("expected one reason with its share of all denials, got %+v", got)
+	}
+
+	m.Reset()
+	if got := m.TopDenialReasons(0); len(got) != 0 {
+		t.Errorf("expected no reasons after reset, got %+v", got)
+	}
+}
+
+func TestMetricsConnections(t *testing.T) {
+	m := New()
+	m.RecordConnOpened()
+	m.RecordConnState(http.StateNew, http.StateActive)
+	m.RecordConnOpened()
+	m.RecordConnState(http.StateNew, http.StateActive)
+	m.RecordConnState(http.StateActive, http.StateIdle)
+	for i := 0; i < 6; i++ {
+		m.RecordRequest("test", "10.0.0.1", "allow_forward", 1.0)
+	}
+
+	conns := m.GetSnapshot().Connections
+	if conns.Total != 2 || conns.Active != 1 || conns.Idle != 1 {
+		t.Errorf("unexpected connections: %+v", conns)
+	}
+	if conns.RequestsPerConnection != 3 {
+		t.Errorf("expected 3 requests per connection, got %v", conns.RequestsPerConnection)
+	}
+
+	rr := httptest.NewRecorder()
+	m.PrometheusHandler()(rr, httptest.NewRequest("GET", "/metrics/prometheus", nil))
+	for _, line := range []string{
+		"shadowgate_connections_total 2",
+		"shadowgate_connections_active 1",
+		"shadowgate_connections_idle 1",
+		"shadowgate_requests_per_connection 3.000",
+	} {
+		if !strings.Contains(rr.Body.String(), line) {
+			t.Errorf("expected %q in Prometheus output", line)
+		}
+	}
+
+	// Gauges describe open connections and survive a reset
+	m.Reset()
+	conns = m.GetSnapshot().Connections
+	if conns.Total != 0 || conns.Active != 1 || conns.Idle != 1 {
+		t.Errorf("unexpected connections after reset: %+v", conns)
+	}
+
+	m.RecordConnState(http.StateIdle, http.StateClosed)
+	if idle := m.GetSnapshot().Connections.Idle; idle != 0 {
+		t.Errorf("expected closed connection to leave idle gauge, got %d", idle)
+	}
+}
+
+func TestMetricsTLSVersions(t *testing.T) {
+	m := New()
+
+	m.RecordTLSVersion("TLS 1.3")
+	m.RecordTLSVersion("TLS 1.3")
+	m.RecordTLSVersion("TLS 1.2")
+
+	snapshot := m.GetSnapshot()
+	if got := snapshot.TLSVersions["TLS 1.3"]; got != 2 {
+		t.Errorf("expected 2 TLS 1.3 requests, got %d", got)
+	}
+
+	rr := httptest.NewRecorder()
+	m.PrometheusHandler()(rr, httptest.NewRequest("GET", "/metrics/prometheus", nil))
+	if !strings.Contains(rr.Body.String(), `shadowgate_tls_requests_total{version="TLS 1.2"} 1`) {
+		t.Error("expected TLS version counter in Prometheus output")
+	}
+
+	m.Reset()
+	if len(m.GetSnapshot().TLSVersions) != 0 {
+		t.Error("expected TLS versions to be cleared by Reset")
+	}
+}
+
+func TestMetricsProfileCollectors(t *testing.T) {
+	m := New()
+
+	a := m.Profile("team-a")
+	b := m.Profile("team-b")
+	if m.Profile("team-a") != a {
+		t.Error("expected Profile to return the registered collector")
+	}
+
+	for _, c := range []*Metrics{m, a} {
+		c.RecordRequest("team-a", "10.0.0.1", "allow_forward", 10)
+	}
+	for _, c := range []*Metrics{m, b} {
+		c.RecordRequest("team-b", "10.0.0.2", "allow_forward", 10)
+	}
+
+	if !m.ResetProfile("team-a") {
+		t.Error("expected team-a to be known")
+	}
+	if got := a.GetSnapshot().TotalRequests; got != 0 {
+		t.Errorf("expected team-a collector to be reset, got %d requests", got)
+	}
+	if got := b.GetSnapshot().TotalRequests; got != 1 {
+		t.Errorf("expected team-b collector untouched, got %d requests", got)
+	}
+
+	snapshot := m.GetSnapshot()
+	if _, ok := snapshot.ProfileRequests["team-a"]; ok {
+		t.Error("expected team-a per-profile counter to be dropped")
+	}
+	if snapshot.ProfileRequests["team-b"] != 1 || snapshot.TotalRequests != 2 {
+		t.Errorf("expected shared counters for other profiles untouched: %+v", snapshot.ProfileRequests)
+	}
+
+	if m.ResetProfile("unknown") {
+		t.Error("expected unknown profile to be reported")
+	}
+	if _, ok := m.LookupProfile("unknown"); ok {
+		t.Error("expected ResetProfile not to register collectors")
+	}
+
+	m.Reset()
+	if got := b.GetSnapshot().TotalRequests; got != 0 {
+		t.Errorf("expected Reset to reset profile collectors, got %d requests", got)
+	}
+	if ids := m.ProfileIDs(); len(ids) != 2 || ids[0] != "team-a" {
+		t.Errorf("expected collectors to stay registered, got %v", ids)
+	}
+}
+
+func TestMetricsLimits(t *testing.T) {
+	m := NewWithLimits(Limits{MaxKeys: 2, MaxUniqueIPs: 3})
+
+	for i := 0; i < 5; i++ {
+		m.RecordRequest(fmt.Sprintf("profile%d", i), fmt.Sprintf("10.0.0.%d", i), "allow_forward", 1)
+		m.RecordBackendRequest(fmt.Sprintf("backend%d", i), 100, 200)
+		m.RecordRuleHit(fmt.Sprintf("rule%d", i))
+	}
+
+	snapshot := m.GetSnapshot()
+	if snapshot.TotalRequests != 5 {
+		t.Errorf("expected totals to be unaffected by limits, got %d", snapshot.TotalRequests)
+	}
+	if len(snapshot.ProfileRequests) != 3 || snapshot.ProfileRequests[OverflowKey] != 3 {
+		t.Errorf("expected 2 profiles plus %q with 3 requests, got %v", OverflowKey, snapshot.ProfileRequests)
+	}
+	if len(snapshot.BackendStats) != 3 || snapshot.BackendStats[OverflowKey].Requests != 3 {
+		t.Errorf("expected 2 backends plus %q with 3 requests, got %v", OverflowKey, snapshot.BackendStats)
+	}
+	if len(snapshot.RuleHits) != 3 || snapshot.RuleHits[OverflowKey] != 3 {
+		t.Errorf("expected 2 rule types plus %q with 3 hits, got %v", OverflowKey, snapshot.RuleHits)
+	}
+	if snapshot.UniqueIPs > 3 {
+		t.Errorf("expected at most 3 unique IPs tracked, got %d", snapshot.UniqueIPs)
+	}
+
+	// Freed keys can be reused
+	m.ResetProfile("profile0")
+	m.RecordRequest("profile9", "10.0.0.9", "allow_forward", 1)
+	if got := m.GetSnapshot().ProfileRequests["profile9"]; got != 1 {
+		t.Errorf("expected profile9 to take the freed slot, got %d", got)
+	}
+
+	if got := New().limits; got.MaxKeys != DefaultMaxKeys || got.MaxUniqueIPs != DefaultMaxUniqueIPs {
+		t.Errorf("expected default limits, got %+v", got)
+	}
 }
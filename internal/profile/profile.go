@@ -2,8 +2,13 @@ package profile
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"os"
+	"sort"
+	"strings"
 	"sync"
 
 	"shadowgate/internal/config"
@@ -19,25 +24,241 @@ type Profile struct {
 	mu        sync.RWMutex
 }
 
+// ErrUnknownProfile is returned when a profile ID is not in the configuration
+var ErrUnknownProfile = errors.New("unknown profile")
+
 // Manager manages multiple profiles
 type Manager struct {
+	profiles     map[string]*Profile
+	shared       []listener.Listener // SNI-routed listeners serving several profiles
+	bindings     map[string]*binding // all listeners by configured address
+	connObserver listener.ConnObserver
+	cfg          *config.Config  // configuration the profiles were built from
+	overrides    map[string]bool // runtime enabled state by profile ID
+	mu           sync.RWMutex
+}
+
+// binding ties a listener to the network settings it was created from, so a
+// reload can keep listeners whose settings did not change
+type binding struct {
+	spec     string // protocol, TLS, socket and SNI settings
+	listener *listener.HTTPListener
+	handler  http.Handler
+	reused   bool // carried over from the previous configuration
+}
+
+// loadState holds profiles and listeners built from a configuration
+type loadState struct {
 	profiles map[string]*Profile
-	mu       sync.RWMutex
+	shared   []listener.Listener
+	bindings map[string]*binding
+}
+
+// ReloadResult lists listener addresses by what a reload did with them
+type ReloadResult struct {
+	Kept    []string // unchanged listeners whose handlers were swapped
+	Started []string // new or changed listeners
+	Stopped []string // removed or changed listeners
+
+	Errors map[string]error // listeners that failed to stop or start, by address
 }
 
 // NewManager creates a new profile manager
 func NewManager() *Manager {
 	return &Manager{
 		profiles: make(map[string]*Profile),
+		bindings: make(map[string]*binding),
 	}
 }
 
-// LoadFromConfig loads profiles from configuration
+// SetConnObserver sets the observer told about client connections on
+// listeners created from now on, such as the metrics collector
+func (m *Manager) SetConnObserver(obs listener.ConnObserver) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.connObserver = obs
+}
+
+// LoadFromConfig loads profiles from configuration. Disabled profiles are
+// skipped and their listeners are not created.
 func (m *Manager) LoadFromConfig(cfg *config.Config, handlerFactory func(p *Profile) http.Handler) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	state, err := m.build(cfg, handlerFactory, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	m.profiles = state.profiles
+	m.shared = state.shared
+	m.bindings = state.bindings
+	m.cfg = cfg
+	m.overrides = nil
+	return nil
+}
+
+// Reload applies a new configuration to running listeners. Listeners whose
+// address, protocol, TLS, socket and SNI settings are unchanged keep running,
+// including their accepted connections, and have the new profile handlers
+// swapped in. Changed or removed listeners are shut down gracefully (bounded
+// by ctx) before new ones are started. If the configuration cannot be built,
+// an error is returned and nothing is changed; otherwise the new
+// configuration is applied and per-listener failures are reported in the
+// result. Profiles enabled or disabled at runtime return to the state set in
+// the new configuration.
+func (m *Manager) Reload(ctx context.Context, cfg *config.Config, handlerFactory func(p *Profile) http.Handler) (ReloadResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.reload(ctx, cfg, handlerFactory, nil)
+}
+
+// SetEnabled enables or disables a profile at runtime. The current
+// configuration is reloaded with the change: a disabled profile's listeners
+// are stopped and release their ports, an enabled profile's are started.
+// The change lasts until the next Reload.
+func (m *Manager) SetEnabled(ctx context.Context, id string, enabled bool, handlerFactory func(p *Profile) http.Handler) (ReloadResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.configured(id) {
+		return ReloadResult{}, fmt.Errorf("%w: %s", ErrUnknownProfile, id)
+	}
+	overrides := make(map[string]bool, len(m.overrides)+1)
+	for k, v := range m.overrides {
+		overrides[k] = v
+	}
+	overrides[id] = enabled
+	return m.reload(ctx, m.cfg, handlerFactory, overrides)
+}
+
+// configured reports whether id is in the current configuration, enabled or
+// not. The caller holds m.mu.
+func (m *Manager) configured(id string) bool {
+	if m.cfg == nil {
+		return false
+	}
+	for _, pc := range m.cfg.Profiles {
+		if pc.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// profileEnabled reports whether a profile should be served, preferring a
+// runtime override over its configuration
+func profileEnabled(pc *config.ProfileConfig, overrides map[string]bool) bool {
+	if enabled, ok := overrides[pc.ID]; ok {
+		return enabled
+	}
+	return pc.IsEnabled()
+}
+
+// reload swaps in profiles built from cfg with the given runtime overrides.
+// The caller holds m.mu.
+func (m *Manager) reload(ctx context.Context, cfg *config.Config, handlerFactory func(p *Profile) http.Handler, overrides map[string]bool) (ReloadResult, error) {
+	var result ReloadResult
+
+	state, err := m.build(cfg, handlerFactory, m.bindings, overrides)
+	if err != nil {
+		return result, err
+	}
+
+	for addr, old := range m.bindings {
+		if next, ok := state.bindings[addr]; ok && next.reused {
+			continue
+		}
+		if err := old.listener.Stop(ctx); err != nil {
+			result.addError(addr, fmt.Errorf("stop: %w", err))
+		}
+		result.Stopped = append(result.Stopped, addr)
+	}
+
+	for addr, b := range state.bindings {
+		if b.reused {
+			b.listener.SetHandler(b.handler)
+			result.Kept = append(result.Kept, addr)
+			continue
+		}
+		if err := b.listener.Start(ctx); err != nil {
+			result.addError(addr, fmt.Errorf("start: %w", err))
+			continue
+		}
+		result.Started = append(result.Started, addr)
+	}
+
+	// Replaced handlers may still be finishing requests on kept listeners,
+	// so closing only releases their background resources
+	closeHandlers(m.profiles)
+
+	m.profiles = state.profiles
+	m.shared = state.shared
+	m.bindings = state.bindings
+	m.cfg = cfg
+	m.overrides = overrides
+
+	sort.Strings(result.Kept)
+	sort.Strings(result.Started)
+	sort.Strings(result.Stopped)
+	return result, nil
+}
+
+func (r *ReloadResult) addError(addr string, err error) {
+	if r.Errors == nil {
+		r.Errors = make(map[string]error)
+	}
+	r.Errors[addr] = err
+}
+
+// build creates the enabled profiles and their listeners from configuration.
+// Listeners in prev whose settings match are reused instead of created.
+func (m *Manager) build(cfg *config.Config, handlerFactory func(p *Profile) http.Handler, prev map[string]*binding, overrides map[string]bool) (*loadState, error) {
+	state := &loadState{
+		profiles: make(map[string]*Profile),
+		bindings: make(map[string]*binding),
+	}
+
+	// bind returns the listener for addr, reusing the previous one when its
+	// settings are unchanged
+	bind := func(addr, spec string, handler http.Handler, create func() (*listener.HTTPListener, error)) (*listener.HTTPListener, error) {
+		if old, ok := prev[addr]; ok && old.spec == spec {
+			state.bindings[addr] = &binding{spec: spec, listener: old.listener, handler: handler, reused: true}
+			return old.listener, nil
+		}
+		l, err := create()
+		if err != nil {
+			return nil, err
+		}
+		state.bindings[addr] = &binding{spec: spec, listener: l, handler: handler}
+		return l, nil
+	}
+
+	// HTTPS listeners that declare sni_hosts or share an address are served
+	// by one SNI router per address instead of a listener per profile
+	addrCount := make(map[string]int)
 	for _, pc := range cfg.Profiles {
+		if !profileEnabled(&pc, overrides) {
+			continue
+		}
+		for _, lc := range pc.ExpandListeners() {
+			addrCount[lc.Addr]++
+		}
+	}
+	routers := make(map[string]*listener.SNIRouter)
+	routerModes := make(map[string]os.FileMode)
+	routerLimits := make(map[string]listener.AcceptLimitConfig)
+	routerProxyProtocol := make(map[string]listener.ProxyProtocolConfig)
+	routerTimeouts := make(map[string]listener.Timeouts)
+	routerKeepAlive := make(map[string]bool)
+	routerTLS := make(map[string]listener.TLSOptions)
+	routerSpecs := make(map[string][]string)
+	var routerAddrs []string
+
+	for _, pc := range cfg.Profiles {
+		if !profileEnabled(&pc, overrides) {
+			continue
+		}
 		profile := &Profile{
 			ID:     pc.ID,
 			Config: pc,
@@ -47,34 +268,173 @@ func (m *Manager) LoadFromConfig(cfg *config.Config, handlerFactory func(p *Prof
 		profile.handler = handlerFactory(profile)
 
 		// Create listeners for this profile
-		for _, lc := range pc.Listeners {
-			var l listener.Listener
+		for _, lc := range pc.ExpandListeners() {
+			socketMode, err := lc.SocketFileMode()
+			if err != nil {
+				return nil, fmt.Errorf("profile %s: %w", pc.ID, err)
+			}
+			spec := listenerSpec(lc, socketMode)
+
+			var l *listener.HTTPListener
 			switch lc.Protocol {
 			case "http":
-				l = listener.NewHTTPListener(listener.HTTPListenerConfig{
-					Addr:    lc.Addr,
-					Handler: profile.handler,
+				l, err = bind(lc.Addr, spec, profile.handler, func() (*listener.HTTPListener, error) {
+					return listener.NewHTTPListener(listener.HTTPListenerConfig{
+						Addr:          lc.Addr,
+						SocketMode:    socketMode,
+						Handler:       profile.handler,
+						AcceptLimit:   acceptLimit(lc),
+						ProxyProtocol: proxyProtocol(lc),
+						Timeouts:      timeouts(lc),
+						ConnObserver:  m.connObserver,
+
+						DisableKeepAlives: !lc.KeepAliveEnabled(),
+					}), nil
 				})
 			case "https":
-				tlsCfg, err := listener.LoadTLSConfig(lc.TLS.CertFile, lc.TLS.KeyFile)
-				if err != nil {
-					return fmt.Errorf("profile %s: %w", pc.ID, err)
+				if len(lc.SNIHosts) > 0 || addrCount[lc.Addr] > 1 {
+					router, ok := routers[lc.Addr]
+					if !ok {
+						router = listener.NewSNIRouter()
+						routers[lc.Addr] = router
+						routerModes[lc.Addr] = socketMode
+						routerLimits[lc.Addr] = acceptLimit(lc)
+						routerProxyProtocol[lc.Addr] = proxyProtocol(lc)
+						routerTimeouts[lc.Addr] = timeouts(lc)
+						routerKeepAlive[lc.Addr] = lc.KeepAliveEnabled()
+						routerTLS[lc.Addr] = sessionOptions(lc)
+						routerAddrs = append(routerAddrs, lc.Addr)
+					} else if routerTLS[lc.Addr] != sessionOptions(lc) {
+						return nil, fmt.Errorf("profile %s: listeners on %s must share TLS session settings", pc.ID, lc.Addr)
+					} else if routerKeepAlive[lc.Addr] != lc.KeepAliveEnabled() {
+						return nil, fmt.Errorf("profile %s: listeners on %s must share the keep_alive setting", pc.ID, lc.Addr)
+					}
+					if err := addSNIRoute(router, lc, profile.handler); err != nil {
+						return nil, fmt.Errorf("profile %s: %w", pc.ID, err)
+					}
+					routerSpecs[lc.Addr] = append(routerSpecs[lc.Addr], spec)
+					continue
 				}
-				l = listener.NewHTTPListener(listener.HTTPListenerConfig{
-					Addr:      lc.Addr,
-					TLSConfig: tlsCfg,
-					Handler:   profile.handler,
+				l, err = bind(lc.Addr, spec, profile.handler, func() (*listener.HTTPListener, error) {
+					tlsCfg, err := listener.LoadTLSConfigWithOptions(lc.TLS.CertFile, lc.TLS.KeyFile, tlsOptions(lc))
+					if err != nil {
+						return nil, err
+					}
+					return listener.NewHTTPListener(listener.HTTPListenerConfig{
+						Addr:          lc.Addr,
+						SocketMode:    socketMode,
+						TLSConfig:     tlsCfg,
+						Handler:       profile.handler,
+						AcceptLimit:   acceptLimit(lc),
+						ProxyProtocol: proxyProtocol(lc),
+						Timeouts:      timeouts(lc),
+						ConnObserver:  m.connObserver,
+
+						DisableKeepAlives: !lc.KeepAliveEnabled(),
+					}), nil
 				})
 			default:
-				return fmt.Errorf("profile %s: unsupported protocol %s", pc.ID, lc.Protocol)
+				return nil, fmt.Errorf("profile %s: unsupported protocol %s", pc.ID, lc.Protocol)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("profile %s: %w", pc.ID, err)
 			}
 			profile.listeners = append(profile.listeners, l)
 		}
 
-		m.profiles[pc.ID] = profile
+		state.profiles[pc.ID] = profile
 	}
 
-	return nil
+	for _, addr := range routerAddrs {
+		router := routers[addr]
+		specs := routerSpecs[addr]
+		sort.Strings(specs)
+		spec := "sni|" + strings.Join(specs, ";")
+
+		l, err := bind(addr, spec, router, func() (*listener.HTTPListener, error) {
+			tlsCfg := router.TLSConfig()
+			if err := routerTLS[addr].Apply(tlsCfg); err != nil {
+				return nil, err
+			}
+			return listener.NewHTTPListener(listener.HTTPListenerConfig{
+				Addr:          addr,
+				SocketMode:    routerModes[addr],
+				AcceptLimit:   routerLimits[addr],
+				ProxyProtocol: routerProxyProtocol[addr],
+				Timeouts:      routerTimeouts[addr],
+				ConnObserver:  m.connObserver,
+				TLSConfig:     tlsCfg,
+				Handler:       router,
+
+				DisableKeepAlives: !routerKeepAlive[addr],
+			}), nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		state.shared = append(state.shared, l)
+	}
+
+	return state, nil
+}
+
+// listenerSpec summarizes the settings that require rebinding when changed
+func listenerSpec(lc config.ListenerConfig, socketMode os.FileMode) string {
+	return fmt.Sprintf("%s|%s|%s|%04o|%s|%+v|%t|%s|%+v|%t|%+v", lc.Protocol, lc.TLS.CertFile, lc.TLS.KeyFile, socketMode, strings.Join(lc.SNIHosts, ","), lc.ConnRateLimit,
+		lc.ProxyProtocol, strings.Join(lc.ProxyProtocolTrusted, ","), timeouts(lc), lc.KeepAliveEnabled(), tlsOptions(lc))
+}
+
+// acceptLimit converts a listener's connection-rate settings
+func acceptLimit(lc config.ListenerConfig) listener.AcceptLimitConfig {
+	return listener.AcceptLimitConfig{
+		GlobalRate:  lc.ConnRateLimit.GlobalRate,
+		GlobalBurst: lc.ConnRateLimit.GlobalBurst,
+		PerIPRate:   lc.ConnRateLimit.PerIPRate,
+		PerIPBurst:  lc.ConnRateLimit.PerIPBurst,
+	}
+}
+
+// proxyProtocol converts a listener's PROXY protocol settings
+func proxyProtocol(lc config.ListenerConfig) listener.ProxyProtocolConfig {
+	return listener.ProxyProtocolConfig{
+		Enabled: lc.ProxyProtocol,
+		Trusted: lc.ProxyProtocolTrusted,
+	}
+}
+
+// timeouts converts a listener's server timeouts
+func timeouts(lc config.ListenerConfig) listener.Timeouts {
+	read, write, idle, readHeader := lc.Timeouts()
+	return listener.Timeouts{Read: read, Write: write, Idle: idle, ReadHeader: readHeader}
+}
+
+// tlsOptions converts a listener's session resumption and OCSP settings
+func tlsOptions(lc config.ListenerConfig) listener.TLSOptions {
+	opts := sessionOptions(lc)
+	opts.OCSPStapleFile = lc.TLS.OCSPStapleFile
+	return opts
+}
+
+// sessionOptions converts a listener's session resumption settings, which
+// apply to the whole listener rather than one certificate
+func sessionOptions(lc config.ListenerConfig) listener.TLSOptions {
+	return listener.TLSOptions{
+		SessionTicketKeyFile:  lc.TLS.SessionTicketKeyFile,
+		SessionCacheSize:      lc.TLS.SessionCacheSize,
+		DisableSessionTickets: lc.TLS.DisableSessionTickets,
+	}
+}
+
+// addSNIRoute registers a listener's hostnames and certificate on a router
+func addSNIRoute(router *listener.SNIRouter, lc config.ListenerConfig, handler http.Handler) error {
+	cert, err := listener.LoadCertificateWithOCSP(lc.TLS.CertFile, lc.TLS.KeyFile, lc.TLS.OCSPStapleFile)
+	if err != nil {
+		return err
+	}
+	if len(lc.SNIHosts) == 0 {
+		return router.SetDefault(cert, handler)
+	}
+	return router.Add(lc.SNIHosts, cert, handler)
 }
 
 // Start starts all profiles
@@ -90,6 +450,12 @@ func (m *Manager) Start(ctx context.Context) error {
 			fmt.Printf("Profile %s: listening on %s\n", id, l.Addr())
 		}
 	}
+	for i, l := range m.shared {
+		if err := l.Start(ctx); err != nil {
+			return fmt.Errorf("shared listener %d: %w", i, err)
+		}
+		fmt.Printf("Shared SNI listener on %s\n", l.Addr())
+	}
 	return nil
 }
 
@@ -106,9 +472,82 @@ func (m *Manager) Stop(ctx context.Context) error {
 			}
 		}
 	}
+	for i, l := range m.shared {
+		if err := l.Stop(ctx); err != nil {
+			lastErr = fmt.Errorf("shared listener %d: %w", i, err)
+		}
+	}
+	closeHandlers(m.profiles)
+	return lastErr
+}
+
+// closeHandlers releases resources held by profile handlers that implement
+// io.Closer, such as rule cleanup goroutines
+func closeHandlers(profiles map[string]*Profile) {
+	for _, p := range profiles {
+		if c, ok := p.handler.(io.Closer); ok {
+			c.Close()
+		}
+	}
+}
+
+// Drain stops all listeners from accepting new connections while letting
+// in-flight requests complete
+func (m *Manager) Drain() error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var lastErr error
+	for id, p := range m.profiles {
+		for i, l := range p.listeners {
+			if err := l.Drain(); err != nil {
+				lastErr = fmt.Errorf("profile %s listener %d: %w", id, i, err)
+			}
+		}
+	}
+	for i, l := range m.shared {
+		if err := l.Drain(); err != nil {
+			lastErr = fmt.Errorf("shared listener %d: %w", i, err)
+		}
+	}
 	return lastErr
 }
 
+// ActiveConnections returns open connection counts keyed by listener address
+func (m *Manager) ActiveConnections() map[string]int64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	counts := make(map[string]int64)
+	for _, p := range m.profiles {
+		for _, l := range p.listeners {
+			counts[l.Addr()] += l.ActiveConnections()
+		}
+	}
+	for _, l := range m.shared {
+		counts[l.Addr()] += l.ActiveConnections()
+	}
+	return counts
+}
+
+// ListenerStatus reports whether each listener is accepting connections,
+// keyed by listener address
+func (m *Manager) ListenerStatus() map[string]bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	status := make(map[string]bool)
+	for _, p := range m.profiles {
+		for _, l := range p.listeners {
+			status[l.Addr()] = l.Serving()
+		}
+	}
+	for _, l := range m.shared {
+		status[l.Addr()] = l.Serving()
+	}
+	return status
+}
+
 // Get returns a profile by ID
 func (m *Manager) Get(id string) (*Profile, bool) {
 	m.mu.RLock()
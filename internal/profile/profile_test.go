@@ -2,6 +2,8 @@ package profile
 
 import (
 	"context"
+	"errors"
+	"io"
 	"net/http"
 	"testing"
 
@@ -86,3 +88,279 @@ func TestManagerStartStop(t *testing.T) {
 		t.Fatalf("failed to stop: %v", err)
 	}
 }
+
+func TestManagerReload(t *testing.T) {
+	profileConfig := func(id string, addrs ...string) config.ProfileConfig {
+		pc := config.ProfileConfig{
+			ID:       id,
+			Backends: []config.BackendConfig{{Name: "primary", URL: "http://127.0.0.1:9000"}},
+		}
+		for _, addr := range addrs {
+			pc.Listeners = append(pc.Listeners, config.ListenerConfig{Addr: addr, Protocol: "http"})
+		}
+		return pc
+	}
+	factory := func(body string) func(p *Profile) http.Handler {
+		return func(p *Profile) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(body))
+			})
+		}
+	}
+
+	mgr := NewManager()
+	cfg := &config.Config{Profiles: []config.ProfileConfig{
+		profileConfig("kept", "127.0.0.1:18191"),
+		profileConfig("removed", "127.0.0.1:18192"),
+	}}
+	if err := mgr.LoadFromConfig(cfg, factory("v1")); err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+
+	ctx := context.Background()
+	if err := mgr.Start(ctx); err != nil {
+		t.Fatalf("failed to start: %v", err)
+	}
+	defer mgr.Stop(ctx)
+
+	kept, _ := mgr.Get("kept")
+	before := kept.listeners[0]
+
+	newCfg := &config.Config{Profiles: []config.ProfileConfig{
+		profileConfig("kept", "127.0.0.1:18191"),
+		profileConfig("added", "127.0.0.1:18193"),
+	}}
+	result, err := mgr.Reload(ctx, newCfg, factory("v2"))
+	if err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+	if len(result.Errors) != 0 {
+		t.Fatalf("unexpected listener errors: %v", result.Errors)
+	}
+
+	if len(result.Kept) != 1 || result.Kept[0] != "127.0.0.1:18191" {
+		t.Errorf("expected unchanged listener to be kept, got %v", result.Kept)
+	}
+	if len(result.Started) != 1 || result.Started[0] != "127.0.0.1:18193" {
+		t.Errorf("expected added listener to be started, got %v", result.Started)
+	}
+	if len(result.Stopped) != 1 || result.Stopped[0] != "127.0.0.1:18192" {
+		t.Errorf("expected removed listener to be stopped, got %v", result.Stopped)
+	}
+
+	kept, _ = mgr.Get("kept")
+	if kept.listeners[0] != before {
+		t.Error("expected kept profile to reuse its running listener")
+	}
+
+	for _, addr := range []string{"127.0.0.1:18191", "127.0.0.1:18193"} {
+		resp, err := http.Get("http://" + addr)
+		if err != nil {
+			t.Fatalf("request to %s failed: %v", addr, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != "v2" {
+			t.Errorf("%s: expected new handler, got %q", addr, string(body))
+		}
+	}
+
+	if _, err := http.Get("http://127.0.0.1:18192"); err == nil {
+		t.Error("expected removed listener to be closed")
+	}
+}
+
+func TestManagerMultipleAddrs(t *testing.T) {
+	profileConfig := func(addrs ...string) config.ProfileConfig {
+		return config.ProfileConfig{
+			ID:        "multi",
+			Listeners: []config.ListenerConfig{{Addrs: addrs, Protocol: "http"}},
+			Backends:  []config.BackendConfig{{Name: "primary", URL: "http://127.0.0.1:9000"}},
+		}
+	}
+	factory := func(p *Profile) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(p.ID))
+		})
+	}
+
+	mgr := NewManager()
+	cfg := &config.Config{Profiles: []config.ProfileConfig{profileConfig("127.0.0.1:18194", "127.0.0.1:18195")}}
+	if err := mgr.LoadFromConfig(cfg, factory); err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+
+	ctx := context.Background()
+	if err := mgr.Start(ctx); err != nil {
+		t.Fatalf("failed to start: %v", err)
+	}
+	defer mgr.Stop(ctx)
+
+	for _, addr := range []string{"127.0.0.1:18194", "127.0.0.1:18195"} {
+		resp, err := http.Get("http://" + addr)
+		if err != nil {
+			t.Fatalf("request to %s failed: %v", addr, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != "multi" {
+			t.Errorf("%s: expected profile handler, got %q", addr, string(body))
+		}
+	}
+
+	// Dropping one address stops only its listener
+	result, err := mgr.Reload(ctx, &config.Config{Profiles: []config.ProfileConfig{profileConfig("127.0.0.1:18194")}}, factory)
+	if err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+	if len(result.Kept) != 1 || result.Kept[0] != "127.0.0.1:18194" {
+		t.Errorf("expected remaining address to be kept, got %v", result.Kept)
+	}
+	if len(result.Stopped) != 1 || result.Stopped[0] != "127.0.0.1:18195" {
+		t.Errorf("expected dropped address to be stopped, got %v", result.Stopped)
+	}
+}
+
+func TestManagerReloadKeepsStateOnError(t *testing.T) {
+	mgr := NewManager()
+	cfg := &config.Config{Profiles: []config.ProfileConfig{{
+		ID:        "p",
+		Listeners: []config.ListenerConfig{{Addr: "127.0.0.1:18194", Protocol: "http"}},
+	}}}
+	handler := func(p *Profile) http.Handler { return http.NotFoundHandler() }
+	if err := mgr.LoadFromConfig(cfg, handler); err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+
+	newCfg := &config.Config{Profiles: []config.ProfileConfig{{
+		ID:        "p",
+		Listeners: []config.ListenerConfig{{Addr: "127.0.0.1:18194", Protocol: "https", TLS: config.TLSConfig{CertFile: "missing.pem", KeyFile: "missing.key"}}},
+	}}}
+	if _, err := mgr.Reload(context.Background(), newCfg, handler); err == nil {
+		t.Fatal("expected reload with unloadable certificate to fail")
+	}
+
+	// A failed build leaves the previous configuration in place
+	p, ok := mgr.Get("p")
+	if !ok || len(p.listeners) != 1 {
+		t.Fatal("expected previous profile to remain loaded")
+	}
+	if spec := mgr.bindings["127.0.0.1:18194"].spec; spec != listenerSpec(cfg.Profiles[0].Listeners[0], 0) {
+		t.Errorf("expected previous binding to remain, got spec %q", spec)
+	}
+}
+
+type closingHandler struct {
+	http.Handler
+	closed bool
+}
+
+func (h *closingHandler) Close() error {
+	h.closed = true
+	return nil
+}
+
+func TestManagerReloadClosesHandlers(t *testing.T) {
+	cfg := &config.Config{Profiles: []config.ProfileConfig{{
+		ID:        "test",
+		Listeners: []config.ListenerConfig{{Addr: "127.0.0.1:18195", Protocol: "http"}},
+		Backends:  []config.BackendConfig{{Name: "primary", URL: "http://127.0.0.1:9000"}},
+	}}}
+
+	var handlers []*closingHandler
+	factory := func(p *Profile) http.Handler {
+		h := &closingHandler{Handler: http.NotFoundHandler()}
+		handlers = append(handlers, h)
+		return h
+	}
+
+	mgr := NewManager()
+	if err := mgr.LoadFromConfig(cfg, factory); err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	ctx := context.Background()
+	if _, err := mgr.Reload(ctx, cfg, factory); err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+
+	if len(handlers) != 2 || !handlers[0].closed || handlers[1].closed {
+		t.Fatalf("expected only the replaced handler to be closed")
+	}
+
+	mgr.Stop(ctx)
+	if !handlers[1].closed {
+		t.Error("expected Stop to close the current handler")
+	}
+}
+
+func TestManagerDisabledProfiles(t *testing.T) {
+	disabled := false
+	cfg := &config.Config{Profiles: []config.ProfileConfig{
+		{
+			ID:        "active",
+			Listeners: []config.ListenerConfig{{Addr: "127.0.0.1:18196", Protocol: "http"}},
+		},
+		{
+			ID:        "seasonal",
+			Enabled:   &disabled,
+			Listeners: []config.ListenerConfig{{Addr: "127.0.0.1:18197", Protocol: "http"}},
+		},
+	}}
+	handler := func(p *Profile) http.Handler { return http.NotFoundHandler() }
+
+	mgr := NewManager()
+	if err := mgr.LoadFromConfig(cfg, handler); err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	ctx := context.Background()
+	if err := mgr.Start(ctx); err != nil {
+		t.Fatalf("failed to start: %v", err)
+	}
+	defer mgr.Stop(ctx)
+
+	if _, ok := mgr.Get("seasonal"); ok {
+		t.Fatal("expected disabled profile to be skipped")
+	}
+	if _, err := http.Get("http://127.0.0.1:18197"); err == nil {
+		t.Fatal("expected disabled profile not to bind its port")
+	}
+
+	result, err := mgr.SetEnabled(ctx, "seasonal", true, handler)
+	if err != nil {
+		t.Fatalf("enable failed: %v", err)
+	}
+	if len(result.Started) != 1 || result.Started[0] != "127.0.0.1:18197" {
+		t.Errorf("expected enabled profile's listener to be started, got %v", result.Started)
+	}
+	resp, err := http.Get("http://127.0.0.1:18197")
+	if err != nil {
+		t.Fatalf("expected enabled profile to serve requests: %v", err)
+	}
+	resp.Body.Close()
+
+	result, err = mgr.SetEnabled(ctx, "active", false, handler)
+	if err != nil {
+		t.Fatalf("disable failed: %v", err)
+	}
+	if len(result.Stopped) != 1 || result.Stopped[0] != "127.0.0.1:18196" {
+		t.Errorf("expected disabled profile's listener to be stopped, got %v", result.Stopped)
+	}
+	if _, err := http.Get("http://127.0.0.1:18196"); err == nil {
+		t.Error("expected disabled profile to release its port")
+	}
+
+	if _, err := mgr.SetEnabled(ctx, "missing", true, handler); !errors.Is(err, ErrUnknownProfile) {
+		t.Errorf("expected ErrUnknownProfile, got %v", err)
+	}
+
+	// A reload returns to the enabled state in the configuration
+	if _, err := mgr.Reload(ctx, cfg, handler); err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+	if _, ok := mgr.Get("active"); !ok {
+		t.Error("expected reload to re-enable profile")
+	}
+	if _, ok := mgr.Get("seasonal"); ok {
+		t.Error("expected reload to disable profile again")
+	}
+}
@@ -0,0 +1,116 @@
+package proxy
+
+import (
+	"math"
+	"sync/atomic"
+)
+
+// Adaptive weight defaults
+const (
+	DefaultAdaptiveErrorThreshold = 0.05
+	DefaultAdaptiveMinFactor      = 0.1
+)
+
+// adaptiveWindow is roughly how many recent requests the rolling error rate
+// reflects
+const adaptiveWindow = 100
+
+// adaptiveFullErrorRate is the error rate at which a backend's weight is cut
+// to the minimum factor
+const adaptiveFullErrorRate = 0.5
+
+// weightScale turns fractional effective weights into the integer weights
+// used for weighted selection
+const weightScale = 1000
+
+// AdaptiveWeightOptions configures scaling down the weight of backends whose
+// recent requests are failing, so weighted selection shifts traffic to
+// healthier backends before a circuit breaker trips
+type AdaptiveWeightOptions struct {
+	Enabled        bool
+	ErrorThreshold float64 // error rate tolerated before the weight is reduced
+	MinFactor      float64 // smallest fraction of the configured weight a backend keeps
+}
+
+// DefaultAdaptiveWeightOptions returns default adaptive weight options
+func DefaultAdaptiveWeightOptions() AdaptiveWeightOptions {
+	return AdaptiveWeightOptions{
+		ErrorThreshold: DefaultAdaptiveErrorThreshold,
+		MinFactor:      DefaultAdaptiveMinFactor,
+	}
+}
+
+// factor returns the fraction of its configured weight a backend with the
+// given error rate receives. It falls linearly from 1 at ErrorThreshold to
+// MinFactor at adaptiveFullErrorRate.
+func (o AdaptiveWeightOptions) factor(rate float64) float64 {
+	if !o.Enabled || rate <= o.ErrorThreshold {
+		return 1
+	}
+	f := 1 - (rate-o.ErrorThreshold)/(adaptiveFullErrorRate-o.ErrorThreshold)
+	return math.Max(f, o.MinFactor)
+}
+
+// errorRate is an exponentially weighted moving average of request failures
+type errorRate struct {
+	bits uint64 // float64 bits
+}
+
+func (e *errorRate) record(failed bool) {
+	const alpha = 2.0 / (adaptiveWindow + 1)
+	sample := 0.0
+	if failed {
+		sample = 1
+	}
+	for {
+		old := atomic.LoadUint64(&e.bits)
+		rate := math.Float64frombits(old)
+		next := rate + alpha*(sample-rate)
+		if atomic.CompareAndSwapUint64(&e.bits, old, math.Float64bits(next)) {
+			return
+		}
+	}
+}
+
+func (e *errorRate) value() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&e.bits))
+}
+
+// ErrorRate returns the backend's rolling error rate (0-1)
+func (b *Backend) ErrorRate() float64 {
+	return b.errors.value()
+}
+
+// SetAdaptiveWeight configures error rate based weight adjustment. It only
+// affects weighted selection.
+func (p *Pool) SetAdaptiveWeight(opts AdaptiveWeightOptions) {
+	if opts.ErrorThreshold < 0 || opts.ErrorThreshold >= adaptiveFullErrorRate {
+		opts.ErrorThreshold = DefaultAdaptiveErrorThreshold
+	}
+	if opts.MinFactor <= 0 || opts.MinFactor > 1 {
+		opts.MinFactor = DefaultAdaptiveMinFactor
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.adaptive = opts
+}
+
+// EffectiveWeight returns the weight weighted selection currently gives b:
+// its configured weight scaled down by its recent error rate when adaptive
+// weighting is enabled
+func (p *Pool) EffectiveWeight(b *Backend) float64 {
+	p.mu.RLock()
+	opts := p.adaptive
+	p.mu.RUnlock()
+	return float64(b.Weight) * opts.factor(b.ErrorRate())
+}
+
+// scaledWeight returns b's effective weight as an integer for selection,
+// never dropping a backend below 1
+func (o AdaptiveWeightOptions) scaledWeight(b *Backend) int {
+	w := int(float64(b.Weight) * weightScale * o.factor(b.ErrorRate()))
+	if w < 1 {
+		w = 1
+	}
+	return w
+}
@@ -0,0 +1,85 @@
+package proxy
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAdaptiveWeightFactor(t *testing.T) {
+	opts := AdaptiveWeightOptions{Enabled: true, ErrorThreshold: 0.1, MinFactor: 0.2}
+
+	tests := []struct {
+		rate float64
+		want float64
+	}{
+		{0, 1},
+		{0.1, 1},
+		{0.3, 0.5},
+		{0.5, 0.2},
+		{1, 0.2},
+	}
+	for _, tt := range tests {
+		if got := opts.factor(tt.rate); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("factor(%v) = %v, want %v", tt.rate, got, tt.want)
+		}
+	}
+
+	opts.Enabled = false
+	if got := opts.factor(1); got != 1 {
+		t.Errorf("expected disabled adaptive weighting to keep full weight, got %v", got)
+	}
+}
+
+func TestAdaptiveWeightShiftsTraffic(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ok.Close()
+
+	bad, _ := NewBackend("bad", failing.URL, 1)
+	good, _ := NewBackend("good", ok.URL, 1)
+
+	// Keep the circuit breaker closed so every failure reaches the backend
+	cbConfig := DefaultCircuitBreakerConfig()
+	cbConfig.FailureThreshold = 1000
+	bad.circuitBreaker = NewCircuitBreaker(cbConfig)
+
+	pool := NewPool()
+	pool.SetMode(Weighted)
+	pool.SetAdaptiveWeight(AdaptiveWeightOptions{Enabled: true, ErrorThreshold: 0.05, MinFactor: 0.1})
+	pool.Add(bad)
+	pool.Add(good)
+
+	for i := 0; i < 200; i++ {
+		bad.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+		good.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	}
+
+	if rate := bad.ErrorRate(); rate < 0.9 {
+		t.Errorf("expected failing backend error rate near 1, got %v", rate)
+	}
+	if rate := good.ErrorRate(); rate != 0 {
+		t.Errorf("expected healthy backend error rate 0, got %v", rate)
+	}
+	if w := pool.EffectiveWeight(bad); math.Abs(w-0.1) > 1e-9 {
+		t.Errorf("expected failing backend effective weight 0.1, got %v", w)
+	}
+	if w := pool.EffectiveWeight(good); w != 1 {
+		t.Errorf("expected healthy backend effective weight 1, got %v", w)
+	}
+
+	counts := make(map[string]int)
+	for i := 0; i < 1100; i++ {
+		counts[pool.NextBackend().Name]++
+	}
+	if counts["bad"] > 200 {
+		t.Errorf("expected failing backend to receive about 1/11 of traffic, got %d of 1100", counts["bad"])
+	}
+	if counts["bad"] == 0 {
+		t.Error("expected failing backend to keep some traffic")
+	}
+}
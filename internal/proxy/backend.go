@@ -1,10 +1,14 @@
 package proxy
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -15,24 +19,154 @@ type Backend struct {
 	Name            string
 	URL             *url.URL
 	Weight          int
+	Priority        int // failover tier; higher is preferred
 	HealthCheckPath string
 	proxy           *httputil.ReverseProxy
 	health          HealthStatus
 	healthMu        sync.RWMutex
 	circuitBreaker  *CircuitBreaker
+	xffMode         XFFMode
+	transport       *trackedTransport
+	sharedTransport bool
+	healthTransport http.RoundTripper // health check transport for backends with TLS settings
+	conns           connStats
+	errors          errorRate
+}
+
+// XFFMode controls how the X-Forwarded-For header is set on forwarded requests
+type XFFMode string
+
+const (
+	// XFFAppend appends the direct connection IP to any existing chain
+	XFFAppend XFFMode = "append"
+	// XFFOverwrite replaces the chain with the resolved client IP
+	XFFOverwrite XFFMode = "overwrite"
+	// XFFRemove strips X-Forwarded-For entirely
+	XFFRemove XFFMode = "remove"
+)
+
+// ParseXFFMode parses an XFF mode name; an empty string selects XFFAppend
+func ParseXFFMode(s string) (XFFMode, error) {
+	switch XFFMode(strings.ToLower(s)) {
+	case "", XFFAppend:
+		return XFFAppend, nil
+	case XFFOverwrite:
+		return XFFOverwrite, nil
+	case XFFRemove:
+		return XFFRemove, nil
+	default:
+		return "", fmt.Errorf("invalid XFF mode: %s", s)
+	}
+}
+
+type clientIPKey struct{}
+
+// WithClientIP returns a context carrying the resolved client IP, used by
+// XFFOverwrite in place of the direct connection address
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+// ClientIPFromContext returns the resolved client IP stored by WithClientIP
+func ClientIPFromContext(ctx context.Context) (string, bool) {
+	ip, ok := ctx.Value(clientIPKey{}).(string)
+	return ip, ok && ip != ""
+}
+
+// ErrorWriter writes an error response generated by the proxy itself
+type ErrorWriter func(w http.ResponseWriter, r *http.Request, status int)
+
+type errorWriterKey struct{}
+
+// WithErrorWriter returns a context carrying an ErrorWriter, used instead of
+// a bare status when the backend is unreachable, times out or has an open
+// circuit breaker
+func WithErrorWriter(ctx context.Context, ew ErrorWriter) context.Context {
+	return context.WithValue(ctx, errorWriterKey{}, ew)
+}
+
+// writeError writes status using the request's ErrorWriter, if any
+func writeError(w http.ResponseWriter, r *http.Request, status int) {
+	if ew, ok := r.Context().Value(errorWriterKey{}).(ErrorWriter); ok && ew != nil {
+		ew(w, r, status)
+		return
+	}
+	w.WriteHeader(status)
+}
+
+// Failure classifies why a backend failed to answer a request
+type Failure int
+
+const (
+	// FailureNone means the backend answered, whatever its status
+	FailureNone Failure = iota
+	// FailureTimeout means the backend did not answer in time (504)
+	FailureTimeout
+	// FailureConnection means the backend could not be reached or dropped
+	// the connection (502)
+	FailureConnection
+)
+
+func (f Failure) String() string {
+	switch f {
+	case FailureTimeout:
+		return "timeout"
+	case FailureConnection:
+		return "connection"
+	default:
+		return "none"
+	}
+}
+
+// Observer is told the outcome of each request proxied to a backend. status
+// is the status returned to the client, including 502 and 504 responses
+// generated by the proxy when the backend fails; failure tells why.
+type Observer func(backend string, status int, latency time.Duration, failure Failure)
+
+type observerKey struct{}
+
+// WithObserver returns a context carrying an Observer, called after every
+// backend attempt (including retries). Requests rejected by an open circuit
+// breaker never reach the backend and are not observed.
+func WithObserver(ctx context.Context, obs Observer) context.Context {
+	return context.WithValue(ctx, observerKey{}, obs)
+}
+
+type backendHeaderKey struct{}
+
+// WithBackendHeader returns a context asking the backend serving the request
+// to name itself in the response header header
+func WithBackendHeader(ctx context.Context, header string) context.Context {
+	return context.WithValue(ctx, backendHeaderKey{}, header)
 }
 
 // BackendOptions contains optional backend configuration
 type BackendOptions struct {
 	HealthCheckPath string
 	Timeout         time.Duration
+	XFFMode         XFFMode
+	PathRewrite     *PathRewrite // optional; the incoming request keeps its original path
+	Priority        int          // failover tier; higher is preferred
+	TLS             BackendTLS   // CA, client certificate and SNI for HTTPS backends
+
+	// Connection pool; zero values use the defaults
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	IdleConnTimeout     time.Duration
+	// ShareTransport pools connections with other backends that point at the
+	// same scheme and host and have identical pool and timeout settings
+	ShareTransport bool
 }
 
 // DefaultBackendOptions returns default backend options
 func DefaultBackendOptions() BackendOptions {
 	return BackendOptions{
-		HealthCheckPath: "/",
-		Timeout:         30 * time.Second,
+		HealthCheckPath:     "/",
+		Timeout:             30 * time.Second,
+		XFFMode:             XFFAppend,
+		MaxIdleConns:        DefaultMaxIdleConns,
+		MaxIdleConnsPerHost: DefaultMaxIdleConnsPerHost,
+		IdleConnTimeout:     DefaultIdleConnTimeout,
 	}
 }
 
@@ -61,26 +195,54 @@ func NewBackendWithOptions(name, rawURL string, weight int, opts BackendOptions)
 	if opts.Timeout <= 0 {
 		opts.Timeout = 30 * time.Second
 	}
+	if opts.XFFMode == "" {
+		opts.XFFMode = XFFAppend
+	}
+	if opts.MaxIdleConns <= 0 {
+		opts.MaxIdleConns = DefaultMaxIdleConns
+	}
+	if opts.MaxIdleConnsPerHost <= 0 {
+		opts.MaxIdleConnsPerHost = DefaultMaxIdleConnsPerHost
+	}
+	if opts.IdleConnTimeout <= 0 {
+		opts.IdleConnTimeout = DefaultIdleConnTimeout
+	}
+	tlsCfg, err := opts.TLS.clientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("backend %s TLS: %w", name, err)
+	}
 
 	b := &Backend{
 		Name:            name,
 		URL:             u,
 		Weight:          weight,
+		Priority:        opts.Priority,
 		HealthCheckPath: opts.HealthCheckPath,
+		xffMode:         opts.XFFMode,
 		health:          HealthStatus{Healthy: true}, // Assume healthy until checked
 		circuitBreaker:  NewCircuitBreaker(DefaultCircuitBreakerConfig()),
 	}
 
 	// Create reverse proxy with connection pooling and timeouts
-	transport := &http.Transport{
-		MaxIdleConns:          100,
-		MaxIdleConnsPerHost:   20,
-		IdleConnTimeout:       90 * time.Second,
-		TLSHandshakeTimeout:   10 * time.Second,
-		ResponseHeaderTimeout: opts.Timeout,
-		ExpectContinueTimeout: 1 * time.Second,
-		DisableCompression:    true, // Preserve original encoding
+	settings := transportSettings{
+		scheme:                u.Scheme,
+		host:                  u.Host,
+		maxIdleConns:          opts.MaxIdleConns,
+		maxIdleConnsPerHost:   opts.MaxIdleConnsPerHost,
+		idleConnTimeout:       opts.IdleConnTimeout,
+		responseHeaderTimeout: opts.Timeout,
+		tls:                   opts.TLS,
+	}
+	if opts.ShareTransport {
+		b.transport = sharedTransport(settings, tlsCfg)
+		b.sharedTransport = true
+	} else {
+		b.transport = newTrackedTransport(settings, tlsCfg)
 	}
+	if tlsCfg != nil {
+		b.healthTransport = &http.Transport{TLSClientConfig: tlsCfg, DisableKeepAlives: true}
+	}
+	transport := b.transport
 
 	b.proxy = &httputil.ReverseProxy{
 		Director: func(req *http.Request) {
@@ -88,6 +250,12 @@ func NewBackendWithOptions(name, rawURL string, weight int, opts BackendOptions)
 			req.URL.Host = u.Host
 			req.Host = u.Host
 
+			// req is the proxy's copy, so the original path stays available
+			// to the gateway for logging
+			if opts.PathRewrite != nil {
+				opts.PathRewrite.apply(req)
+			}
+
 			// Remove hop-by-hop headers
 			req.Header.Del("Connection")
 			req.Header.Del("Proxy-Connection")
@@ -98,6 +266,15 @@ func NewBackendWithOptions(name, rawURL string, weight int, opts BackendOptions)
 			req.Header.Del("Trailers")
 			req.Header.Del("Transfer-Encoding")
 			req.Header.Del("Upgrade")
+
+			// ReverseProxy appends the client address to X-Forwarded-For after
+			// the Director runs; a nil value suppresses that entirely
+			switch opts.XFFMode {
+			case XFFOverwrite:
+				req.Header.Del("X-Forwarded-For")
+			case XFFRemove:
+				req.Header["X-Forwarded-For"] = nil
+			}
 		},
 		ModifyResponse: func(resp *http.Response) error {
 			// Strip sensitive backend headers that could leak information
@@ -111,8 +288,24 @@ func NewBackendWithOptions(name, rawURL string, weight int, opts BackendOptions)
 		},
 		Transport: transport,
 		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
-			// Return 502 Bad Gateway on backend error
-			w.WriteHeader(http.StatusBadGateway)
+			// A body over the gateway's size limit is the client's fault,
+			// not the backend's
+			var maxErr *http.MaxBytesError
+			if errors.As(err, &maxErr) {
+				writeError(w, r, http.StatusRequestEntityTooLarge)
+				return
+			}
+			failure := classifyError(r, err)
+			if rw, ok := w.(*responseWrapper); ok {
+				rw.failure = failure
+			}
+			// Return 504 Gateway Timeout when the backend was too slow
+			if failure == FailureTimeout {
+				writeError(w, r, http.StatusGatewayTimeout)
+				return
+			}
+			// Return 502 Bad Gateway on other backend errors
+			writeError(w, r, http.StatusBadGateway)
 		},
 	}
 
@@ -121,22 +314,88 @@ func NewBackendWithOptions(name, rawURL string, weight int, opts BackendOptions)
 
 // ServeHTTP proxies the request to the backend
 func (b *Backend) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if header, ok := r.Context().Value(backendHeaderKey{}).(string); ok && header != "" {
+		w.Header().Set(header, b.Name)
+	}
+
 	// Check circuit breaker
 	if !b.circuitBreaker.Allow() {
-		w.WriteHeader(http.StatusServiceUnavailable)
+		writeError(w, r, http.StatusServiceUnavailable)
 		return
 	}
 
+	// In overwrite mode the proxy appends the resolved client IP to an
+	// emptied chain instead of the direct connection address
+	if b.xffMode == XFFOverwrite {
+		if ip, ok := ClientIPFromContext(r.Context()); ok {
+			r = withRemoteIP(r, ip)
+		}
+	}
+
 	// Use a custom response writer to capture the status
 	wrapper := &responseWrapper{ResponseWriter: w, statusCode: http.StatusOK}
-	b.proxy.ServeHTTP(wrapper, r)
+	start := time.Now()
+	atomic.AddInt64(&b.conns.inFlight, 1)
+	b.proxy.ServeHTTP(wrapper, b.conns.withConnTrace(r))
+	atomic.AddInt64(&b.conns.inFlight, -1)
+
+	// A deadline hit after headers were sent still counts as a timeout
+	failure := wrapper.failure
+	if failure == FailureNone && errors.Is(r.Context().Err(), context.DeadlineExceeded) {
+		failure = FailureTimeout
+	}
+
+	if obs, ok := r.Context().Value(observerKey{}).(Observer); ok && obs != nil {
+		obs(b.Name, wrapper.statusCode, time.Since(start), failure)
+	}
 
-	// Record success/failure based on status code
-	if wrapper.statusCode >= 500 || wrapper.statusCode == http.StatusBadGateway {
+	// Record success/failure based on the failure kind and status code
+	switch {
+	case failure == FailureTimeout:
+		b.circuitBreaker.RecordTimeout()
+		b.errors.record(true)
+	case failure == FailureConnection:
+		b.circuitBreaker.RecordConnectionError()
+		b.errors.record(true)
+	case wrapper.statusCode >= 500:
 		b.circuitBreaker.RecordFailure()
-	} else {
+		b.errors.record(true)
+	default:
 		b.circuitBreaker.RecordSuccess()
+		b.errors.record(false)
+	}
+}
+
+// withRemoteIP returns a shallow copy of r whose RemoteAddr uses the given IP
+func withRemoteIP(r *http.Request, ip string) *http.Request {
+	_, port, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		port = "0"
+	}
+	r = r.WithContext(r.Context())
+	r.RemoteAddr = net.JoinHostPort(ip, port)
+	return r
+}
+
+// isTimeout reports whether a proxy error was caused by a deadline or timeout
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// classifyError tells a slow backend from an unreachable one. Errors after
+// the client went away are not the backend's fault.
+func classifyError(r *http.Request, err error) Failure {
+	if isTimeout(err) {
+		return FailureTimeout
+	}
+	if errors.Is(err, context.Canceled) && r.Context().Err() != nil {
+		return FailureNone
 	}
+	return FailureConnection
 }
 
 // responseWrapper wraps ResponseWriter to capture status code
@@ -144,6 +403,7 @@ type responseWrapper struct {
 	http.ResponseWriter
 	statusCode int
 	written    bool
+	failure    Failure // set by the proxy's ErrorHandler
 }
 
 func (rw *responseWrapper) WriteHeader(code int) {
@@ -180,6 +440,8 @@ func (b *Backend) ResetCircuitBreaker() {
 type Pool struct {
 	backends   []*Backend
 	currentIdx uint64
+	mode       BalanceMode
+	adaptive   AdaptiveWeightOptions
 	mu         sync.RWMutex
 }
 
@@ -1,9 +1,11 @@
 package proxy
 
 import (
+	"context"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 )
@@ -296,3 +298,129 @@ func TestBackendWithOptionsZeroTimeout(t *testing.T) {
 		t.Error("expected backend to be created")
 	}
 }
+
+func TestBackendRequestDeadline(t *testing.T) {
+	backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(2 * time.Second):
+		case <-r.Context().Done():
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backendServer.Close()
+
+	b, _ := NewBackend("slow", backendServer.URL, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	req := httptest.NewRequest("GET", "/", nil).WithContext(ctx)
+	rr := httptest.NewRecorder()
+	b.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusGatewayTimeout {
+		t.Errorf("expected status 504, got %d", rr.Code)
+	}
+	if stats := b.CircuitBreakerStats(); stats.Failures != 1 {
+		t.Errorf("expected timeout to count as circuit breaker failure, got %d failures", stats.Failures)
+	}
+}
+
+func TestBackendFailureClassification(t *testing.T) {
+	slowServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(2 * time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer slowServer.Close()
+
+	// A closed server refuses connections
+	downServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	downServer.Close()
+
+	slow, _ := NewBackendWithOptions("slow", slowServer.URL, 1, BackendOptions{Timeout: 50 * time.Millisecond})
+	down, _ := NewBackend("down", downServer.URL, 1)
+
+	tests := []struct {
+		backend *Backend
+		status  int
+		failure Failure
+	}{
+		{slow, http.StatusGatewayTimeout, FailureTimeout},
+		{down, http.StatusBadGateway, FailureConnection},
+	}
+
+	for _, tc := range tests {
+		var observed Failure
+		ctx := WithObserver(context.Background(), func(_ string, _ int, _ time.Duration, failure Failure) {
+			observed = failure
+		})
+		rr := httptest.NewRecorder()
+		tc.backend.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil).WithContext(ctx))
+
+		if rr.Code != tc.status {
+			t.Errorf("%s: expected status %d, got %d", tc.backend.Name, tc.status, rr.Code)
+		}
+		if observed != tc.failure {
+			t.Errorf("%s: expected failure %s, got %s", tc.backend.Name, tc.failure, observed)
+		}
+	}
+
+	if stats := slow.CircuitBreakerStats(); stats.Timeouts != 1 || stats.ConnErrors != 0 {
+		t.Errorf("expected one timeout on slow backend, got %+v", stats)
+	}
+	if stats := down.CircuitBreakerStats(); stats.Timeouts != 0 || stats.ConnErrors != 1 {
+		t.Errorf("expected one connection error on down backend, got %+v", stats)
+	}
+}
+
+func TestBackendXFFModes(t *testing.T) {
+	var got []string
+	backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Values("X-Forwarded-For")
+	}))
+	defer backendServer.Close()
+
+	tests := []struct {
+		mode XFFMode
+		want string
+	}{
+		{XFFAppend, "198.51.100.7, 10.0.0.1"},
+		{XFFOverwrite, "203.0.113.9"},
+		{XFFRemove, ""},
+	}
+
+	for _, tc := range tests {
+		opts := DefaultBackendOptions()
+		opts.XFFMode = tc.mode
+		b, err := NewBackendWithOptions("test", backendServer.URL, 1, opts)
+		if err != nil {
+			t.Fatalf("failed to create backend: %v", err)
+		}
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = "10.0.0.1:12345"
+		req.Header.Set("X-Forwarded-For", "198.51.100.7")
+		req = req.WithContext(WithClientIP(req.Context(), "203.0.113.9"))
+
+		got = nil
+		b.ServeHTTP(httptest.NewRecorder(), req)
+
+		if joined := strings.Join(got, ", "); joined != tc.want {
+			t.Errorf("%s: expected X-Forwarded-For %q, got %q", tc.mode, tc.want, joined)
+		}
+	}
+}
+
+func TestParseXFFMode(t *testing.T) {
+	if mode, err := ParseXFFMode(""); err != nil || mode != XFFAppend {
+		t.Errorf("expected empty mode to default to append, got %q (%v)", mode, err)
+	}
+	if mode, err := ParseXFFMode("Overwrite"); err != nil || mode != XFFOverwrite {
+		t.Errorf("expected overwrite, got %q (%v)", mode, err)
+	}
+	if _, err := ParseXFFMode("replace"); err == nil {
+		t.Error("expected error for invalid mode")
+	}
+}
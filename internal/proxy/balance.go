@@ -0,0 +1,111 @@
+package proxy
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// BalanceMode selects how a pool spreads requests across its backends
+type BalanceMode string
+
+const (
+	// RoundRobin rotates across healthy backends (default)
+	RoundRobin BalanceMode = "round_robin"
+	// Failover sends all traffic to the healthy backends with the highest
+	// priority, using lower tiers only when every higher tier is down
+	Failover BalanceMode = "failover"
+	// Weighted spreads healthy backends' traffic in proportion to their
+	// weights, optionally scaled down by recent error rates
+	Weighted BalanceMode = "weighted"
+)
+
+// ParseBalanceMode parses a configured balance mode. An empty string
+// selects RoundRobin.
+func ParseBalanceMode(s string) (BalanceMode, error) {
+	switch BalanceMode(strings.ToLower(s)) {
+	case "", RoundRobin:
+		return RoundRobin, nil
+	case Failover:
+		return Failover, nil
+	case Weighted:
+		return Weighted, nil
+	default:
+		return "", fmt.Errorf("invalid load balancing mode %q (expected round_robin, failover or weighted)", s)
+	}
+}
+
+// SetMode sets the pool's balance mode
+func (p *Pool) SetMode(mode BalanceMode) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.mode = mode
+}
+
+// Mode returns the pool's balance mode
+func (p *Pool) Mode() BalanceMode {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.mode == "" {
+		return RoundRobin
+	}
+	return p.mode
+}
+
+// NextBackend returns the next backend according to the pool's balance mode
+func (p *Pool) NextBackend() *Backend {
+	switch p.Mode() {
+	case Failover:
+		return p.NextFailover()
+	case Weighted:
+		return p.NextWeighted()
+	}
+	return p.NextHealthy()
+}
+
+// NextFailover returns a healthy backend from the highest priority tier that
+// has one, rotating between backends of equal priority. A backend whose
+// circuit breaker is open counts as unavailable. If no backend is available
+// the highest priority backend is returned as a fallback.
+func (p *Pool) NextFailover() *Backend {
+	p.mu.RLock()
+	backends := p.backends
+	p.mu.RUnlock()
+
+	if len(backends) == 0 {
+		return nil
+	}
+
+	ordered := failoverOrder(backends, atomic.AddUint64(&p.currentIdx, 1)-1)
+	for _, b := range ordered {
+		if b.IsHealthy() && b.CircuitBreakerState() != CircuitOpen {
+			return b
+		}
+	}
+	return ordered[0]
+}
+
+// failoverOrder returns backends sorted by descending priority, with each
+// tier rotated by counter so equal-priority backends share the load
+func failoverOrder(backends []*Backend, counter uint64) []*Backend {
+	ordered := make([]*Backend, len(backends))
+	copy(ordered, backends)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].Priority > ordered[j].Priority
+	})
+
+	for start := 0; start < len(ordered); {
+		end := start + 1
+		for end < len(ordered) && ordered[end].Priority == ordered[start].Priority {
+			end++
+		}
+		if n := end - start; n > 1 {
+			tier := append([]*Backend(nil), ordered[start:end]...)
+			shift := int(counter % uint64(n))
+			copy(ordered[start:end], append(tier[shift:], tier[:shift]...))
+		}
+		start = end
+	}
+	return ordered
+}
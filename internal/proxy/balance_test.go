@@ -0,0 +1,122 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func failoverTestPool(t *testing.T, priorities map[string]int, names ...string) *Pool {
+	t.Helper()
+	pool := NewPool()
+	pool.SetMode(Failover)
+	for _, name := range names {
+		opts := DefaultBackendOptions()
+		opts.Priority = priorities[name]
+		b, err := NewBackendWithOptions(name, "http://127.0.0.1:8080", 1, opts)
+		if err != nil {
+			t.Fatalf("failed to create backend: %v", err)
+		}
+		pool.Add(b)
+	}
+	return pool
+}
+
+func TestParseBalanceMode(t *testing.T) {
+	for in, want := range map[string]BalanceMode{"": RoundRobin, "round_robin": RoundRobin, "FAILOVER": Failover, "weighted": Weighted} {
+		got, err := ParseBalanceMode(in)
+		if err != nil || got != want {
+			t.Errorf("ParseBalanceMode(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseBalanceMode("random"); err == nil {
+		t.Error("expected error for unknown mode")
+	}
+}
+
+func TestPoolNextFailover(t *testing.T) {
+	// Configured order should not matter, only priority
+	pool := failoverTestPool(t, map[string]int{"primary": 10, "standby": 0}, "standby", "primary")
+
+	for i := 0; i < 5; i++ {
+		if b := pool.NextBackend(); b.Name != "primary" {
+			t.Fatalf("expected primary while healthy, got %s", b.Name)
+		}
+	}
+
+	pool.Get("primary").SetHealthy(false)
+	if b := pool.NextBackend(); b.Name != "standby" {
+		t.Errorf("expected standby when primary is down, got %s", b.Name)
+	}
+
+	pool.Get("primary").SetHealthy(true)
+	if b := pool.NextBackend(); b.Name != "primary" {
+		t.Errorf("expected traffic to return to primary, got %s", b.Name)
+	}
+
+	// An open circuit breaker also fails over
+	primary := pool.Get("primary")
+	for i := 0; i < DefaultCircuitBreakerConfig().FailureThreshold; i++ {
+		primary.circuitBreaker.RecordFailure()
+	}
+	if b := pool.NextBackend(); b.Name != "standby" {
+		t.Errorf("expected standby when primary circuit is open, got %s", b.Name)
+	}
+
+	// Nothing available: fall back to the highest priority backend
+	pool.Get("standby").SetHealthy(false)
+	if b := pool.NextBackend(); b.Name != "primary" {
+		t.Errorf("expected fallback to primary, got %s", b.Name)
+	}
+}
+
+func TestPoolNextFailoverRotatesWithinTier(t *testing.T) {
+	pool := failoverTestPool(t, map[string]int{"a": 1, "b": 1}, "a", "b", "standby")
+
+	counts := make(map[string]int)
+	for i := 0; i < 10; i++ {
+		counts[pool.NextFailover().Name]++
+	}
+	if counts["a"] != 5 || counts["b"] != 5 || counts["standby"] != 0 {
+		t.Errorf("expected even split across the top tier, got %v", counts)
+	}
+}
+
+func TestServeHTTPWithRetryFailoverOrder(t *testing.T) {
+	var order []string
+	server := func(name string, status int) *httptest.Server {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			order = append(order, name)
+			w.WriteHeader(status)
+		}))
+		t.Cleanup(s.Close)
+		return s
+	}
+
+	pool := NewPool()
+	pool.SetMode(Failover)
+	for _, bc := range []struct {
+		name     string
+		priority int
+		status   int
+	}{
+		{"standby", 0, http.StatusOK},
+		{"secondary", 5, http.StatusBadGateway},
+		{"primary", 10, http.StatusBadGateway},
+	} {
+		opts := DefaultBackendOptions()
+		opts.Priority = bc.priority
+		b, _ := NewBackendWithOptions(bc.name, server(bc.name, bc.status).URL, 1, opts)
+		pool.Add(b)
+	}
+
+	rr := httptest.NewRecorder()
+	pool.ServeHTTPWithRetryOptions(rr, httptest.NewRequest("GET", "/", nil), RetryOptions{MaxRetries: 2})
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected standby to answer, got %d", rr.Code)
+	}
+	if len(order) != 3 || order[0] != "primary" || order[1] != "secondary" || order[2] != "standby" {
+		t.Errorf("expected retries in priority order, got %v", order)
+	}
+}
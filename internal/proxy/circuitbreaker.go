@@ -1,6 +1,7 @@
 package proxy
 
 import (
+	"math/rand"
 	"sync"
 	"time"
 )
@@ -38,8 +39,15 @@ type CircuitBreakerConfig struct {
 	SuccessThreshold int
 	// Timeout is how long to wait before transitioning from open to half-open
 	Timeout time.Duration
+	// RecoveryRampUp is how long after closing from half-open the share of
+	// requests allowed grows linearly to all of them, so a recovering backend
+	// is not hit with full traffic at once. Zero disables the ramp.
+	RecoveryRampUp time.Duration
 }
 
+// rampUpMinFraction is the share of requests allowed when a ramp-up starts
+const rampUpMinFraction = 0.1
+
 // DefaultCircuitBreakerConfig returns sensible defaults
 func DefaultCircuitBreakerConfig() CircuitBreakerConfig {
 	return CircuitBreakerConfig{
@@ -51,12 +59,16 @@ func DefaultCircuitBreakerConfig() CircuitBreakerConfig {
 
 // CircuitBreaker implements the circuit breaker pattern
 type CircuitBreaker struct {
-	config           CircuitBreakerConfig
-	state            CircuitState
-	failures         int
-	successes        int
-	lastStateChange  time.Time
-	mu               sync.RWMutex
+	config          CircuitBreakerConfig
+	state           CircuitState
+	failures        int
+	successes       int
+	lastStateChange time.Time
+	timeouts        int64          // backend timeouts since the last reset
+	connErrors      int64          // backend connection errors since the last reset
+	recovering      bool           // closed from half-open, ramping up
+	random          func() float64 // source for ramp-up admission
+	mu              sync.RWMutex
 }
 
 // NewCircuitBreaker creates a new circuit breaker
@@ -65,6 +77,7 @@ func NewCircuitBreaker(cfg CircuitBreakerConfig) *CircuitBreaker {
 		config:          cfg,
 		state:           CircuitClosed,
 		lastStateChange: time.Now(),
+		random:          rand.Float64,
 	}
 }
 
@@ -75,6 +88,14 @@ func (cb *CircuitBreaker) Allow() bool {
 
 	switch cb.state {
 	case CircuitClosed:
+		if cb.recovering {
+			fraction := cb.rampUpFraction()
+			if fraction >= 1 {
+				cb.recovering = false
+				return true
+			}
+			return cb.random() < fraction
+		}
 		return true
 	case CircuitOpen:
 		// Check if timeout has elapsed
@@ -93,6 +114,23 @@ func (cb *CircuitBreaker) Allow() bool {
 	}
 }
 
+// rampUpFraction returns the share of requests allowed at this point of
+// the recovery ramp-up
+func (cb *CircuitBreaker) rampUpFraction() float64 {
+	if cb.config.RecoveryRampUp <= 0 {
+		return 1
+	}
+	elapsed := time.Since(cb.lastStateChange)
+	if elapsed >= cb.config.RecoveryRampUp {
+		return 1
+	}
+	fraction := float64(elapsed) / float64(cb.config.RecoveryRampUp)
+	if fraction < rampUpMinFraction {
+		fraction = rampUpMinFraction
+	}
+	return fraction
+}
+
 // RecordSuccess records a successful request
 func (cb *CircuitBreaker) RecordSuccess() {
 	cb.mu.Lock()
@@ -107,6 +145,7 @@ func (cb *CircuitBreaker) RecordSuccess() {
 			cb.state = CircuitClosed
 			cb.lastStateChange = time.Now()
 			cb.successes = 0
+			cb.recovering = cb.config.RecoveryRampUp > 0
 		}
 	case CircuitClosed:
 		// Already closed, nothing to do
@@ -126,6 +165,7 @@ func (cb *CircuitBreaker) RecordFailure() {
 		if cb.failures >= cb.config.FailureThreshold {
 			cb.state = CircuitOpen
 			cb.lastStateChange = time.Now()
+			cb.recovering = false
 		}
 	case CircuitHalfOpen:
 		// Any failure in half-open goes back to open
@@ -135,6 +175,23 @@ func (cb *CircuitBreaker) RecordFailure() {
 	}
 }
 
+// RecordTimeout records a request the backend did not answer in time
+func (cb *CircuitBreaker) RecordTimeout() {
+	cb.mu.Lock()
+	cb.timeouts++
+	cb.mu.Unlock()
+	cb.RecordFailure()
+}
+
+// RecordConnectionError records a request that failed because the backend
+// could not be reached or dropped the connection
+func (cb *CircuitBreaker) RecordConnectionError() {
+	cb.mu.Lock()
+	cb.connErrors++
+	cb.mu.Unlock()
+	cb.RecordFailure()
+}
+
 // State returns the current state
 func (cb *CircuitBreaker) State() CircuitState {
 	cb.mu.RLock()
@@ -150,6 +207,8 @@ func (cb *CircuitBreaker) Stats() CircuitBreakerStats {
 		State:           cb.state,
 		Failures:        cb.failures,
 		Successes:       cb.successes,
+		Timeouts:        cb.timeouts,
+		ConnErrors:      cb.connErrors,
 		LastStateChange: cb.lastStateChange,
 	}
 }
@@ -159,6 +218,8 @@ type CircuitBreakerStats struct {
 	State           CircuitState
 	Failures        int
 	Successes       int
+	Timeouts        int64 // backend timeouts since the last reset
+	ConnErrors      int64 // backend connection errors since the last reset
 	LastStateChange time.Time
 }
 
@@ -170,5 +231,8 @@ func (cb *CircuitBreaker) Reset() {
 	cb.state = CircuitClosed
 	cb.failures = 0
 	cb.successes = 0
+	cb.timeouts = 0
+	cb.connErrors = 0
+	cb.recovering = false
 	cb.lastStateChange = time.Now()
 }
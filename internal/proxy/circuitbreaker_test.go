@@ -232,3 +232,53 @@ func TestSuccessResetsFailureCount(t *testing.T) {
 		t.Errorf("expected open state after 3 consecutive failures, got %v", cb.State())
 	}
 }
+
+func TestCircuitBreakerRecoveryRampUp(t *testing.T) {
+	cfg := CircuitBreakerConfig{
+		FailureThreshold: 2,
+		SuccessThreshold: 1,
+		Timeout:          20 * time.Millisecond,
+		RecoveryRampUp:   200 * time.Millisecond,
+	}
+	cb := NewCircuitBreaker(cfg)
+	roll := 0.5
+	cb.random = func() float64 { return roll }
+
+	// Open, then close from half-open
+	cb.RecordFailure()
+	cb.RecordFailure()
+	time.Sleep(30 * time.Millisecond)
+	cb.Allow()
+	cb.RecordSuccess()
+
+	if cb.State() != CircuitClosed {
+		t.Fatalf("expected closed state, got %v", cb.State())
+	}
+
+	// Early in the ramp only a small share of requests is allowed
+	if cb.Allow() {
+		t.Error("expected request to be rejected early in the ramp-up")
+	}
+	roll = 0.05
+	if !cb.Allow() {
+		t.Error("expected request within the ramp-up fraction to be allowed")
+	}
+
+	// After the ramp every request is allowed
+	time.Sleep(210 * time.Millisecond)
+	roll = 0.99
+	if !cb.Allow() {
+		t.Error("expected request to be allowed after the ramp-up")
+	}
+
+	// Reset ends a ramp-up
+	cb.RecordFailure()
+	cb.RecordFailure()
+	time.Sleep(30 * time.Millisecond)
+	cb.Allow()
+	cb.RecordSuccess()
+	cb.Reset()
+	if !cb.Allow() {
+		t.Error("expected request to be allowed after reset")
+	}
+}
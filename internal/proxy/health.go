@@ -1,43 +1,58 @@
 package proxy
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"io"
+	"math/rand"
 	"net/http"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 )
 
+// DefaultHealthConcurrency is the default number of backends checked at once
+const DefaultHealthConcurrency = 10
+
 // HealthConfig configures health checking
 type HealthConfig struct {
-	Enabled  bool
-	Interval time.Duration
-	Timeout  time.Duration
-	Path     string // Health check endpoint path (e.g., "/health")
+	Enabled     bool
+	Interval    time.Duration
+	Timeout     time.Duration
+	Path        string // Health check endpoint path (e.g., "/health")
+	Concurrency int    // backends checked at once (default: 10)
 }
 
 // DefaultHealthConfig returns default health check settings
 func DefaultHealthConfig() HealthConfig {
 	return HealthConfig{
-		Enabled:  true,
-		Interval: 10 * time.Second,
-		Timeout:  5 * time.Second,
-		Path:     "/",
+		Enabled:     true,
+		Interval:    10 * time.Second,
+		Timeout:     5 * time.Second,
+		Path:        "/",
+		Concurrency: DefaultHealthConcurrency,
 	}
 }
 
 // HealthChecker performs health checks on backends
 type HealthChecker struct {
-	pool     *Pool
-	config   HealthConfig
-	client   *http.Client
-	stop     chan struct{}
-	running  bool
-	mu       sync.Mutex
+	pool    *Pool
+	config  HealthConfig
+	client  *http.Client
+	stop    chan struct{}
+	running bool
+	mu      sync.Mutex
+
+	checking int32 // atomic flag set while a check cycle runs
 }
 
 // NewHealthChecker creates a new health checker
 func NewHealthChecker(pool *Pool, config HealthConfig) *HealthChecker {
+	if config.Concurrency <= 0 {
+		config.Concurrency = DefaultHealthConcurrency
+	}
 	return &HealthChecker{
 		pool:   pool,
 		config: config,
@@ -72,6 +87,12 @@ func (hc *HealthChecker) Start() {
 			select {
 			case <-ticker.C:
 				hc.checkAll()
+				// A cycle that ran past the interval leaves a tick queued;
+				// drop it so the next cycle waits for the following tick
+				select {
+				case <-ticker.C:
+				default:
+				}
 			case <-hc.stop:
 				return
 			}
@@ -91,15 +112,32 @@ func (hc *HealthChecker) Stop() {
 	close(hc.stop)
 }
 
+// checkAll checks every backend, at most config.Concurrency at a time. It
+// returns at once if another cycle is still running.
 func (hc *HealthChecker) checkAll() {
+	if !atomic.CompareAndSwapInt32(&hc.checking, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&hc.checking, 0)
+
 	hc.pool.mu.RLock()
 	backends := hc.pool.backends
 	hc.pool.mu.RUnlock()
 
+	sem := make(chan struct{}, hc.config.Concurrency)
+	var wg sync.WaitGroup
 	for _, b := range backends {
-		healthy := hc.check(b)
-		b.SetHealthy(healthy)
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(b *Backend) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			b.SetHealthy(hc.check(b))
+		}(b)
 	}
+	wg.Wait()
 }
 
 func (hc *HealthChecker) check(b *Backend) bool {
@@ -118,7 +156,16 @@ func (hc *HealthChecker) check(b *Backend) bool {
 		return false
 	}
 
-	resp, err := hc.client.Do(req)
+	// Backends with TLS settings are checked with their CA and client
+	// certificate, so a private CA does not mark them unhealthy
+	client := hc.client
+	if b.healthTransport != nil {
+		c := *hc.client
+		c.Transport = b.healthTransport
+		client = &c
+	}
+
+	resp, err := client.Do(req)
 	if err != nil {
 		return false
 	}
@@ -210,6 +257,20 @@ func (p *Pool) HealthyCount() int {
 	return count
 }
 
+// HasAvailable reports whether any backend is healthy with a circuit
+// breaker that is not open
+func (p *Pool) HasAvailable() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	for _, b := range p.backends {
+		if b.IsHealthy() && b.CircuitBreakerState() != CircuitOpen {
+			return true
+		}
+	}
+	return false
+}
+
 // GetHealthStatuses returns health status for all backends
 func (p *Pool) GetHealthStatuses() map[string]HealthStatus {
 	p.mu.RLock()
@@ -222,6 +283,43 @@ func (p *Pool) GetHealthStatuses() map[string]HealthStatus {
 	return statuses
 }
 
+// InheritState takes over the health status and circuit breaker of the
+// backends in prev with the same name and URL, so a pool rebuilt on reload
+// does not send traffic to a backend already known to be down until the
+// next health check. It must be called before the pool serves requests and
+// returns the number of backends whose state was carried over.
+func (p *Pool) InheritState(prev *Pool) int {
+	if prev == nil {
+		return 0
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	prev.mu.RLock()
+	defer prev.mu.RUnlock()
+
+	inherited := 0
+	for _, b := range p.backends {
+		for _, old := range prev.backends {
+			if old.Name == b.Name && old.URL.String() == b.URL.String() {
+				b.inheritState(old)
+				inherited++
+				break
+			}
+		}
+	}
+	return inherited
+}
+
+// inheritState copies the health status of prev and shares its circuit
+// breaker, which requests still in flight on prev keep updating
+func (b *Backend) inheritState(prev *Backend) {
+	health := prev.GetHealthStatus()
+	b.healthMu.Lock()
+	b.health = health
+	b.healthMu.Unlock()
+	b.circuitBreaker = prev.circuitBreaker
+}
+
 // NextWeighted returns a backend using weighted selection (healthy only)
 func (p *Pool) NextWeighted() *Backend {
 	p.mu.RLock()
@@ -231,11 +329,16 @@ func (p *Pool) NextWeighted() *Backend {
 		return nil
 	}
 
-	// Calculate total weight of healthy backends
+	// Calculate total weight of healthy backends. With adaptive weighting
+	// the configured weights are scaled so fractions survive.
+	weight := func(b *Backend) int { return b.Weight }
+	if p.adaptive.Enabled {
+		weight = p.adaptive.scaledWeight
+	}
 	totalWeight := 0
 	for _, b := range p.backends {
 		if b.IsHealthy() {
-			totalWeight += b.Weight
+			totalWeight += weight(b)
 		}
 	}
 
@@ -245,16 +348,22 @@ func (p *Pool) NextWeighted() *Backend {
 		return p.backends[idx%len(p.backends)]
 	}
 
-	// Weighted selection
-	counter := atomic.AddUint64(&p.currentIdx, 1)
-	target := int(counter % uint64(totalWeight))
+	// Weighted selection. Scaled weights make a counter cycle too long to
+	// share traffic proportionally over short spans, so pick at random.
+	var target int
+	if p.adaptive.Enabled {
+		target = rand.Intn(totalWeight)
+	} else {
+		counter := atomic.AddUint64(&p.currentIdx, 1)
+		target = int(counter % uint64(totalWeight))
+	}
 
 	cumulative := 0
 	for _, b := range p.backends {
 		if !b.IsHealthy() {
 			continue
 		}
-		cumulative += b.Weight
+		cumulative += weight(b)
 		if target < cumulative {
 			return b
 		}
@@ -264,99 +373,288 @@ func (p *Pool) NextWeighted() *Backend {
 	return p.backends[0]
 }
 
-// ServeHTTPWithRetry attempts to serve a request, retrying with different backends on failure
-// Returns the backend that successfully handled the request, or nil if all attempts failed
+// DefaultRetryMethods are the idempotent methods that are retried by default
+var DefaultRetryMethods = []string{"GET", "HEAD", "PUT", "DELETE", "OPTIONS"}
+
+// DefaultMaxRetryBody is the largest request body buffered so the request
+// can be retried (10MB)
+const DefaultMaxRetryBody = 10 << 20
+
+// RetryOptions configures retrying failed requests on other backends
+type RetryOptions struct {
+	MaxRetries int           // additional attempts after the first
+	Backoff    time.Duration // delay before the first retry, doubled for each further retry
+	Methods    []string      // methods eligible for retry
+
+	// MaxBody is the largest request body buffered for retries; larger
+	// bodies are streamed to a single backend without retry
+	// (default: DefaultMaxRetryBody)
+	MaxBody int64
+}
+
+// DefaultRetryOptions returns default retry settings
+func DefaultRetryOptions() RetryOptions {
+	return RetryOptions{
+		MaxRetries: 1,
+		Backoff:    50 * time.Millisecond,
+		Methods:    DefaultRetryMethods,
+		MaxBody:    DefaultMaxRetryBody,
+	}
+}
+
+// ServeHTTPWithRetry attempts to serve a request, retrying with different backends on failure.
+// maxRetries is the total number of attempts; only idempotent methods are retried.
+// Returns the backend that handled the final attempt, or nil if no backend was available.
 func (p *Pool) ServeHTTPWithRetry(w http.ResponseWriter, r *http.Request, maxRetries int) *Backend {
+	opts := DefaultRetryOptions()
+	opts.MaxRetries = maxRetries - 1
+	return p.ServeHTTPWithRetryOptions(w, r, opts)
+}
+
+// ServeHTTPWithRetryOptions serves a request, retrying 5xx responses on other
+// healthy backends whose circuit breaker allows traffic. Failed responses are
+// held back while a retry is still possible, so the client only sees the
+// final attempt. Returns the backend that handled the final attempt, or nil
+// if no backend was available.
+func (p *Pool) ServeHTTPWithRetryOptions(w http.ResponseWriter, r *http.Request, opts RetryOptions) *Backend {
 	p.mu.RLock()
 	backends := p.backends
+	mode := p.mode
 	p.mu.RUnlock()
 
 	if len(backends) == 0 {
 		return nil
 	}
 
-	if maxRetries <= 0 {
-		maxRetries = 1
+	attempts := 1
+	if opts.MaxRetries > 0 && isRetryMethod(r.Method, opts.Methods) {
+		attempts += opts.MaxRetries
 	}
-	if maxRetries > len(backends) {
-		maxRetries = len(backends)
+	if attempts > len(backends) {
+		attempts = len(backends)
 	}
 
-	tried := make(map[string]bool)
-	start := int(atomic.AddUint64(&p.currentIdx, 1)) - 1
-
-	for attempt := 0; attempt < maxRetries; attempt++ {
-		// Find a healthy backend we haven't tried yet
-		var backend *Backend
-		for i := 0; i < len(backends); i++ {
-			idx := (start + attempt + i) % len(backends)
-			b := backends[idx]
-			if !tried[b.Name] && b.IsHealthy() && b.circuitBreaker.Allow() {
-				backend = b
-				break
+	// Buffer the body so every attempt sends the same payload. Bodies too
+	// large to buffer are streamed to one backend instead.
+	var body []byte
+	if attempts > 1 && r.Body != nil && r.Body != http.NoBody {
+		maxBody := opts.MaxBody
+		if maxBody <= 0 {
+			maxBody = DefaultMaxRetryBody
+		}
+		var err error
+		if r.ContentLength <= maxBody {
+			body, err = io.ReadAll(io.LimitReader(r.Body, maxBody+1))
+		}
+		if err == nil && (r.ContentLength > maxBody || int64(len(body)) > maxBody) {
+			r.Body = &prefixedBody{Reader: io.MultiReader(bytes.NewReader(body), r.Body), closer: r.Body}
+			body = nil
+			attempts = 1
+		} else {
+			r.Body.Close()
+		}
+		if err != nil {
+			var maxErr *http.MaxBytesError
+			if errors.As(err, &maxErr) {
+				w.WriteHeader(http.StatusRequestEntityTooLarge)
+			} else {
+				w.WriteHeader(http.StatusBadRequest)
 			}
+			return nil
 		}
+	}
 
-		// If no healthy untried backend, try any untried backend
-		if backend == nil {
-			for i := 0; i < len(backends); i++ {
-				idx := (start + attempt + i) % len(backends)
-				b := backends[idx]
-				if !tried[b.Name] {
-					backend = b
+	tried := make(map[string]bool)
+	start := int(atomic.AddUint64(&p.currentIdx, 1)) - 1
+
+	// Round robin moves on to the next backend for each retry; failover
+	// always takes the first untried backend in priority order. Weighted
+	// picks the first attempt by weight and retries in pool order.
+	step := 1
+	switch mode {
+	case Failover:
+		backends = failoverOrder(backends, uint64(start))
+		start, step = 0, 0
+	case Weighted:
+		if picked := p.NextWeighted(); picked != nil {
+			for i, b := range backends {
+				if b == picked {
+					start = i
 					break
 				}
 			}
 		}
+	}
 
+	var last *Backend
+	var held *retryResponseRecorder
+
+	for attempt := 0; attempt < attempts; attempt++ {
+		backend := pickRetryBackend(backends, tried, start+attempt*step, attempt == 0)
 		if backend == nil {
-			break // All backends tried
+			break // no eligible backend left
 		}
 
-		tried[backend.Name] = true
+		if attempt > 0 && opts.Backoff > 0 {
+			select {
+			case <-time.After(opts.Backoff << (attempt - 1)):
+			case <-r.Context().Done():
+				held.release()
+				return last
+			}
+		}
 
-		// Create a response recorder to check if the backend succeeded
-		recorder := &retryResponseRecorder{
-			ResponseWriter: w,
-			statusCode:     0,
-			headerWritten:  false,
+		tried[backend.Name] = true
+		if body != nil {
+			r.Body = io.NopCloser(bytes.NewReader(body))
 		}
 
+		recorder := newRetryResponseRecorder(w, attempt < attempts-1)
 		backend.ServeHTTP(recorder, r)
+		last = backend
 
-		// Check if the request succeeded
-		if recorder.statusCode > 0 && recorder.statusCode < 500 && recorder.statusCode != http.StatusBadGateway && recorder.statusCode != http.StatusServiceUnavailable {
+		if !recorder.held {
 			return backend
 		}
+		held = recorder
+	}
 
-		// If this is the last attempt or headers were already written, return
-		if attempt == maxRetries-1 || recorder.headerWritten {
-			return backend
+	// Out of attempts or eligible backends: send the last failure
+	held.release()
+	return last
+}
+
+// prefixedBody serves bytes already read ahead of the rest of a request body
+type prefixedBody struct {
+	io.Reader
+	closer io.Closer
+}
+
+func (b *prefixedBody) Close() error {
+	return b.closer.Close()
+}
+
+// pickRetryBackend selects the next untried backend. Only healthy backends
+// whose circuit breaker allows traffic are retried; the first attempt falls
+// back to any backend so the client still gets a response.
+func pickRetryBackend(backends []*Backend, tried map[string]bool, start int, first bool) *Backend {
+	for i := 0; i < len(backends); i++ {
+		b := backends[(start+i)%len(backends)]
+		if !tried[b.Name] && b.IsHealthy() && b.circuitBreaker.Allow() {
+			return b
 		}
 	}
 
+	if !first {
+		return nil
+	}
+	for i := 0; i < len(backends); i++ {
+		b := backends[(start+i)%len(backends)]
+		if !tried[b.Name] {
+			return b
+		}
+	}
 	return nil
 }
 
-// retryResponseRecorder wraps ResponseWriter to track if we can still retry
+// isRetryMethod reports whether method is in the retryable set
+func isRetryMethod(method string, methods []string) bool {
+	if methods == nil {
+		methods = DefaultRetryMethods
+	}
+	for _, m := range methods {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// retryResponseRecorder passes a response through to the client unless it is
+// a retryable failure and another attempt is possible, in which case the
+// status, headers and body are held back
 type retryResponseRecorder struct {
 	http.ResponseWriter
+	canRetry      bool
+	header        http.Header // headers for this attempt while it may still be retried
 	statusCode    int
 	headerWritten bool
+	held          bool
+	body          bytes.Buffer
+}
+
+func newRetryResponseRecorder(w http.ResponseWriter, canRetry bool) *retryResponseRecorder {
+	r := &retryResponseRecorder{ResponseWriter: w, canRetry: canRetry}
+	if canRetry {
+		r.header = w.Header().Clone()
+	}
+	return r
+}
+
+func (r *retryResponseRecorder) Header() http.Header {
+	if r.header != nil {
+		return r.header
+	}
+	return r.ResponseWriter.Header()
 }
 
 func (r *retryResponseRecorder) WriteHeader(code int) {
-	if !r.headerWritten {
-		r.statusCode = code
-		r.headerWritten = true
-		r.ResponseWriter.WriteHeader(code)
+	if r.headerWritten {
+		return
+	}
+	r.statusCode = code
+	r.headerWritten = true
+
+	if r.canRetry && code >= 500 {
+		r.held = true
+		return
 	}
+	r.commitHeader()
+	r.ResponseWriter.WriteHeader(code)
 }
 
 func (r *retryResponseRecorder) Write(b []byte) (int, error) {
 	if !r.headerWritten {
-		r.headerWritten = true
-		r.statusCode = http.StatusOK
+		r.WriteHeader(http.StatusOK)
+	}
+	if r.held {
+		return r.body.Write(b)
 	}
 	return r.ResponseWriter.Write(b)
 }
+
+// Flush forwards flushes for responses that are being passed through
+func (r *retryResponseRecorder) Flush() {
+	if r.held {
+		return
+	}
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// commitHeader copies this attempt's headers onto the client response
+func (r *retryResponseRecorder) commitHeader() {
+	if r.header == nil {
+		return
+	}
+	dst := r.ResponseWriter.Header()
+	for k := range dst {
+		delete(dst, k)
+	}
+	for k, v := range r.header {
+		dst[k] = v
+	}
+	r.header = nil
+}
+
+// release writes a held failure to the client
+func (r *retryResponseRecorder) release() {
+	if r == nil || !r.held {
+		return
+	}
+	r.held = false
+	r.commitHeader()
+	r.ResponseWriter.WriteHeader(r.statusCode)
+	r.ResponseWriter.Write(r.body.Bytes())
+}
@@ -1,8 +1,11 @@
 package proxy
 
 import (
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -143,6 +146,80 @@ func TestHealthChecker(t *testing.T) {
 	}
 }
 
+func TestHealthCheckerConcurrency(t *testing.T) {
+	var active, peak int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&active, 1)
+		defer atomic.AddInt32(&active, -1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	pool := NewPool()
+	for i := 0; i < 8; i++ {
+		b, _ := NewBackend("b"+string(rune('0'+i)), server.URL, 10)
+		b.SetHealthy(false)
+		pool.Add(b)
+	}
+
+	hc := NewHealthChecker(pool, HealthConfig{
+		Enabled:     true,
+		Interval:    time.Hour,
+		Timeout:     time.Second,
+		Path:        "/",
+		Concurrency: 3,
+	})
+
+	start := time.Now()
+	hc.checkAll()
+	elapsed := time.Since(start)
+
+	if p := atomic.LoadInt32(&peak); p > 3 {
+		t.Errorf("expected at most 3 concurrent checks, got %d", p)
+	}
+	if elapsed > 350*time.Millisecond {
+		t.Errorf("expected checks to run concurrently, took %v", elapsed)
+	}
+	if pool.HealthyCount() != 8 {
+		t.Errorf("expected 8 healthy backends, got %d", pool.HealthyCount())
+	}
+}
+
+func TestHealthCheckerSkipsOverlappingCycle(t *testing.T) {
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	pool := NewPool()
+	b, _ := NewBackend("test", server.URL, 10)
+	pool.Add(b)
+
+	hc := NewHealthChecker(pool, DefaultHealthConfig())
+
+	// Simulate a cycle still in progress
+	atomic.StoreInt32(&hc.checking, 1)
+	hc.checkAll()
+	if n := atomic.LoadInt32(&hits); n != 0 {
+		t.Errorf("expected overlapping cycle to be skipped, got %d checks", n)
+	}
+
+	atomic.StoreInt32(&hc.checking, 0)
+	hc.checkAll()
+	if n := atomic.LoadInt32(&hits); n != 1 {
+		t.Errorf("expected 1 check, got %d", n)
+	}
+}
+
 func TestGetHealthStatuses(t *testing.T) {
 	pool := NewPool()
 
@@ -169,6 +246,41 @@ func TestGetHealthStatuses(t *testing.T) {
 	}
 }
 
+func TestPoolInheritState(t *testing.T) {
+	oldPool := NewPool()
+	down, _ := NewBackend("api", "http://127.0.0.1:8081", 1)
+	moved, _ := NewBackend("web", "http://127.0.0.1:8082", 1)
+	oldPool.Add(down)
+	oldPool.Add(moved)
+	down.SetHealthy(false)
+	for i := 0; i < 5; i++ {
+		down.circuitBreaker.RecordFailure()
+	}
+	moved.SetHealthy(false)
+
+	newPool := NewPool()
+	api, _ := NewBackend("api", "http://127.0.0.1:8081", 1)
+	web, _ := NewBackend("web", "http://127.0.0.1:9090", 1)
+	newPool.Add(api)
+	newPool.Add(web)
+
+	if n := newPool.InheritState(oldPool); n != 1 {
+		t.Errorf("expected 1 backend to inherit state, got %d", n)
+	}
+	if api.IsHealthy() || api.GetHealthStatus().FailCount != 1 {
+		t.Errorf("expected unchanged backend to stay unhealthy, got %+v", api.GetHealthStatus())
+	}
+	if api.CircuitBreakerState() != CircuitOpen {
+		t.Errorf("expected open circuit to carry over, got %v", api.CircuitBreakerState())
+	}
+	if !web.IsHealthy() || web.CircuitBreakerState() != CircuitClosed {
+		t.Error("expected backend with a new URL to start fresh")
+	}
+	if newPool.InheritState(nil) != 0 {
+		t.Error("expected nothing inherited without a previous pool")
+	}
+}
+
 func TestPoolNextWeighted(t *testing.T) {
 	pool := NewPool()
 
@@ -245,6 +357,32 @@ func TestServeHTTPWithRetry(t *testing.T) {
 	}
 }
 
+func TestServeHTTPWithRetryBackendHeader(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+	working := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer working.Close()
+
+	pool := NewPool()
+	pool.SetMode(Failover)
+	b1, _ := NewBackendWithOptions("failing", failing.URL, 10, BackendOptions{Priority: 2})
+	b2, _ := NewBackendWithOptions("working", working.URL, 10, BackendOptions{Priority: 1})
+	pool.Add(b1)
+	pool.Add(b2)
+
+	req := httptest.NewRequest("GET", "/test", nil)
+	req = req.WithContext(WithBackendHeader(req.Context(), "X-Backend"))
+	rr := httptest.NewRecorder()
+	pool.ServeHTTPWithRetry(rr, req, 2)
+
+	// Only the attempt that answered the client names itself
+	if got := rr.Header().Values("X-Backend"); len(got) != 1 || got[0] != "working" {
+		t.Errorf("expected X-Backend: working, got %v", got)
+	}
+}
+
 func TestServeHTTPWithRetryEmptyPool(t *testing.T) {
 	pool := NewPool()
 
@@ -283,6 +421,122 @@ func TestServeHTTPWithRetrySingleBackend(t *testing.T) {
 	}
 }
 
+// retryTestPool returns a pool whose first backend always fails with 502 and
+// whose second echoes the request body; hits counts calls to the failing one
+func retryTestPool(t *testing.T, hits *int32) *Pool {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(hits, 1)
+		io.Copy(io.Discard, r.Body)
+		w.Header().Set("X-Failed", "true")
+		w.WriteHeader(http.StatusBadGateway)
+		w.Write([]byte("failed"))
+	}))
+	t.Cleanup(failing.Close)
+
+	working := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Write([]byte("ok:" + string(body)))
+	}))
+	t.Cleanup(working.Close)
+
+	pool := NewPool()
+	b1, _ := NewBackend("failing", failing.URL, 1)
+	b2, _ := NewBackend("working", working.URL, 1)
+	pool.Add(b1)
+	pool.Add(b2)
+	return pool
+}
+
+func TestServeHTTPWithRetryOptionsRetriesIdempotent(t *testing.T) {
+	var hits int32
+	pool := retryTestPool(t, &hits)
+
+	opts := RetryOptions{MaxRetries: 1, Backoff: time.Millisecond}
+	for i := 0; i < 4; i++ {
+		req := httptest.NewRequest("PUT", "/", strings.NewReader("payload"))
+		rr := httptest.NewRecorder()
+		pool.ServeHTTPWithRetryOptions(rr, req, opts)
+
+		if rr.Code != http.StatusOK || rr.Body.String() != "ok:payload" {
+			t.Fatalf("attempt %d: expected retried success, got %d %q", i, rr.Code, rr.Body.String())
+		}
+		if rr.Header().Get("X-Failed") != "" {
+			t.Error("expected headers from the failed attempt to be discarded")
+		}
+	}
+	if atomic.LoadInt32(&hits) == 0 {
+		t.Error("expected the failing backend to be tried")
+	}
+}
+
+func TestServeHTTPWithRetryOptionsSkipsNonIdempotent(t *testing.T) {
+	var hits int32
+	pool := retryTestPool(t, &hits)
+
+	opts := RetryOptions{MaxRetries: 1}
+	failures := 0
+	for i := 0; i < 4; i++ {
+		req := httptest.NewRequest("POST", "/", strings.NewReader("payload"))
+		rr := httptest.NewRecorder()
+		pool.ServeHTTPWithRetryOptions(rr, req, opts)
+		if rr.Code == http.StatusBadGateway {
+			failures++
+		}
+	}
+
+	if failures == 0 || int32(failures) != atomic.LoadInt32(&hits) {
+		t.Errorf("expected every POST to the failing backend to be returned without retry, got %d failures for %d hits", failures, hits)
+	}
+}
+
+func TestServeHTTPWithRetryOptionsStreamsLargeBody(t *testing.T) {
+	var hits int32
+	pool := retryTestPool(t, &hits)
+
+	opts := RetryOptions{MaxRetries: 1, MaxBody: 4}
+	failures := 0
+	for i := 0; i < 4; i++ {
+		req := httptest.NewRequest("PUT", "/", strings.NewReader("payload"))
+		if i%2 == 1 {
+			req.ContentLength = -1 // chunked, size unknown until read
+		}
+		rr := httptest.NewRecorder()
+		pool.ServeHTTPWithRetryOptions(rr, req, opts)
+		switch {
+		case rr.Code == http.StatusBadGateway:
+			failures++
+		case rr.Body.String() != "ok:payload":
+			t.Errorf("request %d: expected the whole body to reach the backend, got %q", i, rr.Body.String())
+		}
+	}
+
+	if failures == 0 || int32(failures) != atomic.LoadInt32(&hits) {
+		t.Errorf("expected bodies over MaxBody to be sent without retry, got %d failures for %d hits", failures, hits)
+	}
+}
+
+func TestServeHTTPWithRetryOptionsRespectsCircuitBreaker(t *testing.T) {
+	var hits int32
+	pool := retryTestPool(t, &hits)
+
+	// Open the breaker on the working backend so no retry target is eligible
+	working := pool.Get("working")
+	for i := 0; i < DefaultCircuitBreakerConfig().FailureThreshold; i++ {
+		working.circuitBreaker.RecordFailure()
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	rr := httptest.NewRecorder()
+	result := pool.ServeHTTPWithRetryOptions(rr, req, RetryOptions{MaxRetries: 1})
+
+	if result == nil || result.Name != "failing" {
+		t.Fatalf("expected only the failing backend to be tried, got %v", result)
+	}
+	if rr.Code != http.StatusBadGateway || rr.Body.String() != "failed" {
+		t.Errorf("expected the held failure to be returned, got %d %q", rr.Code, rr.Body.String())
+	}
+}
+
 func TestBackendHealthCheckPath(t *testing.T) {
 	// Server that only responds healthy on /custom/health
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,81 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// PathRewrite rewrites request paths before they are sent to a backend.
+// StripPrefix is applied first, then Pattern is replaced with Replacement.
+type PathRewrite struct {
+	StripPrefix string
+	Pattern     *regexp.Regexp
+	Replacement string // may reference capture groups, e.g. "/v2/$1"
+}
+
+// NewPathRewrite creates a path rewrite; it returns nil when neither a
+// prefix nor a pattern is given
+func NewPathRewrite(stripPrefix, pattern, replacement string) (*PathRewrite, error) {
+	if stripPrefix == "" && pattern == "" {
+		return nil, nil
+	}
+	if stripPrefix != "" && !strings.HasPrefix(stripPrefix, "/") {
+		return nil, fmt.Errorf("strip prefix must start with /: %s", stripPrefix)
+	}
+
+	pr := &PathRewrite{
+		StripPrefix: strings.TrimSuffix(stripPrefix, "/"),
+		Replacement: replacement,
+	}
+	if pattern != "" {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rewrite pattern %q: %w", pattern, err)
+		}
+		pr.Pattern = re
+	}
+	return pr, nil
+}
+
+// Rewrite returns the rewritten path and whether the prefix was stripped.
+// The prefix only matches whole path segments, so "/api" strips "/api/users"
+// and "/api" but not "/apix".
+func (pr *PathRewrite) Rewrite(path string) (string, bool) {
+	stripped := false
+	if pr.StripPrefix != "" {
+		if rest, ok := strings.CutPrefix(path, pr.StripPrefix); ok && (rest == "" || rest[0] == '/') {
+			path = rest
+			stripped = true
+		}
+	}
+	if pr.Pattern != nil {
+		path = pr.Pattern.ReplaceAllString(path, pr.Replacement)
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return path, stripped
+}
+
+// apply rewrites the outgoing request URL. The escaped form is kept when it
+// rewrites to the same path, so encoded characters such as %2F survive.
+func (pr *PathRewrite) apply(req *http.Request) {
+	path, stripped := pr.Rewrite(req.URL.Path)
+	if req.URL.RawPath != "" {
+		raw, _ := pr.Rewrite(req.URL.RawPath)
+		if unescaped, err := url.PathUnescape(raw); err == nil && unescaped == path {
+			req.URL.RawPath = raw
+		} else {
+			req.URL.RawPath = ""
+		}
+	}
+	req.URL.Path = path
+
+	// Let the backend build absolute links under the public prefix
+	if stripped {
+		req.Header.Set("X-Forwarded-Prefix", pr.StripPrefix)
+	}
+}
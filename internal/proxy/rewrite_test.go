@@ -0,0 +1,78 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPathRewrite(t *testing.T) {
+	tests := []struct {
+		name        string
+		strip       string
+		pattern     string
+		replacement string
+		path        string
+		want        string
+	}{
+		{"strip prefix", "/api/v1", "", "", "/api/v1/users", "/users"},
+		{"strip whole path", "/api/v1/", "", "", "/api/v1", "/"},
+		{"prefix must match segment", "/api", "", "", "/apix/users", "/apix/users"},
+		{"no match", "/api", "", "", "/other", "/other"},
+		{"regex", "", `^/old/(.*)$`, "/new/$1", "/old/a/b", "/new/a/b"},
+		{"strip then regex", "/api", `^/v1/`, "/v2/", "/api/v1/items", "/v2/items"},
+		{"regex result made absolute", "", `^/legacy/`, "", "/legacy/page", "/page"},
+	}
+
+	for _, tc := range tests {
+		pr, err := NewPathRewrite(tc.strip, tc.pattern, tc.replacement)
+		if err != nil {
+			t.Fatalf("%s: failed to create rewrite: %v", tc.name, err)
+		}
+		if got, _ := pr.Rewrite(tc.path); got != tc.want {
+			t.Errorf("%s: Rewrite(%q) = %q, want %q", tc.name, tc.path, got, tc.want)
+		}
+	}
+
+	if pr, err := NewPathRewrite("", "", ""); pr != nil || err != nil {
+		t.Errorf("expected nil rewrite when unset, got %v (%v)", pr, err)
+	}
+	if _, err := NewPathRewrite("api", "", ""); err == nil {
+		t.Error("expected error for relative prefix")
+	}
+	if _, err := NewPathRewrite("", "(", ""); err == nil {
+		t.Error("expected error for invalid pattern")
+	}
+}
+
+func TestBackendPathRewrite(t *testing.T) {
+	var gotPath, gotRawPath, gotPrefix string
+	backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotRawPath = r.URL.RawPath
+		gotPrefix = r.Header.Get("X-Forwarded-Prefix")
+	}))
+	defer backendServer.Close()
+
+	opts := DefaultBackendOptions()
+	opts.PathRewrite, _ = NewPathRewrite("/api/v1", "", "")
+	b, err := NewBackendWithOptions("test", backendServer.URL, 1, opts)
+	if err != nil {
+		t.Fatalf("failed to create backend: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/api/v1/files/a%2Fb?x=1", nil)
+	b.ServeHTTP(httptest.NewRecorder(), req)
+
+	if gotPath != "/files/a/b" || gotRawPath != "/files/a%2Fb" {
+		t.Errorf("expected backend path /files/a%%2Fb, got %q (raw %q)", gotPath, gotRawPath)
+	}
+	if gotPrefix != "/api/v1" {
+		t.Errorf("expected X-Forwarded-Prefix /api/v1, got %q", gotPrefix)
+	}
+
+	// The incoming request keeps its original path for logging
+	if req.URL.Path != "/api/v1/files/a/b" {
+		t.Errorf("expected original request path to be unchanged, got %q", req.URL.Path)
+	}
+}
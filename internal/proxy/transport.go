@@ -0,0 +1,196 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Connection pool defaults for backend transports
+const (
+	DefaultMaxIdleConns        = 100
+	DefaultMaxIdleConnsPerHost = 20
+	DefaultIdleConnTimeout     = 90 * time.Second
+)
+
+// trackedTransport is an http.Transport that counts the connections it opens
+type trackedTransport struct {
+	*http.Transport
+	open   int64 // atomic; currently open connections
+	dialed int64 // atomic; connections opened since creation
+}
+
+// transportSettings are the options that determine a backend's transport;
+// backends sharing a transport must agree on all of them
+type transportSettings struct {
+	scheme, host          string
+	maxIdleConns          int
+	maxIdleConnsPerHost   int
+	idleConnTimeout       time.Duration
+	responseHeaderTimeout time.Duration
+	tls                   BackendTLS
+}
+
+// BackendTLS configures TLS connections to an HTTPS backend
+type BackendTLS struct {
+	CAFile     string // PEM CA bundle used instead of the system roots
+	CertFile   string // client certificate for mutual TLS
+	KeyFile    string
+	ServerName string // name sent in SNI and verified (default: URL host)
+
+	// InsecureSkipVerify disables backend certificate verification
+	InsecureSkipVerify bool
+}
+
+// clientConfig loads the files named in t into a TLS client configuration.
+// It returns nil when t is empty, leaving the transport defaults in place.
+func (t BackendTLS) clientConfig() (*tls.Config, error) {
+	if t == (BackendTLS{}) {
+		return nil, nil
+	}
+	cfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         t.ServerName,
+		InsecureSkipVerify: t.InsecureSkipVerify,
+	}
+	if t.CAFile != "" {
+		pem, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", t.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+	if t.CertFile != "" || t.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+func newTrackedTransport(s transportSettings, tlsCfg *tls.Config) *trackedTransport {
+	t := &trackedTransport{}
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	t.Transport = &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := dialer.DialContext(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			atomic.AddInt64(&t.open, 1)
+			atomic.AddInt64(&t.dialed, 1)
+			return &trackedConn{Conn: conn, open: &t.open}, nil
+		},
+		MaxIdleConns:          s.maxIdleConns,
+		MaxIdleConnsPerHost:   s.maxIdleConnsPerHost,
+		IdleConnTimeout:       s.idleConnTimeout,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: s.responseHeaderTimeout,
+		ExpectContinueTimeout: 1 * time.Second,
+		DisableCompression:    true, // Preserve original encoding
+		TLSClientConfig:       tlsCfg,
+	}
+	return t
+}
+
+// trackedConn decrements its transport's open count when closed
+type trackedConn struct {
+	net.Conn
+	open      *int64
+	closeOnce sync.Once
+}
+
+func (c *trackedConn) Close() error {
+	c.closeOnce.Do(func() { atomic.AddInt64(c.open, -1) })
+	return c.Conn.Close()
+}
+
+// sharedTransports holds transports shared by backends with identical
+// settings, keyed by those settings. They live for the life of the process
+// so that pooled connections survive configuration reloads.
+var sharedTransports = struct {
+	sync.Mutex
+	m map[transportSettings]*trackedTransport
+}{m: make(map[transportSettings]*trackedTransport)}
+
+// sharedTransport returns the shared transport for s, creating it with
+// tlsCfg if needed. Transports are keyed by TLS file names, so certificates
+// replaced under the same names are not picked up by an existing transport.
+func sharedTransport(s transportSettings, tlsCfg *tls.Config) *trackedTransport {
+	sharedTransports.Lock()
+	defer sharedTransports.Unlock()
+
+	t, ok := sharedTransports.m[s]
+	if !ok {
+		t = newTrackedTransport(s, tlsCfg)
+		sharedTransports.m[s] = t
+	}
+	return t
+}
+
+// ConnPoolStats describes a backend's connection pool
+type ConnPoolStats struct {
+	// Shared is set when the transport, and so OpenConns and DialedConns, is
+	// shared with other backends pointing at the same host
+	Shared              bool   `json:"shared"`
+	OpenConns           int64  `json:"open_conns"`
+	DialedConns         int64  `json:"dialed_conns"`
+	InFlight            int64  `json:"in_flight"`
+	ReusedConns         int64  `json:"reused_conns"` // requests sent on a pooled connection
+	NewConns            int64  `json:"new_conns"`    // requests that needed a new connection
+	MaxIdleConns        int    `json:"max_idle_conns"`
+	MaxIdleConnsPerHost int    `json:"max_idle_conns_per_host"`
+	IdleConnTimeout     string `json:"idle_conn_timeout"`
+}
+
+// connStats are the per-backend counters behind ConnPoolStats
+type connStats struct {
+	inFlight int64 // atomic
+	reused   int64 // atomic
+	fresh    int64 // atomic
+}
+
+// withConnTrace returns r with a trace that counts whether the backend
+// request reused a pooled connection
+func (s *connStats) withConnTrace(r *http.Request) *http.Request {
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				atomic.AddInt64(&s.reused, 1)
+			} else {
+				atomic.AddInt64(&s.fresh, 1)
+			}
+		},
+	}
+	return r.WithContext(httptrace.WithClientTrace(r.Context(), trace))
+}
+
+// ConnPoolStats returns the backend's connection pool statistics
+func (b *Backend) ConnPoolStats() ConnPoolStats {
+	t := b.transport
+	return ConnPoolStats{
+		Shared:              b.sharedTransport,
+		OpenConns:           atomic.LoadInt64(&t.open),
+		DialedConns:         atomic.LoadInt64(&t.dialed),
+		InFlight:            atomic.LoadInt64(&b.conns.inFlight),
+		ReusedConns:         atomic.LoadInt64(&b.conns.reused),
+		NewConns:            atomic.LoadInt64(&b.conns.fresh),
+		MaxIdleConns:        t.MaxIdleConns,
+		MaxIdleConnsPerHost: t.MaxIdleConnsPerHost,
+		IdleConnTimeout:     t.IdleConnTimeout.String(),
+	}
+}
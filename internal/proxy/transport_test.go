@@ -0,0 +1,176 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBackendConnPoolOptions(t *testing.T) {
+	opts := DefaultBackendOptions()
+	opts.MaxIdleConns = 10
+	opts.MaxIdleConnsPerHost = 5
+	opts.IdleConnTimeout = 30 * time.Second
+	b, err := NewBackendWithOptions("b1", "http://127.0.0.1:8080", 1, opts)
+	if err != nil {
+		t.Fatalf("failed to create backend: %v", err)
+	}
+
+	stats := b.ConnPoolStats()
+	if stats.MaxIdleConns != 10 || stats.MaxIdleConnsPerHost != 5 || stats.IdleConnTimeout != "30s" {
+		t.Errorf("pool settings not applied: %+v", stats)
+	}
+	if stats.Shared {
+		t.Error("expected a dedicated transport by default")
+	}
+
+	// Zero values fall back to the defaults
+	b, _ = NewBackendWithOptions("b2", "http://127.0.0.1:8080", 1, BackendOptions{})
+	if stats := b.ConnPoolStats(); stats.MaxIdleConnsPerHost != DefaultMaxIdleConnsPerHost {
+		t.Errorf("expected default max idle conns per host, got %d", stats.MaxIdleConnsPerHost)
+	}
+}
+
+func TestBackendSharedTransport(t *testing.T) {
+	opts := DefaultBackendOptions()
+	opts.ShareTransport = true
+
+	a, _ := NewBackendWithOptions("a", "http://127.0.0.1:8081", 1, opts)
+	b, _ := NewBackendWithOptions("b", "http://127.0.0.1:8081", 1, opts)
+	other, _ := NewBackendWithOptions("other", "http://127.0.0.1:8082", 1, opts)
+
+	if a.transport != b.transport {
+		t.Error("expected backends on the same host to share a transport")
+	}
+	if a.transport == other.transport {
+		t.Error("expected backends on different hosts to use separate transports")
+	}
+
+	opts.IdleConnTimeout = time.Minute
+	c, _ := NewBackendWithOptions("c", "http://127.0.0.1:8081", 1, opts)
+	if c.transport == a.transport {
+		t.Error("expected different pool settings to use a separate transport")
+	}
+	if !a.ConnPoolStats().Shared {
+		t.Error("expected stats to report a shared transport")
+	}
+}
+
+func TestBackendConnPoolStats(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	b, err := NewBackend("b1", server.URL, 1)
+	if err != nil {
+		t.Fatalf("failed to create backend: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		rr := httptest.NewRecorder()
+		b.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", rr.Code)
+		}
+	}
+
+	stats := b.ConnPoolStats()
+	if stats.DialedConns != 1 || stats.OpenConns != 1 {
+		t.Errorf("expected one pooled connection, got %+v", stats)
+	}
+	if stats.NewConns != 1 || stats.ReusedConns != 2 {
+		t.Errorf("expected 1 new and 2 reused, got %+v", stats)
+	}
+	if stats.InFlight != 0 {
+		t.Errorf("expected no requests in flight, got %d", stats.InFlight)
+	}
+
+	b.transport.CloseIdleConnections()
+	if open := b.ConnPoolStats().OpenConns; open != 0 {
+		t.Errorf("expected closed connections to be uncounted, got %d open", open)
+	}
+}
+
+func TestBackendTLS(t *testing.T) {
+	var gotClientCert bool
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotClientCert = len(r.TLS.PeerCertificates) > 0
+		w.WriteHeader(http.StatusOK)
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	// The test server's certificate is self-signed, so it serves as its own CA
+	cert := server.TLS.Certificates[0]
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	key, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func(opts BackendOptions) int {
+		t.Helper()
+		b, err := NewBackendWithOptions("tls", server.URL, 1, opts)
+		if err != nil {
+			t.Fatalf("failed to create backend: %v", err)
+		}
+		rec := httptest.NewRecorder()
+		b.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+		return rec.Code
+	}
+
+	if code := serve(DefaultBackendOptions()); code != http.StatusBadGateway {
+		t.Errorf("expected untrusted certificate to fail with 502, got %d", code)
+	}
+
+	opts := DefaultBackendOptions()
+	opts.TLS = BackendTLS{CAFile: caFile, ServerName: "example.com"}
+	if code := serve(opts); code != http.StatusOK {
+		t.Errorf("expected private CA to be trusted, got %d", code)
+	}
+	if gotClientCert {
+		t.Error("expected no client certificate without cert_file")
+	}
+
+	opts.TLS.CertFile, opts.TLS.KeyFile = caFile, keyFile
+	if code := serve(opts); code != http.StatusOK {
+		t.Errorf("expected mutual TLS request to succeed, got %d", code)
+	}
+	if !gotClientCert {
+		t.Error("expected client certificate to be presented")
+	}
+
+	opts = DefaultBackendOptions()
+	opts.TLS = BackendTLS{InsecureSkipVerify: true}
+	if code := serve(opts); code != http.StatusOK {
+		t.Errorf("expected insecure_skip_verify to accept the certificate, got %d", code)
+	}
+
+	// Health checks use the backend's TLS settings
+	opts.TLS = BackendTLS{CAFile: caFile, ServerName: "example.com"}
+	b, _ := NewBackendWithOptions("tls", server.URL, 1, opts)
+	if !NewHealthChecker(NewPool(), DefaultHealthConfig()).check(b) {
+		t.Error("expected health check to trust the private CA")
+	}
+
+	opts.TLS = BackendTLS{CAFile: filepath.Join(dir, "missing.pem")}
+	if _, err := NewBackendWithOptions("tls", server.URL, 1, opts); err == nil {
+		t.Error("expected error for missing CA file")
+	}
+}
@@ -0,0 +1,160 @@
+package redis
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeServer answers a few commands the way Redis does, recording them
+type fakeServer struct {
+	ln       net.Listener
+	mu       sync.Mutex
+	values   map[string]int64
+	commands []string
+	conns    int
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	s := &fakeServer{ln: ln, values: make(map[string]int64)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.conns++
+			s.mu.Unlock()
+			go s.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { ln.Close() })
+	return s
+}
+
+func (s *fakeServer) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		reply, err := readReply(r)
+		if err != nil {
+			return
+		}
+		var args []string
+		for _, a := range reply.([]interface{}) {
+			args = append(args, a.(string))
+		}
+
+		s.mu.Lock()
+		s.commands = append(s.commands, strings.Join(args, " "))
+		switch strings.ToUpper(args[0]) {
+		case "PING":
+			fmt.Fprint(conn, "+PONG\r\n")
+		case "AUTH", "SELECT":
+			fmt.Fprint(conn, "+OK\r\n")
+		case "INCR":
+			s.values[args[1]]++
+			fmt.Fprintf(conn, ":%d\r\n", s.values[args[1]])
+		case "GET":
+			if v, ok := s.values[args[1]]; ok {
+				n := strconv.FormatInt(v, 10)
+				fmt.Fprintf(conn, "$%d\r\n%s\r\n", len(n), n)
+			} else {
+				fmt.Fprint(conn, "$-1\r\n")
+			}
+		case "LIST":
+			fmt.Fprint(conn, "*3\r\n+a\r\n:2\r\n$-1\r\n")
+		default:
+			fmt.Fprintf(conn, "-ERR unknown command '%s'\r\n", args[0])
+		}
+		s.mu.Unlock()
+	}
+}
+
+func TestClientReplies(t *testing.T) {
+	s := newFakeServer(t)
+	c := New(Options{Addr: s.ln.Addr().String()})
+	defer c.Close()
+
+	tests := []struct {
+		args []string
+		want interface{}
+	}{
+		{[]string{"PING"}, "PONG"},
+		{[]string{"INCR", "k"}, int64(1)},
+		{[]string{"INCR", "k"}, int64(2)},
+		{[]string{"GET", "k"}, "2"},
+		{[]string{"GET", "missing"}, nil},
+	}
+	for _, tc := range tests {
+		got, err := c.Do(tc.args...)
+		if err != nil {
+			t.Fatalf("%v: unexpected error: %v", tc.args, err)
+		}
+		if got != tc.want {
+			t.Errorf("%v: expected %#v, got %#v", tc.args, tc.want, got)
+		}
+	}
+
+	list, err := c.Do("LIST")
+	if items, ok := list.([]interface{}); err != nil || !ok || len(items) != 3 || items[0] != "a" || items[1] != int64(2) || items[2] != nil {
+		t.Errorf("unexpected array reply %#v (%v)", list, err)
+	}
+
+	// An error reply leaves the connection usable
+	var replyErr Error
+	if _, err := c.Do("BOGUS"); !errors.As(err, &replyErr) {
+		t.Errorf("expected error reply, got %v", err)
+	}
+	if _, err := c.Do("PING"); err != nil {
+		t.Errorf("expected connection to be reused after an error reply: %v", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conns != 1 {
+		t.Errorf("expected a single pooled connection, got %d", s.conns)
+	}
+}
+
+func TestClientAuthAndSelect(t *testing.T) {
+	s := newFakeServer(t)
+	c := New(Options{Addr: s.ln.Addr().String(), Password: "secret", DB: 2})
+	if _, err := c.Do("PING"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c.Close()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	want := []string{"AUTH secret", "SELECT 2", "PING"}
+	if strings.Join(s.commands, ",") != strings.Join(want, ",") {
+		t.Errorf("expected commands %v, got %v", want, s.commands)
+	}
+
+	if _, err := c.Do("PING"); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected ErrClosed after Close, got %v", err)
+	}
+}
+
+func TestClientUnreachable(t *testing.T) {
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := ln.Addr().String()
+	ln.Close()
+
+	c := New(Options{Addr: addr, Timeout: 50 * time.Millisecond})
+	defer c.Close()
+	if _, err := c.Do("PING"); err == nil {
+		t.Error("expected error for unreachable server")
+	}
+}
@@ -0,0 +1,258 @@
+package rules
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Auth schemes
+const (
+	AuthBasic  = "basic"
+	AuthBearer = "bearer"
+)
+
+// AuthRule matches requests carrying valid credentials: HTTP Basic
+// credentials checked against htpasswd-style password hashes, or a static
+// bearer token. Use it in allow rules so unauthenticated requests are denied
+// before they reach the backend.
+type AuthRule struct {
+	scheme string
+	users  map[string]string // username -> password hash
+	tokens [][]byte          // SHA-256 of each accepted bearer token
+}
+
+// NewAuthRule creates an authentication rule. For AuthBasic, users maps
+// usernames to password hashes in htpasswd format (see SupportedPasswordHash);
+// for AuthBearer, tokens lists the accepted bearer tokens.
+func NewAuthRule(scheme string, users map[string]string, tokens []string) (*AuthRule, error) {
+	r := &AuthRule{scheme: strings.ToLower(scheme)}
+
+	switch r.scheme {
+	case AuthBasic:
+		if len(users) == 0 {
+			return nil, fmt.Errorf("basic auth requires at least one user")
+		}
+		r.users = make(map[string]string, len(users))
+		for user, hash := range users {
+			if !SupportedPasswordHash(hash) {
+				return nil, fmt.Errorf("unsupported password hash for user %q", user)
+			}
+			r.users[user] = hash
+		}
+	case AuthBearer:
+		if len(tokens) == 0 {
+			return nil, fmt.Errorf("bearer auth requires at least one token")
+		}
+		for _, t := range tokens {
+			if t == "" {
+				return nil, fmt.Errorf("empty bearer token")
+			}
+			sum := sha256.Sum256([]byte(t))
+			r.tokens = append(r.tokens, sum[:])
+		}
+	default:
+		return nil, fmt.Errorf("invalid auth scheme: %s (expected basic or bearer)", scheme)
+	}
+
+	return r, nil
+}
+
+// Evaluate checks the request's Authorization header
+func (r *AuthRule) Evaluate(ctx *Context) Result {
+	if ctx.Request == nil {
+		return Result{Matched: false, Reason: "no HTTP request"}
+	}
+
+	var ok bool
+	switch r.scheme {
+	case AuthBasic:
+		user, password, present := ctx.Request.BasicAuth()
+		if !present {
+			return Result{Matched: false, Reason: "no basic auth credentials", Labels: []string{"auth-missing"}}
+		}
+		ok = r.checkPassword(user, password)
+	case AuthBearer:
+		token, present := bearerToken(ctx.Request.Header.Get("Authorization"))
+		if !present {
+			return Result{Matched: false, Reason: "no bearer token", Labels: []string{"auth-missing"}}
+		}
+		ok = r.checkToken(token)
+	}
+
+	if !ok {
+		return Result{
+			Matched: false,
+			Reason:  fmt.Sprintf("invalid %s auth credentials", r.scheme),
+			Labels:  []string{"auth-invalid"},
+		}
+	}
+	return Result{
+		Matched: true,
+		Reason:  fmt.Sprintf("valid %s auth credentials", r.scheme),
+		Labels:  []string{"auth-" + r.scheme},
+	}
+}
+
+// checkPassword verifies a password. Unknown users are checked against a
+// dummy hash so response timing does not reveal which usernames exist.
+func (r *AuthRule) checkPassword(user, password string) bool {
+	hash, known := r.users[user]
+	if !known {
+		hash = "{SHA}" + base64.StdEncoding.EncodeToString(make([]byte, sha1.Size))
+	}
+	return verifyPassword(hash, password) && known
+}
+
+// checkToken compares the token against every configured token in
+// constant time
+func (r *AuthRule) checkToken(token string) bool {
+	sum := sha256.Sum256([]byte(token))
+	match := 0
+	for _, t := range r.tokens {
+		match |= subtle.ConstantTimeCompare(sum[:], t)
+	}
+	return match == 1
+}
+
+// bearerToken extracts the token from a "Bearer <token>" header value
+func bearerToken(header string) (string, bool) {
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// Type returns the rule type
+func (r *AuthRule) Type() string {
+	return "auth"
+}
+
+// SupportedPasswordHash reports whether hash uses a supported htpasswd
+// format: Apache MD5 ("$apr1$", from htpasswd -m) or SHA-1 ("{SHA}", from
+// htpasswd -s)
+func SupportedPasswordHash(hash string) bool {
+	return strings.HasPrefix(hash, "$apr1$") || strings.HasPrefix(hash, "{SHA}")
+}
+
+// verifyPassword checks password against an htpasswd hash in constant time
+func verifyPassword(hash, password string) bool {
+	var computed string
+	switch {
+	case strings.HasPrefix(hash, "{SHA}"):
+		sum := sha1.Sum([]byte(password))
+		computed = "{SHA}" + base64.StdEncoding.EncodeToString(sum[:])
+	case strings.HasPrefix(hash, "$apr1$"):
+		salt, _, _ := strings.Cut(strings.TrimPrefix(hash, "$apr1$"), "$")
+		computed = apr1(password, salt)
+	default:
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(hash)) == 1
+}
+
+// LoadHtpasswd reads "user:hash" lines from an htpasswd file. Blank lines
+// and lines starting with # are ignored.
+func LoadHtpasswd(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open htpasswd file: %w", err)
+	}
+	defer f.Close()
+
+	users := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		user, hash, ok := strings.Cut(line, ":")
+		if !ok || user == "" {
+			return nil, fmt.Errorf("htpasswd line %d: expected user:hash", n)
+		}
+		if !SupportedPasswordHash(hash) {
+			return nil, fmt.Errorf("htpasswd line %d: unsupported hash for user %q (use htpasswd -m or -s)", n, user)
+		}
+		users[user] = hash
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read htpasswd file: %w", err)
+	}
+	return users, nil
+}
+
+// apr1 computes an Apache MD5-crypt hash ("$apr1$salt$digest")
+func apr1(password, salt string) string {
+	const magic = "$apr1$"
+	if len(salt) > 8 {
+		salt = salt[:8]
+	}
+	pw := []byte(password)
+
+	alt := md5.New()
+	alt.Write(pw)
+	alt.Write([]byte(salt))
+	alt.Write(pw)
+	altSum := alt.Sum(nil)
+
+	d := md5.New()
+	d.Write(pw)
+	d.Write([]byte(magic))
+	d.Write([]byte(salt))
+	for i := len(pw); i > 0; i -= 16 {
+		d.Write(altSum[:min(i, 16)])
+	}
+	for i := len(pw); i > 0; i >>= 1 {
+		if i&1 != 0 {
+			d.Write([]byte{0})
+		} else {
+			d.Write(pw[:1])
+		}
+	}
+	sum := d.Sum(nil)
+
+	for i := 0; i < 1000; i++ {
+		d := md5.New()
+		if i&1 != 0 {
+			d.Write(pw)
+		} else {
+			d.Write(sum)
+		}
+		if i%3 != 0 {
+			d.Write([]byte(salt))
+		}
+		if i%7 != 0 {
+			d.Write(pw)
+		}
+		if i&1 != 0 {
+			d.Write(sum)
+		} else {
+			d.Write(pw)
+		}
+		sum = d.Sum(nil)
+	}
+
+	const itoa64 = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	out := make([]byte, 0, 22)
+	encode := func(v uint32, n int) {
+		for ; n > 0; n-- {
+			out = append(out, itoa64[v&0x3f])
+			v >>= 6
+		}
+	}
+	for _, g := range [][3]int{{0, 6, 12}, {1, 7, 13}, {2, 8, 14}, {3, 9, 15}, {4, 10, 5}} {
+		encode(uint32(sum[g[0]])<<16|uint32(sum[g[1]])<<8|uint32(sum[g[2]]), 4)
+	}
+	encode(uint32(sum[11]), 2)
+
+	return magic + salt + "$" + string(out)
+}
@@ -0,0 +1,127 @@
+package rules
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAPR1(t *testing.T) {
+	// Vectors generated with openssl passwd -apr1
+	tests := []struct {
+		password string
+		hash     string
+	}{
+		{"s3cret!", "$apr1$Xy7Qk2Lp$CpHVJCYy5ddp1Urai01X.0"},
+		{"", "$apr1$ab$S8K6Sgp3W8c9Jb6LxgywZ."},
+		{"correct horse battery staple, quite long", "$apr1$salt1234$8pDwdv61Cwf0FrBUP5FTQ1"},
+	}
+	for _, tc := range tests {
+		if !verifyPassword(tc.hash, tc.password) {
+			t.Errorf("expected %q to verify against %s", tc.password, tc.hash)
+		}
+		if verifyPassword(tc.hash, tc.password+"x") {
+			t.Errorf("expected wrong password to fail against %s", tc.hash)
+		}
+	}
+}
+
+func TestAuthRuleBasic(t *testing.T) {
+	rule, err := NewAuthRule("basic", map[string]string{
+		"alice": "$apr1$Xy7Qk2Lp$CpHVJCYy5ddp1Urai01X.0", // s3cret!
+		"bob":   "{SHA}87u9ZqY9S/F0eUBXjsPQEDUw4h0=",     // hunter2
+	}, nil)
+	if err != nil {
+		t.Fatalf("failed to create auth rule: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		user     string
+		password string
+		set      bool
+		matched  bool
+	}{
+		{"apr1 user", "alice", "s3cret!", true, true},
+		{"sha user", "bob", "hunter2", true, true},
+		{"wrong password", "alice", "hunter2", true, false},
+		{"unknown user", "mallory", "s3cret!", true, false},
+		{"no credentials", "", "", false, false},
+	}
+	for _, tc := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		if tc.set {
+			req.SetBasicAuth(tc.user, tc.password)
+		}
+		if got := rule.Evaluate(&Context{Request: req}).Matched; got != tc.matched {
+			t.Errorf("%s: expected matched=%v, got %v", tc.name, tc.matched, got)
+		}
+	}
+}
+
+func TestAuthRuleBearer(t *testing.T) {
+	rule, err := NewAuthRule("bearer", nil, []string{"token-one", "token-two"})
+	if err != nil {
+		t.Fatalf("failed to create auth rule: %v", err)
+	}
+
+	tests := []struct {
+		header  string
+		matched bool
+	}{
+		{"Bearer token-one", true},
+		{"bearer token-two", true},
+		{"Bearer token-three", false},
+		{"Basic dG9rZW4tb25lOg==", false},
+		{"Bearer ", false},
+		{"", false},
+	}
+	for _, tc := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		if tc.header != "" {
+			req.Header.Set("Authorization", tc.header)
+		}
+		if got := rule.Evaluate(&Context{Request: req}).Matched; got != tc.matched {
+			t.Errorf("Authorization %q: expected matched=%v, got %v", tc.header, tc.matched, got)
+		}
+	}
+}
+
+func TestAuthRuleInvalid(t *testing.T) {
+	if _, err := NewAuthRule("digest", nil, []string{"x"}); err == nil {
+		t.Error("expected error for unknown scheme")
+	}
+	if _, err := NewAuthRule("basic", nil, nil); err == nil {
+		t.Error("expected error for basic auth without users")
+	}
+	if _, err := NewAuthRule("basic", map[string]string{"alice": "$2y$10$abcdefghijklmnopqrstuv"}, nil); err == nil {
+		t.Error("expected error for unsupported hash")
+	}
+	if _, err := NewAuthRule("bearer", nil, []string{""}); err == nil {
+		t.Error("expected error for empty token")
+	}
+}
+
+func TestLoadHtpasswd(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "htpasswd")
+	content := "# admins\nalice:$apr1$Xy7Qk2Lp$CpHVJCYy5ddp1Urai01X.0\n\nbob:{SHA}87u9ZqY9S/F0eUBXjsPQEDUw4h0=\n"
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	users, err := LoadHtpasswd(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(users) != 2 || users["bob"] != "{SHA}87u9ZqY9S/F0eUBXjsPQEDUw4h0=" {
+		t.Errorf("unexpected users: %v", users)
+	}
+
+	if err := os.WriteFile(path, []byte("carol:$2y$10$abcdefghijklmnopqrstuv\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadHtpasswd(path); err == nil {
+		t.Error("expected error for unsupported hash")
+	}
+}
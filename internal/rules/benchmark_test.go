@@ -3,6 +3,7 @@ package rules
 import (
 	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 func BenchmarkIPRuleEvaluate(b *testing.B) {
@@ -189,6 +190,33 @@ func BenchmarkEvaluatorAND(b *testing.B) {
 	}
 }
 
+func BenchmarkEvaluatorANDTimed(b *testing.B) {
+	ipRule, _ := NewIPRule([]string{"10.0.0.0/8"}, "allow")
+	uaRule, _ := NewUARule([]string{"Mozilla.*"}, "whitelist")
+	methodRule, _ := NewMethodRule([]string{"GET"}, "allow")
+
+	group := &Group{
+		And: []Rule{ipRule, uaRule, methodRule},
+	}
+
+	evaluator := NewEvaluatorWithOptions(EvaluatorOptions{
+		Observe: func(string, time.Duration) {},
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("User-Agent", "Mozilla/5.0")
+
+	ctx := &Context{
+		ClientIP: "10.0.0.50",
+		Request:  req,
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		evaluator.EvaluateGroup(group, ctx)
+	}
+}
+
 func BenchmarkEvaluatorOR(b *testing.B) {
 	ipRule1, _ := NewIPRule([]string{"10.0.0.0/8"}, "allow")
 	ipRule2, _ := NewIPRule([]string{"192.168.0.0/16"}, "allow")
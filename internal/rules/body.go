@@ -0,0 +1,169 @@
+package rules
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// DefaultMaxBodyInspect is the default number of bytes inspected by body rules (1MB)
+const DefaultMaxBodyInspect = 1 << 20
+
+// BodyRule matches requests based on request body content
+type BodyRule struct {
+	patterns []*regexp.Regexp
+	maxBytes int64
+	mode     string // "allow" or "deny"
+}
+
+// NewBodyRule creates a new body-content rule
+func NewBodyRule(patterns []string, maxBytes int64, mode string) (*BodyRule, error) {
+	if mode != "allow" && mode != "deny" {
+		return nil, fmt.Errorf("invalid mode: %s", mode)
+	}
+
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", p, err)
+		}
+		compiled = append(compiled, re)
+	}
+
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxBodyInspect
+	}
+
+	return &BodyRule{
+		patterns: compiled,
+		maxBytes: maxBytes,
+		mode:     mode,
+	}, nil
+}
+
+// Evaluate checks if the (decompressed) request body matches any pattern
+func (r *BodyRule) Evaluate(ctx *Context) Result {
+	if ctx.Request == nil {
+		return Result{Matched: false, Reason: "no HTTP request"}
+	}
+
+	body, err := ctx.InspectBody(r.maxBytes)
+	if err != nil {
+		return Result{
+			Matched: false,
+			Reason:  fmt.Sprintf("body inspection failed: %v", err),
+		}
+	}
+
+	for _, pattern := range r.patterns {
+		if pattern.Match(body) {
+			return Result{
+				Matched: true,
+				Reason:  fmt.Sprintf("body matched pattern %q (%s)", pattern.String(), r.mode),
+				Labels:  []string{"body-" + r.mode},
+			}
+		}
+	}
+
+	return Result{
+		Matched: false,
+		Reason:  fmt.Sprintf("body did not match any %s pattern", r.mode),
+	}
+}
+
+// Type returns the rule type
+func (r *BodyRule) Type() string {
+	return "body_" + r.mode
+}
+
+// InspectBody returns up to limit bytes of the decoded request body.
+// The raw body is buffered and restored on the request so the original
+// (still-encoded) bytes are forwarded to the backend unchanged. The result
+// is cached on the context so multiple body rules share a single read.
+func (ctx *Context) InspectBody(limit int64) ([]byte, error) {
+	if ctx.bodyRead {
+		if int64(len(ctx.body)) > limit {
+			return ctx.body[:limit], ctx.bodyErr
+		}
+		return ctx.body, ctx.bodyErr
+	}
+	ctx.bodyRead = true
+
+	req := ctx.Request
+	if req == nil || req.Body == nil {
+		return nil, nil
+	}
+
+	raw, err := io.ReadAll(io.LimitReader(req.Body, limit))
+	req.Body = &replayBody{
+		Reader: io.MultiReader(bytes.NewReader(raw), req.Body),
+		closer: req.Body,
+	}
+	if err != nil {
+		ctx.bodyErr = err
+		return nil, err
+	}
+	if len(raw) == 0 {
+		return nil, nil
+	}
+
+	ctx.body, ctx.bodyErr = DecodeBody(raw, req.Header.Get("Content-Encoding"), limit)
+	return ctx.body, ctx.bodyErr
+}
+
+// DecodeBody decompresses a body according to its Content-Encoding.
+// At most limit decoded bytes are returned, which guards against
+// decompression bombs. A truncated compressed stream yields whatever
+// could be decoded before the cut-off.
+func DecodeBody(raw []byte, encoding string, limit int64) ([]byte, error) {
+	var reader io.Reader
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", "identity":
+		if int64(len(raw)) > limit {
+			return raw[:limit], nil
+		}
+		return raw, nil
+	case "gzip", "x-gzip":
+		gz, err := gzip.NewReader(bytes.NewReader(raw))
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip body: %w", err)
+		}
+		defer gz.Close()
+		reader = gz
+	case "deflate":
+		// RFC 9110 deflate is zlib-wrapped, but many clients send raw deflate
+		zr, err := zlib.NewReader(bytes.NewReader(raw))
+		if err != nil {
+			fr := flate.NewReader(bytes.NewReader(raw))
+			defer fr.Close()
+			reader = fr
+		} else {
+			defer zr.Close()
+			reader = zr
+		}
+	default:
+		return nil, fmt.Errorf("unsupported content encoding: %s", encoding)
+	}
+
+	decoded, err := io.ReadAll(io.LimitReader(reader, limit))
+	if err != nil && err != io.ErrUnexpectedEOF && len(decoded) == 0 {
+		return nil, fmt.Errorf("failed to decode body: %w", err)
+	}
+	return decoded, nil
+}
+
+// replayBody re-serves buffered bytes ahead of the unread original body
+type replayBody struct {
+	io.Reader
+	closer io.Closer
+}
+
+func (b *replayBody) Close() error {
+	return b.closer.Close()
+}
@@ -0,0 +1,133 @@
+package rules
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func gzipBytes(t *testing.T, data []byte) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write(data)
+	if err := w.Close(); err != nil {
+		t.Fatalf("gzip: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestBodyRulePlain(t *testing.T) {
+	rule, err := NewBodyRule([]string{"(?i)union\\s+select"}, 0, "deny")
+	if err != nil {
+		t.Fatalf("failed to create rule: %v", err)
+	}
+
+	tests := []struct {
+		body    string
+		matched bool
+	}{
+		{"id=1 UNION SELECT password", true},
+		{"id=1", false},
+		{"", false},
+	}
+
+	for _, tc := range tests {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(tc.body))
+		result := rule.Evaluate(&Context{Request: req})
+		if result.Matched != tc.matched {
+			t.Errorf("body %q: expected matched=%v, got %v", tc.body, tc.matched, result.Matched)
+		}
+	}
+}
+
+func TestBodyRuleGzipPreservesOriginal(t *testing.T) {
+	rule, err := NewBodyRule([]string{"secret-marker"}, 0, "deny")
+	if err != nil {
+		t.Fatalf("failed to create rule: %v", err)
+	}
+
+	compressed := gzipBytes(t, []byte("payload with secret-marker inside"))
+	req := httptest.NewRequest("POST", "/", bytes.NewReader(compressed))
+	req.Header.Set("Content-Encoding", "gzip")
+
+	result := rule.Evaluate(&Context{Request: req})
+	if !result.Matched {
+		t.Errorf("expected gzip body to match, got reason %q", result.Reason)
+	}
+
+	forwarded, err := io.ReadAll(req.Body)
+	if err != nil {
+		t.Fatalf("failed to read restored body: %v", err)
+	}
+	if !bytes.Equal(forwarded, compressed) {
+		t.Error("expected original compressed body to be forwarded unchanged")
+	}
+}
+
+func TestBodyRuleDeflate(t *testing.T) {
+	rule, _ := NewBodyRule([]string{"needle"}, 0, "deny")
+
+	var zbuf bytes.Buffer
+	zw := zlib.NewWriter(&zbuf)
+	zw.Write([]byte("hay needle hay"))
+	zw.Close()
+
+	var fbuf bytes.Buffer
+	fw, _ := flate.NewWriter(&fbuf, flate.DefaultCompression)
+	fw.Write([]byte("hay needle hay"))
+	fw.Close()
+
+	for name, data := range map[string][]byte{"zlib": zbuf.Bytes(), "raw": fbuf.Bytes()} {
+		req := httptest.NewRequest("POST", "/", bytes.NewReader(data))
+		req.Header.Set("Content-Encoding", "deflate")
+		if result := rule.Evaluate(&Context{Request: req}); !result.Matched {
+			t.Errorf("%s deflate: expected match, got reason %q", name, result.Reason)
+		}
+	}
+}
+
+func TestDecodeBodySizeCap(t *testing.T) {
+	bomb := gzipBytes(t, bytes.Repeat([]byte("A"), 10<<20))
+
+	decoded, err := DecodeBody(bomb, "gzip", 1024)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(decoded) != 1024 {
+		t.Errorf("expected decoded body capped at 1024 bytes, got %d", len(decoded))
+	}
+}
+
+func TestDecodeBodyUnsupportedEncoding(t *testing.T) {
+	if _, err := DecodeBody([]byte("x"), "br", 1024); err == nil {
+		t.Error("expected error for unsupported encoding")
+	}
+}
+
+func TestBodyRuleSharedRead(t *testing.T) {
+	first, _ := NewBodyRule([]string{"alpha"}, 0, "deny")
+	second, _ := NewBodyRule([]string{"beta"}, 0, "deny")
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader("alpha beta"))
+	ctx := &Context{Request: req}
+
+	if !first.Evaluate(ctx).Matched || !second.Evaluate(ctx).Matched {
+		t.Error("expected both rules to match the same body")
+	}
+}
+
+func TestBodyRuleType(t *testing.T) {
+	rule, _ := NewBodyRule(nil, 0, "allow")
+	if rule.Type() != "body_allow" {
+		t.Errorf("expected type 'body_allow', got %q", rule.Type())
+	}
+
+	if _, err := NewBodyRule(nil, 0, "invalid"); err == nil {
+		t.Error("expected error for invalid mode")
+	}
+}
@@ -7,17 +7,60 @@ import (
 	"shadowgate/internal/geoip"
 )
 
+// GeoIP fail modes decide how geo and ASN rules evaluate when no GeoIP
+// database is loaded. By default they never match, which fails closed for
+// allow rules and open for deny rules.
+const (
+	GeoIPFailDefault = ""
+	GeoIPFailOpen    = "open"   // let the request through: allow rules match, deny rules don't
+	GeoIPFailClosed  = "closed" // reject the request: deny rules match, allow rules don't
+)
+
+// geoIPUnavailable returns the result of a geo or ASN rule in mode when the
+// GeoIP database is not loaded
+func geoIPUnavailable(mode, failMode string) Result {
+	if failMode == GeoIPFailDefault {
+		return Result{
+			Matched: false,
+			Reason:  "GeoIP database not loaded",
+		}
+	}
+	return Result{
+		Matched: (failMode == GeoIPFailOpen) == (mode == "allow"),
+		Reason:  fmt.Sprintf("GeoIP database not loaded, failing %s", failMode),
+		Labels:  []string{"geoip-unavailable"},
+	}
+}
+
+func validateGeoIPFailMode(failMode string) error {
+	switch failMode {
+	case GeoIPFailDefault, GeoIPFailOpen, GeoIPFailClosed:
+		return nil
+	}
+	return fmt.Errorf("invalid GeoIP fail mode: %s (must be 'open' or 'closed')", failMode)
+}
+
 // GeoRule matches requests based on geographic location
 type GeoRule struct {
 	countries map[string]bool
 	mode      string // "allow" or "deny"
+	failMode  string
 }
 
 // NewGeoRule creates a new geography-based rule
 func NewGeoRule(countryCodes []string, mode string) (*GeoRule, error) {
+	return NewGeoRuleWithFailMode(countryCodes, mode, GeoIPFailDefault)
+}
+
+// NewGeoRuleWithFailMode creates a geography-based rule that evaluates
+// according to failMode when no GeoIP database is loaded
+func NewGeoRuleWithFailMode(countryCodes []string, mode, failMode string) (*GeoRule, error) {
 	if mode != "allow" && mode != "deny" {
 		return nil, fmt.Errorf("invalid mode: %s (must be 'allow' or 'deny')", mode)
 	}
+	if err := validateGeoIPFailMode(failMode); err != nil {
+		return nil, err
+	}
 
 	countries := make(map[string]bool)
 	for _, code := range countryCodes {
@@ -27,24 +70,26 @@ func NewGeoRule(countryCodes []string, mode string) (*GeoRule, error) {
 	return &GeoRule{
 		countries: countries,
 		mode:      mode,
+		failMode:  failMode,
 	}, nil
 }
 
 // Evaluate checks if the client IP is in the configured countries
 func (r *GeoRule) Evaluate(ctx *Context) Result {
-	db := geoip.GetGlobal()
-	if db == nil {
-		return Result{
-			Matched: false,
-			Reason:  "GeoIP database not loaded",
+	code, name := strings.ToUpper(ctx.Country), ctx.Country
+	if code == "" {
+		db := geoip.GetGlobal()
+		if db == nil {
+			return geoIPUnavailable(r.mode, r.failMode)
 		}
-	}
 
-	code, name, err := db.LookupCountry(ctx.ClientIP)
-	if err != nil {
-		return Result{
-			Matched: false,
-			Reason:  fmt.Sprintf("GeoIP lookup failed: %v", err),
+		var err error
+		code, name, err = db.LookupCountry(ctx.ClientIP)
+		if err != nil {
+			return Result{
+				Matched: false,
+				Reason:  fmt.Sprintf("GeoIP lookup failed: %v", err),
+			}
 		}
 	}
 
@@ -63,15 +108,25 @@ func (r *GeoRule) Type() string {
 
 // ASNRule matches requests based on Autonomous System Number
 type ASNRule struct {
-	asns map[uint]bool
-	mode string // "allow" or "deny"
+	asns     map[uint]bool
+	mode     string // "allow" or "deny"
+	failMode string
 }
 
 // NewASNRule creates a new ASN-based rule
 func NewASNRule(asns []uint, mode string) (*ASNRule, error) {
+	return NewASNRuleWithFailMode(asns, mode, GeoIPFailDefault)
+}
+
+// NewASNRuleWithFailMode creates an ASN-based rule that evaluates according
+// to failMode when no GeoIP database is loaded
+func NewASNRuleWithFailMode(asns []uint, mode, failMode string) (*ASNRule, error) {
 	if mode != "allow" && mode != "deny" {
 		return nil, fmt.Errorf("invalid mode: %s (must be 'allow' or 'deny')", mode)
 	}
+	if err := validateGeoIPFailMode(failMode); err != nil {
+		return nil, err
+	}
 
 	asnMap := make(map[uint]bool)
 	for _, asn := range asns {
@@ -79,8 +134,9 @@ func NewASNRule(asns []uint, mode string) (*ASNRule, error) {
 	}
 
 	return &ASNRule{
-		asns: asnMap,
-		mode: mode,
+		asns:     asnMap,
+		mode:     mode,
+		failMode: failMode,
 	}, nil
 }
 
@@ -88,10 +144,7 @@ func NewASNRule(asns []uint, mode string) (*ASNRule, error) {
 func (r *ASNRule) Evaluate(ctx *Context) Result {
 	db := geoip.GetGlobal()
 	if db == nil {
-		return Result{
-			Matched: false,
-			Reason:  "GeoIP database not loaded",
-		}
+		return geoIPUnavailable(r.mode, r.failMode)
 	}
 
 	asn, org, err := db.LookupASN(ctx.ClientIP)
@@ -2,6 +2,10 @@ package rules
 
 import (
 	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
 	"regexp"
 	"strings"
 )
@@ -50,6 +54,58 @@ func (r *MethodRule) Type() string {
 	return "method_" + r.mode
 }
 
+// maxPathDecodes bounds repeated percent-decoding in NormalizePath
+const maxPathDecodes = 3
+
+// NormalizePath returns the canonical form of a request path for matching:
+// percent-encoding is decoded repeatedly (so %252e%252e is "..") and
+// backslashes are treated as slashes, then "." and ".." segments and
+// duplicate slashes are collapsed. A trailing slash is kept. Without this,
+// "/admin/../admin", "/%2e%2e/admin" or "//admin" would evade a rule for
+// "^/admin". The forwarded request is not changed.
+func NormalizePath(p string) string {
+	for i := 0; i < maxPathDecodes && strings.Contains(p, "%"); i++ {
+		decoded, err := url.PathUnescape(p)
+		if err != nil || decoded == p {
+			break
+		}
+		p = decoded
+	}
+	p = strings.ReplaceAll(p, "\\", "/")
+
+	if p == "*" {
+		return p // OPTIONS * has no path to normalize
+	}
+	trailing := strings.HasSuffix(p, "/") || strings.HasSuffix(p, "/.") || strings.HasSuffix(p, "/..")
+	p = path.Clean("/" + p)
+	if trailing && p != "/" {
+		p += "/"
+	}
+	return p
+}
+
+// Path returns the normalized request path, computing it on first use
+func (c *Context) Path() string {
+	if c.NormalizedPath == "" && c.Request != nil {
+		c.NormalizedPath = NormalizePath(c.Request.URL.Path)
+	}
+	return c.NormalizedPath
+}
+
+// Query returns the parsed query string, computing it on first use. Both
+// "&" and ";" separate parameters, since backends differ on ";" and a
+// parameter hidden behind one must not evade a rule. Malformed pairs are
+// skipped.
+func (c *Context) Query() url.Values {
+	if c.query == nil {
+		c.query = url.Values{}
+		if c.Request != nil && c.Request.URL.RawQuery != "" {
+			c.query, _ = url.ParseQuery(strings.ReplaceAll(c.Request.URL.RawQuery, ";", "&"))
+		}
+	}
+	return c.query
+}
+
 // PathRule matches requests based on URL path patterns
 type PathRule struct {
 	patterns []*regexp.Regexp
@@ -77,19 +133,29 @@ func NewPathRule(patterns []string, mode string) (*PathRule, error) {
 	}, nil
 }
 
-// Evaluate checks if the URL path matches any pattern
+// Evaluate checks if the URL path matches any pattern. Allow rules only see
+// the normalized path, so "/api/../admin" cannot pass as "/api". Deny rules
+// also match the path as received, so patterns looking for traversal
+// sequences such as "\.\./" keep working after normalization removes them.
 func (r *PathRule) Evaluate(ctx *Context) Result {
 	if ctx.Request == nil {
 		return Result{Matched: false, Reason: "no HTTP request"}
 	}
 
-	path := ctx.Request.URL.Path
+	paths := []string{ctx.Path()}
+	if r.mode == "deny" && ctx.Request.URL.Path != paths[0] {
+		paths = append(paths, ctx.Request.URL.Path)
+	}
+
+	path := paths[0]
 	for _, pattern := range r.patterns {
-		if pattern.MatchString(path) {
-			return Result{
-				Matched: true,
-				Reason:  fmt.Sprintf("path %q matched pattern %q (%s)", path, pattern.String(), r.mode),
-				Labels:  []string{"path-" + r.mode},
+		for _, p := range paths {
+			if pattern.MatchString(p) {
+				return Result{
+					Matched: true,
+					Reason:  fmt.Sprintf("path %q matched pattern %q (%s)", p, pattern.String(), r.mode),
+					Labels:  []string{"path-" + r.mode},
+				}
 			}
 		}
 	}
@@ -187,3 +253,485 @@ func (r *HeaderRule) Evaluate(ctx *Context) Result {
 func (r *HeaderRule) Type() string {
 	return "header_" + r.mode
 }
+
+// HeaderSetRule matches requests based on the presence of a set of headers
+type HeaderSetRule struct {
+	names []string
+	mode  string // "require_all" or "require_any"
+}
+
+// NewHeaderSetRule creates a rule over the header names. In require_all
+// mode it matches when every header is present, in require_any mode when
+// at least one is. A header sent with an empty value counts as missing.
+func NewHeaderSetRule(names []string, mode string) (*HeaderSetRule, error) {
+	if mode != "require_all" && mode != "require_any" {
+		return nil, fmt.Errorf("invalid mode: %s", mode)
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("at least one header name is required")
+	}
+
+	canonical := make([]string, 0, len(names))
+	for _, n := range names {
+		if strings.TrimSpace(n) == "" {
+			return nil, fmt.Errorf("empty header name")
+		}
+		canonical = append(canonical, http.CanonicalHeaderKey(strings.TrimSpace(n)))
+	}
+
+	return &HeaderSetRule{
+		names: canonical,
+		mode:  mode,
+	}, nil
+}
+
+// Evaluate checks which of the headers are present
+func (r *HeaderSetRule) Evaluate(ctx *Context) Result {
+	if ctx.Request == nil {
+		return Result{Matched: false, Reason: "no HTTP request"}
+	}
+
+	var present, missing []string
+	for _, name := range r.names {
+		if ctx.Request.Header.Get(name) != "" {
+			present = append(present, name)
+		} else {
+			missing = append(missing, name)
+		}
+	}
+
+	if r.mode == "require_all" {
+		if len(missing) > 0 {
+			labels := make([]string, 0, len(missing))
+			for _, name := range missing {
+				labels = append(labels, "missing-header-"+name)
+			}
+			return Result{
+				Matched: false,
+				Reason:  fmt.Sprintf("headers %s required but not present", strings.Join(missing, ", ")),
+				Labels:  labels,
+			}
+		}
+		return Result{
+			Matched: true,
+			Reason:  fmt.Sprintf("all headers present: %s", strings.Join(present, ", ")),
+			Labels:  []string{"header-set-complete"},
+		}
+	}
+
+	if len(present) == 0 {
+		return Result{
+			Matched: false,
+			Reason:  fmt.Sprintf("none of headers %s present", strings.Join(missing, ", ")),
+			Labels:  []string{"header-set-missing"},
+		}
+	}
+	return Result{
+		Matched: true,
+		Reason:  fmt.Sprintf("header %s present", present[0]),
+		Labels:  []string{"header-set-present"},
+	}
+}
+
+// Type returns the rule type
+func (r *HeaderSetRule) Type() string {
+	return "header_set"
+}
+
+// QueryRule matches requests based on a query string parameter
+type QueryRule struct {
+	param    string
+	values   map[string]bool
+	patterns []*regexp.Regexp
+	require  bool   // if true, the parameter must be present
+	mode     string // "allow" or "deny"
+}
+
+// NewQueryRule creates a rule for the query parameter param. The rule
+// matches when any value of the parameter equals one of values or matches
+// one of patterns, or when the parameter is present if neither is given.
+// With require set, requests without the parameter are rejected: an allow
+// rule does not match them and a deny rule does.
+func NewQueryRule(param string, values, patterns []string, require bool, mode string) (*QueryRule, error) {
+	if mode != "allow" && mode != "deny" {
+		return nil, fmt.Errorf("invalid mode: %s", mode)
+	}
+	if param == "" {
+		return nil, fmt.Errorf("query parameter name is required")
+	}
+
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", p, err)
+		}
+		compiled = append(compiled, re)
+	}
+
+	exact := make(map[string]bool, len(values))
+	for _, v := range values {
+		exact[v] = true
+	}
+
+	return &QueryRule{
+		param:    param,
+		values:   exact,
+		patterns: compiled,
+		require:  require,
+		mode:     mode,
+	}, nil
+}
+
+// Evaluate checks the query parameter against the configured values
+func (r *QueryRule) Evaluate(ctx *Context) Result {
+	if ctx.Request == nil {
+		return Result{Matched: false, Reason: "no HTTP request"}
+	}
+
+	values, present := ctx.Query()[r.param]
+	if !present {
+		if r.require {
+			return Result{
+				Matched: r.mode == "deny",
+				Reason:  fmt.Sprintf("query parameter %q required but not present", r.param),
+				Labels:  []string{"missing-query-" + r.param},
+			}
+		}
+		return Result{
+			Matched: r.mode == "allow",
+			Reason:  fmt.Sprintf("query parameter %q not present, not required", r.param),
+		}
+	}
+
+	// If no values or patterns specified, just check presence
+	if len(r.values) == 0 && len(r.patterns) == 0 {
+		return Result{
+			Matched: true,
+			Reason:  fmt.Sprintf("query parameter %q is present", r.param),
+			Labels:  []string{"query-present-" + r.param},
+		}
+	}
+
+	for _, v := range values {
+		if r.matches(v) {
+			return Result{
+				Matched: true,
+				Reason:  fmt.Sprintf("query parameter %q value matched (%s)", r.param, r.mode),
+				Labels:  []string{"query-" + r.mode + "-" + r.param},
+			}
+		}
+	}
+
+	return Result{
+		Matched: false,
+		Reason:  fmt.Sprintf("query parameter %q value did not match any %s value", r.param, r.mode),
+	}
+}
+
+func (r *QueryRule) matches(v string) bool {
+	if r.values[v] {
+		return true
+	}
+	for _, pattern := range r.patterns {
+		if pattern.MatchString(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// Type returns the rule type
+func (r *QueryRule) Type() string {
+	return "query_" + r.mode
+}
+
+// CookieRule matches requests based on a named cookie's presence or value
+type CookieRule struct {
+	name     string
+	patterns []*regexp.Regexp
+	require  bool   // if true, the cookie must be present
+	mode     string // "allow" or "deny"
+}
+
+// NewCookieRule creates a rule for the cookie name. The rule matches when
+// any cookie with that name has a value matching one of patterns, or when
+// the cookie is present if no patterns are given. With require set,
+// requests without the cookie are rejected: an allow rule does not match
+// them and a deny rule does.
+func NewCookieRule(name string, patterns []string, require bool, mode string) (*CookieRule, error) {
+	if mode != "allow" && mode != "deny" {
+		return nil, fmt.Errorf("invalid mode: %s", mode)
+	}
+	if name == "" {
+		return nil, fmt.Errorf("cookie name is required")
+	}
+
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", p, err)
+		}
+		compiled = append(compiled, re)
+	}
+
+	return &CookieRule{
+		name:     name,
+		patterns: compiled,
+		require:  require,
+		mode:     mode,
+	}, nil
+}
+
+// Evaluate checks the named cookie against the configured patterns. Cookies
+// are parsed from every Cookie header, so splitting them across headers or
+// reordering them does not evade the rule.
+func (r *CookieRule) Evaluate(ctx *Context) Result {
+	if ctx.Request == nil {
+		return Result{Matched: false, Reason: "no HTTP request"}
+	}
+
+	var values []string
+	for _, c := range ctx.Request.Cookies() {
+		if c.Name == r.name {
+			values = append(values, c.Value)
+		}
+	}
+
+	if len(values) == 0 {
+		if r.require {
+			return Result{
+				Matched: r.mode == "deny",
+				Reason:  fmt.Sprintf("cookie %q required but not present", r.name),
+				Labels:  []string{"missing-cookie-" + r.name},
+			}
+		}
+		return Result{
+			Matched: r.mode == "allow",
+			Reason:  fmt.Sprintf("cookie %q not present, not required", r.name),
+		}
+	}
+
+	// If no patterns specified, just check presence
+	if len(r.patterns) == 0 {
+		return Result{
+			Matched: true,
+			Reason:  fmt.Sprintf("cookie %q is present", r.name),
+			Labels:  []string{"cookie-present-" + r.name},
+		}
+	}
+
+	for _, v := range values {
+		for _, pattern := range r.patterns {
+			if pattern.MatchString(v) {
+				return Result{
+					Matched: true,
+					Reason:  fmt.Sprintf("cookie %q value matched pattern (%s)", r.name, r.mode),
+					Labels:  []string{"cookie-" + r.mode + "-" + r.name},
+				}
+			}
+		}
+	}
+
+	return Result{
+		Matched: false,
+		Reason:  fmt.Sprintf("cookie %q value did not match any %s pattern", r.name, r.mode),
+	}
+}
+
+// Type returns the rule type
+func (r *CookieRule) Type() string {
+	return "cookie_" + r.mode
+}
+
+// protoVersion is an HTTP major/minor version pair
+type protoVersion struct {
+	major, minor int
+}
+
+func (v protoVersion) String() string {
+	if v.major >= 2 {
+		return fmt.Sprintf("HTTP/%d", v.major)
+	}
+	return fmt.Sprintf("HTTP/%d.%d", v.major, v.minor)
+}
+
+// parseProtoVersion parses "1.0", "1.1", "2", "3" with an optional "HTTP/" prefix
+func parseProtoVersion(v string) (protoVersion, error) {
+	s := strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(v)), "HTTP/")
+	switch s {
+	case "1.0":
+		return protoVersion{1, 0}, nil
+	case "1.1":
+		return protoVersion{1, 1}, nil
+	case "2", "2.0":
+		return protoVersion{2, 0}, nil
+	case "3", "3.0":
+		return protoVersion{3, 0}, nil
+	default:
+		return protoVersion{}, fmt.Errorf("unknown HTTP version: %s", v)
+	}
+}
+
+// ProtocolRule matches requests based on HTTP protocol version
+type ProtocolRule struct {
+	versions map[protoVersion]bool
+	mode     string // "allow" or "deny"
+}
+
+// NewProtocolRule creates a new HTTP protocol version rule
+func NewProtocolRule(versions []string, mode string) (*ProtocolRule, error) {
+	if mode != "allow" && mode != "deny" {
+		return nil, fmt.Errorf("invalid mode: %s", mode)
+	}
+
+	versionMap := make(map[protoVersion]bool)
+	for _, v := range versions {
+		pv, err := parseProtoVersion(v)
+		if err != nil {
+			return nil, err
+		}
+		versionMap[pv] = true
+	}
+
+	return &ProtocolRule{
+		versions: versionMap,
+		mode:     mode,
+	}, nil
+}
+
+// Evaluate checks if the HTTP protocol version matches
+func (r *ProtocolRule) Evaluate(ctx *Context) Result {
+	v := protoVersion{ctx.ProtoMajor, ctx.ProtoMinor}
+	if v.major == 0 {
+		if ctx.Request == nil {
+			return Result{Matched: false, Reason: "no HTTP request"}
+		}
+		v = protoVersion{ctx.Request.ProtoMajor, ctx.Request.ProtoMinor}
+	}
+
+	matched := r.versions[v]
+
+	return Result{
+		Matched: matched,
+		Reason:  fmt.Sprintf("protocol %s, %s list", v, r.mode),
+		Labels:  []string{"http-version-" + r.mode, v.String()},
+	}
+}
+
+// Type returns the rule type
+func (r *ProtocolRule) Type() string {
+	return "http_version_" + r.mode
+}
+
+// HostRule matches requests based on the Host header
+type HostRule struct {
+	hosts     map[string]bool // exact hostnames, lowercase
+	wildcards []string        // "*.example.com" entries as ".example.com"
+	patterns  []*regexp.Regexp
+	mode      string // "allow" or "deny"
+}
+
+// NewHostRule creates a new Host header rule. Hosts are matched exactly
+// (case-insensitive, port ignored) and may use a leading "*." wildcard for
+// one subdomain level; patterns are regular expressions matched against the
+// hostname.
+func NewHostRule(hosts, patterns []string, mode string) (*HostRule, error) {
+	if mode != "allow" && mode != "deny" {
+		return nil, fmt.Errorf("invalid mode: %s", mode)
+	}
+
+	rule := &HostRule{
+		hosts: make(map[string]bool),
+		mode:  mode,
+	}
+	for _, h := range hosts {
+		h = normalizeHost(h)
+		if h == "" {
+			return nil, fmt.Errorf("empty host")
+		}
+		if suffix, ok := strings.CutPrefix(h, "*"); ok {
+			if !strings.HasPrefix(suffix, ".") || len(suffix) < 2 {
+				return nil, fmt.Errorf("invalid wildcard host %q", h)
+			}
+			rule.wildcards = append(rule.wildcards, suffix)
+			continue
+		}
+		rule.hosts[h] = true
+	}
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", p, err)
+		}
+		rule.patterns = append(rule.patterns, re)
+	}
+
+	return rule, nil
+}
+
+// normalizeHost lowercases a Host value and strips the port and any
+// trailing dot
+func normalizeHost(h string) string {
+	h = strings.ToLower(strings.TrimSpace(h))
+	if host, _, err := net.SplitHostPort(h); err == nil {
+		h = host
+	} else {
+		h = strings.TrimSuffix(strings.TrimPrefix(h, "["), "]")
+	}
+	return strings.TrimSuffix(h, ".")
+}
+
+// Evaluate checks if the Host header matches. A missing Host never matches
+// an allow rule and always matches a deny rule.
+func (r *HostRule) Evaluate(ctx *Context) Result {
+	if ctx.Request == nil {
+		return Result{Matched: false, Reason: "no HTTP request"}
+	}
+
+	host := normalizeHost(ctx.Request.Host)
+	if host == "" {
+		return Result{
+			Matched: r.mode == "deny",
+			Reason:  fmt.Sprintf("Host header missing (%s)", r.mode),
+			Labels:  []string{"no-host"},
+		}
+	}
+
+	if r.matches(host) {
+		return Result{
+			Matched: true,
+			Reason:  fmt.Sprintf("host %q matched (%s)", host, r.mode),
+			Labels:  []string{"host-" + r.mode},
+		}
+	}
+
+	return Result{
+		Matched: false,
+		Reason:  fmt.Sprintf("host %q did not match any %s entry", host, r.mode),
+	}
+}
+
+func (r *HostRule) matches(host string) bool {
+	if r.hosts[host] {
+		return true
+	}
+	for _, suffix := range r.wildcards {
+		// One subdomain level only: "a.example.com" but not "a.b.example.com"
+		if label, ok := strings.CutSuffix(host, suffix); ok && label != "" && !strings.Contains(label, ".") {
+			return true
+		}
+	}
+	for _, pattern := range r.patterns {
+		if pattern.MatchString(host) {
+			return true
+		}
+	}
+	return false
+}
+
+// Type returns the rule type
+func (r *HostRule) Type() string {
+	return "host_" + r.mode
+}
@@ -59,6 +59,81 @@ func TestPathRule(t *testing.T) {
 	}
 }
 
+func TestNormalizePath(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"/admin", "/admin"},
+		{"/admin/", "/admin/"},
+		{"/admin/../admin", "/admin"},
+		{"/public/../admin/login", "/admin/login"},
+		{"//admin", "/admin"},
+		{"/./admin", "/admin"},
+		{"/admin/.", "/admin/"},
+		{"/%2e%2e/admin", "/admin"},
+		{"/public/%252e%252e/admin", "/admin"},
+		{"/public%5c..%5cadmin", "/admin"},
+		{"/../../../etc/passwd", "/etc/passwd"},
+		{"", "/"},
+		{"admin", "/admin"},
+		{"*", "*"},
+		{"/100%", "/100%"},
+	}
+
+	for _, tc := range tests {
+		if got := NormalizePath(tc.in); got != tc.want {
+			t.Errorf("NormalizePath(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestPathRuleEvasion(t *testing.T) {
+	rule, err := NewPathRule([]string{"^/admin"}, "deny")
+	if err != nil {
+		t.Fatalf("failed to create rule: %v", err)
+	}
+
+	for _, target := range []string{
+		"/admin/../admin",
+		"/public/../admin",
+		"//admin",
+		"/./admin/panel",
+		"/%2e%2e/admin",
+		"/x/%252e%252e/admin",
+		"/public%5c..%5cadmin",
+		"/%61dmin",
+	} {
+		req := httptest.NewRequest("GET", target, nil)
+		original := req.URL.Path
+		if !rule.Evaluate(&Context{Request: req}).Matched {
+			t.Errorf("expected %s to match path_deny ^/admin", target)
+		}
+		if req.URL.Path != original {
+			t.Errorf("expected request path %q to be left unchanged, got %q", original, req.URL.Path)
+		}
+	}
+
+	// Paths that only resemble the protected prefix are not matched
+	req := httptest.NewRequest("GET", "/public/admin", nil)
+	if rule.Evaluate(&Context{Request: req}).Matched {
+		t.Error("expected /public/admin not to match ^/admin")
+	}
+
+	// Deny patterns for traversal sequences still see the original path
+	traversal, _ := NewPathRule([]string{"\\.\\./"}, "deny")
+	req = httptest.NewRequest("GET", "/static/../etc/passwd", nil)
+	if !traversal.Evaluate(&Context{Request: req}).Matched {
+		t.Error("expected deny rule to match traversal in the original path")
+	}
+
+	// Allow rules only trust the normalized path
+	allow, _ := NewPathRule([]string{"^/api/"}, "allow")
+	req = httptest.NewRequest("GET", "/api/../admin", nil)
+	if allow.Evaluate(&Context{Request: req}).Matched {
+		t.Error("expected /api/../admin not to match allow ^/api/")
+	}
+}
+
 func TestHeaderRule(t *testing.T) {
 	// Test header presence required
 	rule, err := NewHeaderRule("Authorization", nil, true, "allow")
@@ -89,3 +164,245 @@ func TestHeaderRule(t *testing.T) {
 		t.Error("expected matched for matching content-type")
 	}
 }
+
+func TestHeaderSetRule(t *testing.T) {
+	browser := []string{"Accept", "accept-language", "Accept-Encoding"}
+	all, err := NewHeaderSetRule(browser, "require_all")
+	if err != nil {
+		t.Fatalf("failed to create rule: %v", err)
+	}
+	any, err := NewHeaderSetRule(browser, "require_any")
+	if err != nil {
+		t.Fatalf("failed to create rule: %v", err)
+	}
+
+	tests := []struct {
+		rule    *HeaderSetRule
+		headers map[string]string
+		matched bool
+	}{
+		{all, map[string]string{"Accept": "*/*", "Accept-Language": "en", "Accept-Encoding": "gzip"}, true},
+		{all, map[string]string{"Accept": "*/*", "Accept-Encoding": "gzip"}, false},
+		{all, map[string]string{"Accept": "*/*", "Accept-Language": "", "Accept-Encoding": "gzip"}, false}, // empty counts as missing
+		{all, nil, false},
+		{any, map[string]string{"Accept-Language": "en"}, true},
+		{any, map[string]string{"User-Agent": "curl/8.0"}, false},
+		{any, nil, false},
+	}
+
+	for i, tc := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		for k, v := range tc.headers {
+			req.Header.Set(k, v)
+		}
+		result := tc.rule.Evaluate(&Context{Request: req})
+		if result.Matched != tc.matched {
+			t.Errorf("case %d (%s): expected matched=%v, got %v (%s)", i, tc.rule.mode, tc.matched, result.Matched, result.Reason)
+		}
+	}
+
+	if _, err := NewHeaderSetRule(browser, "require_none"); err == nil {
+		t.Error("expected error for invalid mode")
+	}
+	if _, err := NewHeaderSetRule(nil, "require_all"); err == nil {
+		t.Error("expected error for empty header list")
+	}
+}
+
+func TestQueryRule(t *testing.T) {
+	debug, err := NewQueryRule("debug", []string{"true", "1"}, nil, false, "deny")
+	if err != nil {
+		t.Fatalf("failed to create rule: %v", err)
+	}
+	version, err := NewQueryRule("api_version", nil, []string{`^v[0-9]+$`}, true, "allow")
+	if err != nil {
+		t.Fatalf("failed to create rule: %v", err)
+	}
+	present, err := NewQueryRule("trace", nil, nil, false, "deny")
+	if err != nil {
+		t.Fatalf("failed to create rule: %v", err)
+	}
+
+	tests := []struct {
+		rule    *QueryRule
+		target  string
+		matched bool
+	}{
+		{debug, "/?debug=true", true},
+		{debug, "/?debug=false", false},
+		{debug, "/?page=2&debug=1", true},
+		{debug, "/?page=2;debug=1", true}, // ";" cannot hide a parameter
+		{debug, "/?debug=%74rue", true},
+		{debug, "/", false},
+		{version, "/?api_version=v2", true},
+		{version, "/?api_version=latest", false},
+		{version, "/", false}, // required parameter missing
+		{present, "/?trace", true},
+		{present, "/?other=1", false},
+	}
+
+	for _, tc := range tests {
+		ctx := &Context{Request: httptest.NewRequest("GET", tc.target, nil)}
+		result := tc.rule.Evaluate(ctx)
+		if result.Matched != tc.matched {
+			t.Errorf("%s %s: expected matched=%v, got %v (%s)", tc.rule.Type(), tc.target, tc.matched, result.Matched, result.Reason)
+		}
+	}
+
+	// A required parameter missing from a request matches a deny rule
+	require, _ := NewQueryRule("token", nil, nil, true, "deny")
+	if !require.Evaluate(&Context{Request: httptest.NewRequest("GET", "/", nil)}).Matched {
+		t.Error("expected deny rule to match request without required parameter")
+	}
+
+	if _, err := NewQueryRule("", nil, nil, false, "deny"); err == nil {
+		t.Error("expected error for missing parameter name")
+	}
+	if _, err := NewQueryRule("q", nil, []string{"("}, false, "deny"); err == nil {
+		t.Error("expected error for invalid pattern")
+	}
+}
+
+func TestCookieRule(t *testing.T) {
+	session, err := NewCookieRule("session", []string{`^[a-f0-9]{32}$`}, true, "allow")
+	if err != nil {
+		t.Fatalf("failed to create rule: %v", err)
+	}
+	debug, err := NewCookieRule("debug", nil, false, "deny")
+	if err != nil {
+		t.Fatalf("failed to create rule: %v", err)
+	}
+
+	tests := []struct {
+		rule    *CookieRule
+		cookies []string // Cookie header values
+		matched bool
+	}{
+		{session, []string{"session=0123456789abcdef0123456789abcdef"}, true},
+		{session, []string{"theme=dark; session=0123456789abcdef0123456789abcdef"}, true},
+		{session, []string{"theme=dark", "session=0123456789abcdef0123456789abcdef"}, true},
+		{session, []string{"session=guest"}, false},
+		{session, []string{"theme=dark"}, false}, // required cookie missing
+		{session, nil, false},
+		{debug, []string{"debug=1"}, true},
+		{debug, []string{"debug="}, true},
+		{debug, []string{"theme=dark"}, false},
+		{debug, []string{"xdebug=1"}, false},
+	}
+
+	for _, tc := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		for _, c := range tc.cookies {
+			req.Header.Add("Cookie", c)
+		}
+		result := tc.rule.Evaluate(&Context{Request: req})
+		if result.Matched != tc.matched {
+			t.Errorf("%s %q: expected matched=%v, got %v (%s)", tc.rule.Type(), tc.cookies, tc.matched, result.Matched, result.Reason)
+		}
+	}
+
+	// A required cookie missing from a request matches a deny rule
+	require, _ := NewCookieRule("session", nil, true, "deny")
+	if !require.Evaluate(&Context{Request: httptest.NewRequest("GET", "/", nil)}).Matched {
+		t.Error("expected deny rule to match request without required cookie")
+	}
+
+	if _, err := NewCookieRule("", nil, false, "deny"); err == nil {
+		t.Error("expected error for missing cookie name")
+	}
+	if _, err := NewCookieRule("c", []string{"("}, false, "deny"); err == nil {
+		t.Error("expected error for invalid pattern")
+	}
+}
+
+func TestProtocolRule(t *testing.T) {
+	rule, err := NewProtocolRule([]string{"1.0", "HTTP/1.1"}, "deny")
+	if err != nil {
+		t.Fatalf("failed to create rule: %v", err)
+	}
+
+	tests := []struct {
+		major, minor int
+		matched      bool
+	}{
+		{1, 0, true},
+		{1, 1, true},
+		{2, 0, false},
+	}
+
+	for _, tc := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		ctx := &Context{Request: req, ProtoMajor: tc.major, ProtoMinor: tc.minor}
+		result := rule.Evaluate(ctx)
+		if result.Matched != tc.matched {
+			t.Errorf("HTTP/%d.%d: expected matched=%v, got %v", tc.major, tc.minor, tc.matched, result.Matched)
+		}
+	}
+
+	// Falls back to the request's protocol when the context is not populated
+	req := httptest.NewRequest("GET", "/", nil) // HTTP/1.1
+	if !rule.Evaluate(&Context{Request: req}).Matched {
+		t.Error("expected request protocol HTTP/1.1 to match")
+	}
+
+	if rule.Type() != "http_version_deny" {
+		t.Errorf("expected type 'http_version_deny', got %q", rule.Type())
+	}
+
+	if _, err := NewProtocolRule([]string{"0.9"}, "allow"); err == nil {
+		t.Error("expected error for unknown HTTP version")
+	}
+}
+
+func TestHostRule(t *testing.T) {
+	rule, err := NewHostRule([]string{"Example.com", "*.api.example.com"}, []string{`^static[0-9]+\.example\.net$`}, "allow")
+	if err != nil {
+		t.Fatalf("failed to create rule: %v", err)
+	}
+
+	tests := []struct {
+		host    string
+		matched bool
+	}{
+		{"example.com", true},
+		{"EXAMPLE.COM:8443", true},
+		{"example.com.", true},
+		{"v1.api.example.com", true},
+		{"a.v1.api.example.com", false}, // wildcard covers one level only
+		{"api.example.com", false},
+		{"static3.example.net", true},
+		{"203.0.113.7", false},
+		{"[2001:db8::1]:443", false},
+		{"", false},
+	}
+
+	for _, tc := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Host = tc.host
+		if got := rule.Evaluate(&Context{Request: req}).Matched; got != tc.matched {
+			t.Errorf("host %q: expected matched=%v, got %v", tc.host, tc.matched, got)
+		}
+	}
+
+	deny, _ := NewHostRule([]string{"203.0.113.7"}, nil, "deny")
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Host = ""
+	if !deny.Evaluate(&Context{Request: req}).Matched {
+		t.Error("expected missing Host to match deny rule")
+	}
+	req.Host = "203.0.113.7:80"
+	if !deny.Evaluate(&Context{Request: req}).Matched {
+		t.Error("expected IP Host to match deny rule")
+	}
+
+	if deny.Type() != "host_deny" {
+		t.Errorf("expected type 'host_deny', got %q", deny.Type())
+	}
+
+	if _, err := NewHostRule([]string{"*example.com"}, nil, "allow"); err == nil {
+		t.Error("expected error for malformed wildcard")
+	}
+	if _, err := NewHostRule(nil, []string{"("}, "allow"); err == nil {
+		t.Error("expected error for invalid pattern")
+	}
+}
@@ -3,6 +3,8 @@ package rules
 import (
 	"fmt"
 	"net"
+	"net/netip"
+	"strings"
 )
 
 // IPRule matches requests based on client IP against CIDR ranges
@@ -29,7 +31,7 @@ func NewIPRule(cidrs []string, mode string) (*IPRule, error) {
 			}
 			network = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
 		}
-		networks = append(networks, network)
+		networks = append(networks, unmapNetwork(network))
 	}
 
 	if mode != "allow" && mode != "deny" {
@@ -44,7 +46,7 @@ func NewIPRule(cidrs []string, mode string) (*IPRule, error) {
 
 // Evaluate checks if the client IP matches any of the configured networks
 func (r *IPRule) Evaluate(ctx *Context) Result {
-	ip := net.ParseIP(ctx.ClientIP)
+	ip := parseClientIP(ctx.ClientIP)
 	if ip == nil {
 		return Result{
 			Matched: false,
@@ -72,3 +74,29 @@ func (r *IPRule) Evaluate(ctx *Context) Result {
 func (r *IPRule) Type() string {
 	return "ip_" + r.mode
 }
+
+// parseClientIP parses a client address for matching. A zone identifier
+// ("fe80::1%eth0") is dropped and an IPv4-mapped IPv6 address
+// ("::ffff:10.0.0.1") is reduced to its IPv4 form, so that dual-stack
+// listeners cannot present an IPv4 client in a form IPv4 CIDRs miss.
+func parseClientIP(s string) net.IP {
+	addr, err := netip.ParseAddr(strings.TrimSuffix(strings.TrimPrefix(s, "["), "]"))
+	if err != nil {
+		return nil
+	}
+	return net.IP(addr.WithZone("").Unmap().AsSlice())
+}
+
+// unmapNetwork rewrites an IPv4-mapped IPv6 network ("::ffff:10.0.0.0/104")
+// as the IPv4 network it covers, matching how client IPs are normalized
+func unmapNetwork(network *net.IPNet) *net.IPNet {
+	ones, bits := network.Mask.Size()
+	if bits != 128 || ones < 96 {
+		return network
+	}
+	addr, ok := netip.AddrFromSlice(network.IP)
+	if !ok || !addr.Is4In6() {
+		return network
+	}
+	return &net.IPNet{IP: net.IP(addr.Unmap().AsSlice()), Mask: net.CIDRMask(ones-96, 32)}
+}
@@ -0,0 +1,338 @@
+package rules
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"hash"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// JWTConfig configures a JWT rule. Empty fields are not checked.
+type JWTConfig struct {
+	Issuers   []string          // accepted "iss" values
+	Audiences []string          // accepted "aud" values; any one must be present
+	Claims    map[string]string // claim name -> regex the claim value must match
+
+	// Signature verification, at most one of them. Without a key the
+	// signature is not checked and any client can forge a token.
+	Secret    []byte         // HMAC key for HS256, HS384 and HS512
+	PublicKey *rsa.PublicKey // RSA key for RS256, RS384 and RS512
+
+	// Leeway is the clock skew allowed when checking "exp" and "nbf"
+	Leeway time.Duration
+}
+
+// JWTRule matches requests carrying a bearer JWT whose claims satisfy the
+// configured issuer, audience and claim patterns and that has not expired.
+// Use it in allow rules so requests without a suitable token are denied.
+type JWTRule struct {
+	issuers   map[string]bool
+	audiences map[string]bool
+	claims    map[string]*regexp.Regexp
+	names     []string // claim names in order, for stable reasons
+	secret    []byte
+	publicKey *rsa.PublicKey
+	leeway    time.Duration
+	now       func() time.Time
+}
+
+// NewJWTRule creates a JWT rule
+func NewJWTRule(cfg JWTConfig) (*JWTRule, error) {
+	if len(cfg.Secret) > 0 && cfg.PublicKey != nil {
+		return nil, fmt.Errorf("jwt: secret and public key cannot both be set")
+	}
+
+	r := &JWTRule{
+		issuers:   make(map[string]bool, len(cfg.Issuers)),
+		audiences: make(map[string]bool, len(cfg.Audiences)),
+		claims:    make(map[string]*regexp.Regexp, len(cfg.Claims)),
+		secret:    cfg.Secret,
+		publicKey: cfg.PublicKey,
+		leeway:    cfg.Leeway,
+		now:       time.Now,
+	}
+	for _, iss := range cfg.Issuers {
+		r.issuers[iss] = true
+	}
+	for _, aud := range cfg.Audiences {
+		r.audiences[aud] = true
+	}
+	for name, pattern := range cfg.Claims {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q for claim %q: %w", pattern, name, err)
+		}
+		r.claims[name] = re
+		r.names = append(r.names, name)
+	}
+	sort.Strings(r.names)
+	return r, nil
+}
+
+// Evaluate checks the bearer token in the request's Authorization header
+func (r *JWTRule) Evaluate(ctx *Context) Result {
+	if ctx.Request == nil {
+		return Result{Matched: false, Reason: "no HTTP request"}
+	}
+
+	token, present := bearerToken(ctx.Request.Header.Get("Authorization"))
+	if !present {
+		return Result{Matched: false, Reason: "no bearer token", Labels: []string{"jwt-missing"}}
+	}
+
+	claims, err := r.parse(token)
+	if err == nil {
+		err = r.check(claims)
+	}
+	if err != nil {
+		return Result{
+			Matched: false,
+			Reason:  "invalid JWT: " + err.Error(),
+			Labels:  []string{"jwt-invalid"},
+		}
+	}
+
+	label := "jwt-verified"
+	if len(r.secret) == 0 && r.publicKey == nil {
+		label = "jwt-unverified"
+	}
+	reason := "JWT claims accepted"
+	if iss, ok := claims["iss"].(string); ok {
+		reason = fmt.Sprintf("JWT from issuer %q accepted", iss)
+	}
+	return Result{Matched: true, Reason: reason, Labels: []string{label}}
+}
+
+// parse decodes a compact JWT, verifying its signature when a key is
+// configured, and returns its claims
+func (r *JWTRule) parse(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("malformed header")
+	}
+
+	if len(r.secret) > 0 || r.publicKey != nil {
+		sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+		if err != nil {
+			return nil, fmt.Errorf("malformed signature")
+		}
+		if err := r.verify(header.Alg, parts[0]+"."+parts[1], sig); err != nil {
+			return nil, err
+		}
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("malformed claims")
+	}
+	return claims, nil
+}
+
+// verify checks the signature of signed with the configured key. The
+// algorithm must belong to the key's family so an HMAC token cannot be
+// validated with the RSA public key as its secret.
+func (r *JWTRule) verify(alg, signed string, sig []byte) error {
+	newHash, cryptoHash, ok := jwtHash(alg)
+	if !ok {
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+
+	switch {
+	case len(r.secret) > 0 && strings.HasPrefix(alg, "HS"):
+		mac := hmac.New(newHash, r.secret)
+		mac.Write([]byte(signed))
+		if !hmac.Equal(mac.Sum(nil), sig) {
+			return fmt.Errorf("signature mismatch")
+		}
+	case r.publicKey != nil && strings.HasPrefix(alg, "RS"):
+		h := newHash()
+		h.Write([]byte(signed))
+		if err := rsa.VerifyPKCS1v15(r.publicKey, cryptoHash, h.Sum(nil), sig); err != nil {
+			return fmt.Errorf("signature mismatch")
+		}
+	default:
+		return fmt.Errorf("algorithm %q does not match the configured key", alg)
+	}
+	return nil
+}
+
+// jwtHash returns the hash used by a supported JWT algorithm
+func jwtHash(alg string) (func() hash.Hash, crypto.Hash, bool) {
+	switch alg {
+	case "HS256", "RS256":
+		return sha256.New, crypto.SHA256, true
+	case "HS384", "RS384":
+		return sha512.New384, crypto.SHA384, true
+	case "HS512", "RS512":
+		return sha512.New, crypto.SHA512, true
+	}
+	return nil, 0, false
+}
+
+// check validates the time, issuer, audience and custom claims
+func (r *JWTRule) check(claims map[string]interface{}) error {
+	now := r.now()
+	if v, ok := claims["exp"]; ok {
+		exp, ok := numericDate(v)
+		if !ok {
+			return fmt.Errorf("malformed exp claim")
+		}
+		if now.After(exp.Add(r.leeway)) {
+			return fmt.Errorf("token expired")
+		}
+	}
+	if v, ok := claims["nbf"]; ok {
+		nbf, ok := numericDate(v)
+		if !ok {
+			return fmt.Errorf("malformed nbf claim")
+		}
+		if now.Add(r.leeway).Before(nbf) {
+			return fmt.Errorf("token not valid yet")
+		}
+	}
+
+	if len(r.issuers) > 0 {
+		iss, _ := claims["iss"].(string)
+		if !r.issuers[iss] {
+			return fmt.Errorf("issuer %q not accepted", iss)
+		}
+	}
+
+	if len(r.audiences) > 0 {
+		accepted := false
+		for _, aud := range claimStrings(claims["aud"]) {
+			if r.audiences[aud] {
+				accepted = true
+				break
+			}
+		}
+		if !accepted {
+			return fmt.Errorf("audience not accepted")
+		}
+	}
+
+	for _, name := range r.names {
+		values := claimStrings(claims[name])
+		if len(values) == 0 {
+			return fmt.Errorf("claim %q missing", name)
+		}
+		matched := false
+		for _, v := range values {
+			if r.claims[name].MatchString(v) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fmt.Errorf("claim %q did not match", name)
+		}
+	}
+	return nil
+}
+
+// Type returns the rule type
+func (r *JWTRule) Type() string {
+	return "jwt"
+}
+
+// decodeSegment decodes a base64url JWT segment as JSON. Numbers are kept
+// as json.Number so large NumericDate values stay exact.
+func decodeSegment(segment string, v interface{}) error {
+	raw, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// numericDate converts a NumericDate claim (seconds since the epoch)
+func numericDate(v interface{}) (time.Time, bool) {
+	n, ok := v.(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+	secs, err := n.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, 0).Add(time.Duration(secs * float64(time.Second))), true
+}
+
+// claimStrings returns a claim value as strings: arrays yield one string
+// per element, numbers and booleans their JSON text
+func claimStrings(v interface{}) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case json.Number:
+		return []string{v.String()}
+	case bool:
+		return []string{strconv.FormatBool(v)}
+	case []interface{}:
+		var out []string
+		for _, e := range v {
+			out = append(out, claimStrings(e)...)
+		}
+		return out
+	}
+	return nil
+}
+
+// LoadRSAPublicKey reads a PEM-encoded RSA public key, either a bare key or
+// a certificate
+func LoadRSAPublicKey(path string) (*rsa.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read public key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data", path)
+	}
+
+	var pub interface{}
+	switch block.Type {
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		pub = cert.PublicKey
+	case "RSA PUBLIC KEY":
+		pub, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		pub, err = x509.ParsePKIXPublicKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	key, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an RSA public key", path)
+	}
+	return key, nil
+}
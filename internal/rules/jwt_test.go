@@ -0,0 +1,148 @@
+package rules
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// signJWT builds a compact JWT signed with an HMAC secret or RSA key
+func signJWT(t *testing.T, alg string, key interface{}, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	var sig []byte
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		sum := sha256.Sum256([]byte(signed))
+		var err error
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, sum[:]); err != nil {
+			t.Fatalf("failed to sign token: %v", err)
+		}
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func evaluateJWT(rule *JWTRule, token string) Result {
+	req := httptest.NewRequest("GET", "/", nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return rule.Evaluate(&Context{Request: req})
+}
+
+func TestJWTRuleClaims(t *testing.T) {
+	secret := []byte("test-secret")
+	rule, err := NewJWTRule(JWTConfig{
+		Issuers:   []string{"https://auth.example.com"},
+		Audiences: []string{"api"},
+		Claims:    map[string]string{"scope": `(^|\s)orders:read(\s|$)`},
+		Secret:    secret,
+		Leeway:    time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("failed to create rule: %v", err)
+	}
+	now := time.Now().Unix()
+
+	valid := map[string]interface{}{
+		"iss":   "https://auth.example.com",
+		"aud":   []string{"web", "api"},
+		"scope": "profile orders:read",
+		"exp":   now + 3600,
+	}
+	with := func(key string, value interface{}) map[string]interface{} {
+		claims := make(map[string]interface{}, len(valid))
+		for k, v := range valid {
+			claims[k] = v
+		}
+		claims[key] = value
+		return claims
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		matched bool
+	}{
+		{"valid", signJWT(t, "HS256", secret, valid), true},
+		{"within leeway", signJWT(t, "HS256", secret, with("exp", now-30)), true},
+		{"expired", signJWT(t, "HS256", secret, with("exp", now-120)), false},
+		{"not yet valid", signJWT(t, "HS256", secret, with("nbf", now+3600)), false},
+		{"wrong issuer", signJWT(t, "HS256", secret, with("iss", "https://evil.example.com")), false},
+		{"wrong audience", signJWT(t, "HS256", secret, with("aud", "web")), false},
+		{"missing scope", signJWT(t, "HS256", secret, with("scope", "orders:write")), false},
+		{"wrong secret", signJWT(t, "HS256", []byte("other"), valid), false},
+		{"unsigned", signJWT(t, "none", nil, valid), false},
+		{"malformed", "not-a-jwt", false},
+		{"missing", "", false},
+	}
+
+	for _, tc := range tests {
+		result := evaluateJWT(rule, tc.token)
+		if result.Matched != tc.matched {
+			t.Errorf("%s: expected matched=%v, got %v (%s)", tc.name, tc.matched, result.Matched, result.Reason)
+		}
+	}
+}
+
+func TestJWTRuleRSA(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	der, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	path := filepath.Join(t.TempDir(), "jwt.pem")
+	os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0600)
+
+	pub, err := LoadRSAPublicKey(path)
+	if err != nil {
+		t.Fatalf("failed to load public key: %v", err)
+	}
+	rule, err := NewJWTRule(JWTConfig{Issuers: []string{"issuer"}, PublicKey: pub})
+	if err != nil {
+		t.Fatalf("failed to create rule: %v", err)
+	}
+
+	claims := map[string]interface{}{"iss": "issuer"}
+	if result := evaluateJWT(rule, signJWT(t, "RS256", key, claims)); !result.Matched {
+		t.Errorf("expected RS256 token to match: %s", result.Reason)
+	}
+
+	// An HS256 token keyed with the public key must not pass as RS256
+	if evaluateJWT(rule, signJWT(t, "HS256", der, claims)).Matched {
+		t.Error("expected algorithm confusion to be rejected")
+	}
+}
+
+func TestJWTRuleUnverified(t *testing.T) {
+	rule, err := NewJWTRule(JWTConfig{Claims: map[string]string{"role": "^admin$"}})
+	if err != nil {
+		t.Fatalf("failed to create rule: %v", err)
+	}
+
+	result := evaluateJWT(rule, signJWT(t, "HS256", []byte("anything"), map[string]interface{}{"role": "admin"}))
+	if !result.Matched || result.Labels[0] != "jwt-unverified" {
+		t.Errorf("expected unverified token to match with label, got %+v", result)
+	}
+
+	if _, err := NewJWTRule(JWTConfig{Claims: map[string]string{"role": "("}}); err == nil {
+		t.Error("expected error for invalid claim pattern")
+	}
+}
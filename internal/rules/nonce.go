@@ -0,0 +1,166 @@
+package rules
+
+import (
+	"container/list"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultMaxNonces bounds the number of nonces remembered by a NonceRule
+const DefaultMaxNonces = 100000
+
+// NonceRule rejects replayed requests by remembering nonces seen within a
+// window, and optionally rejects requests whose timestamp is too far from now
+type NonceRule struct {
+	nonceHeader     string
+	timestampHeader string
+	window          time.Duration
+	maxSkew         time.Duration
+	maxNonces       int
+
+	seen  map[string]*list.Element
+	order *list.List // oldest first; all entries share the same TTL
+	mu    sync.Mutex
+	now   func() time.Time
+}
+
+type nonceEntry struct {
+	nonce   string
+	expires time.Time
+}
+
+// NewNonceRule creates a replay-protection rule. The rule matches requests
+// carrying a nonce that has not been seen within window. If timestampHeader
+// is set, the header must hold a Unix or RFC 3339 timestamp within maxSkew
+// of the current time (maxSkew defaults to window).
+func NewNonceRule(nonceHeader, timestampHeader string, window, maxSkew time.Duration, maxNonces int) (*NonceRule, error) {
+	if nonceHeader == "" {
+		return nil, fmt.Errorf("nonce header is required")
+	}
+	if window <= 0 {
+		return nil, fmt.Errorf("nonce window must be positive")
+	}
+	if maxSkew <= 0 {
+		maxSkew = window
+	}
+	if maxNonces <= 0 {
+		maxNonces = DefaultMaxNonces
+	}
+
+	return &NonceRule{
+		nonceHeader:     nonceHeader,
+		timestampHeader: timestampHeader,
+		window:          window,
+		maxSkew:         maxSkew,
+		maxNonces:       maxNonces,
+		seen:            make(map[string]*list.Element),
+		order:           list.New(),
+		now:             time.Now,
+	}, nil
+}
+
+// Evaluate checks the timestamp skew and records the nonce
+func (r *NonceRule) Evaluate(ctx *Context) Result {
+	if ctx.Request == nil {
+		return Result{Matched: false, Reason: "no HTTP request"}
+	}
+
+	nonce := ctx.Request.Header.Get(r.nonceHeader)
+	if nonce == "" {
+		return Result{
+			Matched: false,
+			Reason:  fmt.Sprintf("nonce header %q missing", r.nonceHeader),
+			Labels:  []string{"nonce-missing"},
+		}
+	}
+
+	now := r.now()
+
+	if r.timestampHeader != "" {
+		ts, err := parseRequestTimestamp(ctx.Request.Header.Get(r.timestampHeader))
+		if err != nil {
+			return Result{
+				Matched: false,
+				Reason:  fmt.Sprintf("timestamp header %q: %v", r.timestampHeader, err),
+				Labels:  []string{"nonce-bad-timestamp"},
+			}
+		}
+		skew := now.Sub(ts)
+		if skew < 0 {
+			skew = -skew
+		}
+		if skew > r.maxSkew {
+			return Result{
+				Matched: false,
+				Reason:  fmt.Sprintf("timestamp skew %v exceeds %v", skew.Round(time.Second), r.maxSkew),
+				Labels:  []string{"nonce-stale"},
+			}
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.expire(now)
+
+	if _, replayed := r.seen[nonce]; replayed {
+		return Result{
+			Matched: false,
+			Reason:  "nonce replayed within window",
+			Labels:  []string{"nonce-replay"},
+		}
+	}
+
+	fresh := Result{
+		Matched: true,
+		Reason:  "nonce not seen within window",
+		Labels:  []string{"nonce-ok"},
+	}
+	if ctx.DryRun {
+		return fresh
+	}
+
+	// Evict the oldest nonce once the cache is full
+	if r.order.Len() >= r.maxNonces {
+		oldest := r.order.Front()
+		delete(r.seen, oldest.Value.(*nonceEntry).nonce)
+		r.order.Remove(oldest)
+	}
+	r.seen[nonce] = r.order.PushBack(&nonceEntry{nonce: nonce, expires: now.Add(r.window)})
+
+	return fresh
+}
+
+// expire removes nonces whose window has passed; caller holds mu
+func (r *NonceRule) expire(now time.Time) {
+	for e := r.order.Front(); e != nil; e = r.order.Front() {
+		entry := e.Value.(*nonceEntry)
+		if now.Before(entry.expires) {
+			return
+		}
+		delete(r.seen, entry.nonce)
+		r.order.Remove(e)
+	}
+}
+
+// parseRequestTimestamp parses a Unix timestamp in seconds or an RFC 3339 time
+func parseRequestTimestamp(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, fmt.Errorf("missing")
+	}
+	if secs, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Unix(secs, 0), nil
+	}
+	ts, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timestamp %q", v)
+	}
+	return ts, nil
+}
+
+// Type returns the rule type
+func (r *NonceRule) Type() string {
+	return "nonce"
+}
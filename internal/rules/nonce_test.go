@@ -0,0 +1,111 @@
+package rules
+
+import (
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func nonceContext(nonce, timestamp string) *Context {
+	req := httptest.NewRequest("POST", "/api", nil)
+	if nonce != "" {
+		req.Header.Set("X-Nonce", nonce)
+	}
+	if timestamp != "" {
+		req.Header.Set("X-Timestamp", timestamp)
+	}
+	return &Context{Request: req}
+}
+
+func TestNonceRuleRejectsReplay(t *testing.T) {
+	rule, err := NewNonceRule("X-Nonce", "", time.Minute, 0, 0)
+	if err != nil {
+		t.Fatalf("failed to create rule: %v", err)
+	}
+
+	now := time.Now()
+	rule.now = func() time.Time { return now }
+
+	if !rule.Evaluate(nonceContext("abc", "")).Matched {
+		t.Error("expected first use of nonce to match")
+	}
+	if rule.Evaluate(nonceContext("abc", "")).Matched {
+		t.Error("expected replayed nonce to be rejected")
+	}
+	if rule.Evaluate(nonceContext("", "")).Matched {
+		t.Error("expected missing nonce to be rejected")
+	}
+
+	// After the window the nonce may be reused
+	now = now.Add(2 * time.Minute)
+	if !rule.Evaluate(nonceContext("abc", "")).Matched {
+		t.Error("expected nonce to be accepted after window expired")
+	}
+}
+
+func TestNonceRuleTimestampSkew(t *testing.T) {
+	rule, _ := NewNonceRule("X-Nonce", "X-Timestamp", 5*time.Minute, 30*time.Second, 0)
+	now := time.Now()
+	rule.now = func() time.Time { return now }
+
+	tests := []struct {
+		name      string
+		timestamp string
+		matched   bool
+	}{
+		{"unix within skew", strconv.FormatInt(now.Add(-10*time.Second).Unix(), 10), true},
+		{"rfc3339 within skew", now.Add(10 * time.Second).Format(time.RFC3339), true},
+		{"too old", strconv.FormatInt(now.Add(-time.Minute).Unix(), 10), false},
+		{"too far ahead", strconv.FormatInt(now.Add(time.Minute).Unix(), 10), false},
+		{"missing", "", false},
+		{"invalid", "yesterday", false},
+	}
+
+	for i, tc := range tests {
+		ctx := nonceContext("nonce-"+strconv.Itoa(i), tc.timestamp)
+		if got := rule.Evaluate(ctx).Matched; got != tc.matched {
+			t.Errorf("%s: expected matched=%v, got %v", tc.name, tc.matched, got)
+		}
+	}
+}
+
+func TestNonceRuleBounded(t *testing.T) {
+	rule, _ := NewNonceRule("X-Nonce", "", time.Hour, 0, 2)
+
+	for _, n := range []string{"a", "b", "c"} {
+		rule.Evaluate(nonceContext(n, ""))
+	}
+
+	if len(rule.seen) != 2 || rule.order.Len() != 2 {
+		t.Errorf("expected cache bounded to 2 entries, got %d", len(rule.seen))
+	}
+	if rule.Evaluate(nonceContext("c", "")).Matched {
+		t.Error("expected most recent nonce to still be remembered")
+	}
+}
+
+func TestNewNonceRuleValidation(t *testing.T) {
+	if _, err := NewNonceRule("", "", time.Minute, 0, 0); err == nil {
+		t.Error("expected error for missing nonce header")
+	}
+	if _, err := NewNonceRule("X-Nonce", "", 0, 0, 0); err == nil {
+		t.Error("expected error for zero window")
+	}
+}
+
+func TestNonceRuleDryRun(t *testing.T) {
+	rule, _ := NewNonceRule("X-Nonce", "", time.Minute, 0, 0)
+
+	dry := nonceContext("abc", "")
+	dry.DryRun = true
+	if !rule.Evaluate(dry).Matched || !rule.Evaluate(dry).Matched {
+		t.Error("expected dry run to match without recording the nonce")
+	}
+	if !rule.Evaluate(nonceContext("abc", "")).Matched {
+		t.Error("expected nonce to still be unused after dry runs")
+	}
+	if rule.Evaluate(dry).Matched {
+		t.Error("expected dry run to report the replay")
+	}
+}
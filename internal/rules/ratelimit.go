@@ -2,18 +2,55 @@ package rules
 
 import (
 	"fmt"
+	"strings"
 	"sync"
 	"time"
+
+	"shadowgate/internal/geoip"
 )
 
-// RateLimitRule limits requests per source IP
+// rateLimitShards is the number of independently locked counter maps a
+// RateLimitRule spreads its buckets over
+const rateLimitShards = 32
+
+// RateLimitStore counts requests per key in fixed windows outside the
+// process, so several gateway instances can enforce one limit
+type RateLimitStore interface {
+	// Increment counts a request for key and returns the number of requests
+	// in key's current window, opening a window of the given length if none
+	// is open
+	Increment(key string, window time.Duration) (int, error)
+
+	// Count returns the number of requests in key's current window
+	Count(key string) (int, error)
+}
+
+// RateLimitRule limits requests per source IP, or per value of a header or
+// cookie when a key source is configured. Buckets are sharded by key so
+// requests from different clients rarely contend for the same lock.
 type RateLimitRule struct {
 	maxRequests int
 	window      time.Duration
-	counters    map[string]*rateLimitCounter
-	mu          sync.RWMutex
+	keyKind     string // "ip", "header" or "cookie"
+	keyName     string
+	shards      [rateLimitShards]rateLimitShard
+	stopMu      sync.Mutex
 	stopChan    chan struct{}
 	stopped     bool
+
+	// Shared counters, used instead of the shards when set
+	store     RateLimitStore
+	namespace string
+
+	// Per-ASN limits replacing maxRequests for clients in those ASNs; nil
+	// for plain rate_limit rules
+	asnLimits map[uint]int
+	lookupASN func(ip string) (uint, error)
+}
+
+type rateLimitShard struct {
+	counters map[string]*rateLimitCounter
+	mu       sync.Mutex
 }
 
 type rateLimitCounter struct {
@@ -21,29 +58,146 @@ type rateLimitCounter struct {
 	windowEnd time.Time
 }
 
-// NewRateLimitRule creates a new rate limiting rule
+// NewRateLimitRule creates a new rate limiting rule keyed on client IP
 func NewRateLimitRule(maxRequests int, window time.Duration) *RateLimitRule {
+	r, _ := NewRateLimitRuleWithKey(maxRequests, window, "ip")
+	return r
+}
+
+// NewRateLimitRuleWithKey creates a rate limiting rule whose buckets are keyed
+// by keySource: "ip", "header:<name>" or "cookie:<name>". Requests without
+// the configured header or cookie fall back to their client IP.
+func NewRateLimitRuleWithKey(maxRequests int, window time.Duration, keySource string) (*RateLimitRule, error) {
+	kind, name, err := ParseRateLimitKey(keySource)
+	if err != nil {
+		return nil, err
+	}
+
 	r := &RateLimitRule{
 		maxRequests: maxRequests,
 		window:      window,
-		counters:    make(map[string]*rateLimitCounter),
+		keyKind:     kind,
+		keyName:     name,
 		stopChan:    make(chan struct{}),
 	}
+	for i := range r.shards {
+		r.shards[i].counters = make(map[string]*rateLimitCounter)
+	}
 
 	// Start cleanup goroutine
 	go r.cleanup()
 
-	return r
+	return r, nil
+}
+
+// NewASNRateLimitRule creates a rate limiting rule whose limit depends on the
+// client's autonomous system: clients in an ASN listed in asnLimits get that
+// limit, everyone else (including clients whose ASN cannot be resolved)
+// gets defaultLimit. Buckets are keyed by keySource as for
+// NewRateLimitRuleWithKey.
+func NewASNRateLimitRule(defaultLimit int, window time.Duration, keySource string, asnLimits map[uint]int) (*RateLimitRule, error) {
+	if len(asnLimits) == 0 {
+		return nil, fmt.Errorf("at least one ASN limit is required")
+	}
+	for asn, limit := range asnLimits {
+		if limit <= 0 {
+			return nil, fmt.Errorf("invalid limit %d for AS%d", limit, asn)
+		}
+	}
+
+	r, err := NewRateLimitRuleWithKey(defaultLimit, window, keySource)
+	if err != nil {
+		return nil, err
+	}
+	r.asnLimits = asnLimits
+	r.lookupASN = lookupGlobalASN
+	return r, nil
+}
+
+// lookupGlobalASN resolves ip's ASN in the global GeoIP database
+func lookupGlobalASN(ip string) (uint, error) {
+	db := geoip.GetGlobal()
+	if db == nil {
+		return 0, fmt.Errorf("GeoIP database not loaded")
+	}
+	asn, _, err := db.LookupASN(ip)
+	return asn, err
+}
+
+// limit returns the request limit applying to ctx and, for ASN-aware rules,
+// a label naming the tier: the client's ASN, asn-default or asn-unknown
+func (r *RateLimitRule) limit(ctx *Context) (int, string) {
+	if r.asnLimits == nil {
+		return r.maxRequests, ""
+	}
+	asn, err := r.lookupASN(ctx.ClientIP)
+	if err != nil {
+		return r.maxRequests, "asn-unknown"
+	}
+	if limit, ok := r.asnLimits[asn]; ok {
+		return limit, fmt.Sprintf("AS%d", asn)
+	}
+	return r.maxRequests, "asn-default"
+}
+
+// SetStore makes the rule count requests in store, under keys prefixed with
+// namespace, instead of in memory. Rules in other instances using the same
+// store and namespace share their counts. While the store fails, requests
+// are counted in memory. It must be called before the rule is used.
+func (r *RateLimitRule) SetStore(store RateLimitStore, namespace string) {
+	r.store = store
+	r.namespace = namespace
+}
+
+// ParseRateLimitKey splits a rate limit key source into its kind and name.
+// An empty source means "ip".
+func ParseRateLimitKey(keySource string) (kind, name string, err error) {
+	if keySource == "" || keySource == "ip" {
+		return "ip", "", nil
+	}
+	kind, name, _ = strings.Cut(keySource, ":")
+	if (kind != "header" && kind != "cookie") || strings.TrimSpace(name) == "" {
+		return "", "", fmt.Errorf("invalid rate limit key source %q (expected ip, header:<name> or cookie:<name>)", keySource)
+	}
+	return kind, strings.TrimSpace(name), nil
+}
+
+// key returns the bucket key for a request. Header and cookie values are
+// prefixed so a client cannot collide with another client's IP bucket.
+func (r *RateLimitRule) key(ctx *Context) string {
+	if ctx.Request != nil {
+		switch r.keyKind {
+		case "header":
+			if v := ctx.Request.Header.Get(r.keyName); v != "" {
+				return "header:" + v
+			}
+		case "cookie":
+			if c, err := ctx.Request.Cookie(r.keyName); err == nil && c.Value != "" {
+				return "cookie:" + c.Value
+			}
+		}
+	}
+	return ctx.ClientIP
+}
+
+// shard returns the shard holding key, chosen by its FNV-1a hash
+func (r *RateLimitRule) shard(key string) *rateLimitShard {
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return &r.shards[h%rateLimitShards]
 }
 
 // Stop stops the background cleanup goroutine
 func (r *RateLimitRule) Stop() {
-	r.mu.Lock()
+	r.stopMu.Lock()
 	if !r.stopped {
 		r.stopped = true
 		close(r.stopChan)
 	}
-	r.mu.Unlock()
+	r.stopMu.Unlock()
 }
 
 // cleanup periodically removes expired entries
@@ -56,68 +210,120 @@ func (r *RateLimitRule) cleanup() {
 		case <-r.stopChan:
 			return
 		case <-ticker.C:
-			r.mu.Lock()
 			now := time.Now()
-			for ip, counter := range r.counters {
-				if now.After(counter.windowEnd) {
-					delete(r.counters, ip)
+			for i := range r.shards {
+				s := &r.shards[i]
+				s.mu.Lock()
+				for key, counter := range s.counters {
+					if now.After(counter.windowEnd) {
+						delete(s.counters, key)
+					}
 				}
+				s.mu.Unlock()
 			}
-			r.mu.Unlock()
 		}
 	}
 }
 
 // Evaluate checks if the client has exceeded the rate limit
 func (r *RateLimitRule) Evaluate(ctx *Context) Result {
-	r.mu.Lock()
-	defer r.mu.Unlock()
+	key := r.key(ctx)
+	count, shared := r.sharedCount(key, ctx.DryRun)
+	if !shared {
+		count = r.localCount(key, ctx.DryRun)
+	}
+	limit, tier := r.limit(ctx)
+
+	result := Result{
+		Matched: true,
+		Reason:  fmt.Sprintf("rate limit: %d/%d requests", count, limit),
+		Labels:  []string{"rate-ok"},
+	}
+	if count > limit {
+		result = Result{
+			Matched: false,
+			Reason:  fmt.Sprintf("rate limit exceeded: %d/%d requests in window", count, limit),
+			Labels:  []string{"rate-exceeded"},
+		}
+	}
+	if strings.HasPrefix(tier, "AS") {
+		result.Reason += " for " + tier
+	}
+	if tier != "" {
+		result.Labels = append(result.Labels, tier)
+	}
+	// Counted in memory because the shared store failed
+	if r.store != nil && !shared {
+		result.Labels = append(result.Labels, "rate-store-unavailable")
+	}
+	return result
+}
+
+// sharedCount counts the request in the shared store, returning the count
+// including it and whether the store could be used. Dry runs only read.
+func (r *RateLimitRule) sharedCount(key string, dryRun bool) (int, bool) {
+	if r.store == nil {
+		return 0, false
+	}
+	key = r.namespace + key
+
+	var count int
+	var err error
+	if dryRun {
+		count, err = r.store.Count(key)
+		count++
+	} else {
+		count, err = r.store.Increment(key, r.window)
+	}
+	return count, err == nil
+}
+
+// localCount counts the request in memory, returning the count including
+// it. Dry runs only read.
+func (r *RateLimitRule) localCount(key string, dryRun bool) int {
+	s := r.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
 	now := time.Now()
-	counter, exists := r.counters[ctx.ClientIP]
+	counter, exists := s.counters[key]
 
 	if !exists || now.After(counter.windowEnd) {
 		// Start new window
-		r.counters[ctx.ClientIP] = &rateLimitCounter{
-			count:     1,
-			windowEnd: now.Add(r.window),
-		}
-		return Result{
-			Matched: true,
-			Reason:  fmt.Sprintf("rate limit: 1/%d requests", r.maxRequests),
-			Labels:  []string{"rate-ok"},
-		}
-	}
-
-	counter.count++
-	if counter.count > r.maxRequests {
-		return Result{
-			Matched: false,
-			Reason:  fmt.Sprintf("rate limit exceeded: %d/%d requests in window", counter.count, r.maxRequests),
-			Labels:  []string{"rate-exceeded"},
+		if !dryRun {
+			s.counters[key] = &rateLimitCounter{
+				count:     1,
+				windowEnd: now.Add(r.window),
+			}
 		}
+		return 1
 	}
 
-	return Result{
-		Matched: true,
-		Reason:  fmt.Sprintf("rate limit: %d/%d requests", counter.count, r.maxRequests),
-		Labels:  []string{"rate-ok"},
+	count := counter.count + 1
+	if !dryRun {
+		counter.count = count
 	}
+	return count
 }
 
 // Type returns the rule type
 func (r *RateLimitRule) Type() string {
+	if r.asnLimits != nil {
+		return "asn_rate_limit"
+	}
 	return "rate_limit"
 }
 
-// GetStats returns current rate limit statistics
+// GetStats returns current request counts by bucket key
 func (r *RateLimitRule) GetStats() map[string]int {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
-
 	stats := make(map[string]int)
-	for ip, counter := range r.counters {
-		stats[ip] = counter.count
+	for i := range r.shards {
+		s := &r.shards[i]
+		s.mu.Lock()
+		for key, counter := range s.counters {
+			stats[key] = counter.count
+		}
+		s.mu.Unlock()
 	}
 	return stats
 }
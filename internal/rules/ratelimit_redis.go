@@ -0,0 +1,60 @@
+package rules
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"shadowgate/internal/redis"
+)
+
+// DefaultRedisKeyPrefix is prepended to rate limit keys stored in Redis
+const DefaultRedisKeyPrefix = "shadowgate:ratelimit:"
+
+// incrementScript counts a request and starts the key's expiry with its
+// first request, atomically so concurrent instances agree on the window
+const incrementScript = `local n = redis.call('INCR', KEYS[1])
+if n == 1 then redis.call('PEXPIRE', KEYS[1], ARGV[1]) end
+return n`
+
+// RedisRateLimitStore keeps rate limit counters in Redis, one key per
+// bucket expiring at the end of its window
+type RedisRateLimitStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisRateLimitStore creates a store using client. An empty prefix
+// means DefaultRedisKeyPrefix.
+func NewRedisRateLimitStore(client *redis.Client, prefix string) *RedisRateLimitStore {
+	if prefix == "" {
+		prefix = DefaultRedisKeyPrefix
+	}
+	return &RedisRateLimitStore{client: client, prefix: prefix}
+}
+
+// Increment counts a request for key in its current window
+func (s *RedisRateLimitStore) Increment(key string, window time.Duration) (int, error) {
+	reply, err := s.client.Do("EVAL", incrementScript, "1", s.prefix+key, strconv.FormatInt(window.Milliseconds(), 10))
+	if err != nil {
+		return 0, err
+	}
+	n, ok := reply.(int64)
+	if !ok {
+		return 0, fmt.Errorf("redis: unexpected reply %v", reply)
+	}
+	return int(n), nil
+}
+
+// Count returns the requests counted for key in its current window
+func (s *RedisRateLimitStore) Count(key string) (int, error) {
+	reply, err := s.client.Do("GET", s.prefix+key)
+	if err != nil || reply == nil {
+		return 0, err
+	}
+	str, ok := reply.(string)
+	if !ok {
+		return 0, fmt.Errorf("redis: unexpected reply %v", reply)
+	}
+	return strconv.Atoi(str)
+}
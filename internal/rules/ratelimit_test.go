@@ -0,0 +1,132 @@
+package rules
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryStore is a RateLimitStore shared by rules standing in for separate
+// gateway instances
+type memoryStore struct {
+	mu     sync.Mutex
+	counts map[string]int
+	down   bool
+}
+
+func (s *memoryStore) Increment(key string, window time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.down {
+		return 0, errors.New("store unavailable")
+	}
+	s.counts[key]++
+	return s.counts[key], nil
+}
+
+func (s *memoryStore) Count(key string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.down {
+		return 0, errors.New("store unavailable")
+	}
+	return s.counts[key], nil
+}
+
+func TestRateLimitSharedStore(t *testing.T) {
+	store := &memoryStore{counts: make(map[string]int)}
+
+	// Two instances of the same rule share one limit
+	instances := make([]*RateLimitRule, 2)
+	for i := range instances {
+		instances[i] = NewRateLimitRule(3, time.Minute)
+		instances[i].SetStore(store, "p:0:")
+		defer instances[i].Stop()
+	}
+
+	ctx := &Context{ClientIP: "192.0.2.1"}
+	for i := 0; i < 3; i++ {
+		if !instances[i%2].Evaluate(ctx).Matched {
+			t.Fatalf("expected request %d to pass", i+1)
+		}
+	}
+	if instances[1].Evaluate(&Context{ClientIP: "192.0.2.1", DryRun: true}).Matched {
+		t.Error("expected dry run to see the shared count")
+	}
+	if instances[1].Evaluate(ctx).Matched {
+		t.Error("expected the fourth request across instances to be limited")
+	}
+	if store.counts["p:0:192.0.2.1"] != 4 {
+		t.Errorf("expected namespaced key with 4 requests, got %v", store.counts)
+	}
+	if len(instances[0].GetStats()) != 0 {
+		t.Error("expected no in-memory counters while the store works")
+	}
+
+	// Requests are counted in memory while the store fails
+	store.down = true
+	result := instances[0].Evaluate(ctx)
+	if !result.Matched || len(result.Labels) != 2 || result.Labels[1] != "rate-store-unavailable" {
+		t.Errorf("expected in-memory fallback, got %+v", result)
+	}
+	if instances[0].GetStats()["192.0.2.1"] != 1 {
+		t.Errorf("expected fallback request counted in memory, got %v", instances[0].GetStats())
+	}
+}
+
+func TestASNRateLimitTiers(t *testing.T) {
+	rule, err := NewASNRateLimitRule(5, time.Minute, "ip", map[uint]int{16509: 2})
+	if err != nil {
+		t.Fatalf("failed to create rule: %v", err)
+	}
+	defer rule.Stop()
+	asns := map[string]uint{"203.0.113.1": 16509, "198.51.100.1": 7922}
+	rule.lookupASN = func(ip string) (uint, error) {
+		if asn, ok := asns[ip]; ok {
+			return asn, nil
+		}
+		return 0, errors.New("not found")
+	}
+
+	tests := []struct {
+		ip      string
+		allowed int
+		label   string
+	}{
+		{"203.0.113.1", 2, "AS16509"},      // datacenter tier
+		{"198.51.100.1", 5, "asn-default"}, // unlisted ASN
+		{"192.0.2.1", 5, "asn-unknown"},    // lookup failure
+	}
+	for _, tc := range tests {
+		ctx := &Context{ClientIP: tc.ip}
+		for i := 0; i < tc.allowed; i++ {
+			if result := rule.Evaluate(ctx); !result.Matched {
+				t.Fatalf("%s: request %d unexpectedly limited: %s", tc.ip, i+1, result.Reason)
+			}
+		}
+		result := rule.Evaluate(ctx)
+		if result.Matched {
+			t.Errorf("%s: expected request %d to be limited", tc.ip, tc.allowed+1)
+		}
+		if !containsLabel(result.Labels, tc.label) {
+			t.Errorf("%s: expected label %q, got %v", tc.ip, tc.label, result.Labels)
+		}
+	}
+
+	if rule.Type() != "asn_rate_limit" {
+		t.Errorf("expected type asn_rate_limit, got %q", rule.Type())
+	}
+	if _, err := NewASNRateLimitRule(5, time.Minute, "ip", map[uint]int{16509: 0}); err == nil {
+		t.Error("expected error for zero limit")
+	}
+}
+
+func containsLabel(labels []string, label string) bool {
+	for _, l := range labels {
+		if l == label {
+			return true
+		}
+	}
+	return false
+}
@@ -1,14 +1,21 @@
 package rules
 
 import (
+	"math/rand"
 	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
 )
 
 // Result represents the outcome of rule evaluation
 type Result struct {
-	Matched bool
-	Reason  string
-	Labels  []string
+	Matched   bool
+	Reason    string
+	Labels    []string
+	Evaluated int    // number of rules evaluated to reach this result
+	RuleType  string // type of the rule that decided a group result
 }
 
 // Context contains request information for rule evaluation
@@ -17,6 +24,28 @@ type Context struct {
 	ClientIP   string
 	TLSVersion uint16
 	SNI        string
+	ALPN       string // negotiated TLS application protocol, e.g. "h2"
+	ProtoMajor int    // HTTP protocol version, e.g. 1.1 or 2.0
+	ProtoMinor int
+
+	// NormalizedPath is the request path as matched by path rules; see
+	// NormalizePath. Computed from Request when empty.
+	NormalizedPath string
+
+	// Country, when set, is used by geo rules instead of a GeoIP lookup
+	Country string
+
+	// DryRun marks a synthetic request evaluated to test rules. Stateful
+	// rules report what they would decide without recording the request.
+	DryRun bool
+
+	// Parsed query string, populated lazily by Query
+	query url.Values
+
+	// Decoded request body, populated lazily by InspectBody
+	body     []byte
+	bodyErr  error
+	bodyRead bool
 }
 
 // Rule is the interface all rules must implement
@@ -28,53 +57,105 @@ type Rule interface {
 }
 
 // Evaluator evaluates rule groups with boolean logic
-type Evaluator struct{}
+type Evaluator struct {
+	observe    func(ruleType string, d time.Duration)
+	sampleRate float64
+}
+
+// DefaultTimingSampleRate is the fraction of group evaluations timed when
+// EvaluatorOptions.Observe is set
+const DefaultTimingSampleRate = 0.01
+
+// EvaluatorOptions configures an Evaluator
+type EvaluatorOptions struct {
+	// Observe, when set, receives how long individual rules took to
+	// evaluate, keyed by rule type
+	Observe func(ruleType string, d time.Duration)
+	// SampleRate is the fraction of group evaluations whose rules are
+	// timed, keeping the clock off the hot path (default: 0.01, at most 1)
+	SampleRate float64
+}
 
 // NewEvaluator creates a new rule evaluator
 func NewEvaluator() *Evaluator {
 	return &Evaluator{}
 }
 
+// NewEvaluatorWithOptions creates a rule evaluator with custom options
+func NewEvaluatorWithOptions(opts EvaluatorOptions) *Evaluator {
+	if opts.SampleRate <= 0 {
+		opts.SampleRate = DefaultTimingSampleRate
+	}
+	if opts.SampleRate > 1 {
+		opts.SampleRate = 1
+	}
+	return &Evaluator{observe: opts.Observe, sampleRate: opts.SampleRate}
+}
+
+// sampled reports whether the rules of the next group evaluation are timed
+func (e *Evaluator) sampled() bool {
+	return e.observe != nil && (e.sampleRate >= 1 || rand.Float64() < e.sampleRate)
+}
+
+// evaluate evaluates r, timing it when timed is set
+func (e *Evaluator) evaluate(r Rule, ctx *Context, timed bool) Result {
+	if !timed {
+		return r.Evaluate(ctx)
+	}
+	start := time.Now()
+	result := r.Evaluate(ctx)
+	e.observe(r.Type(), time.Since(start))
+	return result
+}
+
 // EvaluateGroup evaluates a group of rules with boolean logic
 func (e *Evaluator) EvaluateGroup(group *Group, ctx *Context) Result {
 	if group == nil {
 		return Result{Matched: false}
 	}
+	timed := e.sampled()
 
 	// Handle AND logic
 	if len(group.And) > 0 {
-		for _, r := range group.And {
-			result := r.Evaluate(ctx)
+		for i, r := range group.And {
+			result := e.evaluate(r, ctx, timed)
 			if !result.Matched {
-				return Result{Matched: false, Reason: result.Reason}
+				return Result{Matched: false, Reason: result.Reason, Evaluated: i + 1, RuleType: r.Type()}
 			}
 		}
-		return Result{Matched: true, Reason: "all AND conditions matched"}
+		// Attribute the match to the last condition, which completed it
+		last := group.And[len(group.And)-1]
+		return Result{Matched: true, Reason: "all AND conditions matched", Evaluated: len(group.And), RuleType: last.Type()}
 	}
 
 	// Handle OR logic
 	if len(group.Or) > 0 {
-		for _, r := range group.Or {
-			result := r.Evaluate(ctx)
+		for i, r := range group.Or {
+			result := e.evaluate(r, ctx, timed)
 			if result.Matched {
-				return Result{Matched: true, Reason: result.Reason, Labels: result.Labels}
+				return Result{Matched: true, Reason: result.Reason, Labels: result.Labels, Evaluated: i + 1, RuleType: r.Type()}
 			}
 		}
-		return Result{Matched: false, Reason: "no OR conditions matched"}
+		return Result{Matched: false, Reason: "no OR conditions matched", Evaluated: len(group.Or)}
 	}
 
 	// Handle NOT logic
 	if group.Not != nil {
-		result := group.Not.Evaluate(ctx)
+		result := e.evaluate(group.Not, ctx, timed)
 		return Result{
-			Matched: !result.Matched,
-			Reason:  "NOT: " + result.Reason,
+			Matched:   !result.Matched,
+			Reason:    "NOT: " + result.Reason,
+			Evaluated: 1,
+			RuleType:  group.Not.Type(),
 		}
 	}
 
 	// Handle single rule
 	if group.Single != nil {
-		return group.Single.Evaluate(ctx)
+		result := e.evaluate(group.Single, ctx, timed)
+		result.Evaluated = 1
+		result.RuleType = group.Single.Type()
+		return result
 	}
 
 	return Result{Matched: false}
@@ -87,3 +168,43 @@ type Group struct {
 	Not    Rule
 	Single Rule
 }
+
+// EstimateCost returns a static relative cost for evaluating a rule.
+// Cheap lookups (IP, method, TLS) score low; regex, GeoIP and body
+// inspection score high.
+func EstimateCost(r Rule) int {
+	switch t := r.Type(); {
+	case strings.HasPrefix(t, "ip_"), strings.HasPrefix(t, "method_"),
+		strings.HasPrefix(t, "http_version_"), t == "tls_version", t == "require_tls", t == "time_window",
+		strings.HasPrefix(t, "alpn_"):
+		return 1
+	case strings.HasPrefix(t, "sni_"), strings.HasPrefix(t, "host_"):
+		return 2
+	case strings.HasPrefix(t, "ua_"), strings.HasPrefix(t, "path_"), strings.HasPrefix(t, "header_"),
+		strings.HasPrefix(t, "query_"):
+		return 3
+	case t == "rate_limit", t == "nonce", t == "scanner_score":
+		// Stateful: evaluate after cheap filters so rejected traffic isn't counted
+		return 4
+	case strings.HasPrefix(t, "geo_"), strings.HasPrefix(t, "asn_"):
+		return 5
+	case t == "waf":
+		return 8
+	case strings.HasPrefix(t, "body_"):
+		return 10
+	default:
+		return 5
+	}
+}
+
+// OptimizeOrder sorts AND rules by estimated cost so cheap rules that are
+// likely to fail run before expensive ones. The relative order of rules
+// with equal cost is preserved.
+func (g *Group) OptimizeOrder() {
+	if g == nil {
+		return
+	}
+	sort.SliceStable(g.And, func(i, j int) bool {
+		return EstimateCost(g.And[i]) < EstimateCost(g.And[j])
+	})
+}
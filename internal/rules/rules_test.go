@@ -1,7 +1,11 @@
 package rules
 
 import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
 	"net/http/httptest"
+	"sync"
 	"testing"
 	"time"
 )
@@ -31,6 +35,41 @@ func TestIPRuleAllow(t *testing.T) {
 	}
 }
 
+func TestIPRuleNormalizesClientIP(t *testing.T) {
+	rule, err := NewIPRule([]string{"10.0.0.0/8", "fe80::/10"}, "allow")
+	if err != nil {
+		t.Fatalf("failed to create rule: %v", err)
+	}
+
+	tests := []struct {
+		ip      string
+		matched bool
+	}{
+		{"::ffff:10.0.0.1", true},
+		{"::ffff:8.8.8.8", false},
+		{"fe80::1%eth0", true},
+		{"[::ffff:10.0.0.1]", true},
+	}
+
+	for _, tc := range tests {
+		result := rule.Evaluate(&Context{ClientIP: tc.ip})
+		if result.Matched != tc.matched {
+			t.Errorf("IP %s: expected matched=%v, got %v (%s)", tc.ip, tc.matched, result.Matched, result.Reason)
+		}
+	}
+
+	// Mapped networks in the config match plain IPv4 clients
+	mapped, err := NewIPRule([]string{"::ffff:192.168.0.0/112", "::ffff:172.16.0.1"}, "deny")
+	if err != nil {
+		t.Fatalf("failed to create rule: %v", err)
+	}
+	for _, ip := range []string{"192.168.5.5", "::ffff:192.168.5.5", "172.16.0.1"} {
+		if !mapped.Evaluate(&Context{ClientIP: ip}).Matched {
+			t.Errorf("expected %s to match mapped network", ip)
+		}
+	}
+}
+
 func TestIPRuleSingleIP(t *testing.T) {
 	rule, err := NewIPRule([]string{"192.168.1.1"}, "allow")
 	if err != nil {
@@ -121,6 +160,86 @@ func TestEvaluatorAND(t *testing.T) {
 	}
 }
 
+func TestEvaluatorTiming(t *testing.T) {
+	ipRule, _ := NewIPRule([]string{"10.0.0.0/8"}, "allow")
+	uaRule, _ := NewUARule([]string{".*Chrome.*"}, "whitelist")
+	group := &Group{And: []Rule{ipRule, uaRule}}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("User-Agent", "Chrome/91.0")
+	ctx := &Context{ClientIP: "10.1.2.3", Request: req}
+
+	observed := make(map[string]int)
+	eval := NewEvaluatorWithOptions(EvaluatorOptions{
+		Observe:    func(ruleType string, d time.Duration) { observed[ruleType]++ },
+		SampleRate: 1,
+	})
+	eval.EvaluateGroup(group, ctx)
+	if observed[ipRule.Type()] != 1 || observed[uaRule.Type()] != 1 {
+		t.Errorf("expected each rule type timed once, got %v", observed)
+	}
+
+	// A small sample rate times only some evaluations
+	var timed int
+	eval = NewEvaluatorWithOptions(EvaluatorOptions{
+		Observe:    func(string, time.Duration) { timed++ },
+		SampleRate: 0.01,
+	})
+	for i := 0; i < 1000; i++ {
+		eval.EvaluateGroup(&Group{Single: ipRule}, ctx)
+	}
+	if timed == 0 || timed > 100 {
+		t.Errorf("expected about 10 of 1000 evaluations timed, got %d", timed)
+	}
+}
+
+func TestEvaluatorEvaluatedCount(t *testing.T) {
+	ipRule, _ := NewIPRule([]string{"10.0.0.0/8"}, "allow")
+	uaRule, _ := NewUARule([]string{".*Chrome.*"}, "whitelist")
+	eval := NewEvaluator()
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("User-Agent", "Chrome/91.0")
+
+	// AND short-circuits on the first failing rule
+	result := eval.EvaluateGroup(&Group{And: []Rule{ipRule, uaRule}}, &Context{ClientIP: "8.8.8.8", Request: req})
+	if result.Evaluated != 1 {
+		t.Errorf("expected 1 rule evaluated, got %d", result.Evaluated)
+	}
+
+	result = eval.EvaluateGroup(&Group{And: []Rule{ipRule, uaRule}}, &Context{ClientIP: "10.1.2.3", Request: req})
+	if result.Evaluated != 2 {
+		t.Errorf("expected 2 rules evaluated, got %d", result.Evaluated)
+	}
+
+	// OR short-circuits on the first matching rule
+	result = eval.EvaluateGroup(&Group{Or: []Rule{ipRule, uaRule}}, &Context{ClientIP: "10.1.2.3", Request: req})
+	if result.Evaluated != 1 {
+		t.Errorf("expected 1 rule evaluated, got %d", result.Evaluated)
+	}
+}
+
+func TestGroupOptimizeOrder(t *testing.T) {
+	geoRule, _ := NewGeoRule([]string{"US"}, "allow")
+	uaRule, _ := NewUARule([]string{".*Chrome.*"}, "whitelist")
+	ipRule, _ := NewIPRule([]string{"10.0.0.0/8"}, "allow")
+	methodRule, _ := NewMethodRule([]string{"GET"}, "allow")
+
+	group := &Group{And: []Rule{geoRule, uaRule, ipRule, methodRule}}
+	group.OptimizeOrder()
+
+	want := []string{"ip_allow", "method_allow", "ua_whitelist", "geo_allow"}
+	for i, r := range group.And {
+		if r.Type() != want[i] {
+			t.Errorf("position %d: expected %s, got %s", i, want[i], r.Type())
+		}
+	}
+
+	// nil group is a no-op
+	var nilGroup *Group
+	nilGroup.OptimizeOrder()
+}
+
 func TestEvaluatorOR(t *testing.T) {
 	ipRule, _ := NewIPRule([]string{"10.0.0.0/8"}, "allow")
 	uaRule, _ := NewUARule([]string{".*Chrome.*"}, "whitelist")
@@ -218,6 +337,25 @@ func TestTLSVersionRuleEmptyVersion(t *testing.T) {
 	}
 }
 
+func TestRequireTLSRule(t *testing.T) {
+	rule := NewRequireTLSRule()
+
+	result := rule.Evaluate(&Context{})
+	if !result.Matched {
+		t.Error("expected plaintext request to match")
+	}
+	if len(result.Labels) != 1 || result.Labels[0] != "plaintext" {
+		t.Errorf("expected plaintext label, got %v", result.Labels)
+	}
+
+	if rule.Evaluate(&Context{TLSVersion: tls.VersionTLS12}).Matched {
+		t.Error("expected TLS request not to match")
+	}
+	if rule.Type() != "require_tls" {
+		t.Errorf("expected type 'require_tls', got %q", rule.Type())
+	}
+}
+
 // SNI Rule Tests
 
 func TestSNIRuleAllow(t *testing.T) {
@@ -285,6 +423,49 @@ func TestSNIRuleInvalidPattern(t *testing.T) {
 	}
 }
 
+// ALPN Rule Tests
+
+func TestALPNRule(t *testing.T) {
+	rule, err := NewALPNRule([]string{"h2", "none"}, "allow")
+	if err != nil {
+		t.Fatalf("failed to create ALPN rule: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		ctx     *Context
+		matched bool
+	}{
+		{"h2", &Context{TLSVersion: tls.VersionTLS13, ALPN: "h2"}, true},
+		{"http/1.1", &Context{TLSVersion: tls.VersionTLS13, ALPN: "http/1.1"}, false},
+		{"no protocol negotiated", &Context{TLSVersion: tls.VersionTLS12}, true},
+		{"plain HTTP", &Context{}, false},
+	}
+
+	for _, tc := range tests {
+		result := rule.Evaluate(tc.ctx)
+		if result.Matched != tc.matched {
+			t.Errorf("%s: expected matched=%v, got %v", tc.name, tc.matched, result.Matched)
+		}
+	}
+
+	if rule.Type() != "alpn_allow" {
+		t.Errorf("expected type 'alpn_allow', got %q", rule.Type())
+	}
+}
+
+func TestALPNRuleInvalid(t *testing.T) {
+	if _, err := NewALPNRule([]string{"h2"}, "invalid"); err == nil {
+		t.Error("expected error for invalid mode")
+	}
+	if _, err := NewALPNRule(nil, "deny"); err == nil {
+		t.Error("expected error for empty protocol list")
+	}
+	if _, err := NewALPNRule([]string{""}, "deny"); err == nil {
+		t.Error("expected error for empty protocol")
+	}
+}
+
 // GeoIP Rule Tests (without actual database)
 
 func TestGeoRuleCreation(t *testing.T) {
@@ -315,6 +496,74 @@ func TestGeoRuleNoDatabase(t *testing.T) {
 	}
 }
 
+func TestGeoRuleFailMode(t *testing.T) {
+	tests := []struct {
+		mode     string
+		failMode string
+		matched  bool
+	}{
+		{"allow", GeoIPFailOpen, true},
+		{"deny", GeoIPFailOpen, false},
+		{"allow", GeoIPFailClosed, false},
+		{"deny", GeoIPFailClosed, true},
+	}
+
+	for _, tc := range tests {
+		geo, err := NewGeoRuleWithFailMode([]string{"US"}, tc.mode, tc.failMode)
+		if err != nil {
+			t.Fatalf("failed to create geo rule: %v", err)
+		}
+		asn, err := NewASNRuleWithFailMode([]uint{15169}, tc.mode, tc.failMode)
+		if err != nil {
+			t.Fatalf("failed to create asn rule: %v", err)
+		}
+
+		for _, rule := range []Rule{geo, asn} {
+			result := rule.Evaluate(&Context{ClientIP: "8.8.8.8"})
+			if result.Matched != tc.matched {
+				t.Errorf("%s failing %s: expected matched=%v, got %v", rule.Type(), tc.failMode, tc.matched, result.Matched)
+			}
+		}
+	}
+
+	if _, err := NewGeoRuleWithFailMode([]string{"US"}, "allow", "sometimes"); err == nil {
+		t.Error("expected error for invalid fail mode")
+	}
+}
+
+func TestGeoRuleCountryOverride(t *testing.T) {
+	rule, _ := NewGeoRule([]string{"US"}, "allow")
+	if result := rule.Evaluate(&Context{ClientIP: "8.8.8.8", Country: "us"}); !result.Matched {
+		t.Errorf("expected country override to match without a database: %s", result.Reason)
+	}
+	if rule.Evaluate(&Context{ClientIP: "8.8.8.8", Country: "DE"}).Matched {
+		t.Error("expected other country not to match")
+	}
+}
+
+func TestRateLimitDryRun(t *testing.T) {
+	rule := NewRateLimitRule(1, time.Minute)
+	defer rule.Stop()
+
+	dry := &Context{ClientIP: "192.0.2.1", DryRun: true}
+	for i := 0; i < 3; i++ {
+		if !rule.Evaluate(dry).Matched {
+			t.Fatal("expected dry run not to use up the limit")
+		}
+	}
+	if len(rule.GetStats()) != 0 {
+		t.Errorf("expected dry run to record nothing, got %v", rule.GetStats())
+	}
+
+	rule.Evaluate(&Context{ClientIP: "192.0.2.1"})
+	if result := rule.Evaluate(dry); result.Matched {
+		t.Errorf("expected dry run to report the exceeded limit: %s", result.Reason)
+	}
+	if got := rule.GetStats()["192.0.2.1"]; got != 1 {
+		t.Errorf("expected 1 recorded request, got %d", got)
+	}
+}
+
 func TestASNRuleCreation(t *testing.T) {
 	rule, err := NewASNRule([]uint{15169, 32934}, "deny")
 	if err != nil {
@@ -448,6 +697,34 @@ func TestRateLimitGetStats(t *testing.T) {
 	}
 }
 
+func TestRateLimitConcurrentClients(t *testing.T) {
+	rule := NewRateLimitRule(1000, time.Minute)
+	defer rule.Stop()
+
+	const clients, requests = 64, 50
+	var wg sync.WaitGroup
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func(ip string) {
+			defer wg.Done()
+			for j := 0; j < requests; j++ {
+				rule.Evaluate(&Context{ClientIP: ip})
+			}
+		}(fmt.Sprintf("10.0.%d.%d", i/8, i%8))
+	}
+	wg.Wait()
+
+	stats := rule.GetStats()
+	if len(stats) != clients {
+		t.Fatalf("expected %d buckets across shards, got %d", clients, len(stats))
+	}
+	for ip, count := range stats {
+		if count != requests {
+			t.Errorf("expected %d requests for %s, got %d", requests, ip, count)
+		}
+	}
+}
+
 func TestRateLimitRuleStop(t *testing.T) {
 	rule := NewRateLimitRule(10, time.Minute)
 
@@ -463,6 +740,61 @@ func TestRateLimitRuleStop(t *testing.T) {
 	}
 }
 
+func TestRateLimitKeySource(t *testing.T) {
+	headerRule, err := NewRateLimitRuleWithKey(1, time.Minute, "header:X-API-Key")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer headerRule.Stop()
+
+	withKey := func(ip, key string) *Context {
+		req := httptest.NewRequest("GET", "/", nil)
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		return &Context{Request: req, ClientIP: ip}
+	}
+
+	// Same CDN IP, different keys: separate buckets
+	if !headerRule.Evaluate(withKey("203.0.113.1", "alpha")).Matched {
+		t.Error("expected first request for alpha to pass")
+	}
+	if !headerRule.Evaluate(withKey("203.0.113.1", "beta")).Matched {
+		t.Error("expected first request for beta to pass")
+	}
+	// Same key from another IP shares the bucket
+	if headerRule.Evaluate(withKey("203.0.113.2", "alpha")).Matched {
+		t.Error("expected second request for alpha to be limited")
+	}
+	// Missing key falls back to the client IP
+	if !headerRule.Evaluate(withKey("203.0.113.1", "")).Matched {
+		t.Error("expected keyless request to use its own IP bucket")
+	}
+	// A key equal to an IP does not share that IP's bucket
+	if !headerRule.Evaluate(withKey("198.51.100.1", "203.0.113.1")).Matched {
+		t.Error("expected key values not to collide with IP buckets")
+	}
+
+	cookieRule, err := NewRateLimitRuleWithKey(1, time.Minute, "cookie:session")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer cookieRule.Stop()
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(&http.Cookie{Name: "session", Value: "s1"})
+	cookieRule.Evaluate(&Context{Request: req, ClientIP: "10.0.0.1"})
+	if cookieRule.GetStats()["cookie:s1"] != 1 {
+		t.Errorf("expected cookie bucket, got %v", cookieRule.GetStats())
+	}
+
+	for _, bad := range []string{"header:", "cookie: ", "query:token", "ua"} {
+		if _, err := NewRateLimitRuleWithKey(1, time.Minute, bad); err == nil {
+			t.Errorf("expected error for key source %q", bad)
+		}
+	}
+}
+
 // Evaluator Tests
 
 func TestEvaluatorNOT(t *testing.T) {
@@ -0,0 +1,200 @@
+package rules
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Scanner score defaults
+const (
+	DefaultScannerMaxErrors = 20
+	DefaultScannerWindow    = time.Minute
+)
+
+// ScannerScoreRule detects clients probing for content, such as directory
+// brute-forcing, by counting the error responses each client IP receives.
+// It matches once an IP has received more than maxErrors counted responses
+// within a window, so it belongs in deny rules.
+//
+// The rule learns about responses after the fact through ObserveResponse,
+// which the gateway calls once a forwarded request completes; a client is
+// scored on the responses to its earlier requests.
+type ScannerScoreRule struct {
+	maxErrors int
+	window    time.Duration
+	statuses  []statusMatcher
+	counters  map[string]*rateLimitCounter
+	mu        sync.Mutex
+	now       func() time.Time
+	stopChan  chan struct{}
+	stopped   bool
+}
+
+// statusMatcher matches a single status code, or a class when code is 0
+type statusMatcher struct {
+	code  int
+	class int
+}
+
+func (m statusMatcher) matches(status int) bool {
+	if m.code != 0 {
+		return status == m.code
+	}
+	return status/100 == m.class
+}
+
+// parseScannerStatuses parses status codes ("404") and classes ("4xx").
+// An empty list means "4xx".
+func parseScannerStatuses(statuses []string) ([]statusMatcher, error) {
+	if len(statuses) == 0 {
+		statuses = []string{"4xx"}
+	}
+	matchers := make([]statusMatcher, 0, len(statuses))
+	for _, s := range statuses {
+		s = strings.ToLower(strings.TrimSpace(s))
+		if len(s) == 3 && strings.HasSuffix(s, "xx") && s[0] >= '1' && s[0] <= '5' {
+			matchers = append(matchers, statusMatcher{class: int(s[0] - '0')})
+			continue
+		}
+		code, err := strconv.Atoi(s)
+		if err != nil || code < 100 || code > 599 {
+			return nil, fmt.Errorf("invalid status %q (expected a code such as 404 or a class such as 4xx)", s)
+		}
+		matchers = append(matchers, statusMatcher{code: code})
+	}
+	return matchers, nil
+}
+
+// NewScannerScoreRule creates a scanner detection rule. Responses whose
+// status matches statuses (default "4xx") count towards the client's score;
+// maxErrors and window default to DefaultScannerMaxErrors and
+// DefaultScannerWindow.
+func NewScannerScoreRule(maxErrors int, window time.Duration, statuses []string) (*ScannerScoreRule, error) {
+	matchers, err := parseScannerStatuses(statuses)
+	if err != nil {
+		return nil, err
+	}
+	if maxErrors <= 0 {
+		maxErrors = DefaultScannerMaxErrors
+	}
+	if window <= 0 {
+		window = DefaultScannerWindow
+	}
+
+	r := &ScannerScoreRule{
+		maxErrors: maxErrors,
+		window:    window,
+		statuses:  matchers,
+		counters:  make(map[string]*rateLimitCounter),
+		now:       time.Now,
+		stopChan:  make(chan struct{}),
+	}
+
+	// Start cleanup goroutine
+	go r.cleanup()
+
+	return r, nil
+}
+
+// ObserveResponse records the status of a response sent to clientIP
+func (r *ScannerScoreRule) ObserveResponse(clientIP string, status int) {
+	if clientIP == "" || !r.counts(status) {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	counter, exists := r.counters[clientIP]
+	if !exists || now.After(counter.windowEnd) {
+		r.counters[clientIP] = &rateLimitCounter{count: 1, windowEnd: now.Add(r.window)}
+		return
+	}
+	counter.count++
+}
+
+func (r *ScannerScoreRule) counts(status int) bool {
+	for _, m := range r.statuses {
+		if m.matches(status) {
+			return true
+		}
+	}
+	return false
+}
+
+// Evaluate matches clients whose error count in the current window exceeds
+// the threshold
+func (r *ScannerScoreRule) Evaluate(ctx *Context) Result {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	count := 0
+	if counter, ok := r.counters[ctx.ClientIP]; ok && !r.now().After(counter.windowEnd) {
+		count = counter.count
+	}
+
+	if count > r.maxErrors {
+		return Result{
+			Matched: true,
+			Reason:  fmt.Sprintf("scanner score exceeded: %d/%d error responses in window", count, r.maxErrors),
+			Labels:  []string{"scanner"},
+		}
+	}
+	return Result{
+		Matched: false,
+		Reason:  fmt.Sprintf("scanner score: %d/%d error responses", count, r.maxErrors),
+	}
+}
+
+// Stop stops the background cleanup goroutine
+func (r *ScannerScoreRule) Stop() {
+	r.mu.Lock()
+	if !r.stopped {
+		r.stopped = true
+		close(r.stopChan)
+	}
+	r.mu.Unlock()
+}
+
+// cleanup periodically removes expired entries
+func (r *ScannerScoreRule) cleanup() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.stopChan:
+			return
+		case <-ticker.C:
+			r.mu.Lock()
+			now := r.now()
+			for key, counter := range r.counters {
+				if now.After(counter.windowEnd) {
+					delete(r.counters, key)
+				}
+			}
+			r.mu.Unlock()
+		}
+	}
+}
+
+// Type returns the rule type
+func (r *ScannerScoreRule) Type() string {
+	return "scanner_score"
+}
+
+// GetStats returns current error counts by client IP
+func (r *ScannerScoreRule) GetStats() map[string]int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stats := make(map[string]int)
+	for key, counter := range r.counters {
+		stats[key] = counter.count
+	}
+	return stats
+}
@@ -0,0 +1,74 @@
+package rules
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestScannerScoreRule(t *testing.T) {
+	rule, err := NewScannerScoreRule(3, time.Minute, nil)
+	if err != nil {
+		t.Fatalf("failed to create rule: %v", err)
+	}
+	defer rule.Stop()
+
+	now := time.Unix(1700000000, 0)
+	rule.now = func() time.Time { return now }
+
+	ctx := &Context{ClientIP: "192.0.2.1"}
+	for i := 0; i < 3; i++ {
+		rule.ObserveResponse("192.0.2.1", http.StatusNotFound)
+	}
+	// Successful and server error responses are not counted by default
+	rule.ObserveResponse("192.0.2.1", http.StatusOK)
+	rule.ObserveResponse("192.0.2.1", http.StatusBadGateway)
+	if rule.Evaluate(ctx).Matched {
+		t.Error("expected no match at the threshold")
+	}
+
+	rule.ObserveResponse("192.0.2.1", http.StatusForbidden)
+	result := rule.Evaluate(ctx)
+	if !result.Matched {
+		t.Fatalf("expected match over the threshold: %s", result.Reason)
+	}
+	if len(result.Labels) != 1 || result.Labels[0] != "scanner" {
+		t.Errorf("expected scanner label, got %v", result.Labels)
+	}
+
+	// Other clients are scored separately
+	if rule.Evaluate(&Context{ClientIP: "192.0.2.2"}).Matched {
+		t.Error("expected other client not to match")
+	}
+
+	// The score resets when the window ends
+	now = now.Add(2 * time.Minute)
+	if rule.Evaluate(ctx).Matched {
+		t.Error("expected no match after the window")
+	}
+	rule.ObserveResponse("192.0.2.1", http.StatusNotFound)
+	if got := rule.GetStats()["192.0.2.1"]; got != 1 {
+		t.Errorf("expected count to restart at 1, got %d", got)
+	}
+}
+
+func TestScannerScoreRuleStatuses(t *testing.T) {
+	rule, err := NewScannerScoreRule(1, time.Minute, []string{"404", "5XX"})
+	if err != nil {
+		t.Fatalf("failed to create rule: %v", err)
+	}
+	defer rule.Stop()
+
+	rule.ObserveResponse("192.0.2.1", http.StatusForbidden)
+	rule.ObserveResponse("192.0.2.1", http.StatusNotFound)
+	rule.ObserveResponse("192.0.2.1", http.StatusServiceUnavailable)
+	if got := rule.GetStats()["192.0.2.1"]; got != 2 {
+		t.Errorf("expected 2 counted responses, got %d", got)
+	}
+
+	for _, bad := range []string{"4x", "600", "abc", "0xx"} {
+		if _, err := NewScannerScoreRule(1, time.Minute, []string{bad}); err == nil {
+			t.Errorf("expected error for status %q", bad)
+		}
+	}
+}
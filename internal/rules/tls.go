@@ -14,12 +14,12 @@ type TLSVersionRule struct {
 
 // NewTLSVersionRule creates a new TLS version rule
 func NewTLSVersionRule(minVersion, maxVersion string) (*TLSVersionRule, error) {
-	min, err := parseTLSVersion(minVersion)
+	min, err := ParseTLSVersion(minVersion)
 	if err != nil {
 		return nil, fmt.Errorf("invalid min version: %w", err)
 	}
 
-	max, err := parseTLSVersion(maxVersion)
+	max, err := ParseTLSVersion(maxVersion)
 	if err != nil {
 		return nil, fmt.Errorf("invalid max version: %w", err)
 	}
@@ -30,7 +30,8 @@ func NewTLSVersionRule(minVersion, maxVersion string) (*TLSVersionRule, error) {
 	}, nil
 }
 
-func parseTLSVersion(v string) (uint16, error) {
+// ParseTLSVersion parses a TLS version such as "1.2" ("" means unset)
+func ParseTLSVersion(v string) (uint16, error) {
 	switch v {
 	case "1.0", "TLS1.0":
 		return tls.VersionTLS10, nil
@@ -91,11 +92,41 @@ func (r *TLSVersionRule) Type() string {
 	return "tls_version"
 }
 
+// RequireTLSRule matches requests that arrived over plain HTTP. Used as a
+// deny rule, it keeps sensitive paths HTTPS-only on profiles that listen
+// for both.
+type RequireTLSRule struct{}
+
+// NewRequireTLSRule creates a new plaintext detection rule
+func NewRequireTLSRule() *RequireTLSRule {
+	return &RequireTLSRule{}
+}
+
+// Evaluate matches when the request was not received over TLS
+func (r *RequireTLSRule) Evaluate(ctx *Context) Result {
+	if ctx.TLSVersion != 0 {
+		return Result{
+			Matched: false,
+			Reason:  fmt.Sprintf("TLS connection (%s)", tlsVersionString(ctx.TLSVersion)),
+		}
+	}
+	return Result{
+		Matched: true,
+		Reason:  "plaintext HTTP, TLS required",
+		Labels:  []string{"plaintext"},
+	}
+}
+
+// Type returns the rule type
+func (r *RequireTLSRule) Type() string {
+	return "require_tls"
+}
+
 // SNIRule matches requests based on Server Name Indication
 type SNIRule struct {
-	patterns     []*regexp.Regexp
-	requireSNI   bool
-	mode         string // "allow" or "deny"
+	patterns   []*regexp.Regexp
+	requireSNI bool
+	mode       string // "allow" or "deny"
 }
 
 // NewSNIRule creates a new SNI-based rule
@@ -156,3 +187,60 @@ func (r *SNIRule) Evaluate(ctx *Context) Result {
 func (r *SNIRule) Type() string {
 	return "sni_" + r.mode
 }
+
+// ALPNRule matches requests based on the application protocol negotiated
+// during the TLS handshake (ALPN), such as "h2" or "http/1.1"
+type ALPNRule struct {
+	protocols map[string]bool
+	mode      string // "allow" or "deny"
+}
+
+// NewALPNRule creates a new ALPN rule. Protocols are matched exactly; "none"
+// matches TLS connections where no protocol was negotiated.
+func NewALPNRule(protocols []string, mode string) (*ALPNRule, error) {
+	if mode != "allow" && mode != "deny" {
+		return nil, fmt.Errorf("invalid mode: %s", mode)
+	}
+	if len(protocols) == 0 {
+		return nil, fmt.Errorf("at least one protocol is required")
+	}
+
+	protocolMap := make(map[string]bool, len(protocols))
+	for _, p := range protocols {
+		if p == "" {
+			return nil, fmt.Errorf("empty protocol")
+		}
+		protocolMap[p] = true
+	}
+
+	return &ALPNRule{
+		protocols: protocolMap,
+		mode:      mode,
+	}, nil
+}
+
+// Evaluate checks if the negotiated protocol is in the list
+func (r *ALPNRule) Evaluate(ctx *Context) Result {
+	if ctx.TLSVersion == 0 {
+		return Result{
+			Matched: false,
+			Reason:  "no TLS connection",
+		}
+	}
+
+	alpn := ctx.ALPN
+	if alpn == "" {
+		alpn = "none"
+	}
+
+	return Result{
+		Matched: r.protocols[alpn],
+		Reason:  fmt.Sprintf("ALPN %s, %s list", alpn, r.mode),
+		Labels:  []string{"alpn-" + r.mode, alpn},
+	}
+}
+
+// Type returns the rule type
+func (r *ALPNRule) Type() string {
+	return "alpn_" + r.mode
+}
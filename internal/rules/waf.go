@@ -0,0 +1,221 @@
+package rules
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// DefaultWAFMaxInput is the number of bytes of each inspected value that
+// WAF checks look at. Longer values are truncated, which bounds the cost of
+// a request with huge headers or query strings.
+const DefaultWAFMaxInput = 4096
+
+// WAF categories in the basic ruleset
+const (
+	WAFSQLi      = "sqli"
+	WAFXSS       = "xss"
+	WAFTraversal = "traversal"
+	WAFScanner   = "scanner"
+)
+
+// wafTarget is a part of the request a check inspects
+type wafTarget int
+
+const (
+	wafPath wafTarget = 1 << iota
+	wafQuery
+	wafHeaders
+	wafUserAgent
+)
+
+// wafCheck is one signature of a WAF ruleset
+type wafCheck struct {
+	category string
+	name     string
+	pattern  *regexp.Regexp
+	targets  wafTarget
+}
+
+// wafRequestParts is every target except the dedicated User-Agent check
+const wafRequestParts = wafPath | wafQuery | wafHeaders
+
+// wafBasic is a small starter set of signatures for common attacks. It is
+// deliberately conservative: each pattern needs an attack-specific token
+// sequence rather than a single suspicious character.
+var wafBasic = []wafCheck{
+	{WAFSQLi, "union select", regexp.MustCompile(`(?i)\bunion\b[\s(/*]+(all\b[\s(/*]+)?select\b`), wafRequestParts},
+	{WAFSQLi, "tautology", regexp.MustCompile(`(?i)['"]\s*\b(or|and)\b\s*['"]?\w+['"]?\s*(=|like\b)\s*['"]?\w+`), wafRequestParts},
+	{WAFSQLi, "time-based", regexp.MustCompile(`(?i)\b(sleep|benchmark|pg_sleep|waitfor\s+delay)\b\s*[('"]`), wafRequestParts},
+	{WAFSQLi, "stacked query", regexp.MustCompile(`(?i)[;'"]\s*\b(drop|delete|insert|update|alter|truncate|exec)\b\s+\w*\s*\b(table|from|into|database|set|xp_)`), wafRequestParts},
+	{WAFSQLi, "schema probe", regexp.MustCompile(`(?i)\b(information_schema|pg_catalog|sysobjects|mysql\.user)\b`), wafRequestParts},
+	{WAFXSS, "script tag", regexp.MustCompile(`(?i)<\s*/?\s*script\b`), wafRequestParts},
+	{WAFXSS, "javascript uri", regexp.MustCompile(`(?i)\b(javascript|vbscript)\s*:`), wafRequestParts},
+	{WAFXSS, "event handler", regexp.MustCompile(`(?i)<[^>]*\bon[a-z]{3,20}\s*=`), wafRequestParts},
+	{WAFXSS, "embedded content", regexp.MustCompile(`(?i)<\s*(iframe|object|embed|svg|math)\b`), wafRequestParts},
+	{WAFTraversal, "dot-dot-slash", regexp.MustCompile(`(^|[\\/=])\.\.([\\/]|$)`), wafRequestParts},
+	{WAFTraversal, "sensitive file", regexp.MustCompile(`(?i)(/etc/(passwd|shadow|hosts)\b|\b(boot|win)\.ini\b|/proc/self/)`), wafRequestParts},
+	{WAFTraversal, "null byte", regexp.MustCompile(`\x00`), wafPath | wafQuery},
+	{WAFScanner, "scanner user-agent", regexp.MustCompile(`(?i)\b(sqlmap|nikto|nmap|masscan|zgrab|nuclei|wpscan|dirbuster|gobuster|feroxbuster|acunetix|nessus|openvas|w3af|havij|fimap|netsparker|jaeles)\b`), wafUserAgent},
+}
+
+// wafRulesets maps ruleset names to their checks
+var wafRulesets = map[string][]wafCheck{
+	"basic": wafBasic,
+}
+
+// WAFCategories returns the categories available in a ruleset
+func WAFCategories(ruleset string) []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, c := range wafRulesets[ruleset] {
+		if !seen[c.category] {
+			seen[c.category] = true
+			out = append(out, c.category)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// WAFRule matches requests carrying common attack signatures in the path,
+// query string or headers. It matches when an attack is detected, so it
+// belongs in deny rules.
+type WAFRule struct {
+	checks   []wafCheck
+	maxInput int
+}
+
+// NewWAFRule creates a WAF rule from a named ruleset ("basic" if empty),
+// optionally limited to some of its categories
+func NewWAFRule(ruleset string, categories []string) (*WAFRule, error) {
+	if ruleset == "" {
+		ruleset = "basic"
+	}
+	checks, ok := wafRulesets[ruleset]
+	if !ok {
+		return nil, fmt.Errorf("unknown WAF ruleset: %s", ruleset)
+	}
+
+	if len(categories) > 0 {
+		known := WAFCategories(ruleset)
+		enabled := make(map[string]bool)
+		for _, c := range categories {
+			c = strings.ToLower(c)
+			if i := sort.SearchStrings(known, c); i == len(known) || known[i] != c {
+				return nil, fmt.Errorf("unknown WAF category %q in ruleset %s", c, ruleset)
+			}
+			enabled[c] = true
+		}
+		var selected []wafCheck
+		for _, c := range checks {
+			if enabled[c.category] {
+				selected = append(selected, c)
+			}
+		}
+		checks = selected
+	}
+
+	return &WAFRule{checks: checks, maxInput: DefaultWAFMaxInput}, nil
+}
+
+// Evaluate returns a match for the first signature found in the request
+func (r *WAFRule) Evaluate(ctx *Context) Result {
+	if ctx.Request == nil {
+		return Result{Matched: false, Reason: "no HTTP request"}
+	}
+	req := ctx.Request
+
+	path := r.decode(req.URL.EscapedPath())
+	query := r.decode(req.URL.RawQuery)
+	ua := r.truncate(req.UserAgent())
+
+	for _, c := range r.checks {
+		if c.targets&wafPath != 0 && c.pattern.MatchString(path) {
+			return r.match(c, "path")
+		}
+		if c.targets&wafQuery != 0 && query != "" && c.pattern.MatchString(query) {
+			return r.match(c, "query")
+		}
+		if c.targets&wafUserAgent != 0 && c.pattern.MatchString(ua) {
+			return r.match(c, "User-Agent")
+		}
+		if c.targets&wafHeaders != 0 {
+			for name, values := range req.Header {
+				for _, v := range values {
+					if c.pattern.MatchString(r.decode(v)) {
+						return r.match(c, name+" header")
+					}
+				}
+			}
+		}
+	}
+
+	return Result{Matched: false, Reason: "no WAF signature matched"}
+}
+
+func (r *WAFRule) match(c wafCheck, where string) Result {
+	return Result{
+		Matched: true,
+		Reason:  fmt.Sprintf("WAF %s signature %q in %s", c.category, c.name, where),
+		Labels:  []string{"waf", "waf-" + c.category},
+	}
+}
+
+// decode truncates s and percent-decodes it twice, catching double-encoded
+// payloads
+func (r *WAFRule) decode(s string) string {
+	s = r.truncate(s)
+	for i := 0; i < 2 && strings.ContainsAny(s, "%+"); i++ {
+		s = wafUnescape(s)
+	}
+	return s
+}
+
+// wafUnescape decodes %XX escapes and "+" as in query strings. Unlike
+// url.QueryUnescape it never fails: malformed escapes are kept as-is, so a
+// stray "%" cannot be used to stop the rest of a payload being decoded.
+func wafUnescape(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '%' && i+2 < len(s) && isHex(s[i+1]) && isHex(s[i+2]):
+			b.WriteByte(unhex(s[i+1])<<4 | unhex(s[i+2]))
+			i += 2
+		case c == '+':
+			b.WriteByte(' ')
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
+
+func (r *WAFRule) truncate(s string) string {
+	if len(s) > r.maxInput {
+		return s[:r.maxInput]
+	}
+	return s
+}
+
+// Type returns the rule type
+func (r *WAFRule) Type() string {
+	return "waf"
+}
@@ -0,0 +1,105 @@
+package rules
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWAFRule(t *testing.T) {
+	rule, err := NewWAFRule("basic", nil)
+	if err != nil {
+		t.Fatalf("failed to create rule: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		target   string
+		headers  map[string]string
+		category string // "" for no match
+	}{
+		{"plain request", "/api/users?id=42&sort=name", nil, ""},
+		{"search text", "/search?q=select+the+best+union+jobs", nil, ""},
+		{"apostrophe", "/search?q=o'reilly+and+sons", nil, ""},
+		{"relative dots in name", "/files/report..final.pdf", nil, ""},
+		{"union select", "/items?id=1+UNION+SELECT+username,password+FROM+users", nil, WAFSQLi},
+		{"union comment obfuscation", "/items?id=1/**/union/**/all/**/select/**/1", nil, WAFSQLi},
+		{"tautology", "/login?user=admin'+or+'1'='1", nil, WAFSQLi},
+		{"double encoded tautology", "/login?user=admin%2527%2520or%25201%253D1", nil, WAFSQLi},
+		{"stray percent", "/login?user=%zz%27%20or%201%3D1", nil, WAFSQLi},
+		{"time based", "/items?id=1;SELECT+pg_sleep(10)", nil, WAFSQLi},
+		{"schema probe", "/items?t=information_schema.tables", nil, WAFSQLi},
+		{"script tag", "/comment?text=%3Cscript%3Ealert(1)%3C/script%3E", nil, WAFXSS},
+		{"event handler", "/comment?text=<img+src=x+onerror=alert(1)>", nil, WAFXSS},
+		{"javascript uri", "/redirect?to=javascript:alert(1)", nil, WAFXSS},
+		{"traversal in query", "/download?file=../../etc/passwd", nil, WAFTraversal},
+		{"encoded traversal in path", "/static/%2e%2e%2f%2e%2e%2fetc/hosts", nil, WAFTraversal},
+		{"windows traversal", `/download?file=..\..\boot.ini`, nil, WAFTraversal},
+		{"null byte", "/download?file=report.pdf%00.php", nil, WAFTraversal},
+		{"xss in header", "/", map[string]string{"Referer": "https://example.com/<script>"}, WAFXSS},
+		{"sqli in cookie", "/", map[string]string{"Cookie": "id=1' OR 1=1"}, WAFSQLi},
+		{"scanner", "/", map[string]string{"User-Agent": "sqlmap/1.7.2#stable (https://sqlmap.org)"}, WAFScanner},
+		{"browser", "/", map[string]string{"User-Agent": "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://example.com/", nil)
+			path, query, _ := strings.Cut(tt.target, "?")
+			req.URL.RawPath = path
+			req.URL.Path = wafUnescape(path)
+			req.URL.RawQuery = query
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+
+			result := rule.Evaluate(&Context{Request: req})
+			if tt.category == "" {
+				if result.Matched {
+					t.Errorf("expected no match, got %s", result.Reason)
+				}
+				return
+			}
+			if !result.Matched {
+				t.Fatalf("expected %s match, got: %s", tt.category, result.Reason)
+			}
+			if len(result.Labels) != 2 || result.Labels[1] != "waf-"+tt.category {
+				t.Errorf("expected label waf-%s, got %v (%s)", tt.category, result.Labels, result.Reason)
+			}
+		})
+	}
+}
+
+func TestWAFRuleCategories(t *testing.T) {
+	rule, err := NewWAFRule("", []string{"SQLi", "scanner"})
+	if err != nil {
+		t.Fatalf("failed to create rule: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/comment?text=%3Cscript%3E", nil)
+	if rule.Evaluate(&Context{Request: req}).Matched {
+		t.Error("xss should not be checked when not enabled")
+	}
+	req = httptest.NewRequest("GET", "/items?id=1%20union%20select%201", nil)
+	if !rule.Evaluate(&Context{Request: req}).Matched {
+		t.Error("expected sqli to be checked")
+	}
+
+	if _, err := NewWAFRule("strict", nil); err == nil {
+		t.Error("expected error for unknown ruleset")
+	}
+	if _, err := NewWAFRule("basic", []string{"rce"}); err == nil {
+		t.Error("expected error for unknown category")
+	}
+}
+
+func TestWAFRuleTruncatesInput(t *testing.T) {
+	rule, _ := NewWAFRule("basic", nil)
+
+	// A payload beyond the inspection cap is not seen
+	padding := strings.Repeat("a", DefaultWAFMaxInput)
+	req := httptest.NewRequest("GET", "/?pad="+padding+"%3Cscript%3E", nil)
+	if rule.Evaluate(&Context{Request: req}).Matched {
+		t.Error("expected input beyond the cap to be ignored")
+	}
+}